@@ -62,6 +62,7 @@ func (a *App) Manager() *sandbox.Manager {
 		}
 		os.Exit(1)
 	}
+	mgr.SetAuthorizer(a.authorizeWithCode)
 	return mgr
 }
 
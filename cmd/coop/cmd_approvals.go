@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+	"golang.org/x/term"
+)
+
+func (a *App) ApprovalsCmd(args []string) {
+	if len(args) == 0 {
+		printApprovalsUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		a.approvalsListCmd(args[1:])
+	case "approve":
+		a.approvalsApproveCmd(args[1:])
+	case "deny":
+		a.approvalsDenyCmd(args[1:])
+	case "serve":
+		a.approvalsServeCmd()
+	default:
+		ui.Errorf("Unknown approvals subcommand: %s", args[0])
+		printApprovalsUsage()
+		os.Exit(1)
+	}
+}
+
+func (a *App) approvalsListCmd(args []string) {
+	fs := flag.NewFlagSet("approvals list", flag.ExitOnError)
+	all := fs.Bool("all", false, "Include decided requests")
+	fs.Usage = printApprovalsUsage
+	positional := parseInterleaved(fs, args)
+
+	if len(positional) > 1 {
+		printApprovalsUsage()
+		os.Exit(1)
+	}
+	container := ""
+	if len(positional) == 1 {
+		container = a.ValidContainerName(positional[0])
+	}
+
+	approvals, err := sandbox.ListApprovals()
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	table := ui.NewTable(8, 14, 10, 16, 40, 30)
+	table.SetHeaders("ID", "CONTAINER", "STATUS", "REQUESTED", "REQUEST", "REASON")
+	shown := 0
+	for _, req := range approvals {
+		if container != "" && req.Container != container {
+			continue
+		}
+		if !*all && req.Status != sandbox.ApprovalPending {
+			continue
+		}
+		table.AddRow(
+			ui.Name(req.ID),
+			req.Container,
+			approvalStatusText(req),
+			req.Requested.Local().Format("2006-01-02 15:04"),
+			req.Summary,
+			req.Reason,
+		)
+		shown++
+	}
+
+	if shown == 0 {
+		if *all {
+			ui.Muted("No requests")
+		} else {
+			ui.Muted("No pending requests")
+		}
+		return
+	}
+	fmt.Print(table.Render())
+}
+
+func approvalStatusText(req sandbox.Approval) string {
+	switch req.Status {
+	case sandbox.ApprovalPending:
+		return ui.WarningText("pending")
+	case sandbox.ApprovalApproved:
+		return ui.SuccessText("approved")
+	case sandbox.ApprovalDenied:
+		return ui.MutedText("denied")
+	}
+	return ui.ErrorText(string(req.Status))
+}
+
+func (a *App) approvalsApproveCmd(args []string) {
+	fs := flag.NewFlagSet("approvals approve", flag.ExitOnError)
+	force := fs.Bool("force", false, "Authorize a protected path or port")
+	fromEnv := fs.String("from-env", "", "Take a secret's value from this environment variable")
+	fs.Usage = printApprovalsUsage
+	positional := parseInterleaved(fs, args)
+
+	if len(positional) != 1 {
+		ui.Error("request id required")
+		ui.Muted("Usage: coop approvals approve [--force] [--from-env VAR] <id>")
+		os.Exit(1)
+	}
+	id := positional[0]
+
+	req, err := sandbox.LoadApproval(id)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	if req.Status != sandbox.ApprovalPending {
+		ui.Errorf("Request %s is already %s", id, req.Status)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s requests %s\n", ui.Name(req.Container), req.Summary)
+	if req.Reason != "" {
+		ui.Mutedf("Reason: %s", req.Reason)
+	}
+
+	var secret string
+	if req.Kind == sandbox.ApprovalSecret {
+		secret = readApprovalSecret(req.Args["name"], *fromEnv)
+	}
+
+	auth, err := a.checkAuthCode(fmt.Sprintf("%s requests %s", req.Container, req.Summary))
+	if err != nil {
+		ui.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	mgr := a.Manager()
+	if *force {
+		// The approval code already covers overriding the seatbelt
+		mgr.SetAuthorizer(func(sandbox.HostAccess, sandbox.SeatbeltDecision) (string, error) {
+			return auth, nil
+		})
+	}
+	req, err = mgr.ApproveRequest(id, auth, secret, *force)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	ui.Successf("Approved %s: %s", req.ID, req.Result)
+}
+
+// readApprovalSecret takes a secret's value from the environment or, so
+// it stays out of shell history, from the terminal without echo.
+func readApprovalSecret(name, fromEnv string) string {
+	if fromEnv != "" {
+		value := os.Getenv(fromEnv)
+		if value == "" {
+			ui.Errorf("%s is not set", fromEnv)
+			os.Exit(1)
+		}
+		return value
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		ui.Error("a secret needs a terminal to type it in, or --from-env")
+		os.Exit(1)
+	}
+	fmt.Printf("Value for %s: ", name)
+	value, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil || len(value) == 0 {
+		ui.Error("no value entered")
+		os.Exit(1)
+	}
+	return string(value)
+}
+
+func (a *App) approvalsDenyCmd(args []string) {
+	fs := flag.NewFlagSet("approvals deny", flag.ExitOnError)
+	reason := fs.String("reason", "", "Tell the agent why")
+	fs.Usage = printApprovalsUsage
+	positional := parseInterleaved(fs, args)
+
+	if len(positional) != 1 {
+		ui.Error("request id required")
+		ui.Muted("Usage: coop approvals deny [--reason TEXT] <id>")
+		os.Exit(1)
+	}
+
+	req, err := sandbox.DenyApproval(positional[0], *reason)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	ui.Successf("Denied %s: %s for %s", req.ID, req.Summary, ui.Name(req.Container))
+}
+
+func (a *App) approvalsServeCmd() {
+	mgr := a.Manager()
+	listener, err := mgr.RequestListener()
+	if err != nil {
+		ui.Errorf("Cannot listen for agent requests: %v", err)
+		os.Exit(1)
+	}
+
+	srv := &http.Server{
+		Handler: mgr.RequestHandler(func(req *sandbox.Approval) {
+			fmt.Printf("%s %s requests %s\n", ui.Name(req.ID), ui.Name(req.Container), req.Summary)
+			if req.Reason != "" {
+				ui.Mutedf("  %s", req.Reason)
+			}
+			ui.Notify("coop", "Request from "+req.Container, req.Summary)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	ui.Successf("Listening for agent requests on %s", listener.Addr())
+	ui.Muted("Approve them with 'coop approvals approve <id>'. Press Ctrl-C to stop")
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+}
+
+func printApprovalsUsage() {
+	fmt.Println("Usage: coop approvals <subcommand>")
+	fmt.Println("\nSubcommands:")
+	fmt.Println("  list, ls [container]   List pending requests (--all for decided ones too)")
+	fmt.Println("  approve <id>           Grant a request (needs an authorization code)")
+	fmt.Println("  deny <id>              Refuse a request (--reason to tell the agent why)")
+	fmt.Println("  serve                  Accept requests from containers until Ctrl-C")
+	fmt.Println("\nApprove options:")
+	fmt.Println("  --force                Also authorize a protected path or port")
+	fmt.Println("  --from-env VAR         Take a secret's value from VAR instead of prompting")
+	fmt.Println("\nAgents run coop-request inside their container to ask for a host mount,")
+	fmt.Println("a host port or a secret:")
+	fmt.Println()
+	fmt.Println("  coop-request --reason 'need the fixtures' mount '~/data/fixtures'")
+	fmt.Println("  coop-request expose 5432")
+	fmt.Println("  coop-request secret GITHUB_TOKEN")
+	fmt.Println()
+	fmt.Println("Requests arrive while 'coop approvals serve' runs and wait for a decision.")
+	fmt.Println("Secrets are written to " + sandbox.SecretsDir + "/<NAME>, which is cleared when the")
+	fmt.Println("container stops. Every request and decision is recorded in the audit log.")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/audit"
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) AuditCmd(args []string) {
+	if len(args) == 0 {
+		printAuditUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "log":
+		a.auditLogCmd(args[1:])
+	case "verify":
+		a.auditVerifyCmd()
+	default:
+		ui.Errorf("Unknown audit subcommand: %s", args[0])
+		printAuditUsage()
+		os.Exit(1)
+	}
+}
+
+func (a *App) auditLogCmd(args []string) {
+	fs := flag.NewFlagSet("audit log", flag.ExitOnError)
+	op := fs.String("op", "", "Only entries for this operation (e.g. exec, mount)")
+	since := fs.Duration("since", 0, "Only entries newer than this (e.g. 24h)")
+	limit := fs.Int("n", 50, "Show at most this many of the latest entries (0 for all)")
+	asJSON := fs.Bool("json", false, "Print entries as JSON lines")
+	fs.Usage = printAuditUsage
+	positional := parseInterleaved(fs, args)
+
+	if len(positional) > 1 {
+		printAuditUsage()
+		os.Exit(1)
+	}
+	container := ""
+	if len(positional) == 1 {
+		container = a.ValidContainerName(positional[0])
+	}
+
+	log := sandbox.AuditLog()
+	entries, err := log.Entries()
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	var shown []audit.Entry
+	for _, e := range entries {
+		if container != "" && e.Container != container {
+			continue
+		}
+		if *op != "" && e.Op != *op && !strings.HasPrefix(e.Op, *op+".") {
+			continue
+		}
+		if *since > 0 && e.Time.Before(time.Now().Add(-*since)) {
+			continue
+		}
+		shown = append(shown, e)
+	}
+	if *limit > 0 && len(shown) > *limit {
+		shown = shown[len(shown)-*limit:]
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range shown {
+			_ = enc.Encode(e)
+		}
+		return
+	}
+
+	if len(shown) == 0 {
+		ui.Muted("No audit entries")
+		ui.Mutedf("Log: %s", log.Path())
+		return
+	}
+
+	table := ui.NewTable(6, 19, 10, 18, 14, 8, 6, 40)
+	table.SetHeaders("SEQ", "TIME", "ACTOR", "OP", "CONTAINER", "OUTCOME", "AUTH", "DETAILS")
+	for _, e := range shown {
+		outcome := string(e.Outcome)
+		switch e.Outcome {
+		case audit.OutcomeOK:
+			outcome = ui.SuccessText(outcome)
+		default:
+			outcome = ui.ErrorText(outcome)
+		}
+		details := formatAuditArgs(e.Args)
+		if e.Error != "" {
+			details = strings.TrimSpace(details + " error=" + e.Error)
+		}
+		table.AddRow(
+			fmt.Sprint(e.Seq),
+			e.Time.Local().Format(time.DateTime),
+			e.Actor,
+			e.Op,
+			e.Container,
+			outcome,
+			e.Auth,
+			details,
+		)
+	}
+	fmt.Print(table.Render())
+}
+
+func (a *App) auditVerifyCmd() {
+	log := sandbox.AuditLog()
+	n, err := log.Verify()
+
+	var chainErr *audit.ChainError
+	switch {
+	case errors.As(err, &chainErr):
+		ui.Errorf("Audit log has been altered: %v", chainErr)
+		if chainErr.Line > 0 {
+			ui.Mutedf("The %d entries before it are intact", n)
+		}
+		ui.Mutedf("Log: %s", log.Path())
+		os.Exit(1)
+	case err != nil:
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	ui.Successf("Audit log intact: %d entries", n)
+	ui.Mutedf("Log: %s", log.Path())
+}
+
+// formatAuditArgs renders arguments as sorted key=value pairs.
+func formatAuditArgs(args map[string]string) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := args[k]
+		if strings.ContainsAny(v, " \t") {
+			v = fmt.Sprintf("%q", v)
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
+
+func printAuditUsage() {
+	fmt.Println("Usage: coop audit <subcommand>")
+	fmt.Println("\nSubcommands:")
+	fmt.Println("  log [container]   Show audited operations")
+	fmt.Println("  verify            Check the log has not been altered")
+	fmt.Println("\nLog options:")
+	fmt.Println("  --op OP           Only this operation (exec, mount, seatbelt, ...)")
+	fmt.Println("  --since DURATION  Only entries newer than this (e.g. 24h)")
+	fmt.Println("  -n N              Show the latest N entries (default: 50, 0 for all)")
+	fmt.Println("  --json            Print entries as JSON lines")
+	fmt.Println("\nCoop records who created, deleted, locked, unlocked, exec'd into, shelled")
+	fmt.Println("into, mounted, copied or synced what, whether it worked, and how protected")
+	fmt.Println("paths were authorized. Entries are hash-chained and keyed with a secret in")
+	fmt.Println("~/.config/coop, so 'verify' finds edited, removed or reordered entries.")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) CodeCmd(args []string) {
+	fs := flag.NewFlagSet("code", flag.ExitOnError)
+	editorName := fs.String("editor", "vscode", "Editor to open: vscode, cursor or jetbrains")
+	fs.Usage = printCodeUsage
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		printCodeUsage()
+		os.Exit(1)
+	}
+
+	name := a.ValidContainerName(fs.Arg(0))
+	dir := sandbox.DefaultEditorPath
+	if fs.NArg() > 1 {
+		dir = fs.Arg(1)
+	}
+
+	editor, err := sandbox.ParseEditor(*editorName)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	mgr := a.Manager()
+	if err := mgr.PrepareRemoteEditor(name); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	a.ensureSSHInclude()
+
+	command, err := sandbox.EditorCommand(editor, name, dir)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	ui.Printf("Opening %s:%s in %s...\n", ui.Name(name), ui.Path(dir), editor)
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		ui.Errorf("Error launching %s: %v", editor, err)
+		os.Exit(1)
+	}
+}
+
+func printCodeUsage() {
+	fmt.Println("Usage: coop code [--editor vscode|cursor|jetbrains] <container> [path]")
+	fmt.Println("\nOpen a folder in the container in a desktop editor over SSH. The default")
+	fmt.Println("folder is /home/agent/workspace; relative paths are under /home/agent.")
+	fmt.Println("\nOptions:")
+	fmt.Println("  --editor NAME   vscode (default), cursor, or jetbrains for JetBrains Gateway")
+	fmt.Println("\nThe container's SSH Host entry is refreshed (with the VM jump host on")
+	fmt.Println("bladerunner) and, with consent, ~/.ssh/config is set to Include coop's SSH")
+	fmt.Println("config, so the editor's Remote-SSH support can connect by container name.")
+	fmt.Println("\nExamples:")
+	fmt.Println("  coop code myagent")
+	fmt.Println("  coop code myagent workspace/api")
+	fmt.Println("  coop code --editor jetbrains myagent")
+}
@@ -18,8 +18,8 @@ func (a *App) InitCmd(args []string) {
 	dirs := config.GetDirectories()
 
 	_, settingsExists := os.Stat(dirs.SettingsFile)
-	_, sshKeyExists := os.Stat(filepath.Join(dirs.SSH, "id_ed25519"))
-	alreadyInitialized := settingsExists == nil && sshKeyExists == nil
+	_, sshCAExists := os.Stat(filepath.Join(dirs.SSH, "ca"))
+	alreadyInitialized := settingsExists == nil && sshCAExists == nil
 
 	fmt.Println()
 	if alreadyInitialized {
@@ -48,12 +48,10 @@ func (a *App) InitCmd(args []string) {
 	ui.Successf("Created cache directory:  %s", ui.Path(dirs.Cache))
 	ui.Successf("Settings file: %s", ui.Path(dirs.SettingsFile))
 
-	pubKey, err := sandbox.EnsureSSHKeys()
-	if err != nil {
-		ui.Warnf("Could not generate SSH keys: %v", err)
+	if _, err := sandbox.EnsureSSHCA(); err != nil {
+		ui.Warnf("Could not generate SSH CA: %v", err)
 	} else {
-		ui.Successf("SSH keys generated in: %s", ui.Path(dirs.SSH))
-		_ = pubKey
+		ui.Successf("SSH CA generated in: %s", ui.Path(dirs.SSH))
 	}
 
 	fmt.Println()
@@ -67,8 +65,11 @@ func (a *App) CreateCmd(args []string) {
 	cpus := fs.Int("cpus", 2, "Number of CPUs")
 	memory := fs.Int("memory", 4096, "Memory in MB")
 	disk := fs.Int("disk", 20, "Disk size in GB")
-	sshKey := fs.String("ssh-key", "", "SSH public key (default: auto-detect)")
+	sshKey := fs.String("ssh-key", "", "Extra SSH public key to authorize (coop itself logs in with certificates)")
 	workDir := fs.String("workdir", "", "Host directory to mount as workspace")
+	force := fs.Bool("force", false, "Authorize a protected --workdir")
+	security := fs.String("security", "", "Security tier: strict, standard or dev (default: standard)")
+	with := fs.String("with", "", "Install a container engine inside: docker or podman")
 	verbose := fs.Bool("verbose", false, "Stream cloud-init logs during setup")
 
 	_ = fs.Parse(args)
@@ -81,25 +82,33 @@ func (a *App) CreateCmd(args []string) {
 		name = fs.Arg(0)
 	}
 
+	cfg := sandbox.DefaultContainerConfig(name)
+	if *security != "" {
+		cfg.Security = sandbox.SecurityTier(*security)
+	}
+	tier, err := sandbox.ParseSecurityTier(string(cfg.Security))
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	cfg.Security = tier
+	engine, err := sandbox.ParseContainerEngine(*with)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	cfg.Engine = engine
+
 	mgr := a.Manager()
 
-	cfg := sandbox.DefaultContainerConfig(name)
 	cfg.CPUs = *cpus
 	cfg.MemoryMB = *memory
 	cfg.DiskGB = *disk
 	cfg.WorkingDir = *workDir
+	cfg.Force = *force
 	cfg.Verbose = *verbose
 
-	if *sshKey != "" {
-		cfg.SSHPubKey = *sshKey
-	} else {
-		pubKey, err := sandbox.EnsureSSHKeys()
-		if err != nil {
-			ui.Warnf("Could not setup SSH keys: %v", err)
-		} else {
-			cfg.SSHPubKey = pubKey
-		}
-	}
+	cfg.SSHPubKey = *sshKey
 
 	if err := mgr.Create(cfg); err != nil {
 		ui.Errorf("Error creating container: %v", err)
@@ -111,13 +120,19 @@ func (a *App) CreateCmd(args []string) {
 		baseImage = sandbox.DefaultImage
 	}
 	instanceDir := filepath.Join(a.Config.Dirs.Data, "instances")
-	if _, err := state.NewTracker(instanceDir, name, baseImage); err != nil {
+	tracker, err := state.NewTracker(instanceDir, name, baseImage)
+	if err == nil {
+		_, err = tracker.RecordSecurity(string(cfg.Security))
+	}
+	if err != nil {
 		ui.Warnf("Container created but state tracking failed: %v", err)
 	}
 
 	if ip, _ := mgr.GetContainerIP(name); ip != "" {
-		if err := sandbox.UpdateSSHConfig(name, ip); err != nil {
+		if err := mgr.UpdateSSHConfig(name, ip); err != nil {
 			ui.Warnf("Could not update SSH config: %v", err)
+		} else {
+			a.ensureSSHInclude()
 		}
 	}
 }
@@ -141,10 +156,16 @@ func (a *App) StartCmd(args []string) {
 	ui.Successf("Container %s started", ui.Name(name))
 
 	if ip, _ := mgr.GetContainerIP(name); ip != "" {
-		if err := sandbox.UpdateSSHConfig(name, ip); err != nil {
+		if err := mgr.UpdateSSHConfig(name, ip); err != nil {
 			ui.Warnf("Could not update SSH config: %v", err)
+		} else {
+			a.ensureSSHInclude()
 		}
 	}
+
+	if err := mgr.RestoreForwards(name); err != nil {
+		ui.Warnf("%v", err)
+	}
 }
 
 func (a *App) StopCmd(args []string) {
@@ -344,12 +365,28 @@ func (a *App) StatusCmd(args []string) {
 		fmt.Printf("%s  %s\n", ui.Bold("IP:"), ui.IP(status.IP))
 	}
 	fmt.Printf("%s  %s\n", ui.Bold("Created:"), status.CreatedAt.Format("2006-01-02 15:04:05"))
+	if status.Security != "" {
+		fmt.Printf("%s  %s %s\n", ui.Bold("Security:"), status.Security, ui.MutedText("("+status.Security.Profile().Summary()+")"))
+	} else {
+		fmt.Printf("%s  %s\n", ui.Bold("Security:"), ui.MutedText("none (created before security tiers)"))
+	}
+	if status.Engine != "" {
+		fmt.Printf("%s  %s %s\n", ui.Bold("Engine:"), status.Engine, ui.MutedText("(check with 'coop doctor "+status.Name+"')"))
+	}
 
 	fmt.Println()
 	ui.Print(ui.Header("Configuration:"))
 	for k, v := range status.Config {
-		if strings.HasPrefix(k, "limits.") || k == "security.nesting" {
+		if strings.HasPrefix(k, "limits.") || strings.HasPrefix(k, "security.") {
 			fmt.Printf("  %s: %s\n", k, v)
 		}
 	}
+
+	if exposed, err := mgr.ListExposed(name); err == nil && len(exposed) > 0 {
+		fmt.Println()
+		ui.Print(ui.Header("Exposed host services:"))
+		for _, e := range exposed {
+			fmt.Printf("  %s:%d -> 127.0.0.1:%d\n", e.HostAddr, e.HostPort, e.ContainerPort)
+		}
+	}
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) CpCmd(args []string) {
+	fs := flag.NewFlagSet("cp", flag.ExitOnError)
+	force := fs.Bool("force", false, "Authorize copying protected host paths")
+	quiet := fs.Bool("quiet", false, "Do not show progress")
+	fs.Usage = printCpUsage
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		printCpUsage()
+		os.Exit(1)
+	}
+
+	src := sandbox.ParseCopyPath(fs.Arg(0))
+	dst := sandbox.ParseCopyPath(fs.Arg(1))
+
+	if src.IsContainer() == dst.IsContainer() {
+		ui.Error("exactly one of source and destination must be a container path (container:path)")
+		os.Exit(1)
+	}
+
+	container := dst.Container
+	if src.IsContainer() {
+		container = src.Container
+	}
+	a.ValidContainerName(container)
+
+	opts := sandbox.CopyOptions{Force: *force}
+
+	showProgress := !*quiet && ui.IsTTY()
+	if showProgress {
+		opts.Progress = printCopyProgress
+	}
+
+	mgr := a.Manager()
+
+	var err error
+	if src.IsContainer() {
+		err = mgr.CopyFromContainer(container, src.Path, dst.Path, opts)
+	} else {
+		err = mgr.CopyToContainer(container, src.Path, dst.Path, opts)
+	}
+	if showProgress {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	ui.Successf("Copied %s to %s", ui.Path(src.String()), ui.Path(dst.String()))
+}
+
+// printCopyProgress redraws a single progress line on stderr.
+func printCopyProgress(p sandbox.CopyProgress) {
+	percent := 100
+	if p.Total > 0 {
+		percent = int(p.Done * 100 / p.Total)
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%3d%%  %s / %s  %s",
+		percent, formatBytes(p.Done), formatBytes(p.Total), filepath.Base(p.File))
+}
+
+// formatBytes converts bytes to human-readable format
+func formatBytes(bytes int64) string {
+	const (
+		KB = 1024
+		MB = KB * 1024
+		GB = MB * 1024
+	)
+	switch {
+	case bytes >= GB:
+		return fmt.Sprintf("%.1fGB", float64(bytes)/GB)
+	case bytes >= MB:
+		return fmt.Sprintf("%.1fMB", float64(bytes)/MB)
+	case bytes >= KB:
+		return fmt.Sprintf("%.1fKB", float64(bytes)/KB)
+	default:
+		return fmt.Sprintf("%dB", bytes)
+	}
+}
+
+func printCpUsage() {
+	fmt.Println("Usage: coop cp [options] <source> <destination>")
+	fmt.Println("\nCopy files between the host and a container. One side must be a")
+	fmt.Println("container path written container:path; relative container paths are")
+	fmt.Println("under /home/agent. Directories are copied recursively.")
+	fmt.Println("\nOptions:")
+	fmt.Println("  --force   Authorize copying protected host paths")
+	fmt.Println("  --quiet   Do not show progress")
+	fmt.Println("\nFile modes are preserved. Files copied into a container are owned by")
+	fmt.Println("the agent user; protected host paths (~/.ssh, ~/Library, ...) need --force.")
+	fmt.Println("\nExamples:")
+	fmt.Println("  coop cp ./project myagent:work/")
+	fmt.Println("  coop cp myagent:/var/log/syslog ./syslog")
+}
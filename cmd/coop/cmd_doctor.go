@@ -4,22 +4,59 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/stuffbucket/coop/internal/doctor"
+	"github.com/stuffbucket/coop/internal/sandbox"
 	"github.com/stuffbucket/coop/internal/ui"
 )
 
 func (a *App) DoctorCmd(args []string) {
 	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
-	fix := fs.Bool("fix", false, "Attempt to fix issues automatically")
-	_ = fs.Parse(args)
+	fix := fs.Bool("fix", false, "Fix what can be fixed automatically, after confirmation")
+	yes := fs.Bool("yes", false, "Apply --fix without asking")
+	positional := parseInterleaved(fs, args)
+
+	if len(positional) > 1 {
+		ui.Muted("Usage: coop doctor [--fix [--yes]] [container]")
+		os.Exit(1)
+	}
+
+	title := "Coop Doctor"
+	run := func() *doctor.Report { return doctor.Run(a.Config) }
+	if len(positional) == 1 {
+		name := a.ValidContainerName(positional[0])
+		title += ": " + name
+		run = func() *doctor.Report { return a.containerReport(name) }
+	}
 
 	fmt.Println()
-	ui.Print(ui.Bold("Coop Doctor"))
+	ui.Print(ui.Bold(title))
 	fmt.Println()
+	report := run()
+	printDoctorReport(report)
+
+	if *fix {
+		if plan := report.Fixable(); len(plan) > 0 && confirmDoctorPlan(plan, *yes) {
+			applyDoctorPlan(plan)
+			fmt.Println()
+			ui.Print(ui.Bold("Checking again"))
+			fmt.Println()
+			report = run()
+			printDoctorReport(report)
+		} else if len(plan) == 0 && !allPassed(report) {
+			ui.Muted("Nothing can be fixed automatically; follow the fix hints above.")
+		}
+	}
+	printDoctorSummary(report, *fix, len(positional) == 0)
 
-	report := doctor.Run(a.Config)
+	if report.HasFailures() {
+		os.Exit(1)
+	}
+}
 
+func printDoctorReport(report *doctor.Report) {
 	maxNameLen := 0
 	for _, r := range report.Results {
 		if len(r.Name) > maxNameLen {
@@ -60,15 +97,18 @@ func (a *App) DoctorCmd(args []string) {
 			fmt.Printf("  %s  %s  %s\n", ui.MutedText(icon), ui.MutedText(name), ui.MutedText(r.Message))
 		}
 
-		if r.Status == doctor.StatusFail && r.Fix != "" {
-			if *fix {
-				fmt.Printf("      %s %s\n", ui.MutedText("fixing:"), r.Fix)
-			} else {
-				fmt.Printf("      %s %s\n", ui.MutedText("fix:"), ui.WarningText(r.Fix))
-			}
+		if (r.Status == doctor.StatusFail || r.Status == doctor.StatusWarn) && r.Fix != "" {
+			fmt.Printf("      %s %s\n", ui.MutedText("fix:"), ui.WarningText(r.Fix))
 		}
 	}
+}
+
+func allPassed(report *doctor.Report) bool {
+	_, warn, fail := report.Summary()
+	return warn == 0 && fail == 0
+}
 
+func printDoctorSummary(report *doctor.Report, fixed, host bool) {
 	pass, warn, fail := report.Summary()
 	fmt.Println()
 	if fail == 0 && warn == 0 {
@@ -78,12 +118,109 @@ func (a *App) DoctorCmd(args []string) {
 	} else {
 		ui.Printf("%d passed, %d warnings, %s\n", pass, warn, ui.ErrorText(fmt.Sprintf("%d failed", fail)))
 		fmt.Println()
-		ui.Muted("Run suggested fix commands to resolve issues.")
-		ui.Muted("For macOS dependencies: brew bundle")
+		if fixed {
+			ui.Muted("Run the remaining fix commands to resolve issues.")
+		} else {
+			ui.Muted("Run suggested fix commands, or 'coop doctor --fix', to resolve issues.")
+		}
+		if host {
+			ui.Muted("For macOS dependencies: brew bundle")
+		}
 	}
 	fmt.Println()
+}
 
-	if report.HasFailures() {
+// confirmDoctorPlan shows what --fix would do and asks to go ahead.
+func confirmDoctorPlan(plan []doctor.CheckResult, yes bool) bool {
+	fmt.Println()
+	ui.Print(ui.Header("Fix plan:"))
+	width := 0
+	for _, r := range plan {
+		width = max(width, len(r.Name))
+	}
+	for i, r := range plan {
+		fmt.Printf("  %d. %-*s  %s\n", i+1, width, r.Name, ui.MutedText(r.Fix))
+	}
+	fmt.Println()
+	if yes {
+		return true
+	}
+	if !ui.IsInteractive() {
+		ui.Error("Refusing to fix without confirmation; pass --yes")
 		os.Exit(1)
 	}
+	if !ui.Confirm(fmt.Sprintf("Apply %d fixes?", len(plan)), "Some may ask for your password or take several minutes.") {
+		ui.Muted("Cancelled")
+		return false
+	}
+	return true
+}
+
+// applyDoctorPlan runs each remedy in order; a failure does not stop the rest.
+func applyDoctorPlan(plan []doctor.CheckResult) {
+	for _, r := range plan {
+		fmt.Printf("%s %s\n", ui.MutedText("fixing:"), r.Fix)
+		if err := r.Remedy(); err != nil {
+			ui.Errorf("%s: %v", r.Name, err)
+			continue
+		}
+		ui.Successf("%s fixed", r.Name)
+	}
+}
+
+// containerReport runs the checks for one container.
+func (a *App) containerReport(name string) *doctor.Report {
+	mgr := a.Manager()
+	status, err := mgr.Status(name)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	info := doctor.ContainerInfo{
+		Name:         name,
+		Status:       status.Status,
+		Engine:       string(status.Engine),
+		Backend:      status.Backend,
+		IP:           status.IP,
+		RootSize:     status.RootSize,
+		ProcessLimit: processLimit(status.Config),
+		Config:       status.Config,
+	}
+	if mounts, err := mgr.ListMounts(name); err == nil {
+		for _, m := range mounts {
+			info.Mounts = append(info.Mounts, doctor.Mount{Name: m.Name, Source: m.Source, Path: m.Path, Readonly: m.Readonly})
+		}
+	}
+	if transport, err := mgr.ProbeShellTransport(name); err == nil {
+		info.Transport = string(transport)
+	}
+	return doctor.RunContainer(info, containerProbe{mgr: mgr, name: name})
+}
+
+// processLimit returns a container's limits.processes, or coop's default
+// where the key is unset or unreadable.
+func processLimit(config map[string]string) int {
+	if limit, err := strconv.Atoi(config["limits.processes"]); err == nil {
+		return limit
+	}
+	limit, _ := strconv.Atoi(sandbox.DefaultProcessLimit)
+	return limit
+}
+
+// containerProbe runs doctor's commands through the manager as root.
+type containerProbe struct {
+	mgr  *sandbox.Manager
+	name string
+}
+
+func (p containerProbe) Start() error {
+	return p.mgr.Start(p.name)
+}
+
+func (p containerProbe) Run(command []string, timeout time.Duration) (string, int, error) {
+	result, err := p.mgr.Exec(p.name, command, sandbox.ExecOptions{Timeout: timeout})
+	if result == nil {
+		return "", -1, err
+	}
+	return result.Stdout + result.Stderr, result.ExitCode, err
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) ExposeCmd(args []string) {
+	fs := flag.NewFlagSet("expose", flag.ExitOnError)
+	as := fs.Int("as", 0, "Port inside the container (default: same as host port)")
+	force := fs.Bool("force", false, "Authorize exposing protected ports")
+	list := fs.Bool("list", false, "List exposed host services")
+	stop := fs.Int("stop", 0, "Stop exposing the given container port")
+	fs.Usage = printExposeUsage
+	positional := parseInterleaved(fs, args)
+
+	if len(positional) < 1 {
+		printExposeUsage()
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(positional[0])
+	mgr := a.Manager()
+
+	switch {
+	case *stop > 0:
+		if err := mgr.Unexpose(container, *stop); err != nil {
+			ui.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		ui.Successf("Stopped exposing port %d in %s", *stop, ui.Name(container))
+		return
+
+	case *list || len(positional) < 2:
+		printExposed(mgr, container)
+		return
+	}
+
+	addr, hostPort, err := sandbox.ParseHostAddr(positional[1])
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	containerPort := hostPort
+	if *as > 0 {
+		containerPort = *as
+	}
+
+	if protected, reason := sandbox.IsPortProtected(addr, hostPort); protected && !*force {
+		ui.Errorf("Refusing to expose protected port: %s", reason)
+		ui.Muted("Use --force to authorize with a one-time code")
+		os.Exit(1)
+	}
+
+	if err := mgr.Expose(container, addr, hostPort, containerPort, *force); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	ui.Successf("%s:%d is reachable in %s at %s", addr, hostPort, ui.Name(container),
+		ui.Path("127.0.0.1:"+strconv.Itoa(containerPort)))
+}
+
+func printExposed(mgr *sandbox.Manager, container string) {
+	exposed, err := mgr.ListExposed(container)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if len(exposed) == 0 {
+		ui.Mutedf("No host services exposed to %s", container)
+		return
+	}
+
+	table := ui.NewTable(25, 10)
+	table.SetHeaders("HOST", "CONTAINER")
+	for _, e := range exposed {
+		table.AddRow(fmt.Sprintf("%s:%d", e.HostAddr, e.HostPort), strconv.Itoa(e.ContainerPort))
+	}
+	fmt.Print(table.Render())
+}
+
+// parseInterleaved parses flags that may appear before, between or after
+// positional arguments, and returns the positional arguments.
+func parseInterleaved(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func printExposeUsage() {
+	fmt.Println("Usage: coop expose [options] <container> [host:]<port>")
+	fmt.Println("\nMake one host service reachable inside the container at 127.0.0.1.")
+	fmt.Println("\nOptions:")
+	fmt.Println("  --as PORT     Port inside the container (default: same as host port)")
+	fmt.Println("  --force       Authorize exposing protected ports")
+	fmt.Println("  --list        List exposed host services (also the default with no port)")
+	fmt.Println("  --stop PORT   Stop exposing a container port")
+	fmt.Println("\nProtected ports (SSH, SMB, VNC, Docker/Kubernetes/Incus APIs, ...) and")
+	fmt.Println("addresses other than this machine require --force with a one-time code.")
+	fmt.Println("\nExamples:")
+	fmt.Println("  coop expose myagent host:5432              # Postgres on the host")
+	fmt.Println("  coop expose myagent host:11434 --as 8000   # Local model server")
+	fmt.Println("  coop expose --stop 5432 myagent")
+}
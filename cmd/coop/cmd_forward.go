@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) ForwardCmd(args []string) {
+	fs := flag.NewFlagSet("forward", flag.ExitOnError)
+	list := fs.Bool("list", false, "List forwards")
+	stop := fs.Bool("stop", false, "Stop forwarding the given host port")
+	fs.Usage = printForwardUsage
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		printForwardUsage()
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(fs.Arg(0))
+	mgr := a.Manager()
+
+	if *list || fs.NArg() < 2 {
+		a.forwardList(mgr, container)
+		return
+	}
+
+	hostPort, containerPort, err := sandbox.ParsePortSpec(fs.Arg(1))
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if *stop {
+		if err := mgr.RemoveForward(container, hostPort); err != nil {
+			ui.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		ui.Successf("Stopped forwarding port %d", hostPort)
+		return
+	}
+
+	if err := mgr.AddForward(container, hostPort, containerPort); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	ui.Successf("Forwarding %s to %s:%d", ui.Path("127.0.0.1:"+strconv.Itoa(hostPort)), ui.Name(container), containerPort)
+}
+
+func (a *App) forwardList(mgr *sandbox.Manager, container string) {
+	forwards, err := mgr.ListForwards(container)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if len(forwards) == 0 {
+		ui.Mutedf("No forwards for %s", container)
+		return
+	}
+
+	table := ui.NewTable(10, 10, 7, 10)
+	table.SetHeaders("HOST", "CONTAINER", "MODE", "STATUS")
+	for _, f := range forwards {
+		status := ui.SuccessText("active")
+		if !f.Active {
+			status = ui.MutedText("inactive")
+		}
+		table.AddRow(strconv.Itoa(f.HostPort), strconv.Itoa(f.ContainerPort), string(f.Mode), status)
+	}
+	fmt.Print(table.Render())
+}
+
+func printForwardUsage() {
+	fmt.Println("Usage: coop forward [options] <container> <host-port>[:<container-port>]")
+	fmt.Println("\nForward a port on 127.0.0.1 to a port in the container.")
+	fmt.Println("\nOptions:")
+	fmt.Println("  --list    List forwards (also the default with no port)")
+	fmt.Println("  --stop    Stop forwarding the host port")
+	fmt.Println("\nForwards are remembered and come back on 'coop start'. Local backends use")
+	fmt.Println("Incus proxy devices; bladerunner and remote backends use an SSH tunnel.")
+	fmt.Println("\nExamples:")
+	fmt.Println("  coop forward myagent 3000          # localhost:3000 -> myagent:3000")
+	fmt.Println("  coop forward myagent 8080:8888     # localhost:8080 -> myagent:8888")
+	fmt.Println("  coop forward --stop myagent 8080")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+// execDetached starts a command as a background job for 'coop exec --detach'.
+func (a *App) execDetached(fs *flag.FlagSet, name string, command []string, cwd string, env []string) {
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "checkpoint", "timeout":
+			ui.Errorf("--%s cannot be used with --detach", f.Name)
+			os.Exit(1)
+		case "user":
+			if f.Value.String() != "agent" {
+				ui.Error("detached jobs run as the agent user")
+				os.Exit(1)
+			}
+		}
+	})
+
+	vars, err := sandbox.ParseExecEnv(env)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	job, err := a.Manager().StartJob(name, command, sandbox.ExecOptions{Cwd: cwd, Env: vars})
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	ui.Successf("Started job %s in %s", ui.Name(job.ID), ui.Name(name))
+	ui.Mutedf("Attach with:  coop attach %s %s", name, job.ID)
+	ui.Mutedf("Follow logs:  coop job logs -f %s %s", name, job.ID)
+}
+
+func (a *App) JobsCmd(args []string) {
+	if len(args) < 1 {
+		ui.Error("container name required")
+		ui.Muted("Usage: coop jobs <container>")
+		os.Exit(1)
+	}
+
+	name := a.ValidContainerName(args[0])
+	jobs, err := a.Manager().ListJobs(name)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if len(jobs) == 0 {
+		ui.Mutedf("No jobs in %s", name)
+		ui.Mutedf("Start one with: coop exec --detach %s <command>", name)
+		return
+	}
+
+	table := ui.NewTable(8, 12, 16, 40)
+	table.SetHeaders("ID", "STATUS", "STARTED", "COMMAND")
+	for _, job := range jobs {
+		var status string
+		switch job.Status {
+		case sandbox.JobRunning:
+			status = ui.SuccessText("running")
+		case sandbox.JobExited:
+			status = fmt.Sprintf("exited (%d)", job.ExitCode)
+			if job.ExitCode != 0 {
+				status = ui.ErrorText(status)
+			}
+		default:
+			status = ui.MutedText("killed")
+		}
+		table.AddRow(ui.Name(job.ID), status, job.Started.Format("2006-01-02 15:04"), job.Command)
+	}
+	fmt.Print(table.Render())
+}
+
+func (a *App) AttachCmd(args []string) {
+	if len(args) < 2 {
+		ui.Error("container name and job id required")
+		ui.Muted("Usage: coop attach <container> <job>")
+		os.Exit(1)
+	}
+
+	name := a.ValidContainerName(args[0])
+	ui.Muted("Detach with Ctrl-b d; the job keeps running")
+	exitCode, err := a.Manager().AttachJob(name, args[1])
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(exitCode)
+}
+
+func (a *App) JobCmd(args []string) {
+	if len(args) == 0 {
+		printJobUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "logs":
+		a.jobLogsCmd(args[1:])
+	case "kill":
+		a.jobKillCmd(args[1:])
+	case "list", "ls":
+		a.JobsCmd(args[1:])
+	default:
+		ui.Errorf("Unknown job subcommand: %s", args[0])
+		printJobUsage()
+		os.Exit(1)
+	}
+}
+
+func (a *App) jobLogsCmd(args []string) {
+	fs := flag.NewFlagSet("job logs", flag.ExitOnError)
+	follow := fs.Bool("f", false, "Follow log output")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		ui.Error("container name and job id required")
+		ui.Muted("Usage: coop job logs [-f] <container> <job>")
+		os.Exit(1)
+	}
+
+	name := a.ValidContainerName(fs.Arg(0))
+	if err := a.Manager().JobLogs(name, fs.Arg(1), *follow, os.Stdout); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+}
+
+func (a *App) jobKillCmd(args []string) {
+	if len(args) < 2 {
+		ui.Error("container name and job id required")
+		ui.Muted("Usage: coop job kill <container> <job>")
+		os.Exit(1)
+	}
+
+	name := a.ValidContainerName(args[0])
+	if err := a.Manager().KillJob(name, args[1]); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	ui.Successf("Job %s killed (log kept)", ui.Name(args[1]))
+}
+
+func printJobUsage() {
+	fmt.Println("Usage: coop job <subcommand>")
+	fmt.Println("\nSubcommands:")
+	fmt.Println("  list <container>               List jobs (same as 'coop jobs')")
+	fmt.Println("  logs [-f] <container> <job>    Show a job's output")
+	fmt.Println("  kill <container> <job>         Stop a running job")
+	fmt.Println("\nJobs are started with 'coop exec --detach' and run as the agent user in a")
+	fmt.Println("tmux session inside the container, so they survive SSH disconnects and")
+	fmt.Println("closed terminals. Reattach with 'coop attach <container> <job>'.")
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -74,52 +76,15 @@ func (a *App) mountAddCmd(args []string) {
 		mountPath = "/home/agent/" + mountName
 	}
 
-	// Check if path is seatbelted and handle authorization
-	forceAuthorized := false
-	if seatbelted, reason := sandbox.IsSeatbelted(source); seatbelted {
-		if !*force {
-			ui.Errorf("Refusing to mount protected path: %s", reason)
-			ui.Muted("Use --force to authorize with a one-time code")
-			os.Exit(1)
-		}
-
-		_, err := sandbox.CurrentAuthCode()
-		if err != nil {
-			ui.Errorf("Failed to generate authorization code: %v", err)
-			os.Exit(1)
-		}
-		ui.NotifyWithSound("coop", "Protected Path", "Enter the auth code in your terminal", "Purr")
-
-		result := ui.PromptAuthCode(ui.AuthCodePromptConfig{
-			Reason:   reason,
-			Timeout:  15 * time.Second,
-			Attempts: 3,
-			Validator: func(code string) (bool, error) {
-				return sandbox.ValidateAuthCode(code)
-			},
-		})
-
-		switch result {
-		case ui.AuthCodeSuccess:
-			forceAuthorized = true
-		case ui.AuthCodeExpired:
-			ui.Errorf("Authorization code expired")
-			os.Exit(1)
-		case ui.AuthCodeFailed:
-			ui.Errorf("Authorization failed after 3 attempts")
-			os.Exit(1)
-		case ui.AuthCodeError:
-			ui.Errorf("Cannot read from terminal")
-			os.Exit(1)
-		}
+	mgr := a.Manager()
 
-		ui.Warnf("Mounting protected path: %s", source)
+	if !mgr.SharesHostFilesystem() {
+		ui.Warn("This backend runs containers on another machine; the mount will not see your files")
+		ui.Mutedf("Use 'coop sync add %s %s %s' instead", container, source, mountPath)
 	}
 
-	mgr := a.Manager()
-
 	ui.Printf("Mounting %s to %s as %s...\n", ui.Path(source), ui.Path(mountPath), ui.Name(mountName))
-	if err := mgr.Mount(container, mountName, source, mountPath, *readonly, forceAuthorized); err != nil {
+	if err := mgr.Mount(container, mountName, source, mountPath, *readonly, *force); err != nil {
 		ui.Errorf("Error: %v", err)
 		os.Exit(1)
 	}
@@ -131,6 +96,71 @@ func (a *App) mountAddCmd(args []string) {
 	}
 }
 
+// authorizeWithCode is the Manager's Authorizer: a forced override of a
+// protected host path or port goes ahead only after a valid one-time code.
+func (a *App) authorizeWithCode(access sandbox.HostAccess, d sandbox.SeatbeltDecision) (string, error) {
+	what := "path"
+	if access.Op == sandbox.HostOpExpose {
+		what = "port"
+	}
+	ui.Warnf("Authorizing %s of protected %s %s for %s", access.Op, what, d.Path, ui.Name(access.Container))
+	return a.checkAuthCode(d.Reason)
+}
+
+// checkAuthCode sends a one-time code through the configured channels and
+// prompts for it. It returns the auth method, "totp:" and the channels
+// that delivered the code, and why the code was not accepted.
+func (a *App) checkAuthCode(reason string) (string, error) {
+	code, err := sandbox.CurrentAuthCode()
+	if err != nil {
+		return "totp", fmt.Errorf("failed to generate authorization code: %w", err)
+	}
+	channels, err := sandbox.AuthChannels(a.Config.Settings.Seatbelt)
+	if err != nil {
+		return "totp", err
+	}
+	delivered, err := sandbox.DeliverAuthCode(channels, code, reason)
+	if err != nil {
+		if sandbox.AuthenticatorEnrolled() {
+			return "totp", err
+		}
+		return "totp", fmt.Errorf("%w. Run 'coop seatbelt enroll' to use an authenticator app, which needs no notification daemon", err)
+	}
+
+	var names, hints []string
+	timeout := 15 * time.Second
+	for _, c := range delivered {
+		names = append(names, c.Name())
+		if !slices.Contains(hints, c.Hint()) {
+			hints = append(hints, c.Hint())
+		}
+		if c.Name() == sandbox.AuthChannelAuthenticator {
+			timeout = 60 * time.Second // Time to reach for a phone
+		}
+	}
+	method := "totp:" + strings.Join(names, ",")
+
+	result := ui.PromptAuthCode(ui.AuthCodePromptConfig{
+		Reason:   reason,
+		Hint:     strings.Join(hints, "; "),
+		Timeout:  timeout,
+		Attempts: 3,
+		Validator: func(code string) (bool, error) {
+			return sandbox.ValidateAuthCode(code)
+		},
+	})
+
+	switch result {
+	case ui.AuthCodeSuccess:
+		return method, nil
+	case ui.AuthCodeExpired:
+		return method, errors.New("authorization code expired")
+	case ui.AuthCodeFailed:
+		return method, errors.New("authorization failed after 3 attempts")
+	}
+	return method, errors.New("cannot read an authorization code from the terminal")
+}
+
 func (a *App) mountRemoveCmd(args []string) {
 	if len(args) < 2 {
 		ui.Error("container name and mount name required")
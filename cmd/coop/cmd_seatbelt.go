@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/user"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) SeatbeltCmd(args []string) {
+	if len(args) == 0 {
+		printSeatbeltUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "check":
+		a.seatbeltCheckCmd(args[1:])
+	case "rules":
+		a.seatbeltRulesCmd()
+	case "enroll":
+		a.seatbeltEnrollCmd()
+	case "rotate":
+		a.seatbeltRotateCmd(args[1:])
+	default:
+		ui.Errorf("Unknown seatbelt subcommand: %s", args[0])
+		printSeatbeltUsage()
+		os.Exit(1)
+	}
+}
+
+func (a *App) seatbeltCheckCmd(args []string) {
+	fs := flag.NewFlagSet("seatbelt check", flag.ExitOnError)
+	container := fs.String("container", "", "Apply allow rules for this container")
+	fs.Usage = printSeatbeltUsage
+	positional := parseInterleaved(fs, args)
+
+	if len(positional) != 1 {
+		printSeatbeltUsage()
+		os.Exit(1)
+	}
+	if *container != "" {
+		a.ValidContainerName(*container)
+	}
+
+	d := sandbox.CheckSeatbelt(positional[0], *container)
+
+	verdict := ui.SuccessText(string(d.Verdict))
+	if d.Protected() {
+		verdict = ui.ErrorText(string(d.Verdict))
+	}
+	ui.Printf("Path:       %s\n", ui.Path(d.Path))
+	ui.Printf("Verdict:    %s\n", verdict)
+	if d.Rule != nil {
+		ui.Printf("Rule:       %s\n", formatSeatbeltRule(d.Rule))
+	} else {
+		ui.Printf("Rule:       %s\n", ui.MutedText("none matched"))
+	}
+	if d.Overridden != nil {
+		ui.Printf("Overrides:  %s\n", formatSeatbeltRule(d.Overridden))
+	}
+	if d.Reason != "" {
+		ui.Printf("Reason:     %s\n", d.Reason)
+	}
+	if d.PolicyError != nil {
+		ui.Warnf("Only built-in rules applied: %v", d.PolicyError)
+	}
+
+	switch d.Verdict {
+	case sandbox.SeatbeltDenied:
+		ui.Muted("Commands sharing this path need --force and a one-time code.")
+		os.Exit(1)
+	case sandbox.SeatbeltBlocked:
+		ui.Muted("This path cannot be shared, even with --force.")
+		os.Exit(1)
+	}
+}
+
+func (a *App) seatbeltRulesCmd() {
+	rules, err := sandbox.SeatbeltRules()
+	if err != nil {
+		ui.Warnf("%v", err)
+	}
+
+	table := ui.NewTable(7, 44, 16, 10)
+	table.SetHeaders("ACTION", "PATH", "CONTAINERS", "SOURCE")
+	for _, r := range rules {
+		source := "default"
+		if r.Source != "default" {
+			source = "policy"
+		}
+		table.AddRow(string(r.Action), r.Path, strings.Join(r.Containers, ","), source)
+	}
+	fmt.Print(table.Render())
+	ui.Mutedf("Policy file: %s", sandbox.SeatbeltPolicyPath())
+}
+
+func (a *App) seatbeltEnrollCmd() {
+	if !ui.IsInteractive() {
+		ui.Error("Enrolling needs an interactive terminal")
+		os.Exit(1)
+	}
+	// The secret mints every future code, so whoever drives the terminal
+	// must first prove they receive codes outside it. A first enrollment
+	// where no channel can deliver one falls back to a confirmation.
+	if _, err := a.checkAuthCode("show the authenticator secret"); err != nil {
+		if sandbox.AuthenticatorEnrolled() || !errors.Is(err, sandbox.ErrAuthCodeUndelivered) {
+			ui.Errorf("%v", err)
+			os.Exit(1)
+		}
+		if !confirmFirstEnroll() {
+			ui.Muted("Cancelled")
+			os.Exit(1)
+		}
+	}
+
+	account := "coop"
+	if u, err := user.Current(); err == nil {
+		account = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		account += "@" + host
+	}
+
+	otpURL, err := sandbox.AuthenticatorURL(account)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	qr, err := ui.QRCode(otpURL)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	secret := ""
+	if u, err := url.Parse(otpURL); err == nil {
+		secret = u.Query().Get("secret")
+	}
+
+	if sandbox.AuthenticatorEnrolled() {
+		ui.Warn("An authenticator app is already enrolled; this shows the same secret again")
+		ui.Muted("Use 'coop seatbelt rotate' first to replace it")
+	}
+	fmt.Println()
+	fmt.Println("Scan this code with your authenticator app:")
+	fmt.Println()
+	fmt.Print(qr)
+	fmt.Println()
+	ui.Printf("Or add it by hand: account %s, key %s (time-based, 6 digits)\n", ui.Name(account), secret)
+
+	result := ui.PromptAuthCode(ui.AuthCodePromptConfig{
+		Title:    "Enroll authenticator",
+		Reason:   "confirm the app shows the right codes",
+		Hint:     "Enter the code from your authenticator app",
+		Timeout:  2 * time.Minute,
+		Attempts: 3,
+		Validator: func(code string) (bool, error) {
+			return sandbox.ValidateAuthCode(code)
+		},
+	})
+	if result != ui.AuthCodeSuccess {
+		ui.Error("Enrollment not confirmed; the app's codes were not accepted")
+		os.Exit(1)
+	}
+
+	if err := sandbox.MarkAuthenticatorEnrolled(); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	ui.Success("Authenticator app enrolled")
+	if channels := a.Config.Settings.Seatbelt.AuthChannels; len(channels) > 0 && !slices.Contains(channels, sandbox.AuthChannelAuthenticator) {
+		ui.Warnf("seatbelt.auth_channels is %v; add %q to use the app", channels, sandbox.AuthChannelAuthenticator)
+	} else {
+		ui.Muted("--force now accepts the codes your app shows")
+	}
+}
+
+// confirmFirstEnroll asks before the secret is shown without a code, on a
+// terminal for both input and output so piped input cannot answer.
+func confirmFirstEnroll() bool {
+	ui.Warnf("%v", sandbox.ErrAuthCodeUndelivered)
+	if !ui.IsInteractive() || !ui.IsTTY() {
+		return false
+	}
+	return ui.Confirm("Enroll without a one-time code?",
+		"No authenticator app is enrolled and no channel can deliver a code, so the secret is shown to whoever is at this terminal.")
+}
+
+func (a *App) seatbeltRotateCmd(args []string) {
+	fs := flag.NewFlagSet("seatbelt rotate", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "Rotate without asking")
+	fs.Usage = printSeatbeltUsage
+	_ = fs.Parse(args)
+
+	if !ui.IsInteractive() {
+		ui.Error("Rotating needs an interactive terminal")
+		os.Exit(1)
+	}
+
+	enrolled := sandbox.AuthenticatorEnrolled()
+	if !*yes {
+		description := "Codes from the old secret stop working."
+		if enrolled {
+			description += " Your authenticator app must be enrolled again."
+		}
+		if !ui.Confirm("Rotate the authorization code secret?", description) {
+			ui.Muted("Cancelled")
+			return
+		}
+	}
+	if _, err := a.checkAuthCode("rotate the authorization code secret"); err != nil {
+		ui.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	if _, err := sandbox.RotateSeatbeltSecret(); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	ui.Success("Authorization code secret rotated")
+	if enrolled {
+		ui.Muted("Enroll your authenticator app again with: coop seatbelt enroll")
+	}
+}
+
+func formatSeatbeltRule(r *sandbox.SeatbeltRule) string {
+	s := fmt.Sprintf("%s %s", r.Action, r.Path)
+	if len(r.Containers) > 0 {
+		s += fmt.Sprintf(" (containers: %s)", strings.Join(r.Containers, ", "))
+	}
+	source := "built-in"
+	if r.Source != "default" {
+		source = r.Source
+	}
+	return s + " " + ui.MutedText("["+source+"]")
+}
+
+func printSeatbeltUsage() {
+	fmt.Println("Usage: coop seatbelt <subcommand>")
+	fmt.Println("\nSubcommands:")
+	fmt.Println("  check [--container NAME] <path>   Explain whether a host path may be shared")
+	fmt.Println("  rules                             List built-in and policy rules")
+	fmt.Println("  enroll                            Enroll an authenticator app with a QR code")
+	fmt.Println("  rotate [--yes]                    Replace the authorization code secret")
+	fmt.Println("\nenroll and rotate ask for a one-time code first; --yes only skips the")
+	fmt.Println("confirmation. A first enroll on a host where no channel can deliver a")
+	fmt.Println("code, such as one without a notification daemon, asks to confirm instead.")
+	fmt.Println("\nThe seatbelt guards host paths used by mount, cp and sync. Deny rules need")
+	fmt.Println("--force and a one-time code; block rules cannot be overridden; allow rules")
+	fmt.Println("make exceptions to deny rules that are no more specific. Add rules in")
+	fmt.Println("~/.config/coop/seatbelt.json:")
+	fmt.Println()
+	fmt.Println(`  {"rules": [`)
+	fmt.Println(`    {"path": "~/Documents/code", "action": "allow"},`)
+	fmt.Println(`    {"path": "~/.config/myapp", "action": "allow", "containers": ["myagent"]},`)
+	fmt.Println(`    {"path": "~/clients/*/credentials", "action": "deny", "reason": "client secrets"},`)
+	fmt.Println(`    {"path": "~/work/keys", "action": "block"}`)
+	fmt.Println(`  ]}`)
+	fmt.Println("\nOne-time codes reach you through seatbelt.auth_channels in settings.json:")
+	fmt.Println("notify (desktop notification), dbus (Linux notification daemon),")
+	fmt.Println("authenticator (after 'enroll') and file (seatbelt.auth_file, a file or FIFO).")
+	fmt.Println("\n'check' exits 1 when the path is denied or blocked.")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/recording"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) SessionsCmd(args []string) {
+	if len(args) == 0 {
+		printSessionsUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		a.sessionsListCmd(args[1:])
+	case "play":
+		a.sessionsPlayCmd(args[1:])
+	case "record":
+		a.sessionsRecordCmd(args[1:])
+	default:
+		ui.Errorf("Unknown sessions subcommand: %s", args[0])
+		printSessionsUsage()
+		os.Exit(1)
+	}
+}
+
+func (a *App) sessionsListCmd(args []string) {
+	container := ""
+	if len(args) > 0 {
+		container = a.ValidContainerName(args[0])
+	}
+
+	sessions, err := a.Manager().ListSessions(container)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if len(sessions) == 0 {
+		ui.Muted("No recorded sessions")
+		ui.Muted("Record one with: coop shell --record <container>")
+		return
+	}
+
+	table := ui.NewTable(15, 26, 10, 6, 30)
+	table.SetHeaders("CONTAINER", "SESSION", "DURATION", "EXIT", "COMMAND")
+	for _, s := range sessions {
+		duration, exit, command := "-", ui.MutedText("?"), ""
+		if s.Info != nil {
+			duration = s.Info.Duration.Round(time.Second).String()
+			command = s.Info.Header.Command
+			if s.Info.ExitCode != nil {
+				exit = strconv.Itoa(*s.Info.ExitCode)
+				if *s.Info.ExitCode != 0 {
+					exit = ui.ErrorText(exit)
+				}
+			}
+		}
+		table.AddRow(ui.Name(s.Container), s.ID, duration, exit, command)
+	}
+	fmt.Print(table.Render())
+}
+
+func (a *App) sessionsPlayCmd(args []string) {
+	fs := flag.NewFlagSet("sessions play", flag.ExitOnError)
+	speed := fs.Float64("speed", 1, "Playback speed multiplier")
+	idle := fs.Duration("idle-limit", 2*time.Second, "Shorten pauses longer than this (0 to keep them)")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		ui.Error("container name and session required")
+		ui.Muted("Usage: coop sessions play [--speed 2] [--idle-limit 2s] <container> <session>")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(fs.Arg(0))
+	session, err := a.Manager().FindSession(container, fs.Arg(1))
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := recording.PlayOptions{Speed: *speed, MaxIdle: *idle}
+	if err := recording.Play(ctx, session.Path, os.Stdout, opts); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	// Reset attributes the recording may have left set
+	fmt.Print("\033[0m\n")
+}
+
+func (a *App) sessionsRecordCmd(args []string) {
+	if len(args) < 1 {
+		ui.Error("container name required")
+		ui.Muted("Usage: coop sessions record <container> [on|off|default]")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(args[0])
+	mgr := a.Manager()
+
+	if len(args) > 1 {
+		if err := mgr.SetSessionRecording(container, args[1]); err != nil {
+			ui.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	if mgr.RecordsSessions(container) {
+		ui.Successf("Sessions in %s are recorded to %s", ui.Name(container), ui.Path(mgr.SessionDir(container)))
+	} else {
+		ui.Mutedf("Sessions in %s are not recorded", container)
+	}
+}
+
+func printSessionsUsage() {
+	fmt.Println("Usage: coop sessions <subcommand>")
+	fmt.Println("\nSubcommands:")
+	fmt.Println("  list [container]                       List recorded sessions")
+	fmt.Println("  play [options] <container> <session>   Replay a session in the terminal")
+	fmt.Println("  record <container> [on|off|default]    Show or set recording for a container")
+	fmt.Println("\nOptions for 'play':")
+	fmt.Println("  --speed N          Playback speed multiplier (default: 1)")
+	fmt.Println("  --idle-limit DUR   Shorten pauses longer than this (default: 2s)")
+	fmt.Println("\nSessions are recorded with 'coop shell --record' or 'coop exec --record', or")
+	fmt.Println("always when record_sessions is set in settings.json or for the container.")
+	fmt.Println("Recordings are asciicast v2 files that asciinema can also play.")
+}
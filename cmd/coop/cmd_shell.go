@@ -1,12 +1,24 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/creack/pty"
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/state"
 	"github.com/stuffbucket/coop/internal/ui"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
 )
 
 func (a *App) SSHCmd(args []string) {
@@ -31,26 +43,53 @@ func (a *App) SSHCmd(args []string) {
 }
 
 func (a *App) ShellCmd(args []string) {
-	if len(args) < 1 {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	checkpoint := addCheckpointFlags(fs)
+	record := fs.Bool("record", false, "Record the session (see 'coop sessions')")
+	via := fs.String("via", "", "Connect with ssh or exec (default: whichever reaches the container)")
+	forwardAgent := fs.Bool("forward-agent", false, "Make your SSH agent available in the session")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 {
 		ui.Error("container name required")
-		ui.Muted("Usage: coop shell <name> [command...]")
+		ui.Muted("Usage: coop shell [--via ssh|exec] [--forward-agent] [--checkpoint] [--record] <name> [command...]")
 		os.Exit(1)
 	}
 
-	name := a.ValidContainerName(args[0])
-	remoteCmd := args[1:]
+	name := a.ValidContainerName(fs.Arg(0))
+	remoteCmd := fs.Args()[1:]
 
 	mgr := a.Manager()
+	recording := *record || mgr.RecordsSessions(name)
 
-	// For backends where container IPs aren't routable from the host
-	// (e.g. bladerunner), use the Incus exec API instead of SSH.
-	if mgr.UseIncusExec() {
-		exitCode, err := mgr.Shell(name, remoteCmd)
-		if err != nil {
-			ui.Errorf("Error: %v", err)
+	transport, err := mgr.ShellTransport(name, *via)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	sshPath, err := exec.LookPath("ssh")
+	if err != nil && transport != sandbox.TransportExec {
+		if *via == "ssh" {
+			ui.Error("ssh not found in PATH")
 			os.Exit(1)
 		}
-		os.Exit(exitCode)
+		transport = sandbox.TransportExec
+	}
+
+	// Use the Incus exec API when SSH cannot reach the container (e.g.
+	// bladerunner, or macOS without a route to the container network).
+	if transport == sandbox.TransportExec {
+		opts := sandbox.ShellOptions{ForwardAgent: *forwardAgent}
+		run := func() (int, error) { return mgr.Shell(name, remoteCmd, opts) }
+		if recording {
+			run = recordSession(mgr, name, "shell", shellCommandLine(remoteCmd), func(rec io.Writer) (int, error) {
+				recorded := opts
+				recorded.Recorder = rec
+				return mgr.Shell(name, remoteCmd, recorded)
+			})
+		}
+		a.runShell(mgr, name, remoteCmd, checkpoint, run)
 	}
 
 	sshArgs, err := mgr.SSHArgs(name)
@@ -58,16 +97,26 @@ func (a *App) ShellCmd(args []string) {
 		ui.Errorf("Error: %v", err)
 		os.Exit(1)
 	}
+	sandbox.AuditShell(name, remoteCmd, transport, *forwardAgent)
 
+	if *forwardAgent {
+		sshArgs = append([]string{"-A"}, sshArgs...)
+	}
 	if len(remoteCmd) > 0 {
 		sshArgs = append(sshArgs, "--")
 		sshArgs = append(sshArgs, remoteCmd...)
 	}
 
-	sshPath, err := exec.LookPath("ssh")
-	if err != nil {
-		ui.Error("ssh not found in PATH")
-		os.Exit(1)
+	// Checkpointed and recorded sessions need to observe the exit code and
+	// output, so run ssh as a child
+	if checkpoint.enabled || recording {
+		run := func() (int, error) { return runSSH(sshPath, sshArgs, nil) }
+		if recording {
+			run = recordSession(mgr, name, "shell", shellCommandLine(remoteCmd), func(rec io.Writer) (int, error) {
+				return runSSH(sshPath, sshArgs, rec)
+			})
+		}
+		a.runShell(mgr, name, remoteCmd, checkpoint, run)
 	}
 
 	// Replace current process with ssh
@@ -77,19 +126,93 @@ func (a *App) ShellCmd(args []string) {
 	}
 }
 
+// runShell runs a shell session, checkpointed if requested, and exits
+// with its exit code.
+func (a *App) runShell(mgr *sandbox.Manager, name string, remoteCmd []string, checkpoint *checkpointOptions, run func() (int, error)) {
+	if checkpoint.enabled {
+		os.Exit(a.runCheckpointed(mgr, name, shellCommandLine(remoteCmd), checkpoint, run))
+	}
+	exitCode, err := run()
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(exitCode)
+}
+
 func (a *App) ExecCmd(args []string) {
-	if len(args) < 2 {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	checkpoint := addCheckpointFlags(fs)
+	user := fs.String("user", "root", "User to run as: root, agent or a numeric uid")
+	cwd := fs.String("cwd", "", "Working directory (default: the user's home for agent)")
+	var env stringList
+	fs.Var(&env, "env", "Set an environment variable KEY=VALUE (repeatable)")
+	timeout := fs.Duration("timeout", 0, "Kill the command after this long (e.g. 30s, 5m)")
+	detach := fs.Bool("detach", false, "Run as a background job that survives disconnects")
+	record := fs.Bool("record", false, "Record the session (see 'coop sessions')")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 2 {
 		ui.Error("container name and command required")
-		ui.Muted("Usage: coop exec <name> <command> [args...]")
+		ui.Muted("Usage: coop exec [--user agent] [--cwd DIR] [--env K=V] [--timeout 30s] [--checkpoint] [--record | --detach] <name> <command> [args...]")
 		os.Exit(1)
 	}
 
-	name := a.ValidContainerName(args[0])
-	command := args[1:]
+	name := a.ValidContainerName(fs.Arg(0))
+	command := fs.Args()[1:]
+
+	if *detach {
+		a.execDetached(fs, name, command, *cwd, env)
+		return
+	}
+
+	uid, err := sandbox.ParseExecUser(*user)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	vars, err := sandbox.ParseExecEnv(env)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	opts := sandbox.ExecOptions{
+		User:    uid,
+		Cwd:     *cwd,
+		Env:     vars,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Timeout: *timeout,
+	}
 
 	mgr := a.Manager()
 
-	exitCode, err := mgr.Exec(name, command)
+	runExec := func(opts sandbox.ExecOptions) (int, error) {
+		result, err := mgr.Exec(name, command, opts)
+		if errors.Is(err, sandbox.ErrExecTimeout) {
+			ui.Errorf("Error: %v", err)
+			return exitTimeout, nil
+		}
+		if err != nil {
+			return -1, err
+		}
+		return result.ExitCode, nil
+	}
+	run := func() (int, error) { return runExec(opts) }
+	if *record || mgr.RecordsSessions(name) {
+		run = recordSession(mgr, name, "exec", command, func(rec io.Writer) (int, error) {
+			recorded := opts
+			recorded.Stdout = io.MultiWriter(os.Stdout, rec)
+			recorded.Stderr = io.MultiWriter(os.Stderr, rec)
+			return runExec(recorded)
+		})
+	}
+	if checkpoint.enabled {
+		os.Exit(a.runCheckpointed(mgr, name, command, checkpoint, run))
+	}
+
+	exitCode, err := run()
 	if err != nil {
 		ui.Errorf("Error: %v", err)
 		os.Exit(1)
@@ -97,3 +220,218 @@ func (a *App) ExecCmd(args []string) {
 
 	os.Exit(exitCode)
 }
+
+// exitTimeout is the exit code for commands killed by --timeout, matching timeout(1).
+const exitTimeout = 124
+
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// checkpointOptions configures the snapshot taken before exec/shell.
+type checkpointOptions struct {
+	enabled   bool
+	name      string
+	onFailure string // ask, restore or keep
+}
+
+func addCheckpointFlags(fs *flag.FlagSet) *checkpointOptions {
+	opts := &checkpointOptions{}
+	fs.BoolVar(&opts.enabled, "checkpoint", false, "Snapshot the container before running")
+	fs.StringVar(&opts.name, "checkpoint-name", "", "Checkpoint snapshot name (default: checkpoint-<timestamp>)")
+	fs.StringVar(&opts.onFailure, "on-failure", "ask", "With --checkpoint: ask, restore or keep after a failed command")
+	return opts
+}
+
+// runCheckpointed snapshots the container, runs the command, records the
+// outcome in state history and handles rollback if the command fails.
+// Returns the exit code to exit with.
+func (a *App) runCheckpointed(mgr *sandbox.Manager, container string, command []string, opts *checkpointOptions, run func() (int, error)) int {
+	switch opts.onFailure {
+	case "ask", "restore", "keep":
+	default:
+		ui.Errorf("Invalid --on-failure value %q (use ask, restore or keep)", opts.onFailure)
+		return 1
+	}
+
+	snapshotName := opts.name
+	if snapshotName == "" {
+		snapshotName = "checkpoint-" + time.Now().Format("20060102-150405")
+	}
+	snapshotName = a.ValidSnapshotName(snapshotName)
+	cmdLine := strings.Join(command, " ")
+
+	ui.Printf("Creating checkpoint %s of %s...\n", ui.Name(snapshotName), ui.Name(container))
+	if err := mgr.CreateSnapshotWithMode(container, snapshotName, sandbox.SnapshotLive); err != nil {
+		ui.Errorf("Error creating checkpoint: %v", err)
+		return 1
+	}
+
+	instanceDir := filepath.Join(a.Config.Dirs.Data, "instances")
+	tracker, err := state.NewTracker(instanceDir, container, "")
+	if err != nil {
+		ui.Warnf("Checkpoint created but state tracking failed: %v", err)
+	} else if _, err := tracker.RecordSnapshot(snapshotName, "checkpoint before: "+cmdLine); err != nil {
+		ui.Warnf("Checkpoint created but state tracking failed: %v", err)
+	}
+
+	started := time.Now()
+	exitCode, runErr := run()
+	duration := time.Since(started)
+	if runErr != nil {
+		ui.Errorf("Error: %v", runErr)
+		exitCode = 1
+	}
+
+	if tracker != nil {
+		rec := state.ExecRecord{
+			Command:    command,
+			ExitCode:   exitCode,
+			DurationMS: duration.Milliseconds(),
+			Checkpoint: snapshotName,
+			StartedAt:  started,
+		}
+		if _, err := tracker.RecordExec(rec); err != nil {
+			ui.Warnf("State tracking failed: %v", err)
+		}
+	}
+
+	if exitCode == 0 {
+		return 0
+	}
+
+	restore := opts.onFailure == "restore"
+	if opts.onFailure == "ask" && ui.IsInteractive() {
+		restore = ui.Confirm(
+			fmt.Sprintf("Command failed (exit %d). Restore checkpoint %s?", exitCode, snapshotName),
+			"Rolls the container back to its state before the command ran.",
+		)
+	}
+
+	if !restore {
+		ui.Mutedf("Checkpoint kept. Roll back with: coop snapshot restore %s %s", container, snapshotName)
+		return exitCode
+	}
+
+	ui.Printf("Restoring %s to checkpoint %s...\n", ui.Name(container), ui.Name(snapshotName))
+	if err := mgr.RestoreSnapshot(container, snapshotName); err != nil {
+		ui.Errorf("Error restoring checkpoint: %v", err)
+		return exitCode
+	}
+	if tracker != nil {
+		if _, err := tracker.RecordRestore(snapshotName, fmt.Sprintf("%s failed (exit %d)", cmdLine, exitCode)); err != nil {
+			ui.Warnf("State tracking failed: %v", err)
+		}
+	}
+	ui.Successf("Container %s restored to %s", ui.Name(container), ui.Name(snapshotName))
+
+	return exitCode
+}
+
+// recordSession wraps run so the session's output is recorded as an
+// asciicast. run receives the writer to copy output to and returns the
+// exit code, which is stored with the recording.
+func recordSession(mgr *sandbox.Manager, container, kind string, command []string, run func(rec io.Writer) (int, error)) func() (int, error) {
+	return func() (int, error) {
+		width, height, err := term.GetSize(int(os.Stdin.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+
+		rec, session, err := mgr.StartRecording(container, kind, command, width, height)
+		if err != nil {
+			ui.Warnf("Session not recorded: %v", err)
+			return run(io.Discard)
+		}
+
+		exitCode, runErr := run(rec)
+		if runErr != nil {
+			exitCode = -1
+		}
+		if err := rec.Close(exitCode); err != nil {
+			ui.Warnf("Session recording incomplete: %v", err)
+		}
+		ui.Mutedf("Session recorded: coop sessions play %s %s", container, session.ID)
+		return exitCode, runErr
+	}
+}
+
+// shellCommandLine returns the command recorded for a shell session.
+func shellCommandLine(remoteCmd []string) []string {
+	if len(remoteCmd) == 0 {
+		return []string{"shell"}
+	}
+	return remoteCmd
+}
+
+// runSSH runs ssh as a child process and returns its exit code. If rec is
+// non-nil it also receives the session's output; on a terminal ssh then
+// runs on a pseudo-terminal, so it and the remote programs still see one.
+func runSSH(sshPath string, sshArgs []string, rec io.Writer) (int, error) {
+	cmd := exec.Command(sshPath, sshArgs...)
+
+	var err error
+	switch {
+	case rec != nil && term.IsTerminal(int(os.Stdin.Fd())):
+		err = runOnPTY(cmd, rec)
+	case rec != nil:
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = io.MultiWriter(os.Stdout, rec)
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	default:
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// runOnPTY runs cmd on a pseudo-terminal sized like ours, relaying the
+// terminal in raw mode and copying everything cmd writes to rec.
+func runOnPTY(cmd *exec.Cmd, rec io.Writer) error {
+	stdinFd := int(os.Stdin.Fd())
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = ptmx.Close() }()
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, unix.SIGWINCH)
+	defer signal.Stop(resize)
+	go func() {
+		for range resize {
+			_ = pty.InheritSize(os.Stdin, ptmx)
+		}
+	}()
+	resize <- unix.SIGWINCH
+
+	oldState, err := term.MakeRaw(stdinFd)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("failed to set terminal to raw mode: %w", err)
+	}
+	defer func() { _ = term.Restore(stdinFd, oldState) }()
+
+	go func() { _, _ = io.Copy(ptmx, os.Stdin) }()
+	// Reading fails with EIO once ssh exits and the terminal closes
+	_, _ = io.Copy(io.MultiWriter(os.Stdout, rec), ptmx)
+	return cmd.Wait()
+}
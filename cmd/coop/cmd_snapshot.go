@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
+	"github.com/stuffbucket/coop/internal/sandbox"
 	"github.com/stuffbucket/coop/internal/state"
 	"github.com/stuffbucket/coop/internal/ui"
 )
@@ -25,6 +31,10 @@ func (a *App) SnapshotCmd(args []string) {
 		a.snapshotListCmd(args[1:])
 	case "delete", "rm":
 		a.snapshotDeleteCmd(args[1:])
+	case "schedule":
+		a.snapshotScheduleCmd(args[1:])
+	case "diff":
+		a.snapshotDiffCmd(args[1:])
 	default:
 		ui.Errorf("Unknown snapshot subcommand: %s", args[0])
 		printSnapshotUsage()
@@ -35,25 +45,55 @@ func (a *App) SnapshotCmd(args []string) {
 func (a *App) snapshotCreateCmd(args []string) {
 	fs := flag.NewFlagSet("snapshot create", flag.ExitOnError)
 	note := fs.String("note", "", "Optional note about this snapshot")
+	stateful := fs.Bool("stateful", false, "Checkpoint memory and processes without stopping")
+	noStop := fs.Bool("no-stop", false, "Crash-consistent filesystem snapshot without stopping")
 	_ = fs.Parse(args)
 
 	if fs.NArg() < 2 {
 		ui.Error("container name and snapshot name required")
-		ui.Muted("Usage: coop snapshot create <container> <snapshot-name> [--note 'reason']")
+		ui.Muted("Usage: coop snapshot create [options] <container> <snapshot-name>")
+		os.Exit(1)
+	}
+
+	if *stateful && *noStop {
+		ui.Error("--stateful and --no-stop cannot be combined")
 		os.Exit(1)
 	}
 
 	container := fs.Arg(0)
 	snapshotName := fs.Arg(1)
 
+	mode := sandbox.SnapshotStopped
+	switch {
+	case *stateful:
+		mode = sandbox.SnapshotStateful
+	case *noStop:
+		mode = sandbox.SnapshotLive
+	}
+
 	mgr := a.Manager()
 
 	ui.Printf("Creating snapshot %s of %s...\n", ui.Name(snapshotName), ui.Name(container))
-	if err := mgr.CreateSnapshot(container, snapshotName); err != nil {
+	err := mgr.CreateSnapshotWithMode(container, snapshotName, mode)
+	if errors.Is(err, sandbox.ErrStatefulUnsupported) {
+		ui.Warnf("%v", err)
+		ui.Muted("Falling back to a crash-consistent snapshot (processes keep running, memory is not saved)")
+		mode = sandbox.SnapshotLive
+		err = mgr.CreateSnapshotWithMode(container, snapshotName, mode)
+	}
+	if err != nil {
 		ui.Errorf("Error: %v", err)
 		os.Exit(1)
 	}
 
+	if mode != sandbox.SnapshotStopped {
+		if *note != "" {
+			*note = fmt.Sprintf("%s (%s)", *note, mode)
+		} else {
+			*note = string(mode)
+		}
+	}
+
 	instanceDir := filepath.Join(a.Config.Dirs.Data, "instances")
 	tracker, err := state.NewTracker(instanceDir, container, "")
 	if err == nil {
@@ -107,13 +147,20 @@ func (a *App) snapshotListCmd(args []string) {
 		return
 	}
 
-	table := ui.NewTable(25, 20)
-	table.SetHeaders("NAME", "CREATED")
+	a.recordAutoSnapshots(container, snapshots)
+
+	table := ui.NewTable(25, 20, 10)
+	table.SetHeaders("NAME", "CREATED", "TYPE")
 
 	for _, s := range snapshots {
+		kind := "disk"
+		if s.Stateful {
+			kind = "stateful"
+		}
 		table.AddRow(
 			ui.Name(s.Name),
 			s.CreatedAt.Format("2006-01-02 15:04:05"),
+			kind,
 		)
 	}
 
@@ -141,6 +188,164 @@ func (a *App) snapshotDeleteCmd(args []string) {
 	ui.Successf("Snapshot %s deleted", ui.Name(snapshotName))
 }
 
+func (a *App) snapshotScheduleCmd(args []string) {
+	fs := flag.NewFlagSet("snapshot schedule", flag.ExitOnError)
+	every := fs.Duration("every", 0, "Interval between snapshots (e.g. 30m, 1h, 6h)")
+	keep := fs.Int("keep", 12, "Retain automatic snapshots for this many intervals")
+	off := fs.Bool("off", false, "Disable automatic snapshots")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		ui.Error("container name required")
+		ui.Muted("Usage: coop snapshot schedule [--every 30m --keep 12 | --off] <container>")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(fs.Arg(0))
+	mgr := a.Manager()
+
+	switch {
+	case *off:
+		if err := mgr.ClearSnapshotSchedule(container); err != nil {
+			ui.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		ui.Successf("Automatic snapshots disabled for %s", ui.Name(container))
+		return
+
+	case *every > 0:
+		schedule, err := sandbox.NewSnapshotSchedule(*every, *keep)
+		if err != nil {
+			ui.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		if err := mgr.SetSnapshotSchedule(container, schedule); err != nil {
+			ui.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		ui.Successf("Snapshotting %s every %s, keeping each for %s", ui.Name(container), schedule.Every, schedule.Every*time.Duration(schedule.Keep))
+		ui.Mutedf("Snapshots are named %sYYYYMMDD-HHMM and taken without stopping the container", sandbox.AutoSnapshotPrefix)
+		return
+	}
+
+	schedule, err := mgr.GetSnapshotSchedule(container)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	if schedule == nil {
+		ui.Mutedf("No snapshot schedule for %s", container)
+		return
+	}
+
+	if schedule.Every > 0 {
+		fmt.Printf("%s  %s\n", ui.Bold("Every:"), schedule.Every)
+		fmt.Printf("%s  %d (each expires after %s)\n", ui.Bold("Keep:"), schedule.Keep, schedule.Every*time.Duration(schedule.Keep))
+	} else {
+		fmt.Printf("%s  %s\n", ui.Bold("Schedule:"), schedule.Cron)
+		if schedule.Expiry != "" {
+			fmt.Printf("%s  %s\n", ui.Bold("Expiry:"), schedule.Expiry)
+		}
+	}
+
+	if snapshots, err := mgr.ListSnapshots(container); err == nil {
+		a.recordAutoSnapshots(container, snapshots)
+	}
+}
+
+func (a *App) snapshotDiffCmd(args []string) {
+	fs := flag.NewFlagSet("snapshot diff", flag.ExitOnError)
+	prefix := fs.String("path", "/", "Only compare files under this directory")
+	content := fs.Bool("content", false, "Show unified diffs for changed text files")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 2 {
+		ui.Error("container name and snapshot name required")
+		ui.Muted("Usage: coop snapshot diff [--path DIR] [--content] <container> <from> [<to>|live]")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(fs.Arg(0))
+	from := a.diffSnapshotName(fs.Arg(1))
+	to := sandbox.LiveSnapshot
+	if fs.NArg() > 2 {
+		to = a.diffSnapshotName(fs.Arg(2))
+	}
+
+	mgr := a.Manager()
+
+	// Interrupting still deletes the temporary snapshot copies
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ui.Mutedf("Comparing %s..%s under %s", from, to, *prefix)
+	changes, err := mgr.DiffSnapshots(ctx, container, from, to, sandbox.DiffOptions{
+		Prefix:  *prefix,
+		Content: *content,
+	})
+	if errors.Is(err, context.Canceled) {
+		ui.Muted("Interrupted")
+		os.Exit(1)
+	}
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if len(changes) == 0 {
+		ui.Mutedf("No differences")
+		return
+	}
+
+	var added, removed, modified int
+	for _, c := range changes {
+		switch c.Kind {
+		case sandbox.ChangeAdded:
+			added++
+			fmt.Printf("%s %s\n", ui.SuccessText("+"), c.Path)
+		case sandbox.ChangeRemoved:
+			removed++
+			fmt.Printf("%s %s\n", ui.ErrorText("-"), c.Path)
+		case sandbox.ChangeModified:
+			modified++
+			fmt.Printf("%s %s\n", ui.WarningText("~"), c.Path)
+		}
+		if c.Diff != "" {
+			fmt.Print(c.Diff)
+		}
+	}
+
+	ui.Mutedf("%d added, %d removed, %d modified", added, removed, modified)
+}
+
+// diffSnapshotName validates a snapshot argument to diff, which may also be "live".
+func (a *App) diffSnapshotName(name string) string {
+	if name == sandbox.LiveSnapshot {
+		return name
+	}
+	return a.ValidSnapshotName(name)
+}
+
+// recordAutoSnapshots records scheduled snapshots taken by Incus since coop last
+// looked, so they show up in state history alongside manual ones.
+func (a *App) recordAutoSnapshots(container string, snapshots []sandbox.SnapshotInfo) {
+	instanceDir := filepath.Join(a.Config.Dirs.Data, "instances")
+	tracker, err := state.NewTracker(instanceDir, container, "")
+	if err != nil {
+		return
+	}
+
+	for _, s := range snapshots {
+		if !sandbox.IsAutoSnapshot(s.Name) || tracker.HasSnapshot(s.Name) {
+			continue
+		}
+		if _, err := tracker.RecordSnapshot(s.Name, sandbox.AutoSnapshotNote); err != nil {
+			ui.Warnf("State tracking failed for %s: %v", s.Name, err)
+			return
+		}
+	}
+}
+
 func printSnapshotUsage() {
 	fmt.Println("Usage: coop snapshot <subcommand>")
 	fmt.Println("\nSubcommands:")
@@ -148,4 +353,26 @@ func printSnapshotUsage() {
 	fmt.Println("  restore <container> <name>  Restore to a snapshot")
 	fmt.Println("  list <container>            List snapshots")
 	fmt.Println("  delete <container> <name>   Delete a snapshot")
+	fmt.Println("  schedule <container>        Show or set automatic snapshots")
+	fmt.Println("  diff <container> <from> [<to>]")
+	fmt.Println("                              Show files changed between snapshots")
+	fmt.Println("\nOptions for 'create':")
+	fmt.Println("  --note TEXT   Record why the snapshot was taken")
+	fmt.Println("  --stateful    Checkpoint memory and processes (CRIU) without stopping;")
+	fmt.Println("                falls back to --no-stop if the server cannot checkpoint")
+	fmt.Println("  --no-stop     Crash-consistent filesystem snapshot without stopping")
+	fmt.Println("\nBy default a running container is stopped for the snapshot and restarted.")
+	fmt.Println("Restoring a stateful snapshot resumes the saved processes exactly.")
+	fmt.Println("\nOptions for 'schedule':")
+	fmt.Println("  --every DURATION  Snapshot interval; must divide an hour or a day (e.g. 30m, 6h)")
+	fmt.Println("  --keep N          Keep automatic snapshots for N intervals (default: 12)")
+	fmt.Println("  --off             Disable automatic snapshots")
+	fmt.Println("\nScheduled snapshots are taken by Incus as auto-YYYYMMDD-HHMM and expire")
+	fmt.Println("every x keep after they were taken, so a container stopped for a while keeps")
+	fmt.Println("fewer than N. Manual snapshots never expire. 'coop snapshot list' records new")
+	fmt.Println("ones in state history.")
+	fmt.Println("\nOptions for 'diff':")
+	fmt.Println("  --path DIR    Only compare files under DIR (default: /)")
+	fmt.Println("  --content     Show unified diffs for changed text files")
+	fmt.Println("\n<to> defaults to 'live', the container's current filesystem.")
 }
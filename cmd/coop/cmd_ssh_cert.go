@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/sshkeys"
+	"github.com/stuffbucket/coop/internal/ui"
+	"golang.org/x/crypto/ssh"
+)
+
+func (a *App) SSHCertCmd(args []string) {
+	fs := flag.NewFlagSet("ssh-cert", flag.ExitOnError)
+	showCA := fs.Bool("ca", false, "Print the CA public key")
+	issue := fs.Bool("issue", false, "Issue a new certificate before showing it")
+	ttl := fs.Duration("ttl", 0, "Lifetime of an issued certificate (default: ssh.cert_ttl, 8h)")
+	fs.Usage = printSSHCertUsage
+	positional := parseInterleaved(fs, args)
+
+	if *showCA {
+		ca, err := sandbox.EnsureSSHCA()
+		if err != nil {
+			ui.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		fmt.Println(ca)
+		return
+	}
+
+	if len(positional) != 1 {
+		printSSHCertUsage()
+		os.Exit(1)
+	}
+	name := a.ValidContainerName(positional[0])
+
+	if *issue {
+		mgr := a.Manager()
+		lifetime := *ttl
+		if lifetime <= 0 {
+			lifetime = mgr.CertTTL()
+		}
+		if _, err := mgr.IssueSSHCert(name, lifetime, false); err != nil {
+			ui.Errorf("Error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	cp := sshkeys.GetContainerPaths(name)
+	shown := false
+	for _, c := range []struct{ label, path string }{
+		{"Config certificate", cp.Certificate},
+		{"Session certificate", cp.SessionCertificate},
+	} {
+		cert, err := sshkeys.ReadCert(c.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			ui.Warnf("%s: %v", c.label, err)
+			continue
+		}
+		if shown {
+			fmt.Println()
+		}
+		printCert(c.label, c.path, cert)
+		shown = true
+	}
+
+	if !shown {
+		ui.Mutedf("No certificates issued for %s", ui.Name(name))
+		ui.Muted("Issue one with: coop ssh-cert --issue " + name)
+	}
+}
+
+func printCert(label, path string, cert *ssh.Certificate) {
+	validAfter := time.Unix(int64(cert.ValidAfter), 0)
+	validBefore := time.Unix(int64(cert.ValidBefore), 0)
+	status := ui.SuccessText(fmt.Sprintf("valid for %s", time.Until(validBefore).Round(time.Second)))
+	if time.Now().After(validBefore) {
+		status = ui.ErrorText("expired")
+	}
+
+	ui.Printf("%s: %s\n", label, ui.Path(path))
+	ui.Printf("  Key ID:      %s\n", cert.KeyId)
+	ui.Printf("  Serial:      %d\n", cert.Serial)
+	ui.Printf("  Principals:  %s\n", strings.Join(cert.ValidPrincipals, ", "))
+	ui.Printf("  Valid:       %s to %s (%s)\n",
+		validAfter.Format(time.DateTime), validBefore.Format(time.DateTime), status)
+	ui.Printf("  Key:         %s\n", ssh.FingerprintSHA256(cert.Key))
+	ui.Printf("  Signed by:   %s\n", ssh.FingerprintSHA256(cert.SignatureKey))
+}
+
+func printSSHCertUsage() {
+	fmt.Println("Usage: coop ssh-cert [--issue] [--ttl DURATION] <container>")
+	fmt.Println("       coop ssh-cert --ca")
+	fmt.Println("\nShow the SSH certificates coop issued for a container.")
+	fmt.Println("\nOptions:")
+	fmt.Println("  --issue          Issue a new certificate for ~/.ssh/config first")
+	fmt.Println("  --ttl DURATION   Lifetime of the issued certificate (default: 8h)")
+	fmt.Println("  --ca             Print coop's CA public key")
+	fmt.Println("\nEach container has its own key. Coop's CA signs short-lived certificates")
+	fmt.Println("for it that only that container accepts: one per ssh session coop starts,")
+	fmt.Println("and a longer-lived one behind its ~/.ssh/config entry, reissued on start,")
+	fmt.Println("code and 'ssh-config sync'. Deleting a container revokes its key.")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/stuffbucket/coop/internal/sshkeys"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) SSHConfigCmd(args []string) {
+	if len(args) == 0 {
+		printSSHConfigUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "sync":
+		a.sshConfigSyncCmd()
+	case "include":
+		a.sshConfigIncludeCmd(args[1:])
+	default:
+		ui.Errorf("Unknown ssh-config subcommand: %s", args[0])
+		printSSHConfigUsage()
+		os.Exit(1)
+	}
+}
+
+func (a *App) sshConfigSyncCmd() {
+	hosts, err := a.Manager().SyncSSHConfig()
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	ui.Successf("Wrote %d host entries to %s", len(hosts), ui.Path(sshkeys.GetPaths().ConfigFile))
+	for _, h := range hosts {
+		ui.Mutedf("  %s  %s", h.Name, h.IP)
+	}
+	a.ensureSSHInclude()
+}
+
+func (a *App) sshConfigIncludeCmd(args []string) {
+	if len(args) == 0 {
+		status := ui.MutedText("not included")
+		if sshkeys.HasInclude() {
+			status = ui.SuccessText("included")
+		}
+		managed := "ask"
+		if v := a.Config.Settings.SSH.ManageInclude; v != nil {
+			managed = map[bool]string{true: "on", false: "off"}[*v]
+		}
+		ui.Printf("~/.ssh/config: %s (managed: %s)\n", status, managed)
+		return
+	}
+
+	var on bool
+	switch args[0] {
+	case "on":
+		on = true
+	case "off":
+	default:
+		ui.Errorf("Invalid include mode %q (use on or off)", args[0])
+		os.Exit(1)
+	}
+
+	a.Config.Settings.SSH.ManageInclude = &on
+	if err := a.Config.Save(); err != nil {
+		ui.Errorf("Failed to save settings: %v", err)
+		os.Exit(1)
+	}
+
+	if on {
+		a.ensureSSHInclude()
+		return
+	}
+	changed, err := sshkeys.RemoveInclude()
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	if changed {
+		ui.Successf("Removed coop's Include from ~/.ssh/config")
+	}
+}
+
+// ensureSSHInclude keeps ~/.ssh/config including coop's SSH config when
+// the user allows it, asking once if they have not decided yet.
+func (a *App) ensureSSHInclude() {
+	manage := a.Config.Settings.SSH.ManageInclude
+	if manage == nil {
+		if sshkeys.HasInclude() {
+			return
+		}
+		if !ui.IsInteractive() {
+			sshkeys.PrintIncludeHint()
+			return
+		}
+		allow := ui.Confirm("Add coop's SSH config to ~/.ssh/config?",
+			"An Include line lets ssh and remote editors reach containers by name.\n"+
+				"Change this later with 'coop ssh-config include on|off'.")
+		manage = &allow
+		a.Config.Settings.SSH.ManageInclude = manage
+		if err := a.Config.Save(); err != nil {
+			ui.Warnf("Could not save settings: %v", err)
+		}
+	}
+
+	if !*manage {
+		return
+	}
+	changed, err := sshkeys.EnsureInclude()
+	if err != nil {
+		ui.Warnf("Could not update ~/.ssh/config: %v", err)
+		sshkeys.PrintIncludeHint()
+		return
+	}
+	if changed {
+		ui.Successf("Added coop's SSH config to ~/.ssh/config")
+		ui.Mutedf("  Include %s", sshkeys.GetPaths().ConfigFile)
+	}
+}
+
+func printSSHConfigUsage() {
+	fmt.Println("Usage: coop ssh-config <subcommand>")
+	fmt.Println("\nSubcommands:")
+	fmt.Println("  sync              Rebuild coop's SSH config from running containers")
+	fmt.Println("  include [on|off]  Show or set whether ~/.ssh/config includes it")
+	fmt.Println("\nCoop writes a Host entry per container to its own SSH config, adding the")
+	fmt.Println("VM jump host on backends whose container IPs are not routable. With include")
+	fmt.Println("on, coop keeps a single Include line at the top of ~/.ssh/config so")
+	fmt.Println("'ssh <container>' and remote editors work by name. Entries are removed by")
+	fmt.Println("'coop delete'; 'sync' also drops entries for containers deleted elsewhere.")
+}
@@ -97,6 +97,10 @@ func (a *App) stateShowCmd(args []string) {
 	if inst.CurrentSnapshot != "" {
 		fmt.Printf("%s  %s\n", ui.Bold("Current snapshot:"), ui.Name(inst.CurrentSnapshot))
 	}
+	if inst.LastExec != nil {
+		fmt.Printf("%s  %s %s\n", ui.Bold("Last exec:"), strings.Join(inst.LastExec.Command, " "),
+			ui.MutedText(fmt.Sprintf("(exit %d, %s)", inst.LastExec.ExitCode, inst.LastExec.Duration())))
+	}
 
 	hasPackages := len(inst.Packages.Apt) > 0 || len(inst.Packages.Pip) > 0 ||
 		len(inst.Packages.Npm) > 0 || len(inst.Packages.Go) > 0 ||
@@ -145,6 +149,7 @@ func printStateUsage() {
 	fmt.Println("  show <container>                 Show current tracked state")
 	fmt.Println("\nState tracking records:")
 	fmt.Println("  - Snapshots created with 'coop snapshot create'")
+	fmt.Println("  - Commands run with 'coop exec --checkpoint' (exit code, duration)")
 	fmt.Println("  - Base image used to create the container")
 	fmt.Println("  - Git-style history with commit messages")
 }
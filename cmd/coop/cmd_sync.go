@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/filesync"
+	"github.com/stuffbucket/coop/internal/sandbox"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+func (a *App) SyncCmd(args []string) {
+	if len(args) == 0 {
+		printSyncUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		a.syncAddCmd(args[1:])
+	case "remove", "rm":
+		a.syncRemoveCmd(args[1:])
+	case "list", "ls":
+		a.syncListCmd(args[1:])
+	case "now":
+		a.syncNowCmd(args[1:])
+	case "run":
+		a.syncRunCmd(args[1:])
+	default:
+		ui.Errorf("Unknown sync subcommand: %s", args[0])
+		printSyncUsage()
+		os.Exit(1)
+	}
+}
+
+func (a *App) syncAddCmd(args []string) {
+	fs := flag.NewFlagSet("sync add", flag.ExitOnError)
+	name := fs.String("name", "", "Sync name (default: directory basename)")
+	force := fs.Bool("force", false, "Authorize syncing protected directories")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 3 {
+		ui.Error("container name, host directory and container path required")
+		ui.Muted("Usage: coop sync add [options] <container> <hostdir> <path>")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(fs.Arg(0))
+	source, err := filepath.Abs(fs.Arg(1))
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	target := fs.Arg(2)
+
+	syncName := *name
+	if syncName == "" {
+		syncName = filepath.Base(source)
+	}
+	syncName = a.ValidMountName(syncName)
+
+	mgr := a.Manager()
+
+	pair := sandbox.SyncPair{Name: syncName, Source: source, Path: target}
+	if err := mgr.AddSync(container, pair, *force); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	ui.Printf("Syncing %s with %s:%s...\n", ui.Path(source), ui.Name(container), ui.Path(target))
+	pairs, err := mgr.ListSyncs(container)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	for _, p := range pairs {
+		if p.Name == syncName && !runSyncPass(mgr, container, p) {
+			os.Exit(1)
+		}
+	}
+
+	ui.Successf("Sync %s added", ui.Name(syncName))
+	ui.Mutedf("Run 'coop sync run %s' to keep it in sync while you work", container)
+}
+
+func (a *App) syncRemoveCmd(args []string) {
+	if len(args) < 2 {
+		ui.Error("container name and sync name required")
+		ui.Muted("Usage: coop sync remove <container> <name>")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(args[0])
+	syncName := a.ValidMountName(args[1])
+
+	if err := a.Manager().RemoveSync(container, syncName); err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+	ui.Successf("Sync %s removed (files on both sides are kept)", ui.Name(syncName))
+}
+
+func (a *App) syncListCmd(args []string) {
+	if len(args) < 1 {
+		ui.Error("container name required")
+		ui.Muted("Usage: coop sync list <container>")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(args[0])
+	pairs, err := a.Manager().ListSyncs(container)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if len(pairs) == 0 {
+		ui.Mutedf("No syncs found for %s", container)
+		return
+	}
+
+	table := ui.NewTable(15, 40, 5, 30)
+	table.SetHeaders("NAME", "SOURCE", "", "PATH")
+	for _, p := range pairs {
+		table.AddRow(ui.Name(p.Name), p.Source, "<~>", p.Path)
+	}
+	fmt.Print(table.Render())
+}
+
+func (a *App) syncNowCmd(args []string) {
+	if len(args) < 1 {
+		ui.Error("container name required")
+		ui.Muted("Usage: coop sync now <container> [name]")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(args[0])
+	mgr := a.Manager()
+	pairs := a.selectSyncs(mgr, container, args[1:])
+
+	ok := true
+	for _, p := range pairs {
+		ok = runSyncPass(mgr, container, p) && ok
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func (a *App) syncRunCmd(args []string) {
+	fs := flag.NewFlagSet("sync run", flag.ExitOnError)
+	interval := fs.Duration("interval", 5*time.Second, "How often to check the container for changes")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		ui.Error("container name required")
+		ui.Muted("Usage: coop sync run [--interval 5s] <container> [name]")
+		os.Exit(1)
+	}
+
+	container := a.ValidContainerName(fs.Arg(0))
+	mgr := a.Manager()
+	pairs := a.selectSyncs(mgr, container, fs.Args()[1:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, p := range pairs {
+		syncer, closeSync, err := mgr.NewSyncer(container, p)
+		if err != nil {
+			ui.Errorf("%s: %v", p.Name, err)
+			os.Exit(1)
+		}
+		defer closeSync()
+
+		ui.Printf("Watching %s <~> %s:%s\n", ui.Path(p.Source), ui.Name(container), ui.Path(p.Path))
+		wg.Add(1)
+		go func(p sandbox.SyncPair) {
+			defer wg.Done()
+			err := syncer.Watch(ctx, p.Source, *interval, func(result *filesync.Result, err error) {
+				printSyncResult(p.Name, result, err)
+			})
+			if err != nil {
+				ui.Errorf("%s: %v", p.Name, err)
+				stop()
+			}
+		}(p)
+	}
+
+	ui.Muted("Press Ctrl-C to stop")
+	wg.Wait()
+}
+
+// selectSyncs returns all of a container's syncs, or the one named in args.
+func (a *App) selectSyncs(mgr *sandbox.Manager, container string, args []string) []sandbox.SyncPair {
+	pairs, err := mgr.ListSyncs(container)
+	if err != nil {
+		ui.Errorf("Error: %v", err)
+		os.Exit(1)
+	}
+
+	if len(args) > 0 {
+		name := a.ValidMountName(args[0])
+		for _, p := range pairs {
+			if p.Name == name {
+				return []sandbox.SyncPair{p}
+			}
+		}
+		ui.Errorf("Sync %s not found on %s", name, container)
+		os.Exit(1)
+	}
+
+	if len(pairs) == 0 {
+		ui.Mutedf("No syncs found for %s", container)
+		ui.Muted("Add one with: coop sync add <container> <hostdir> <path>")
+		os.Exit(1)
+	}
+	return pairs
+}
+
+// runSyncPass syncs a pair once and prints what happened.
+func runSyncPass(mgr *sandbox.Manager, container string, pair sandbox.SyncPair) bool {
+	syncer, closeSync, err := mgr.NewSyncer(container, pair)
+	if err != nil {
+		ui.Errorf("%s: %v", pair.Name, err)
+		return false
+	}
+	defer closeSync()
+
+	result, err := syncer.Sync()
+	printSyncResult(pair.Name, result, err)
+	if err == nil && len(result.Actions) == 0 {
+		ui.Mutedf("%s: up to date", pair.Name)
+	}
+	return err == nil && len(result.Errors) == 0
+}
+
+func printSyncResult(name string, result *filesync.Result, err error) {
+	if err != nil {
+		ui.Errorf("%s: %v", name, err)
+		return
+	}
+
+	var pushed, pulled, deleted int
+	for _, act := range result.Actions {
+		switch act.Kind {
+		case filesync.Push:
+			pushed++
+		case filesync.Pull:
+			pulled++
+		case filesync.DeleteLocal, filesync.DeleteRemote:
+			deleted++
+		}
+	}
+	if pushed+pulled+deleted > 0 {
+		ui.Printf("%s: %d pushed, %d pulled, %d deleted\n", ui.Name(name), pushed, pulled, deleted)
+	}
+	for _, kept := range result.Conflicts {
+		ui.Warnf("%s: conflict, container version saved as %s", name, kept)
+	}
+	for _, e := range result.Errors {
+		ui.Errorf("%s: %v", name, e)
+	}
+}
+
+func printSyncUsage() {
+	fmt.Println("Usage: coop sync <subcommand>")
+	fmt.Println("\nSubcommands:")
+	fmt.Println("  add [options] <container> <hostdir> <path>   Sync a host directory with the container")
+	fmt.Println("  remove <container> <name>                    Stop syncing (files are kept)")
+	fmt.Println("  list <container>                             List syncs")
+	fmt.Println("  now <container> [name]                       Sync once")
+	fmt.Println("  run [--interval 5s] <container> [name]       Keep syncing until Ctrl-C")
+	fmt.Println("\nOptions for 'add':")
+	fmt.Println("  --name NAME      Sync name (default: directory basename)")
+	fmt.Println("  --force          Authorize syncing protected directories")
+	fmt.Println("\nUse sync instead of 'coop mount' on bladerunner and remote backends, where")
+	fmt.Println("the container cannot see host directories. Host changes are pushed as they")
+	fmt.Println("happen and container changes are pulled every interval. Paths matched by")
+	fmt.Println(".gitignore are skipped. When a file changes on both sides the host wins")
+	fmt.Println("and the container's version is kept as <name>.sync-conflict-<time>.")
+}
@@ -59,10 +59,38 @@ func main() {
 		app.ShellCmd(args)
 	case "ssh":
 		app.SSHCmd(args)
+	case "code":
+		app.CodeCmd(args)
+	case "ssh-config":
+		app.SSHConfigCmd(args)
+	case "ssh-cert":
+		app.SSHCertCmd(args)
 	case "exec":
 		app.ExecCmd(args)
+	case "jobs":
+		app.JobsCmd(args)
+	case "job":
+		app.JobCmd(args)
+	case "attach":
+		app.AttachCmd(args)
+	case "sessions":
+		app.SessionsCmd(args)
 	case "mount":
 		app.MountCmd(args)
+	case "cp":
+		app.CpCmd(args)
+	case "sync":
+		app.SyncCmd(args)
+	case "forward":
+		app.ForwardCmd(args)
+	case "expose":
+		app.ExposeCmd(args)
+	case "seatbelt":
+		app.SeatbeltCmd(args)
+	case "audit":
+		app.AuditCmd(args)
+	case "approvals":
+		app.ApprovalsCmd(args)
 	case "snapshot":
 		app.SnapshotCmd(args)
 	case "config":
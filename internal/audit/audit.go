@@ -0,0 +1,419 @@
+// Package audit keeps a tamper-evident log of security-sensitive operations.
+//
+// The log is JSON lines. Each entry carries the hash of the one before it
+// and its own HMAC-SHA256 over that hash and its contents, keyed with a
+// secret kept in the coop config directory, which containers can never
+// reach. Editing, removing or reordering an entry breaks the chain from
+// there on, and a head file recording the last entry catches truncation.
+//
+// Appends continue the chain from the log's last entry; the head is only
+// a check against it. A crash between writing the log and the head leaves
+// the head behind, which the next append repairs.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/filelock"
+)
+
+// Outcome is how an audited operation ended.
+type Outcome string
+
+const (
+	OutcomeOK     Outcome = "ok"
+	OutcomeFailed Outcome = "failed"
+	// OutcomeDenied means authorization was refused.
+	OutcomeDenied Outcome = "denied"
+)
+
+// Entry is one audited operation.
+type Entry struct {
+	Seq       int64             `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Actor     string            `json:"actor"`
+	Op        string            `json:"op"`
+	Container string            `json:"container,omitempty"`
+	Args      map[string]string `json:"args,omitempty"`
+	Outcome   Outcome           `json:"outcome"`
+	Error     string            `json:"error,omitempty"`
+	// Auth is how the operation was authorized, e.g. "totp"; empty when
+	// it needed no authorization.
+	Auth string `json:"auth,omitempty"`
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// Log is an audit log file with its head file and key.
+type Log struct {
+	path    string
+	keyPath string
+}
+
+// Open returns the log at path, keyed with the secret at keyPath. Both
+// are created on first append.
+func Open(path, keyPath string) *Log {
+	return &Log{path: path, keyPath: keyPath}
+}
+
+// Path returns the log file path.
+func (l *Log) Path() string {
+	return l.path
+}
+
+func (l *Log) headPath() string {
+	return strings.TrimSuffix(l.path, filepath.Ext(l.path)) + ".head"
+}
+
+// Append chains e onto the log, filling in its sequence number, time,
+// actor and hashes, and returns the stored entry.
+func (l *Log) Append(e Entry) (Entry, error) {
+	key, err := l.key(true)
+	if err != nil {
+		return e, err
+	}
+
+	err = filelock.With(l.path, func() error {
+		seq, prev, err := l.tail()
+		if err != nil {
+			return err
+		}
+		// A head ahead of the log records entries that were removed; keep
+		// it so Verify still reports them.
+		keepHead := l.truncated(seq, prev)
+
+		e.Seq = seq + 1
+		e.Prev = prev
+		if e.Time.IsZero() {
+			e.Time = time.Now().UTC()
+		}
+		if e.Actor == "" {
+			e.Actor = currentActor()
+		}
+		if e.Outcome == "" {
+			e.Outcome = OutcomeOK
+		}
+		if e.Hash, err = sign(key, e); err != nil {
+			return err
+		}
+
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return fmt.Errorf("open audit log: %w", err)
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("write audit log: %w", err)
+		}
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("write audit log: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("write audit log: %w", err)
+		}
+		if keepHead {
+			return nil
+		}
+		return l.writeHead(e.Seq, e.Hash)
+	})
+	return e, err
+}
+
+// Entries reads every entry without verifying the chain.
+func (l *Log) Entries() ([]Entry, error) {
+	var entries []Entry
+	err := l.scan(func(_ int, e Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return entries, err
+}
+
+// ChainError reports where verification found the log altered.
+type ChainError struct {
+	Line   int   // 1-based line in the log file; 0 for the head file
+	Seq    int64 // Sequence number of the entry, when it could be read
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	if e.Line == 0 {
+		return "audit log head: " + e.Reason
+	}
+	return fmt.Sprintf("audit log line %d (seq %d): %s", e.Line, e.Seq, e.Reason)
+}
+
+// Verify checks the whole chain and returns the number of entries. Any
+// alteration is reported as a *ChainError.
+func (l *Log) Verify() (int, error) {
+	key, err := l.key(false)
+	if err != nil {
+		if _, statErr := os.Stat(l.path); os.IsNotExist(statErr) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	headSeq, headHash, headErr := l.readHead()
+
+	var count int
+	var lastSeq int64
+	var lastHash, hashAtHead string
+	err = l.scan(func(lineNo int, e Entry) error {
+		fail := func(format string, args ...any) error {
+			return &ChainError{Line: lineNo, Seq: e.Seq, Reason: fmt.Sprintf(format, args...)}
+		}
+		if e.Seq != lastSeq+1 {
+			return fail("expected seq %d", lastSeq+1)
+		}
+		if e.Prev != lastHash {
+			return fail("does not follow the previous entry")
+		}
+		want, err := sign(key, e)
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal([]byte(want), []byte(e.Hash)) {
+			return fail("contents do not match the hash")
+		}
+		count++
+		lastSeq, lastHash = e.Seq, e.Hash
+		if e.Seq == headSeq {
+			hashAtHead = e.Hash
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return count, err
+	}
+
+	// The head may trail the log after a crash, but must match an entry
+	switch {
+	case os.IsNotExist(headErr) && count == 0:
+		return 0, nil
+	case os.IsNotExist(headErr):
+		return count, &ChainError{Reason: "missing, but the log has entries"}
+	case headErr != nil:
+		return count, &ChainError{Reason: headErr.Error()}
+	case headSeq > lastSeq:
+		return count, &ChainError{Reason: fmt.Sprintf("records seq %d but the log ends at seq %d; entries were removed", headSeq, lastSeq)}
+	case headHash != hashAtHead:
+		return count, &ChainError{Reason: fmt.Sprintf("does not match the entry at seq %d; entries were replaced", headSeq)}
+	}
+	return count, nil
+}
+
+// scan calls fn for each entry in file order.
+func (l *Log) scan(fn func(line int, e Entry) error) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return &ChainError{Line: lineNo, Reason: "not a valid entry: " + err.Error()}
+		}
+		if err := fn(lineNo, e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// tail returns the sequence number and hash of the log's last entry, or
+// zero and "" for an empty log. A partial line left by an interrupted
+// append is cut off first.
+func (l *Log) tail() (int64, string, error) {
+	f, err := os.OpenFile(l.path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	end, err := lastNewline(f, info.Size())
+	if err != nil {
+		return 0, "", err
+	}
+	if end+1 < info.Size() {
+		if err := f.Truncate(end + 1); err != nil {
+			return 0, "", fmt.Errorf("repair audit log: %w", err)
+		}
+	}
+	if end < 0 {
+		return 0, "", nil
+	}
+
+	start, err := lastNewline(f, end)
+	if err != nil {
+		return 0, "", err
+	}
+	line := make([]byte, end-start-1)
+	if _, err := f.ReadAt(line, start+1); err != nil {
+		return 0, "", err
+	}
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return 0, "", fmt.Errorf("last audit log entry is not valid: %w", err)
+	}
+	return e.Seq, e.Hash, nil
+}
+
+// lastNewline returns the offset of the last newline before offset
+// before, or -1 if there is none.
+func lastNewline(f *os.File, before int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := before; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i), nil
+		}
+		end = start
+	}
+	return -1, nil
+}
+
+// truncated reports whether the head contradicts the log's last entry,
+// seq with hash: it is ahead, at seq with another hash, unreadable, or
+// missing although the log has entries.
+func (l *Log) truncated(seq int64, hash string) bool {
+	headSeq, headHash, err := l.readHead()
+	if err != nil {
+		return seq > 0 || !os.IsNotExist(err)
+	}
+	return headSeq > seq || (headSeq == seq && headHash != hash)
+}
+
+func (l *Log) readHead() (int64, string, error) {
+	data, err := os.ReadFile(l.headPath())
+	if err != nil {
+		return 0, "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0, "", errors.New("malformed head file")
+	}
+	seq, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed head file: %w", err)
+	}
+	return seq, fields[1], nil
+}
+
+func (l *Log) writeHead(seq int64, hash string) error {
+	tmp := l.headPath() + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("write audit head: %w", err)
+	}
+	if _, err := fmt.Fprintf(f, "%d %s\n", seq, hash); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write audit head: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write audit head: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write audit head: %w", err)
+	}
+	return os.Rename(tmp, l.headPath())
+}
+
+// key loads the HMAC key, creating it if asked to.
+func (l *Log) key(create bool) ([]byte, error) {
+	data, err := os.ReadFile(l.keyPath)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("invalid audit key %s", l.keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("read audit key: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate audit key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.keyPath), 0o700); err != nil {
+		return nil, fmt.Errorf("create config dir: %w", err)
+	}
+	// O_EXCL so two processes racing to create it agree on one key.
+	f, err := os.OpenFile(l.keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if os.IsExist(err) {
+		return l.key(false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write audit key: %w", err)
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("write audit key: %w", err)
+	}
+	return key, f.Close()
+}
+
+// sign computes an entry's hash over everything but the hash itself.
+func sign(key []byte, e Entry) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func currentActor() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,228 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestLog(t *testing.T, entries int) *Log {
+	t.Helper()
+	dir := t.TempDir()
+	l := Open(filepath.Join(dir, "audit.jsonl"), filepath.Join(dir, "audit.key"))
+	for i := 0; i < entries; i++ {
+		if _, err := l.Append(Entry{Op: "exec", Container: "web", Args: map[string]string{"command": "ls"}}); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+	return l
+}
+
+func TestAppendChains(t *testing.T) {
+	l := newTestLog(t, 3)
+
+	entries, err := l.Entries()
+	if err != nil {
+		t.Fatalf("Entries() error: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if e.Seq != int64(i+1) {
+			t.Errorf("entry %d seq = %d", i, e.Seq)
+		}
+		if i > 0 && e.Prev != entries[i-1].Hash {
+			t.Errorf("entry %d prev = %q, want %q", i, e.Prev, entries[i-1].Hash)
+		}
+		if e.Actor == "" || e.Outcome != OutcomeOK || e.Time.IsZero() {
+			t.Errorf("entry %d not filled in: %+v", i, e)
+		}
+	}
+	if entries[0].Prev != "" {
+		t.Errorf("first entry prev = %q, want empty", entries[0].Prev)
+	}
+
+	if n, err := l.Verify(); err != nil || n != 3 {
+		t.Errorf("Verify() = %d, %v; want 3, nil", n, err)
+	}
+}
+
+func TestVerifyEmpty(t *testing.T) {
+	l := newTestLog(t, 0)
+	if n, err := l.Verify(); err != nil || n != 0 {
+		t.Errorf("Verify() on missing log = %d, %v", n, err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, l *Log, lines []string)
+		line   int
+	}{
+		{
+			name: "edited entry",
+			tamper: func(t *testing.T, l *Log, lines []string) {
+				lines[1] = strings.Replace(lines[1], `"container":"web"`, `"container":"api"`, 1)
+				writeLines(t, l.path, lines)
+			},
+			line: 2,
+		},
+		{
+			name: "removed entry",
+			tamper: func(t *testing.T, l *Log, lines []string) {
+				writeLines(t, l.path, append(lines[:1:1], lines[2:]...))
+			},
+			line: 2,
+		},
+		{
+			name: "reordered entries",
+			tamper: func(t *testing.T, l *Log, lines []string) {
+				lines[0], lines[1] = lines[1], lines[0]
+				writeLines(t, l.path, lines)
+			},
+			line: 1,
+		},
+		{
+			name: "truncated log",
+			tamper: func(t *testing.T, l *Log, lines []string) {
+				writeLines(t, l.path, lines[:2])
+			},
+		},
+		{
+			name: "truncated with head removed, then appended",
+			tamper: func(t *testing.T, l *Log, lines []string) {
+				writeLines(t, l.path, lines[:2])
+				if err := os.Remove(l.headPath()); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := l.Append(Entry{Op: "exec"}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "truncated, then appended",
+			tamper: func(t *testing.T, l *Log, lines []string) {
+				writeLines(t, l.path, lines[:1])
+				for range 3 {
+					if _, err := l.Append(Entry{Op: "exec"}); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+		},
+		{
+			name: "forged without the key",
+			tamper: func(t *testing.T, l *Log, lines []string) {
+				forged := Open(filepath.Join(t.TempDir(), "audit.jsonl"), filepath.Join(t.TempDir(), "audit.key"))
+				for range 3 {
+					if _, err := forged.Append(Entry{Op: "exec"}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				data, err := os.ReadFile(forged.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(l.path, data, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			line: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLog(t, 3)
+			data, err := os.ReadFile(l.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(t, l, strings.Split(strings.TrimSpace(string(data)), "\n"))
+
+			_, err = l.Verify()
+			var chainErr *ChainError
+			if !errors.As(err, &chainErr) {
+				t.Fatalf("Verify() error = %v, want *ChainError", err)
+			}
+			if chainErr.Line != tt.line {
+				t.Errorf("Verify() flagged line %d, want %d (%v)", chainErr.Line, tt.line, err)
+			}
+		})
+	}
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendRecovers(t *testing.T) {
+	tests := []struct {
+		name  string
+		crash func(t *testing.T, l *Log, lines []string)
+	}{
+		{
+			name: "head not written",
+			crash: func(t *testing.T, l *Log, lines []string) {
+				head, err := os.ReadFile(l.headPath())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := l.Append(Entry{Op: "exec"}); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(l.headPath(), head, 0o600); err != nil {
+					t.Fatal(err)
+				}
+				// A trailing head still verifies
+				if n, err := l.Verify(); err != nil || n != 4 {
+					t.Errorf("Verify() with a trailing head = %d, %v; want 4, nil", n, err)
+				}
+			},
+		},
+		{
+			name: "partial line",
+			crash: func(t *testing.T, l *Log, lines []string) {
+				f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := f.WriteString(`{"seq":4,"op":"ex`); err != nil {
+					t.Fatal(err)
+				}
+				_ = f.Close()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLog(t, 3)
+			data, err := os.ReadFile(l.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.crash(t, l, strings.Split(strings.TrimSpace(string(data)), "\n"))
+
+			e, err := l.Append(Entry{Op: "exec"})
+			if err != nil {
+				t.Fatalf("Append() after a crash: %v", err)
+			}
+			n, err := l.Verify()
+			if err != nil {
+				t.Fatalf("Verify() after recovery: %v", err)
+			}
+			if int64(n) != e.Seq {
+				t.Errorf("Verify() = %d entries, last seq %d", n, e.Seq)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+#!/usr/bin/env python3
+"""Ask the coop host for something only it can grant.
+
+Requests wait in 'coop approvals ls' until the user approves them, with a
+one-time authorization code, or denies them.
+"""
+
+import argparse
+import http.client
+import json
+import socket
+import sys
+import time
+
+SOCKET = "/var/lib/coop-request.sock"
+TOKEN_FILE = "/etc/coop/request-token"
+
+
+class Connection(http.client.HTTPConnection):
+    """HTTP over the Unix socket Incus relays to the host."""
+
+    def __init__(self):
+        super().__init__("coop", timeout=30)
+
+    def connect(self):
+        self.sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        self.sock.settimeout(self.timeout)
+        self.sock.connect(SOCKET)
+
+
+def fail(message):
+    print("coop-request: " + message, file=sys.stderr)
+    sys.exit(1)
+
+
+def call(method, path, body=None):
+    try:
+        with open(TOKEN_FILE) as f:
+            token = f.read().strip()
+    except OSError:
+        fail("this container was not set up to send requests to coop")
+
+    conn = Connection()
+    try:
+        conn.request(
+            method,
+            path,
+            body=None if body is None else json.dumps(body),
+            headers={"Authorization": "Bearer " + token, "Content-Type": "application/json"},
+        )
+        resp = conn.getresponse()
+        data = json.loads(resp.read() or b"{}")
+    except (OSError, ValueError) as e:
+        fail("coop is not listening (%s); ask the user to run 'coop approvals serve'" % e)
+    finally:
+        conn.close()
+    if resp.status >= 400:
+        fail(data.get("error", resp.reason))
+    return data
+
+
+def report(req):
+    status = req["status"]
+    if status == "approved":
+        print("approved: " + req.get("result", req["id"]))
+        return 0
+    if status == "pending":
+        print("pending: %s (check with 'coop-request status %s')" % (req["id"], req["id"]))
+        return 0
+    message = "%s: %s" % (status, req["id"])
+    if req.get("error"):
+        message += " (" + req["error"] + ")"
+    print(message, file=sys.stderr)
+    return 1
+
+
+def main():
+    parser = argparse.ArgumentParser(prog="coop-request", description=__doc__.splitlines()[0])
+    parser.add_argument("--reason", default="", help="why the agent needs it, shown to the user")
+    parser.add_argument("--no-wait", action="store_true", help="print the request id and exit")
+    parser.add_argument("--timeout", type=int, default=600, help="seconds to wait for a decision")
+    sub = parser.add_subparsers(dest="kind", required=True)
+
+    mount = sub.add_parser("mount", help="mount a host directory")
+    mount.add_argument("source", help="absolute host path")
+    mount.add_argument("path", nargs="?", default="", help="path in the container (default: /home/agent/<name>)")
+    mount.add_argument("--readonly", action="store_true")
+
+    expose = sub.add_parser("expose", help="reach a host port from the container")
+    expose.add_argument("port", help="host port")
+    expose.add_argument("container_port", nargs="?", default="", help="container port (default: same)")
+
+    secret = sub.add_parser("secret", help="receive a secret from the user")
+    secret.add_argument("name", help="secret name, e.g. GITHUB_TOKEN")
+
+    status = sub.add_parser("status", help="show a request")
+    status.add_argument("id")
+
+    args = parser.parse_args()
+
+    if args.kind == "status":
+        return report(call("GET", "/v1/requests/" + args.id))
+
+    if args.kind == "mount":
+        fields = {"source": args.source, "path": args.path, "readonly": str(args.readonly).lower()}
+    elif args.kind == "expose":
+        fields = {"port": args.port, "container_port": args.container_port}
+    else:
+        fields = {"name": args.name}
+    fields = {k: v for k, v in fields.items() if v}
+
+    req = call("POST", "/v1/requests", {"kind": args.kind, "args": fields, "reason": args.reason})
+    if args.no_wait:
+        return report(req)
+
+    print("waiting for approval of %s (%s)..." % (req["id"], req["summary"]), file=sys.stderr)
+    deadline = time.time() + args.timeout
+    while req["status"] == "pending" and time.time() < deadline:
+        time.sleep(2)
+        req = call("GET", "/v1/requests/" + req["id"])
+    return report(req)
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -4,6 +4,7 @@ package cloudinit
 import (
 	"bytes"
 	"embed"
+	"encoding/base64"
 	"fmt"
 	"regexp"
 	"strings"
@@ -13,11 +14,38 @@ import (
 //go:embed templates/*.tmpl
 var templateFS embed.FS
 
+// requestHelper is coop-request, which agents use to ask the host for
+// mounts, ports and secrets.
+//
+//go:embed scripts/coop-request.py
+var requestHelper []byte
+
 // Config holds the configuration for generating cloud-init user-data.
 type Config struct {
 	Hostname  string
-	SSHPubKey string
+	SSHPubKey string // Extra key authorized for the agent user, if any
 	AgentPort int
+	NoSudo    bool // Leave the agent user without sudo
+
+	// SSH certificate authentication: sshd trusts SSHUserCA for
+	// certificates naming SSHPrincipal and rejects SSHRevokedKeys.
+	SSHUserCA      string
+	SSHPrincipal   string
+	SSHRevokedKeys []string
+
+	// RequestToken identifies the container to 'coop approvals serve'.
+	// When set, coop-request is installed.
+	RequestToken string
+
+	// Engine installs Docker or Podman ("docker", "podman") with
+	// EngineStorageDriver and preloads hello-world for offline checks.
+	Engine              string
+	EngineStorageDriver string
+}
+
+// RequestHelper returns coop-request base64-encoded for write_files.
+func (Config) RequestHelper() string {
+	return base64.StdEncoding.EncodeToString(requestHelper)
 }
 
 // DefaultConfig returns a Config with sensible defaults.
@@ -34,6 +62,15 @@ var hostnameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,61}[a-z0-9]$|^[a-z0
 // sshPubKeyRegex validates SSH public key format (type key comment).
 var sshPubKeyRegex = regexp.MustCompile(`^(ssh-ed25519|ssh-rsa|ecdsa-sha2-nistp256|ecdsa-sha2-nistp384|ecdsa-sha2-nistp521) AAAA[0-9A-Za-z+/]+=* ?[\w@.-]*$`)
 
+// principalRegex validates SSH certificate principals.
+var principalRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{0,127}$`)
+
+// requestTokenRegex validates request tokens (hex).
+var requestTokenRegex = regexp.MustCompile(`^[0-9a-f]{32,128}$`)
+
+// storageDriverRegex validates engine storage driver names.
+var storageDriverRegex = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+
 // ValidateHostname checks if hostname is DNS-safe.
 func ValidateHostname(hostname string) error {
 	if hostname == "" {
@@ -73,6 +110,30 @@ func Generate(cfg Config) (string, error) {
 	if err := ValidateSSHPubKey(cfg.SSHPubKey); err != nil {
 		return "", fmt.Errorf("invalid SSH key: %w", err)
 	}
+	if err := ValidateSSHPubKey(cfg.SSHUserCA); err != nil {
+		return "", fmt.Errorf("invalid SSH CA key: %w", err)
+	}
+	if cfg.SSHUserCA != "" && !principalRegex.MatchString(cfg.SSHPrincipal) {
+		return "", fmt.Errorf("invalid SSH principal %q", cfg.SSHPrincipal)
+	}
+	for _, key := range cfg.SSHRevokedKeys {
+		if err := ValidateSSHPubKey(key); err != nil {
+			return "", fmt.Errorf("invalid revoked SSH key: %w", err)
+		}
+	}
+
+	if cfg.RequestToken != "" && !requestTokenRegex.MatchString(cfg.RequestToken) {
+		return "", fmt.Errorf("invalid request token")
+	}
+	switch cfg.Engine {
+	case "":
+	case "docker", "podman":
+		if !storageDriverRegex.MatchString(cfg.EngineStorageDriver) {
+			return "", fmt.Errorf("invalid storage driver %q", cfg.EngineStorageDriver)
+		}
+	default:
+		return "", fmt.Errorf("unknown container engine %q", cfg.Engine)
+	}
 
 	tmplData, err := templateFS.ReadFile("templates/userdata.yaml.tmpl")
 	if err != nil {
@@ -1,8 +1,12 @@
 package cloudinit
 
 import (
+	"bytes"
+	"encoding/base64"
 	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v2"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -75,6 +79,70 @@ func TestGenerateWithoutSSHKey(t *testing.T) {
 	}
 }
 
+func TestGenerateWithSSHCA(t *testing.T) {
+	cfg := Config{
+		Hostname:     "ca-sandbox",
+		AgentPort:    8888,
+		SSHUserCA:    "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAACA",
+		SSHPrincipal: "coop-ca-sandbox",
+		SSHRevokedKeys: []string{
+			"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAOLD1",
+			"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAOLD2",
+		},
+	}
+
+	output, err := Generate(cfg)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if strings.Contains(output, "ssh_authorized_keys") {
+		t.Error("Output should not authorize a static key when only the CA is given")
+	}
+
+	var doc struct {
+		WriteFiles []struct {
+			Path    string `yaml:"path"`
+			Content string `yaml:"content"`
+		} `yaml:"write_files"`
+	}
+	if err := yaml.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatalf("Output is not valid YAML: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range doc.WriteFiles {
+		files[f.Path] = f.Content
+	}
+
+	want := map[string]string{
+		"/etc/ssh/coop_user_ca.pub":      cfg.SSHUserCA + "\n",
+		"/etc/ssh/coop_principals/agent": "coop-ca-sandbox\n",
+		"/etc/ssh/coop_revoked_keys":     strings.Join(cfg.SSHRevokedKeys, "\n") + "\n",
+	}
+	for path, content := range want {
+		if files[path] != content {
+			t.Errorf("%s = %q, want %q", path, files[path], content)
+		}
+	}
+	if !strings.Contains(files["/etc/ssh/sshd_config.d/90-coop-ca.conf"], "TrustedUserCAKeys /etc/ssh/coop_user_ca.pub") {
+		t.Error("sshd should trust the coop CA")
+	}
+
+	// sshd rejects every key if RevokedKeys names a missing file
+	cfg.SSHRevokedKeys = nil
+	output, err = Generate(cfg)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if !strings.Contains(output, "path: /etc/ssh/coop_revoked_keys") {
+		t.Error("Revoked keys file should be written even when empty")
+	}
+
+	cfg.SSHPrincipal = "bad principal"
+	if _, err := Generate(cfg); err == nil {
+		t.Error("Generate() accepted an invalid principal")
+	}
+}
+
 func TestGenerateContainsSecurityHardening(t *testing.T) {
 	output, err := Generate(DefaultConfig())
 	if err != nil {
@@ -176,3 +244,145 @@ func BenchmarkGenerate(b *testing.B) {
 		_, _ = Generate(cfg)
 	}
 }
+
+func TestGenerateWithRequestToken(t *testing.T) {
+	cfg := DefaultConfig()
+	output, err := Generate(cfg)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if strings.Contains(output, "coop-request") {
+		t.Error("coop-request should only be installed with a request token")
+	}
+
+	cfg.RequestToken = strings.Repeat("ab", 32)
+	output, err = Generate(cfg)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+
+	var doc struct {
+		WriteFiles []struct {
+			Path        string `yaml:"path"`
+			Content     string `yaml:"content"`
+			Encoding    string `yaml:"encoding"`
+			Permissions string `yaml:"permissions"`
+		} `yaml:"write_files"`
+	}
+	if err := yaml.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatalf("Output is not valid YAML: %v", err)
+	}
+	found := 0
+	for _, f := range doc.WriteFiles {
+		switch f.Path {
+		case "/usr/local/bin/coop-request":
+			script, err := base64.StdEncoding.DecodeString(f.Content)
+			if f.Encoding != "b64" || err != nil || !bytes.Equal(script, requestHelper) || f.Permissions != "0755" {
+				t.Errorf("coop-request not installed intact: encoding %q, permissions %q, err %v", f.Encoding, f.Permissions, err)
+			}
+			found++
+		case "/etc/coop/request-token":
+			if f.Content != cfg.RequestToken+"\n" {
+				t.Errorf("request token = %q", f.Content)
+			}
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("found %d of the coop-request files", found)
+	}
+
+	cfg.RequestToken = "token\nruncmd: [reboot]"
+	if _, err := Generate(cfg); err == nil {
+		t.Error("Generate() accepted an invalid request token")
+	}
+}
+
+func TestGenerateWithoutSudo(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.NoSudo = true
+	output, err := Generate(cfg)
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	for _, grant := range []string{"NOPASSWD", "groups: [sudo", "-aG sudo"} {
+		if strings.Contains(output, grant) {
+			t.Errorf("Output should not grant sudo: found %q", grant)
+		}
+	}
+	if !strings.Contains(output, "rm -f /etc/sudoers.d/agent") {
+		t.Error("Output should remove sudo rights the image may carry")
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatalf("Output is not valid YAML: %v", err)
+	}
+}
+
+func TestGenerateWithEngine(t *testing.T) {
+	tests := []struct {
+		engine, driver string
+		path, config   string
+		runcmd         []string
+	}{
+		{"docker", "overlay2", "/etc/docker/daemon.json", `"storage-driver": "overlay2"`,
+			[]string{"docker.io docker-compose-v2", "usermod -aG docker agent", "docker pull hello-world"}},
+		{"podman", "vfs", "/etc/containers/storage.conf", `driver = "vfs"`,
+			[]string{"install -y -q podman", "podman pull docker.io/library/hello-world"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.engine, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Engine = tt.engine
+			cfg.EngineStorageDriver = tt.driver
+			output, err := Generate(cfg)
+			if err != nil {
+				t.Fatalf("Generate() failed: %v", err)
+			}
+
+			var doc struct {
+				WriteFiles []struct {
+					Path    string `yaml:"path"`
+					Content string `yaml:"content"`
+				} `yaml:"write_files"`
+				RunCmd []string `yaml:"runcmd"`
+			}
+			if err := yaml.Unmarshal([]byte(output), &doc); err != nil {
+				t.Fatalf("Output is not valid YAML: %v", err)
+			}
+			found := false
+			for _, f := range doc.WriteFiles {
+				if f.Path == tt.path {
+					found = strings.Contains(f.Content, tt.config)
+				}
+			}
+			if !found {
+				t.Errorf("%s does not set %s", tt.path, tt.config)
+			}
+			runcmd := strings.Join(doc.RunCmd, "\n")
+			for _, want := range tt.runcmd {
+				if !strings.Contains(runcmd, want) {
+					t.Errorf("runcmd missing %q", want)
+				}
+			}
+		})
+	}
+
+	output, err := Generate(DefaultConfig())
+	if err != nil {
+		t.Fatalf("Generate() failed: %v", err)
+	}
+	if strings.Contains(output, "apt-get") {
+		t.Error("apt-get should only run with an engine")
+	}
+
+	for _, cfg := range []Config{
+		{Hostname: "test", Engine: "lxd", EngineStorageDriver: "overlay2"},
+		{Hostname: "test", Engine: "docker", EngineStorageDriver: "overlay2\"}\nruncmd: [reboot]"},
+	} {
+		if _, err := Generate(cfg); err == nil {
+			t.Errorf("Generate() accepted engine %q with driver %q", cfg.Engine, cfg.EngineStorageDriver)
+		}
+	}
+}
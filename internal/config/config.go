@@ -87,6 +87,13 @@ type Settings struct {
 	FallbackImage   string `json:"fallback_image,omitempty"`
 	// FallbackFingerprint must match the local alias used for fallback_image.
 	FallbackFingerprint string `json:"fallback_fingerprint,omitempty"`
+	// DefaultSecurity is the security tier of new containers: "strict",
+	// "standard" or "dev". Default: "standard"
+	DefaultSecurity string `json:"default_security,omitempty"`
+
+	// RecordSessions records every shell and exec session as an asciicast
+	// under Logs/sessions. Containers can override it with 'coop sessions record'.
+	RecordSessions bool `json:"record_sessions,omitempty"`
 
 	// Incus connection (auto-detected if empty)
 	IncusSocket string `json:"incus_socket,omitempty"`
@@ -100,6 +107,15 @@ type Settings struct {
 	// Network/discovery settings
 	Network NetworkSettings `json:"network,omitempty"`
 
+	// SSH client integration settings
+	SSH SSHSettings `json:"ssh,omitempty"`
+
+	// Seatbelt authorization settings
+	Seatbelt SeatbeltSettings `json:"seatbelt,omitempty"`
+
+	// Agent request approval settings
+	Approvals ApprovalsSettings `json:"approvals,omitempty"`
+
 	// UI settings
 	UI UISettings `json:"ui,omitempty"`
 
@@ -195,6 +211,40 @@ type NetworkSettings struct {
 	HostsFile string `json:"hosts_file,omitempty"`
 }
 
+// SSHSettings configures how coop integrates with the user's OpenSSH client.
+type SSHSettings struct {
+	// ManageInclude lets coop keep an Include of its SSH config in ~/.ssh/config
+	// so 'ssh <container>' and remote editors work by name.
+	// Default: unset (coop asks once and remembers the answer)
+	ManageInclude *bool `json:"manage_include,omitempty"`
+
+	// CertTTL is how long the SSH certificates behind ~/.ssh/config entries
+	// stay valid, as a Go duration. They are reissued on start, code and sync.
+	// Default: "8h"
+	CertTTL string `json:"cert_ttl,omitempty"`
+}
+
+// SeatbeltSettings configures how authorization codes for --force reach the user.
+type SeatbeltSettings struct {
+	// AuthChannels lists where codes are delivered: "notify" (desktop
+	// notification), "dbus" (freedesktop notification over the session bus),
+	// "authenticator" (an app enrolled with 'coop seatbelt enroll') and
+	// "file" (AuthFile, for tests and scripts).
+	// Default: the platform's notifications, plus authenticator once enrolled
+	AuthChannels []string `json:"auth_channels,omitempty"`
+
+	// AuthFile is the file or FIFO the file channel writes codes to.
+	AuthFile string `json:"auth_file,omitempty"`
+}
+
+// ApprovalsSettings configures how agents reach 'coop approvals serve'.
+type ApprovalsSettings struct {
+	// Port is the host port 'coop approvals serve' listens on for
+	// containers in a Colima or Lima VM. Local Incus uses a Unix socket.
+	// Default: 7787
+	Port int `json:"port,omitempty"`
+}
+
 // UISettings configures user interface preferences.
 type UISettings struct {
 	// Theme sets the color scheme (default, solarized, dracula, gruvbox, nord)
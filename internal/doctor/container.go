@@ -0,0 +1,534 @@
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContainerInfo describes the container under inspection.
+type ContainerInfo struct {
+	Name         string
+	Status       string // Incus status, e.g. "Running"
+	Engine       string // "docker", "podman" or "" when created without --with
+	Backend      string // VM backend, or "" for local Incus
+	Transport    string // How coop shell reaches it: "ssh", "ssh-proxy" or "exec"
+	IP           string
+	RootSize     int64 // Root disk quota in bytes, 0 if none
+	ProcessLimit int   // limits.processes, 0 if none
+	Mounts       []Mount
+	Config       map[string]string
+}
+
+// Mount is a host directory mounted into the container.
+type Mount struct {
+	Name     string
+	Source   string // Host path
+	Path     string // Path inside the container
+	Readonly bool
+}
+
+// ContainerProbe runs commands inside the container under inspection.
+type ContainerProbe interface {
+	// Run executes a command as root and returns its combined output and
+	// exit code. A non-zero exit is not an error.
+	Run(command []string, timeout time.Duration) (output string, exitCode int, err error)
+	// Start starts the stopped container.
+	Start() error
+}
+
+const (
+	// probeTimeout bounds quick checks; a hung service fails its check
+	// rather than the whole run.
+	probeTimeout = 15 * time.Second
+	// engineProbeTimeout allows for a container engine starting its first container.
+	engineProbeTimeout = 60 * time.Second
+	// remedyTimeout allows for remedies that download or clean up.
+	remedyTimeout = 5 * time.Minute
+)
+
+// connectivityHost is resolved and fetched to check DNS and outbound
+// access; agents need it for code and tools.
+const connectivityHost = "github.com"
+
+// RunContainer executes the health checks for one container. Checks after
+// the first need it running.
+func RunContainer(info ContainerInfo, probe ContainerProbe) *Report {
+	report := &Report{}
+
+	running := checkContainerRunning(info, probe)
+	report.Results = append(report.Results, running)
+	if running.Status != StatusPass {
+		return report
+	}
+
+	report.Results = append(report.Results, checkCloudInit(info, probe))
+	report.Results = append(report.Results, checkAgentUser(info, probe))
+	report.Results = append(report.Results, checkIDMap(info, probe))
+	report.Results = append(report.Results, checkSSHD(info, probe))
+	report.Results = append(report.Results, checkDNS(info, probe))
+	report.Results = append(report.Results, checkOutbound(info, probe))
+	report.Results = append(report.Results, checkDiskUsage(info, probe))
+	report.Results = append(report.Results, checkProcesses(info, probe))
+	report.Results = append(report.Results, checkToolchain(info, probe))
+	report.Results = append(report.Results, checkContainerEngine(info, probe)...)
+	return report
+}
+
+func checkContainerRunning(info ContainerInfo, probe ContainerProbe) CheckResult {
+	if info.Status == "Running" {
+		return CheckResult{Name: "Container", Status: StatusPass, Message: info.Name + " is running"}
+	}
+	return CheckResult{
+		Name:    "Container",
+		Status:  StatusFail,
+		Message: fmt.Sprintf("%s is %s", info.Name, strings.ToLower(info.Status)),
+		Fix:     "coop start " + info.Name,
+		Remedy:  probe.Start,
+	}
+}
+
+func checkCloudInit(info ContainerInfo, probe ContainerProbe) CheckResult {
+	result := CheckResult{Name: "Cloud-init"}
+	output, _, err := probe.Run([]string{"cloud-init", "status", "--long"}, probeTimeout)
+	if err != nil {
+		result.Status = StatusFail
+		result.Message = "cannot read status: " + err.Error()
+		return result
+	}
+
+	status := "unknown"
+	for line := range strings.Lines(output) {
+		if value, ok := strings.CutPrefix(line, "status:"); ok {
+			status = strings.TrimSpace(value)
+			break
+		}
+	}
+
+	switch status {
+	case "done":
+		result.Status = StatusPass
+		result.Message = "finished"
+	case "running", "not started":
+		result.Status = StatusWarn
+		result.Message = "still " + status
+		result.Fix = fmt.Sprintf("coop exec %s cloud-init status --wait", info.Name)
+	default:
+		result.Status = StatusFail
+		result.Message = "status " + status
+		result.Fix = fmt.Sprintf("coop exec %s cat /var/log/cloud-init-output.log", info.Name)
+	}
+	return result
+}
+
+func checkAgentUser(info ContainerInfo, probe ContainerProbe) CheckResult {
+	output, code, err := probe.Run([]string{"id", "-u", "agent"}, probeTimeout)
+	uid := strings.TrimSpace(output)
+	if err == nil && code == 0 && uid == "1000" {
+		return CheckResult{Name: "Agent user", Status: StatusPass, Message: "agent is UID 1000"}
+	}
+	message := "no agent user"
+	if err == nil && code == 0 {
+		message = "agent is UID " + uid + ", want 1000"
+	}
+	return CheckResult{
+		Name:    "Agent user",
+		Status:  StatusFail,
+		Message: message,
+		Fix:     "rebuild the base image with 'coop image build' and recreate the container",
+	}
+}
+
+// checkIDMap writes a file as the agent through a mount and checks the
+// host sees it owned by the UID raw.idmap maps the agent to.
+func checkIDMap(info ContainerInfo, probe ContainerProbe) CheckResult {
+	result := CheckResult{Name: "UID mapping"}
+
+	var hostUID, agentUID int
+	if _, err := fmt.Sscanf(info.Config["raw.idmap"], "both %d %d", &hostUID, &agentUID); err != nil {
+		result.Status = StatusSkip
+		result.Message = "no UID mapping on this backend"
+		return result
+	}
+
+	mount, ok := writableMount(info.Mounts)
+	if !ok {
+		result.Status = StatusSkip
+		result.Message = "no writable mount to test (add one with --workdir or coop mount)"
+		return result
+	}
+
+	name := fmt.Sprintf(".coop-doctor-%d", time.Now().UnixNano())
+	inside := path.Join(mount.Path, name)
+	output, code, err := probe.Run(asAgent("touch", inside), probeTimeout)
+	if err != nil || code != 0 {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("agent cannot write to %s: %s", mount.Path, probeError(output, err))
+		result.Fix = fmt.Sprintf("coop exec %s ls -ln %s", info.Name, mount.Path)
+		return result
+	}
+	defer func() { _, _, _ = probe.Run([]string{"rm", "-f", inside}, probeTimeout) }()
+
+	fi, err := os.Stat(filepath.Join(mount.Source, name))
+	if err != nil {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("cannot see the test file under %s: %v", mount.Source, err)
+		return result
+	}
+	owner, ok := fileOwner(fi)
+	if !ok {
+		result.Status = StatusSkip
+		result.Message = "file ownership is not available on this platform"
+		return result
+	}
+	if owner != hostUID {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("agent files in %s are owned by UID %d on the host, want %d", mount.Path, owner, hostUID)
+		result.Fix = fmt.Sprintf("coop stop %s && coop start %s", info.Name, info.Name)
+		return result
+	}
+	result.Status = StatusPass
+	result.Message = fmt.Sprintf("agent files in %s are yours on the host", mount.Path)
+	return result
+}
+
+// writableMount picks the mount to test, preferring the workspace.
+func writableMount(mounts []Mount) (Mount, bool) {
+	var found Mount
+	ok := false
+	for _, m := range mounts {
+		if m.Readonly || m.Source == "" || m.Path == "" {
+			continue
+		}
+		if m.Name == "workspace" {
+			return m, true
+		}
+		if !ok || m.Path < found.Path {
+			found, ok = m, true
+		}
+	}
+	return found, ok
+}
+
+// checkSSHD checks sshd runs and can be reached the way coop shell would.
+func checkSSHD(info ContainerInfo, probe ContainerProbe) CheckResult {
+	result := CheckResult{Name: "SSH"}
+	output, _, err := probe.Run([]string{"systemctl", "is-active", "ssh"}, probeTimeout)
+	if state := strings.TrimSpace(output); err != nil || state != "active" {
+		result.Status = StatusFail
+		result.Message = "sshd is not running: " + probeError(output, err)
+		result.Fix = fmt.Sprintf("coop exec %s systemctl restart ssh", info.Name)
+		result.Remedy = runRemedy(probe, "systemctl", "restart", "ssh")
+		return result
+	}
+
+	switch info.Transport {
+	case "ssh":
+		result.Status = StatusPass
+		result.Message = fmt.Sprintf("reachable at %s:22", info.IP)
+	case "ssh-proxy":
+		result.Status = StatusPass
+		result.Message = fmt.Sprintf("reachable through the %s jump host", info.Backend)
+	default:
+		if info.Backend == "bladerunner" {
+			result.Status = StatusPass
+			result.Message = "running; shells use Incus exec on bladerunner"
+			return result
+		}
+		result.Status = StatusWarn
+		result.Message = "not reachable from this machine; shells fall back to Incus exec"
+		result.Fix = "check the route to the container network with 'coop doctor'"
+	}
+	return result
+}
+
+func checkDNS(info ContainerInfo, probe ContainerProbe) CheckResult {
+	output, code, err := probe.Run([]string{"getent", "hosts", connectivityHost}, probeTimeout)
+	if err == nil && code == 0 {
+		return CheckResult{Name: "DNS", Status: StatusPass, Message: "resolves " + connectivityHost}
+	}
+	return CheckResult{
+		Name:    "DNS",
+		Status:  StatusFail,
+		Message: fmt.Sprintf("cannot resolve %s: %s", connectivityHost, probeError(output, err)),
+		Fix:     fmt.Sprintf("coop exec %s systemctl restart systemd-resolved", info.Name),
+		Remedy:  runRemedy(probe, "systemctl", "restart", "systemd-resolved"),
+	}
+}
+
+func checkOutbound(info ContainerInfo, probe ContainerProbe) CheckResult {
+	url := "https://" + connectivityHost
+	output, code, err := probe.Run([]string{"curl", "-sS", "-o", "/dev/null", "--max-time", "10", url}, probeTimeout)
+	if err == nil && code == 0 {
+		return CheckResult{Name: "Outbound", Status: StatusPass, Message: url + " reachable"}
+	}
+	return CheckResult{
+		Name:    "Outbound",
+		Status:  StatusFail,
+		Message: fmt.Sprintf("cannot reach %s: %s", url, probeError(output, err)),
+		Fix:     "check the Incus network and host connectivity with 'coop doctor'",
+	}
+}
+
+// checkDiskUsage compares root filesystem use with the root disk quota,
+// or the filesystem size where the pool sets none.
+func checkDiskUsage(info ContainerInfo, probe ContainerProbe) CheckResult {
+	result := CheckResult{Name: "Disk"}
+	output, code, err := probe.Run([]string{"df", "-B1", "--output=size,used", "/"}, probeTimeout)
+	var size, used int64
+	if err == nil && code == 0 {
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		fields := strings.Fields(lines[len(lines)-1])
+		if len(fields) == 2 {
+			size, _ = strconv.ParseInt(fields[0], 10, 64)
+			used, _ = strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	if size <= 0 {
+		result.Status = StatusWarn
+		result.Message = "cannot read usage: " + probeError(output, err)
+		return result
+	}
+	if info.RootSize > 0 && info.RootSize < size {
+		size = info.RootSize
+	}
+
+	pct := used * 100 / size
+	result.Message = fmt.Sprintf("%s of %s used (%d%%)", formatBytes(uint64(used)), formatBytes(uint64(size)), pct)
+	switch {
+	case pct >= 95:
+		result.Status = StatusFail
+	case pct >= 80:
+		result.Status = StatusWarn
+	default:
+		result.Status = StatusPass
+		return result
+	}
+	result.Fix = fmt.Sprintf("coop exec %s sh -c 'apt-get clean && journalctl --vacuum-size=50M'", info.Name)
+	result.Remedy = runRemedy(probe, "sh", "-c", "apt-get clean && journalctl --vacuum-size=50M")
+	return result
+}
+
+// checkProcesses compares the container's task count with limits.processes.
+func checkProcesses(info ContainerInfo, probe ContainerProbe) CheckResult {
+	result := CheckResult{Name: "Processes"}
+	output, _, err := probe.Run([]string{"sh", "-c", "cat /sys/fs/cgroup/pids.current 2>/dev/null || ls -d /proc/[0-9]* | wc -l"}, probeTimeout)
+	count, convErr := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil || convErr != nil {
+		result.Status = StatusWarn
+		result.Message = "cannot count processes: " + probeError(output, err)
+		return result
+	}
+	if info.ProcessLimit <= 0 {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf("%d running, no limit set", count)
+		return result
+	}
+
+	pct := count * 100 / info.ProcessLimit
+	result.Message = fmt.Sprintf("%d of %d", count, info.ProcessLimit)
+	switch {
+	case pct >= 95:
+		result.Status = StatusFail
+	case pct >= 80:
+		result.Status = StatusWarn
+	default:
+		result.Status = StatusPass
+		return result
+	}
+	result.Fix = fmt.Sprintf("look for runaway processes with 'coop exec %s ps -ef --forest'", info.Name)
+	return result
+}
+
+// toolchain lists the tools agents expect, with the command printing each
+// version. Claude Code is installed per container, in the agent's home.
+// Each runs as the agent, so a tool only root can run counts as missing.
+var toolchain = []struct {
+	name    string
+	command []string
+}{
+	{"git", []string{"git", "--version"}},
+	{"python", []string{"python3", "--version"}},
+	{"node", []string{"node", "--version"}},
+	{"go", []string{"/usr/local/go/bin/go", "version"}},
+	{"gh", []string{"gh", "--version"}},
+	{"claude", []string{"/home/agent/.local/bin/claude", "--version"}},
+}
+
+// claudeInstall is the cloud-init step installing Claude Code.
+const claudeInstall = "curl -fsSL https://claude.ai/install.sh | bash"
+
+var versionRegex = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+func checkToolchain(info ContainerInfo, probe ContainerProbe) CheckResult {
+	result := CheckResult{Name: "Toolchain"}
+	var versions, missing []string
+	for _, tool := range toolchain {
+		output, code, err := probe.Run(asAgent(tool.command...), probeTimeout)
+		version := versionRegex.FindString(output)
+		if err != nil || code != 0 || version == "" {
+			missing = append(missing, tool.name)
+			continue
+		}
+		versions = append(versions, tool.name+" "+version)
+	}
+
+	result.Message = strings.Join(versions, ", ")
+	if len(missing) == 0 {
+		result.Status = StatusPass
+		return result
+	}
+	result.Status = StatusWarn
+	result.Message = "missing " + strings.Join(missing, ", ")
+	if len(versions) > 0 {
+		result.Message += "; " + strings.Join(versions, ", ")
+	}
+	if len(missing) == 1 && missing[0] == "claude" {
+		result.Fix = fmt.Sprintf("coop exec %s su - agent -c '%s'", info.Name, claudeInstall)
+		result.Remedy = runRemedy(probe, "su", "-", "agent", "-c", claudeInstall)
+	} else {
+		result.Fix = "rebuild the base image with 'coop image build' and recreate the container"
+	}
+	return result
+}
+
+// checkContainerEngine confirms a nested engine's instance config, daemon
+// and an offline run of the hello-world image preloaded by cloud-init.
+func checkContainerEngine(info ContainerInfo, probe ContainerProbe) []CheckResult {
+	engine := info.Engine
+	if engine == "" {
+		return []CheckResult{{
+			Name:    "Container engine",
+			Status:  StatusSkip,
+			Message: "none (create with --with docker|podman)",
+		}}
+	}
+
+	results := []CheckResult{checkEngineConfig(info)}
+
+	version := []string{"docker", "version", "--format", "{{.Server.Version}}"}
+	if engine == "podman" {
+		version = []string{"podman", "version", "--format", "{{.Version}}"}
+	}
+	output, code, err := probe.Run(version, engineProbeTimeout)
+	if err != nil || code != 0 {
+		result := CheckResult{
+			Name:    engineTitle(engine),
+			Status:  StatusFail,
+			Message: "not working: " + probeError(output, err),
+			Fix:     fmt.Sprintf("coop exec %s cloud-init status --long", info.Name),
+		}
+		if engine == "docker" {
+			result.Fix = fmt.Sprintf("coop exec %s systemctl restart docker", info.Name)
+			result.Remedy = runRemedy(probe, "systemctl", "restart", "docker")
+		}
+		return append(results, result)
+	}
+	results = append(results, CheckResult{
+		Name:    engineTitle(engine),
+		Status:  StatusPass,
+		Message: "version " + strings.TrimSpace(output),
+	})
+
+	image := "hello-world"
+	if engine == "podman" {
+		image = "docker.io/library/hello-world"
+	}
+	run := []string{engine, "run", "--rm", "--network", "none", "--pull", "never", image}
+	output, code, err = probe.Run(run, engineProbeTimeout)
+	if err != nil || code != 0 || !strings.Contains(output, "Hello from Docker!") {
+		results = append(results, CheckResult{
+			Name:    "Offline run",
+			Status:  StatusFail,
+			Message: engine + " run hello-world failed: " + probeError(output, err),
+			Fix:     fmt.Sprintf("coop exec %s %s pull %s", info.Name, engine, image),
+			Remedy:  runRemedy(probe, engine, "pull", image),
+		})
+		return results
+	}
+	results = append(results, CheckResult{
+		Name:    "Offline run",
+		Status:  StatusPass,
+		Message: engine + " run hello-world works without network",
+	})
+	return results
+}
+
+// checkEngineConfig checks the Incus keys an engine needs are still set.
+func checkEngineConfig(info ContainerInfo) CheckResult {
+	want := []string{
+		"security.nesting",
+		"security.syscalls.intercept.mknod",
+		"security.syscalls.intercept.setxattr",
+	}
+	var missing []string
+	for _, key := range want {
+		if info.Config[key] != "true" {
+			missing = append(missing, key)
+		}
+	}
+	if info.Config["linux.kernel_modules"] == "" {
+		missing = append(missing, "linux.kernel_modules")
+	}
+	// raw.seccomp replaces the policy Incus generates, interception included
+	if _, ok := info.Config["raw.seccomp"]; ok {
+		return CheckResult{
+			Name:    "Engine config",
+			Status:  StatusFail,
+			Message: "raw.seccomp overrides syscall interception",
+			Fix:     fmt.Sprintf("recreate with 'coop create --with %s'", info.Engine),
+		}
+	}
+	if len(missing) > 0 {
+		return CheckResult{
+			Name:    "Engine config",
+			Status:  StatusFail,
+			Message: "missing " + strings.Join(missing, ", "),
+			Fix:     fmt.Sprintf("recreate with 'coop create --with %s'", info.Engine),
+		}
+	}
+	return CheckResult{Name: "Engine config", Status: StatusPass, Message: "nesting, syscall interception and kernel modules set"}
+}
+
+func engineTitle(engine string) string {
+	if engine == "podman" {
+		return "Podman"
+	}
+	return "Docker"
+}
+
+// asAgent wraps a command to run as the agent rather than root.
+func asAgent(command ...string) []string {
+	return append([]string{"runuser", "-u", "agent", "--"}, command...)
+}
+
+// runRemedy returns a Remedy running command in the container as root.
+func runRemedy(probe ContainerProbe, command ...string) func() error {
+	return func() error {
+		output, code, err := probe.Run(command, remedyTimeout)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("%s exited with %d: %s", command[0], code, probeError(output, nil))
+		}
+		return nil
+	}
+}
+
+// probeError condenses a failed command to its last line of output.
+func probeError(output string, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return last
+	}
+	return "no output"
+}
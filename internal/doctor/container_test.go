@@ -0,0 +1,379 @@
+package doctor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProbe answers commands by their first two words, or for commands
+// run as the agent by "runuser" and the command's first word.
+type fakeProbe struct {
+	results map[string]fakeResult
+	ran     []string
+	started bool
+	onRun   func(command []string)
+}
+
+type fakeResult struct {
+	output string
+	code   int
+	err    error
+}
+
+func (p *fakeProbe) Run(command []string, timeout time.Duration) (string, int, error) {
+	p.ran = append(p.ran, strings.Join(command, " "))
+	if p.onRun != nil {
+		p.onRun(command)
+	}
+	key := strings.Join(command[:2], " ")
+	if command[0] == "runuser" {
+		key = "runuser " + command[4]
+	}
+	r, ok := p.results[key]
+	if !ok {
+		return "", 127, nil
+	}
+	return r.output, r.code, r.err
+}
+
+func (p *fakeProbe) Start() error {
+	p.started = true
+	return nil
+}
+
+// healthyProbe answers like a freshly created container, overridden by
+// results.
+func healthyProbe(results map[string]fakeResult) *fakeProbe {
+	p := &fakeProbe{results: map[string]fakeResult{
+		"cloud-init status":                     {output: "status: done\nextended_status: done\n"},
+		"id -u":                                 {output: "1000\n"},
+		"systemctl is-active":                   {output: "active\n"},
+		"getent hosts":                          {output: "140.82.112.3    github.com\n"},
+		"curl -sS":                              {},
+		"df -B1":                                {output: "   1B-blocks        Used\n21474836480  4294967296\n"},
+		"sh -c":                                 {output: "42\n"},
+		"runuser git":                           {output: "git version 2.34.1\n"},
+		"runuser python3":                       {output: "Python 3.13.1\n"},
+		"runuser node":                          {output: "v24.1.0\n"},
+		"runuser /usr/local/go/bin/go":          {output: "go version go1.24.0 linux/arm64\n"},
+		"runuser gh":                            {output: "gh version 2.74.0 (2025-06-01)\n"},
+		"runuser /home/agent/.local/bin/claude": {output: "1.0.30 (Claude Code)\n"},
+		"docker version":                        {output: "27.5.1\n"},
+		"docker run":                            {output: "\nHello from Docker!\nThis message shows that your installation appears to be working correctly.\n"},
+		"podman version":                        {output: "4.9.3\n"},
+		"podman run":                            {output: "Hello from Docker!\n"},
+	}}
+	for k, v := range results {
+		p.results[k] = v
+	}
+	return p
+}
+
+func engineConfig() map[string]string {
+	return map[string]string{
+		"user.coop.engine":                     "docker",
+		"security.nesting":                     "true",
+		"security.syscalls.intercept.mknod":    "true",
+		"security.syscalls.intercept.setxattr": "true",
+		"linux.kernel_modules":                 "overlay,br_netfilter",
+	}
+}
+
+func running(info ContainerInfo) ContainerInfo {
+	info.Name = "c1"
+	info.Status = "Running"
+	if info.Transport == "" {
+		info.Transport = "ssh"
+	}
+	info.IP = "10.0.0.5"
+	info.ProcessLimit = 500
+	return info
+}
+
+func resultsByName(report *Report) map[string]CheckResult {
+	got := make(map[string]CheckResult)
+	for _, r := range report.Results {
+		got[r.Name] = r
+	}
+	return got
+}
+
+func TestRunContainerHealthy(t *testing.T) {
+	report := RunContainer(running(ContainerInfo{}), healthyProbe(nil))
+	for _, r := range report.Results {
+		if r.Status == StatusFail || r.Status == StatusWarn {
+			t.Errorf("%s = %v: %s", r.Name, r.Status, r.Message)
+		}
+	}
+	got := resultsByName(report)
+	for _, name := range []string{"Container", "Cloud-init", "Agent user", "UID mapping", "SSH", "DNS", "Outbound", "Disk", "Processes", "Toolchain", "Container engine"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("missing check %s", name)
+		}
+	}
+	if msg := got["Toolchain"].Message; !strings.Contains(msg, "go 1.24.0") || !strings.Contains(msg, "claude 1.0.30") {
+		t.Errorf("Toolchain message = %q", msg)
+	}
+	if msg := got["Disk"].Message; !strings.Contains(msg, "(20%)") {
+		t.Errorf("Disk message = %q", msg)
+	}
+}
+
+func TestRunContainerStopped(t *testing.T) {
+	probe := healthyProbe(nil)
+	report := RunContainer(ContainerInfo{Name: "c1", Status: "Stopped"}, probe)
+	if len(report.Results) != 1 || report.Results[0].Status != StatusFail {
+		t.Fatalf("got %+v, want only a failed Container check", report.Results)
+	}
+	if len(probe.ran) != 0 {
+		t.Errorf("ran %v in a stopped container", probe.ran)
+	}
+	if err := report.Results[0].Remedy(); err != nil || !probe.started {
+		t.Errorf("Remedy should start the container: %v", err)
+	}
+}
+
+func TestRunContainerChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    ContainerInfo
+		results map[string]fakeResult
+		want    map[string]CheckStatus
+		remedy  bool // The failing check can fix itself
+	}{
+		{
+			name:    "cloud-init error",
+			results: map[string]fakeResult{"cloud-init status": {output: "status: error\n", code: 1}},
+			want:    map[string]CheckStatus{"Cloud-init": StatusFail},
+		},
+		{
+			name:    "cloud-init running",
+			results: map[string]fakeResult{"cloud-init status": {output: "status: running\n"}},
+			want:    map[string]CheckStatus{"Cloud-init": StatusWarn},
+		},
+		{
+			name:    "wrong agent uid",
+			results: map[string]fakeResult{"id -u": {output: "1001\n"}},
+			want:    map[string]CheckStatus{"Agent user": StatusFail},
+		},
+		{
+			name:    "sshd down",
+			results: map[string]fakeResult{"systemctl is-active": {output: "inactive\n", code: 3}},
+			want:    map[string]CheckStatus{"SSH": StatusFail},
+			remedy:  true,
+		},
+		{
+			name: "ssh unreachable",
+			info: ContainerInfo{Transport: "exec"},
+			want: map[string]CheckStatus{"SSH": StatusWarn},
+		},
+		{
+			name: "bladerunner exec",
+			info: ContainerInfo{Transport: "exec", Backend: "bladerunner"},
+			want: map[string]CheckStatus{"SSH": StatusPass},
+		},
+		{
+			name:    "dns down",
+			results: map[string]fakeResult{"getent hosts": {code: 2}},
+			want:    map[string]CheckStatus{"DNS": StatusFail},
+			remedy:  true,
+		},
+		{
+			name:    "offline",
+			results: map[string]fakeResult{"curl -sS": {output: "curl: (7) Failed to connect", code: 7}},
+			want:    map[string]CheckStatus{"Outbound": StatusFail},
+		},
+		{
+			name:    "disk nearly full",
+			results: map[string]fakeResult{"df -B1": {output: "1B-blocks Used\n100 85\n"}},
+			want:    map[string]CheckStatus{"Disk": StatusWarn},
+			remedy:  true,
+		},
+		{
+			name:    "disk full against quota",
+			info:    ContainerInfo{RootSize: 4 << 30},
+			results: map[string]fakeResult{"df -B1": {output: "1B-blocks Used\n107374182400 4187593113\n"}},
+			want:    map[string]CheckStatus{"Disk": StatusFail},
+			remedy:  true,
+		},
+		{
+			name:    "process limit",
+			results: map[string]fakeResult{"sh -c": {output: "490\n"}},
+			want:    map[string]CheckStatus{"Processes": StatusFail},
+		},
+		{
+			name:    "claude missing",
+			results: map[string]fakeResult{"runuser /home/agent/.local/bin/claude": {code: 127}},
+			want:    map[string]CheckStatus{"Toolchain": StatusWarn},
+			remedy:  true,
+		},
+		{
+			name:    "node missing",
+			results: map[string]fakeResult{"runuser node": {code: 127}},
+			want:    map[string]CheckStatus{"Toolchain": StatusWarn},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := RunContainer(running(tt.info), healthyProbe(tt.results))
+			got := resultsByName(report)
+			for name, status := range tt.want {
+				r, ok := got[name]
+				if !ok {
+					t.Errorf("missing check %s", name)
+					continue
+				}
+				if r.Status != status {
+					t.Errorf("%s = %v (%s), want %v", name, r.Status, r.Message, status)
+				}
+				if status != StatusPass && (r.Remedy != nil) != tt.remedy {
+					t.Errorf("%s has remedy %v, want %v", name, r.Remedy != nil, tt.remedy)
+				}
+			}
+		})
+	}
+}
+
+func TestRunContainerEngine(t *testing.T) {
+	rawSeccomp := engineConfig()
+	rawSeccomp["raw.seccomp"] = "2\ndenylist\n[all]\nbpf errno 38\n"
+
+	tests := []struct {
+		name    string
+		info    ContainerInfo
+		stopped bool
+		results map[string]fakeResult
+		want    map[string]CheckStatus
+		remedy  bool // The failing check can fix itself
+	}{
+		{
+			name: "healthy",
+			info: ContainerInfo{Engine: "docker", Config: engineConfig()},
+			want: map[string]CheckStatus{"Container": StatusPass, "Engine config": StatusPass, "Docker": StatusPass, "Offline run": StatusPass},
+		},
+		{
+			name:    "stopped",
+			info:    ContainerInfo{Engine: "docker", Config: engineConfig()},
+			stopped: true,
+			want:    map[string]CheckStatus{"Container": StatusFail},
+			remedy:  true,
+		},
+		{
+			name: "no engine",
+			want: map[string]CheckStatus{"Container": StatusPass, "Container engine": StatusSkip},
+		},
+		{
+			name:    "daemon down",
+			info:    ContainerInfo{Engine: "docker", Config: engineConfig()},
+			results: map[string]fakeResult{"docker version": {output: "Cannot connect to the Docker daemon", code: 1}},
+			want:    map[string]CheckStatus{"Container": StatusPass, "Engine config": StatusPass, "Docker": StatusFail},
+			remedy:  true,
+		},
+		{
+			name:    "podman down",
+			info:    ContainerInfo{Engine: "podman", Config: engineConfig()},
+			results: map[string]fakeResult{"podman version": {output: "cannot find runtime", code: 125}},
+			want:    map[string]CheckStatus{"Engine config": StatusPass, "Podman": StatusFail},
+		},
+		{
+			name:    "image not preloaded",
+			info:    ContainerInfo{Engine: "docker", Config: engineConfig()},
+			results: map[string]fakeResult{"docker run": {output: "Unable to find image 'hello-world:latest' locally", code: 125}},
+			want:    map[string]CheckStatus{"Container": StatusPass, "Engine config": StatusPass, "Docker": StatusPass, "Offline run": StatusFail},
+			remedy:  true,
+		},
+		{
+			name:    "exec error",
+			info:    ContainerInfo{Engine: "docker", Config: engineConfig()},
+			results: map[string]fakeResult{"docker version": {code: -1, err: errors.New("command timed out")}},
+			want:    map[string]CheckStatus{"Container": StatusPass, "Engine config": StatusPass, "Docker": StatusFail},
+			remedy:  true,
+		},
+		{
+			name: "config lost",
+			info: ContainerInfo{Engine: "docker", Config: map[string]string{"security.nesting": "true"}},
+			want: map[string]CheckStatus{"Container": StatusPass, "Engine config": StatusFail, "Docker": StatusPass, "Offline run": StatusPass},
+		},
+		{
+			name: "raw.seccomp overrides interception",
+			info: ContainerInfo{Engine: "docker", Config: rawSeccomp},
+			want: map[string]CheckStatus{"Container": StatusPass, "Engine config": StatusFail, "Docker": StatusPass, "Offline run": StatusPass},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := running(tt.info)
+			if tt.stopped {
+				info.Status = "Stopped"
+			}
+			report := RunContainer(info, healthyProbe(tt.results))
+			got := resultsByName(report)
+			if tt.stopped && len(got) != len(tt.want) {
+				t.Errorf("got checks %v, want only %v", got, tt.want)
+			}
+			for name, status := range tt.want {
+				r, ok := got[name]
+				if !ok {
+					t.Errorf("missing check %s", name)
+					continue
+				}
+				if r.Status != status {
+					t.Errorf("%s = %v (%s), want %v", name, r.Status, r.Message, status)
+				}
+				if status != StatusPass && (r.Remedy != nil) != tt.remedy {
+					t.Errorf("%s has remedy %v, want %v", name, r.Remedy != nil, tt.remedy)
+				}
+			}
+		})
+	}
+}
+
+func TestRunContainerToolchainAsAgent(t *testing.T) {
+	probe := healthyProbe(nil)
+	checkToolchain(running(ContainerInfo{}), probe)
+	if len(probe.ran) != len(toolchain) {
+		t.Fatalf("ran %v, want one command per tool", probe.ran)
+	}
+	for _, command := range probe.ran {
+		if !strings.HasPrefix(command, "runuser -u agent -- ") {
+			t.Errorf("%q should run as the agent", command)
+		}
+	}
+}
+
+func TestRunContainerOffline(t *testing.T) {
+	info := running(ContainerInfo{Engine: "podman", Config: engineConfig()})
+	probe := healthyProbe(nil)
+	report := RunContainer(info, probe)
+	if report.HasFailures() {
+		t.Fatalf("unexpected failures: %+v", report.Results)
+	}
+	run := probe.ran[len(probe.ran)-1]
+	for _, want := range []string{"--network none", "--pull never", "docker.io/library/hello-world"} {
+		if !strings.Contains(run, want) {
+			t.Errorf("run command %q missing %q", run, want)
+		}
+	}
+}
+
+func TestWritableMount(t *testing.T) {
+	mounts := []Mount{
+		{Name: "data", Source: "/src/data", Path: "/mnt/data"},
+		{Name: "ro", Source: "/src/ro", Path: "/mnt/a", Readonly: true},
+		{Name: "cache", Source: "/src/cache", Path: "/mnt/cache"},
+	}
+	if m, ok := writableMount(mounts); !ok || m.Name != "cache" {
+		t.Errorf("writableMount() = %q, %v, want cache", m.Name, ok)
+	}
+	mounts = append(mounts, Mount{Name: "workspace", Source: "/src/ws", Path: "/home/agent/workspace"})
+	if m, _ := writableMount(mounts); m.Name != "workspace" {
+		t.Errorf("writableMount() = %q, want workspace", m.Name)
+	}
+	if _, ok := writableMount(mounts[1:2]); ok {
+		t.Error("writableMount() picked a read-only mount")
+	}
+}
@@ -0,0 +1,61 @@
+//go:build unix
+
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckIDMap(t *testing.T) {
+	tests := []struct {
+		name  string
+		idmap string
+		want  CheckStatus
+	}{
+		{"mapped to us", fmt.Sprintf("both %d 1000", os.Getuid()), StatusPass},
+		{"mapped elsewhere", fmt.Sprintf("both %d 1000", os.Getuid()+1), StatusFail},
+		{"no mapping", "", StatusSkip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := t.TempDir()
+			info := running(ContainerInfo{
+				Mounts: []Mount{{Name: "workspace", Source: source, Path: "/home/agent/workspace"}},
+				Config: map[string]string{"raw.idmap": tt.idmap},
+			})
+			probe := healthyProbe(map[string]fakeResult{"runuser touch": {}, "rm -f": {}})
+			// Touch and rm reach the host through the fake mount
+			probe.onRun = func(command []string) {
+				file := command[len(command)-1]
+				if !strings.HasPrefix(file, "/home/agent/workspace/") {
+					return
+				}
+				host := filepath.Join(source, filepath.Base(file))
+				switch command[0] {
+				case "runuser":
+					_ = os.WriteFile(host, nil, 0644)
+				case "rm":
+					_ = os.Remove(host)
+				}
+			}
+
+			result := checkIDMap(info, probe)
+			if result.Status != tt.want {
+				t.Errorf("checkIDMap() = %v (%s), want %v", result.Status, result.Message, tt.want)
+			}
+			if entries, _ := os.ReadDir(source); len(entries) != 0 {
+				t.Errorf("test file left behind: %v", entries)
+			}
+		})
+	}
+
+	info := running(ContainerInfo{Config: map[string]string{"raw.idmap": "both 501 1000"}})
+	if result := checkIDMap(info, healthyProbe(nil)); result.Status != StatusSkip {
+		t.Errorf("checkIDMap() without mounts = %v, want skip", result.Status)
+	}
+}
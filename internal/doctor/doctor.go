@@ -16,6 +16,7 @@ import (
 	incus "github.com/lxc/incus/v6/client"
 	"github.com/stuffbucket/coop/internal/config"
 	"github.com/stuffbucket/coop/internal/platform"
+	"github.com/stuffbucket/coop/internal/sshkeys"
 )
 
 // CheckStatus represents the result of a health check.
@@ -48,7 +49,8 @@ type CheckResult struct {
 	Name    string
 	Status  CheckStatus
 	Message string
-	Fix     string // Suggested fix command or action
+	Fix     string       // Suggested fix command or action
+	Remedy  func() error // Applies Fix for --fix, when it can be automated
 }
 
 // Report holds all check results.
@@ -551,10 +553,19 @@ func checkIncusStoragePool(cfg *config.Config, vmChecker VMBackendChecker) Check
 		return result
 	}
 
+	recovery, canRecover := recoverCommand(cfg, vmChecker)
+	fix := "incus admin recover inside the VM, or incus storage create default dir"
+	if canRecover {
+		fix = strings.Join(recovery, " ") + ", or incus storage create default dir"
+	}
+
 	if len(pools) == 0 {
 		result.Status = StatusFail
 		result.Message = "no storage pools configured"
-		result.Fix = "incus storage create default dir"
+		result.Fix = fix
+		if canRecover {
+			result.Remedy = recoverStoragePool(conn, recovery)
+		}
 		return result
 	}
 
@@ -582,6 +593,10 @@ func checkIncusStoragePool(cfg *config.Config, vmChecker VMBackendChecker) Check
 	} else {
 		result.Status = StatusWarn
 		result.Message = fmt.Sprintf("no 'default' pool (have: %s)", strings.Join(pools, ", "))
+		result.Fix = fix
+		if canRecover {
+			result.Remedy = recoverStoragePool(conn, recovery)
+		}
 	}
 
 	return result
@@ -693,7 +708,12 @@ func checkNetworkRoute(cfg *config.Config, vmChecker VMBackendChecker) CheckResu
 		if instance == "" {
 			instance = "incus"
 		}
-		result.Fix = fmt.Sprintf("sudo route add -net 10.0.100.0/24 $(colima list -p %s -j | jq -r '.address')", instance)
+		subnet := "10.0.100.0/24"
+		if len(subnets) > 0 {
+			subnet = subnets[0]
+		}
+		result.Fix = fmt.Sprintf("sudo route -n add -net %s $(colima list -p %s -j | jq -r '.address')", subnet, instance)
+		result.Remedy = addContainerRoute(subnet, instance)
 	}
 	return result
 }
@@ -715,6 +735,7 @@ func checkCoopDirectories(cfg *config.Config) CheckResult {
 		result.Status = StatusFail
 		result.Message = fmt.Sprintf("missing: %s", strings.Join(missing, ", "))
 		result.Fix = "coop init"
+		result.Remedy = config.EnsureDirectories
 		return result
 	}
 
@@ -726,13 +747,17 @@ func checkCoopDirectories(cfg *config.Config) CheckResult {
 func checkSSHKeys(cfg *config.Config) CheckResult {
 	result := CheckResult{Name: "SSH keys"}
 
-	dirs := config.GetDirectories()
-	keyPath := filepath.Join(dirs.SSH, "id_ed25519")
+	// Containers log in with certificates from coop's CA
+	keyPath := sshkeys.GetPaths().CAKey
 
 	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
 		result.Status = StatusFail
-		result.Message = "SSH keys not generated"
+		result.Message = "SSH CA not generated"
 		result.Fix = "coop init"
+		result.Remedy = func() error {
+			_, err := sshkeys.EnsureCA()
+			return err
+		}
 		return result
 	}
 
@@ -775,6 +800,9 @@ func checkBaseImage(cfg *config.Config, vmChecker VMBackendChecker) CheckResult
 	result.Status = StatusWarn
 	result.Message = fmt.Sprintf("%s not found (containers will use slow fallback)", imageName)
 	result.Fix = "coop image build"
+	if imageName == "coop-agent-base" {
+		result.Remedy = buildBaseImage
+	}
 	return result
 }
 
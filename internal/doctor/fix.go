@@ -0,0 +1,123 @@
+package doctor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+
+	incus "github.com/lxc/incus/v6/client"
+	"github.com/lxc/incus/v6/shared/api"
+	"github.com/stuffbucket/coop/internal/config"
+)
+
+// Fixable returns the checks that did not pass and have a Remedy, in
+// report order: the plan 'coop doctor --fix' offers.
+func (r *Report) Fixable() []CheckResult {
+	var plan []CheckResult
+	for _, result := range r.Results {
+		if result.Remedy != nil && (result.Status == StatusFail || result.Status == StatusWarn) {
+			plan = append(plan, result)
+		}
+	}
+	return plan
+}
+
+// runInteractive runs a command attached to the terminal, so sudo can ask
+// for a password and interactive tools can ask their questions.
+func runInteractive(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
+
+// colimaAddress returns the routable address of a Colima VM started with
+// --network-address.
+func colimaAddress(instance string) (string, error) {
+	output, err := exec.Command("colima", "list", "-p", instance, "-j").Output()
+	if err != nil {
+		return "", fmt.Errorf("colima list failed: %w", err)
+	}
+	var vm struct {
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(output), &vm); err != nil {
+		return "", fmt.Errorf("cannot parse colima list: %w", err)
+	}
+	if net.ParseIP(vm.Address) == nil {
+		return "", fmt.Errorf("colima VM %s has no network address (start it with --network-address)", instance)
+	}
+	return vm.Address, nil
+}
+
+// addContainerRoute routes subnet through the Colima VM. Changing the
+// routing table needs root, so sudo prompts for a password.
+func addContainerRoute(subnet, instance string) func() error {
+	return func() error {
+		addr, err := colimaAddress(instance)
+		if err != nil {
+			return err
+		}
+		return runInteractive("sudo", "route", "-n", "add", "-net", subnet, addr)
+	}
+}
+
+// recoverCommand returns the command running 'incus admin recover' where
+// the Incus daemon and its storage live: inside the VM on macOS, or
+// locally without one. ok is false for a VM coop cannot open a shell in.
+func recoverCommand(cfg *config.Config, vmChecker VMBackendChecker) (command []string, ok bool) {
+	recovery := []string{"incus", "admin", "recover"}
+	if vmChecker == nil {
+		return recovery, true
+	}
+	instance := cfg.Settings.VM.Instance
+	if instance == "" {
+		instance = "incus"
+	}
+	switch vmChecker.Name() {
+	case "colima":
+		return append([]string{"colima", "ssh", "-p", instance, "--", "sudo"}, recovery...), true
+	case "lima":
+		return append([]string{"limactl", "shell", instance, "sudo"}, recovery...), true
+	}
+	return nil, false
+}
+
+// recoverStoragePool runs Incus' recovery of pools left on disk, for when
+// the VM kept its data but Incus lost track of it, and creates an empty
+// default pool if nothing was recovered. A failed recovery stops there:
+// a new pool named default would stand in the way of recovering the old.
+func recoverStoragePool(conn incus.InstanceServer, recovery []string) func() error {
+	return func() error {
+		if err := runInteractive(recovery[0], recovery[1:]...); err != nil {
+			return fmt.Errorf("storage recovery failed, so no empty pool was created: %w", err)
+		}
+		if _, _, err := conn.GetStoragePool("default"); err == nil {
+			return nil
+		}
+		return conn.CreateStoragePool(api.StoragePoolsPost{
+			Name:   "default",
+			Driver: "dir",
+			StoragePoolPut: api.StoragePoolPut{
+				Description: "coop default pool",
+			},
+		})
+	}
+}
+
+// buildBaseImage runs 'coop image build' from this executable, streaming
+// its progress.
+func buildBaseImage() error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return runInteractive(self, "image", "build")
+}
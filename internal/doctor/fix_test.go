@@ -0,0 +1,58 @@
+package doctor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stuffbucket/coop/internal/config"
+)
+
+func TestReportFixable(t *testing.T) {
+	remedy := func() error { return nil }
+	report := &Report{Results: []CheckResult{
+		{Name: "passing", Status: StatusPass, Remedy: remedy},
+		{Name: "failing", Status: StatusFail, Fix: "fix it", Remedy: remedy},
+		{Name: "hint only", Status: StatusFail, Fix: "do it yourself"},
+		{Name: "skipped", Status: StatusSkip, Remedy: remedy},
+		{Name: "warning", Status: StatusWarn, Fix: "tidy up", Remedy: remedy},
+	}}
+
+	plan := report.Fixable()
+	var names []string
+	for _, r := range plan {
+		names = append(names, r.Name)
+	}
+	if len(names) != 2 || names[0] != "failing" || names[1] != "warning" {
+		t.Errorf("Fixable() = %v, want [failing warning]", names)
+	}
+
+	if plan := (&Report{}).Fixable(); len(plan) != 0 {
+		t.Errorf("Fixable() of an empty report = %v", plan)
+	}
+}
+
+func TestRecoverCommand(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Settings.VM.Instance = "work"
+
+	tests := []struct {
+		name      string
+		vmChecker VMBackendChecker
+		want      string
+		wantOK    bool
+	}{
+		{"local", nil, "incus admin recover", true},
+		{"colima", &ColimaChecker{}, "colima ssh -p work -- sudo incus admin recover", true},
+		{"lima", &LimaChecker{}, "limactl shell work sudo incus admin recover", true},
+		{"bladerunner", &BladerunnerChecker{}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, ok := recoverCommand(cfg, tt.vmChecker)
+			if got := strings.Join(command, " "); got != tt.want || ok != tt.wantOK {
+				t.Errorf("recoverCommand() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package doctor
+
+import (
+	"net/http"
+	"testing"
+
+	incus "github.com/lxc/incus/v6/client"
+	"github.com/lxc/incus/v6/shared/api"
+)
+
+// poolServer records the pools a storage remedy creates.
+type poolServer struct {
+	incus.InstanceServer
+	created []string
+}
+
+func (s *poolServer) GetStoragePool(name string) (*api.StoragePool, string, error) {
+	return nil, "", api.StatusErrorf(http.StatusNotFound, "Storage pool not found")
+}
+
+func (s *poolServer) CreateStoragePool(pool api.StoragePoolsPost) error {
+	s.created = append(s.created, pool.Name)
+	return nil
+}
+
+func TestRecoverStoragePool(t *testing.T) {
+	conn := &poolServer{}
+	if err := recoverStoragePool(conn, []string{"false"})(); err == nil {
+		t.Error("a failed recovery should be reported")
+	}
+	if len(conn.created) != 0 {
+		t.Errorf("created %v after a failed recovery", conn.created)
+	}
+
+	if err := recoverStoragePool(conn, []string{"true"})(); err != nil {
+		t.Fatalf("Remedy failed: %v", err)
+	}
+	if len(conn.created) != 1 || conn.created[0] != "default" {
+		t.Errorf("created %v, want an empty default pool when nothing was recovered", conn.created)
+	}
+}
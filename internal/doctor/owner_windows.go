@@ -0,0 +1,10 @@
+//go:build windows
+
+package doctor
+
+import "os"
+
+// fileOwner is unavailable on Windows, which has no UIDs.
+func fileOwner(os.FileInfo) (int, bool) {
+	return 0, false
+}
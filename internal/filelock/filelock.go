@@ -0,0 +1,32 @@
+// Package filelock serializes access to files shared by concurrent coop
+// processes.
+package filelock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// With runs fn holding an exclusive lock on path.lock, creating path's
+// directory if needed. The lock file is left in place: removing it would
+// let a process waiting on the old file and one creating a new file hold
+// the lock at the same time.
+func With(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create lock file: %w", err)
+	}
+	defer func() { _ = lock.Close() }()
+
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() { _ = unlockFile(lock) }()
+
+	return fn()
+}
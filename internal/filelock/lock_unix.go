@@ -1,6 +1,6 @@
 //go:build unix
 
-package sshkeys
+package filelock
 
 import (
 	"os"
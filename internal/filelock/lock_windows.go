@@ -1,6 +1,6 @@
 //go:build windows
 
-package sshkeys
+package filelock
 
 import (
 	"os"
@@ -9,9 +9,9 @@ import (
 )
 
 var (
-	kernel32         = syscall.NewLazyDLL("kernel32.dll")
-	lockFileEx       = kernel32.NewProc("LockFileEx")
-	unlockFileEx     = kernel32.NewProc("UnlockFileEx")
+	kernel32     = syscall.NewLazyDLL("kernel32.dll")
+	lockFileEx   = kernel32.NewProc("LockFileEx")
+	unlockFileEx = kernel32.NewProc("UnlockFileEx")
 )
 
 const (
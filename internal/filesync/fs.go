@@ -0,0 +1,294 @@
+package filesync
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// FS is one side of a sync. Paths are slash-separated and relative to the
+// sync root.
+type FS interface {
+	// Scan lists every path under the root that ignore does not exclude.
+	// Symlinks and special files are skipped.
+	Scan(ignore func(p string, isDir bool) bool) (Tree, error)
+	// Open opens a file for reading.
+	Open(p string) (io.ReadCloser, error)
+	// WriteFile replaces a file with the contents of r and applies e's mode and mtime.
+	WriteFile(p string, r io.Reader, e Entry) error
+	// Mkdir creates a directory (and any parents) with e's mode.
+	Mkdir(p string, e Entry) error
+	// Remove deletes a file or an empty directory.
+	Remove(p string) error
+}
+
+// LocalFS is a directory on the host. Every access goes through an os.Root,
+// so a symlink the container synced or planted cannot lead outside Root.
+type LocalFS struct {
+	Root string
+}
+
+// Scan implements FS.
+func (l *LocalFS) Scan(ignore func(p string, isDir bool) bool) (Tree, error) {
+	tree := make(Tree)
+	err := filepath.WalkDir(l.Root, func(hostPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if hostPath == l.Root {
+				return err
+			}
+			return nil // Vanished or unreadable; picked up next pass
+		}
+		if hostPath == l.Root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.Root, hostPath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if ignore != nil && ignore(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if e, ok := entryFor(info); ok {
+			tree[rel] = e
+		}
+		return nil
+	})
+	return tree, err
+}
+
+// Open implements FS.
+func (l *LocalFS) Open(p string) (io.ReadCloser, error) {
+	root, err := os.OpenRoot(l.Root)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = root.Close() }()
+	return root.Open(filepath.FromSlash(p))
+}
+
+// WriteFile implements FS. The file is written to a temporary name and
+// renamed into place so readers never see a partial file.
+func (l *LocalFS) WriteFile(p string, r io.Reader, e Entry) error {
+	root, err := os.OpenRoot(l.Root)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = root.Close() }()
+
+	target := filepath.FromSlash(p)
+	if err := root.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(target), ".coop-sync-"+rand.Text())
+	f, err := root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = root.Remove(tmp) }()
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chmod(e.Mode); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	mtime := time.Unix(e.ModTime, 0)
+	if err := root.Chtimes(tmp, mtime, mtime); err != nil {
+		return err
+	}
+	return root.Rename(tmp, target)
+}
+
+// Mkdir implements FS.
+func (l *LocalFS) Mkdir(p string, e Entry) error {
+	root, err := os.OpenRoot(l.Root)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = root.Close() }()
+
+	target := filepath.FromSlash(p)
+	if err := root.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	return root.Chmod(target, e.Mode)
+}
+
+// Remove implements FS.
+func (l *LocalFS) Remove(p string) error {
+	root, err := os.OpenRoot(l.Root)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = root.Close() }()
+	return root.Remove(filepath.FromSlash(p))
+}
+
+// SFTPFS is a directory in a container, reached over the Incus file API.
+// Everything written is owned by UID/GID.
+type SFTPFS struct {
+	Client   *sftp.Client
+	Root     string
+	UID, GID int
+}
+
+// Scan implements FS.
+func (s *SFTPFS) Scan(ignore func(p string, isDir bool) bool) (Tree, error) {
+	tree := make(Tree)
+	walker := s.Client.Walk(s.Root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == s.Root {
+				return nil, err
+			}
+			continue
+		}
+		if walker.Path() == s.Root {
+			continue
+		}
+
+		rel := strings.TrimPrefix(walker.Path(), strings.TrimSuffix(s.Root, "/")+"/")
+		info := walker.Stat()
+
+		if ignore != nil && ignore(rel, info.IsDir()) {
+			if info.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+
+		if e, ok := entryFor(info); ok {
+			tree[rel] = e
+		}
+	}
+	return tree, nil
+}
+
+// Open implements FS.
+func (s *SFTPFS) Open(p string) (io.ReadCloser, error) {
+	return s.Client.Open(s.path(p))
+}
+
+// WriteFile implements FS.
+func (s *SFTPFS) WriteFile(p string, r io.Reader, e Entry) error {
+	target := s.path(p)
+	if err := s.mkdirAll(path.Dir(target)); err != nil {
+		return err
+	}
+
+	tmp := path.Join(path.Dir(target), ".coop-sync-"+path.Base(target))
+	f, err := s.Client.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = s.Client.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = s.Client.Remove(tmp)
+		return err
+	}
+
+	if err := s.setAttrs(tmp, e); err != nil {
+		_ = s.Client.Remove(tmp)
+		return err
+	}
+	mtime := time.Unix(e.ModTime, 0)
+	if err := s.Client.Chtimes(tmp, mtime, mtime); err != nil {
+		_ = s.Client.Remove(tmp)
+		return err
+	}
+	return s.Client.PosixRename(tmp, target)
+}
+
+// Mkdir implements FS.
+func (s *SFTPFS) Mkdir(p string, e Entry) error {
+	target := s.path(p)
+	if err := s.mkdirAll(target); err != nil {
+		return err
+	}
+	return s.setAttrs(target, e)
+}
+
+// EnsureRoot creates the sync root (and missing parents) if needed.
+func (s *SFTPFS) EnsureRoot() error {
+	return s.mkdirAll(s.Root)
+}
+
+// Remove implements FS.
+func (s *SFTPFS) Remove(p string) error {
+	return s.Client.Remove(s.path(p))
+}
+
+// mkdirAll creates a directory and its missing parents owned by UID/GID.
+func (s *SFTPFS) mkdirAll(dir string) error {
+	if info, err := s.Client.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+		}
+		return nil
+	}
+	if parent := path.Dir(dir); parent != dir {
+		if err := s.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	if err := s.Client.Mkdir(dir); err != nil {
+		return err
+	}
+	return s.Client.Chown(dir, s.UID, s.GID)
+}
+
+func (s *SFTPFS) setAttrs(target string, e Entry) error {
+	if err := s.Client.Chmod(target, e.Mode); err != nil {
+		return err
+	}
+	return s.Client.Chown(target, s.UID, s.GID)
+}
+
+func (s *SFTPFS) path(p string) string {
+	return path.Join(s.Root, p)
+}
+
+// entryFor converts file info to an entry. Returns false for paths that are
+// not synced (symlinks, devices, sockets, pipes).
+func entryFor(info os.FileInfo) (Entry, bool) {
+	switch {
+	case info.IsDir():
+		return Entry{Dir: true, Mode: info.Mode().Perm()}, true
+	case info.Mode().IsRegular():
+		return Entry{
+			Mode:    info.Mode().Perm(),
+			Size:    info.Size(),
+			ModTime: info.ModTime().Unix(),
+		}, true
+	}
+	return Entry{}, false
+}
@@ -0,0 +1,55 @@
+//go:build unix
+
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalFSSymlinkedParent(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "secret"), "host secret", time.Now())
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	l := &LocalFS{Root: root}
+	e := Entry{Mode: 0644, ModTime: time.Now().Unix()}
+
+	if err := l.WriteFile("link/planted", strings.NewReader("x"), e); err == nil {
+		t.Error("WriteFile() through a symlinked parent succeeded")
+	}
+	if err := l.WriteFile("link/sub/planted", strings.NewReader("x"), e); err == nil {
+		t.Error("WriteFile() under a symlinked parent succeeded")
+	}
+	if err := l.Mkdir("link/dir", Entry{Dir: true, Mode: 0755}); err == nil {
+		t.Error("Mkdir() through a symlinked parent succeeded")
+	}
+	if err := l.Remove("link/secret"); err == nil {
+		t.Error("Remove() through a symlinked parent succeeded")
+	}
+	if f, err := l.Open("link/secret"); err == nil {
+		_ = f.Close()
+		t.Error("Open() through a symlinked parent succeeded")
+	}
+
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "secret" {
+		t.Errorf("outside the root: %v, want only secret", entries)
+	}
+
+	// Writes inside the root still work
+	if err := l.WriteFile("dir/file", strings.NewReader("ok"), e); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(root, "dir", "file")); got != "ok" {
+		t.Errorf("dir/file = %q", got)
+	}
+}
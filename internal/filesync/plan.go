@@ -0,0 +1,159 @@
+// Package filesync keeps a host directory and a container directory in sync.
+//
+// It is used where Incus cannot share the host filesystem with a container
+// (bladerunner, remote servers), so disk mounts are not available.
+//
+// Sync is three-way: each pass scans both sides and compares them against
+// the base, the state both sides had after the previous pass. A path changed
+// on one side is copied (or deleted) to the other. A file changed on both
+// sides is a conflict: the host version wins and the container version is
+// kept next to it as <name>.sync-conflict-<timestamp>.
+package filesync
+
+import (
+	"os"
+	"sort"
+)
+
+// Entry is the metadata of one path in a synced tree.
+type Entry struct {
+	Dir     bool        `json:"dir,omitempty"`
+	Mode    os.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	ModTime int64       `json:"mtime"` // Unix seconds; SFTP has no finer resolution
+}
+
+// Tree maps slash-separated paths relative to the sync root to entries.
+type Tree map[string]Entry
+
+// BaseEntry records both sides of a path as of the last sync.
+type BaseEntry struct {
+	Local  Entry `json:"local"`
+	Remote Entry `json:"remote"`
+}
+
+// Base is the state both sides had after the last sync.
+type Base map[string]BaseEntry
+
+// ActionKind is what a sync pass does with a path.
+type ActionKind string
+
+const (
+	// Push copies a host path to the container.
+	Push ActionKind = "push"
+	// Pull copies a container path to the host.
+	Pull ActionKind = "pull"
+	// DeleteRemote deletes a container path removed on the host.
+	DeleteRemote ActionKind = "delete-remote"
+	// DeleteLocal deletes a host path removed in the container.
+	DeleteLocal ActionKind = "delete-local"
+	// Conflict means a file changed on both sides.
+	Conflict ActionKind = "conflict"
+)
+
+// Action is one step of a sync pass.
+type Action struct {
+	Kind ActionKind
+	Path string
+	Dir  bool
+}
+
+// Plan compares both sides against the base and returns the actions needed
+// to bring them back in sync, sorted by path.
+func Plan(base Base, local, remote Tree) []Action {
+	paths := make(map[string]struct{}, len(local))
+	for p := range base {
+		paths[p] = struct{}{}
+	}
+	for p := range local {
+		paths[p] = struct{}{}
+	}
+	for p := range remote {
+		paths[p] = struct{}{}
+	}
+
+	var actions []Action
+	for p := range paths {
+		var baseLocal, baseRemote *Entry
+		if b, ok := base[p]; ok {
+			baseLocal, baseRemote = &b.Local, &b.Remote
+		}
+		l, hasLocal := lookup(local, p)
+		r, hasRemote := lookup(remote, p)
+
+		localChanged := changed(baseLocal, l)
+		remoteChanged := changed(baseRemote, r)
+
+		switch {
+		case !localChanged && !remoteChanged:
+			continue
+
+		case localChanged && !remoteChanged:
+			if hasLocal {
+				actions = append(actions, Action{Push, p, l.Dir})
+			} else if hasRemote {
+				actions = append(actions, Action{DeleteRemote, p, r.Dir})
+			}
+
+		case !localChanged && remoteChanged:
+			if hasRemote {
+				actions = append(actions, Action{Pull, p, r.Dir})
+			} else if hasLocal {
+				actions = append(actions, Action{DeleteLocal, p, l.Dir})
+			}
+
+		default: // Changed on both sides
+			switch {
+			case !hasLocal && !hasRemote:
+				continue
+			case hasLocal && !hasRemote:
+				// Edited here, deleted there: keep the edit
+				actions = append(actions, Action{Push, p, l.Dir})
+			case !hasLocal && hasRemote:
+				actions = append(actions, Action{Pull, p, r.Dir})
+			case l.Dir && r.Dir:
+				continue
+			case !l.Dir && !r.Dir && l.Size == r.Size && l.ModTime == r.ModTime:
+				continue // Same edit arrived on both sides
+			default:
+				actions = append(actions, Action{Conflict, p, l.Dir})
+			}
+		}
+	}
+
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Path < actions[j].Path })
+	return actions
+}
+
+func lookup(t Tree, p string) (*Entry, bool) {
+	if e, ok := t[p]; ok {
+		return &e, true
+	}
+	return nil, false
+}
+
+// changed reports whether a path differs from its base entry.
+// Directory mtimes are ignored since they change whenever entries do.
+func changed(base, cur *Entry) bool {
+	if base == nil || cur == nil {
+		return (base == nil) != (cur == nil)
+	}
+	if base.Dir != cur.Dir || base.Mode != cur.Mode {
+		return true
+	}
+	if cur.Dir {
+		return false
+	}
+	return base.Size != cur.Size || base.ModTime != cur.ModTime
+}
+
+// NewBase records the current state of paths present on both sides.
+func NewBase(local, remote Tree) Base {
+	base := make(Base, len(local))
+	for p, l := range local {
+		if r, ok := remote[p]; ok && l.Dir == r.Dir {
+			base[p] = BaseEntry{Local: l, Remote: r}
+		}
+	}
+	return base
+}
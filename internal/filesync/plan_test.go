@@ -0,0 +1,111 @@
+package filesync
+
+import (
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	file := func(size, mtime int64) Entry { return Entry{Mode: 0644, Size: size, ModTime: mtime} }
+	dir := Entry{Dir: true, Mode: 0755}
+
+	base := Base{
+		"same":          {file(1, 100), file(1, 100)},
+		"edited-local":  {file(1, 100), file(1, 100)},
+		"edited-remote": {file(1, 100), file(1, 100)},
+		"edited-both":   {file(1, 100), file(1, 100)},
+		"same-edit":     {file(1, 100), file(1, 100)},
+		"gone-local":    {file(1, 100), file(1, 100)},
+		"gone-remote":   {file(1, 100), file(1, 100)},
+		"gone-both":     {file(1, 100), file(1, 100)},
+		"edit-vs-gone":  {file(1, 100), file(1, 100)},
+		"chmod":         {file(1, 100), file(1, 100)},
+		"dir":           {dir, dir},
+	}
+	local := Tree{
+		"same":          file(1, 100),
+		"edited-local":  file(2, 200),
+		"edited-remote": file(1, 100),
+		"edited-both":   file(2, 200),
+		"same-edit":     file(3, 300),
+		"gone-remote":   file(1, 100),
+		"edit-vs-gone":  file(5, 500),
+		"chmod":         {Mode: 0755, Size: 1, ModTime: 100},
+		"dir":           {Dir: true, Mode: 0755},
+		"new-local":     file(1, 100),
+		"new-dir":       dir,
+	}
+	remote := Tree{
+		"same":          file(1, 100),
+		"edited-local":  file(1, 100),
+		"edited-remote": file(2, 200),
+		"edited-both":   file(3, 300),
+		"same-edit":     file(3, 300),
+		"gone-local":    file(1, 100),
+		"chmod":         file(1, 100),
+		"dir":           {Dir: true, Mode: 0755},
+		"new-remote":    file(1, 100),
+	}
+
+	want := map[string]ActionKind{
+		"chmod":         Push,
+		"edit-vs-gone":  Push,
+		"edited-both":   Conflict,
+		"edited-local":  Push,
+		"edited-remote": Pull,
+		"gone-local":    DeleteRemote,
+		"gone-remote":   DeleteLocal,
+		"new-dir":       Push,
+		"new-local":     Push,
+		"new-remote":    Pull,
+	}
+
+	actions := Plan(base, local, remote)
+
+	got := make(map[string]ActionKind)
+	for i, a := range actions {
+		got[a.Path] = a.Kind
+		if i > 0 && actions[i-1].Path >= a.Path {
+			t.Errorf("actions not sorted: %q before %q", actions[i-1].Path, a.Path)
+		}
+	}
+
+	for p, kind := range want {
+		if got[p] != kind {
+			t.Errorf("Plan()[%q] = %q, want %q", p, got[p], kind)
+		}
+	}
+	for p, kind := range got {
+		if _, ok := want[p]; !ok {
+			t.Errorf("unexpected action %s %s", kind, p)
+		}
+	}
+
+	for _, a := range actions {
+		if a.Path == "new-dir" && !a.Dir {
+			t.Error("new-dir action should be marked Dir")
+		}
+	}
+}
+
+func TestPlanFirstSync(t *testing.T) {
+	local := Tree{"a": {Mode: 0644, Size: 1, ModTime: 1}}
+	remote := Tree{"b": {Mode: 0644, Size: 1, ModTime: 1}}
+
+	actions := Plan(Base{}, local, remote)
+	if len(actions) != 2 || actions[0] != (Action{Push, "a", false}) || actions[1] != (Action{Pull, "b", false}) {
+		t.Errorf("Plan() = %+v, want push a, pull b", actions)
+	}
+}
+
+func TestNewBase(t *testing.T) {
+	local := Tree{"both": {Size: 1}, "local-only": {Size: 1}, "kind": {Dir: true}}
+	remote := Tree{"both": {Size: 1}, "remote-only": {Size: 1}, "kind": {Size: 1}}
+
+	base := NewBase(local, remote)
+	if len(base) != 1 {
+		t.Fatalf("NewBase() = %+v, want only paths present as the same kind on both sides", base)
+	}
+	if _, ok := base["both"]; !ok {
+		t.Error("NewBase() missing path present on both sides")
+	}
+}
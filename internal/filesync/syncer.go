@@ -0,0 +1,291 @@
+package filesync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+const (
+	// tempPrefix names in-flight writes; they are never synced.
+	tempPrefix = ".coop-sync-"
+	// conflictInfix marks the copy kept when a file changed on both sides.
+	conflictInfix = ".sync-conflict-"
+
+	// watchDebounce batches bursts of host events into one pass.
+	watchDebounce = 300 * time.Millisecond
+)
+
+// Syncer syncs one host directory with one container directory.
+type Syncer struct {
+	Local  FS
+	Remote FS
+	// BaseFile persists the base between passes (and runs).
+	BaseFile string
+	// Ignore excludes paths from sync. See GitIgnore.
+	Ignore func(p string, isDir bool) bool
+
+	base Base
+}
+
+// Result describes what one sync pass did.
+type Result struct {
+	Actions   []Action
+	Conflicts []string // Paths of the kept container copies
+	Errors    []error
+}
+
+// Sync runs a single pass: scan both sides, apply the plan, save the base.
+// Errors on individual paths are collected in the result and retried on the
+// next pass; the returned error is for failures affecting the whole pass.
+func (s *Syncer) Sync() (*Result, error) {
+	if s.base == nil {
+		base, err := loadBase(s.BaseFile)
+		if err != nil {
+			return nil, err
+		}
+		s.base = base
+	}
+
+	local, remote, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Actions: Plan(s.base, local, remote)}
+
+	// Create and update parents first, delete children first
+	var deletes []Action
+	for _, a := range result.Actions {
+		switch a.Kind {
+		case Push:
+			result.addError(a, s.copy(s.Local, s.Remote, a, local[a.Path]))
+		case Pull:
+			result.addError(a, s.copy(s.Remote, s.Local, a, remote[a.Path]))
+		case Conflict:
+			kept, err := s.resolveConflict(a, local[a.Path], remote[a.Path])
+			result.addError(a, err)
+			if err == nil {
+				result.Conflicts = append(result.Conflicts, kept)
+			}
+		case DeleteLocal, DeleteRemote:
+			deletes = append(deletes, a)
+		}
+	}
+	for i := len(deletes) - 1; i >= 0; i-- {
+		a := deletes[i]
+		target := s.Remote
+		if a.Kind == DeleteLocal {
+			target = s.Local
+		}
+		// A directory that gained entries on the other side is not empty;
+		// leave it and let the next pass copy it back.
+		if err := target.Remove(a.Path); err != nil && !a.Dir {
+			result.addError(a, err)
+		}
+	}
+
+	if len(result.Actions) > 0 {
+		if local, remote, err = s.scan(); err != nil {
+			return result, err
+		}
+	}
+	s.base = NewBase(local, remote)
+	return result, saveBase(s.BaseFile, s.base)
+}
+
+func (r *Result) addError(a Action, err error) {
+	if err != nil {
+		r.Errors = append(r.Errors, fmt.Errorf("%s %s: %w", a.Kind, a.Path, err))
+	}
+}
+
+func (s *Syncer) scan() (Tree, Tree, error) {
+	ignore := func(p string, isDir bool) bool {
+		if strings.HasPrefix(path.Base(p), tempPrefix) {
+			return true
+		}
+		return s.Ignore != nil && s.Ignore(p, isDir)
+	}
+
+	local, err := s.Local.Scan(ignore)
+	if err != nil {
+		return nil, nil, fmt.Errorf("scan host: %w", err)
+	}
+	remote, err := s.Remote.Scan(ignore)
+	if err != nil {
+		return nil, nil, fmt.Errorf("scan container: %w", err)
+	}
+	return local, remote, nil
+}
+
+func (s *Syncer) copy(from, to FS, a Action, e Entry) error {
+	if e.Dir {
+		return to.Mkdir(a.Path, e)
+	}
+	return copyFile(from, to, a.Path, a.Path, e)
+}
+
+// resolveConflict saves the container version as a sibling conflict copy on
+// the host (the next pass syncs it back), then pushes the host version.
+// Returns the conflict copy's path.
+func (s *Syncer) resolveConflict(a Action, local, remote Entry) (string, error) {
+	if remote.Dir {
+		return "", fmt.Errorf("file on host is a directory in the container")
+	}
+
+	kept := conflictName(a.Path, time.Now())
+	if err := copyFile(s.Remote, s.Local, a.Path, kept, remote); err != nil {
+		return "", err
+	}
+
+	if local.Dir {
+		// Directory on host, file in the container: the host wins
+		if err := s.Remote.Remove(a.Path); err != nil {
+			return "", err
+		}
+		return kept, s.Remote.Mkdir(a.Path, local)
+	}
+	return kept, copyFile(s.Local, s.Remote, a.Path, a.Path, local)
+}
+
+func copyFile(from, to FS, src, dst string, e Entry) error {
+	r, err := from.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+	return to.WriteFile(dst, r, e)
+}
+
+// conflictName returns the name of the conflict copy for a path,
+// keeping the extension so editors still recognize the file type.
+func conflictName(p string, t time.Time) string {
+	ext := path.Ext(p)
+	if ext == path.Base(p) {
+		ext = "" // Dotfile such as .env
+	}
+	return strings.TrimSuffix(p, ext) + conflictInfix + t.Format("20060102-150405") + ext
+}
+
+// Watch syncs whenever the host directory changes, and every interval to
+// pick up changes in the container, until ctx is cancelled. report is called
+// after every pass that did something or failed.
+func (s *Syncer) Watch(ctx context.Context, root string, interval time.Duration, report func(*Result, error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = watcher.Close() }()
+
+	if err := addWatches(watcher, root); err != nil {
+		return err
+	}
+
+	pass := func() {
+		result, err := s.Sync()
+		if err != nil || len(result.Actions) > 0 || len(result.Errors) > 0 {
+			report(result, err)
+		}
+	}
+	pass()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if strings.HasPrefix(filepath.Base(ev.Name), tempPrefix) {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					_ = addWatches(watcher, ev.Name)
+				}
+			}
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			report(nil, err)
+		case <-debounce:
+			debounce = nil
+			pass()
+		case <-ticker.C:
+			pass()
+		}
+	}
+}
+
+// addWatches watches dir and every directory below it (fsnotify is not recursive).
+func addWatches(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" && p != dir {
+			return filepath.SkipDir // Too busy to be worth individual events
+		}
+		return watcher.Add(p)
+	})
+}
+
+// GitIgnore returns an ignore function honoring the .gitignore files (and
+// .git/info/exclude) under a host directory.
+func GitIgnore(root string) (func(p string, isDir bool) bool, error) {
+	patterns, err := gitignore.ReadPatterns(osfs.New(root), nil)
+	if err != nil {
+		return nil, err
+	}
+	matcher := gitignore.NewMatcher(patterns)
+	return func(p string, isDir bool) bool {
+		return matcher.Match(strings.Split(p, "/"), isDir)
+	}, nil
+}
+
+func loadBase(file string) (Base, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return Base{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var base Base
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	return base, nil
+}
+
+func saveBase(file string, base Base) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(base)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
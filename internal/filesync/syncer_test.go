@@ -0,0 +1,188 @@
+package filesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSyncer syncs two host directories, standing in for host and container.
+func newTestSyncer(t *testing.T) (s *Syncer, local, remote string) {
+	t.Helper()
+	local = t.TempDir()
+	remote = t.TempDir()
+	return &Syncer{
+		Local:    &LocalFS{Root: local},
+		Remote:   &LocalFS{Root: remote},
+		BaseFile: filepath.Join(t.TempDir(), "base.json"),
+	}, local, remote
+}
+
+func writeFile(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func runSync(t *testing.T, s *Syncer) *Result {
+	t.Helper()
+	result, err := s.Sync()
+	if err != nil {
+		t.Fatalf("Sync() error: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		t.Fatalf("Sync() path errors: %v", result.Errors)
+	}
+	return result
+}
+
+func TestSyncerRoundTrip(t *testing.T) {
+	s, local, remote := newTestSyncer(t)
+	t0 := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(local, "src", "main.go"), "package main\n", t0)
+	writeFile(t, filepath.Join(remote, "notes.md"), "from agent\n", t0)
+	runSync(t, s)
+
+	if got := readFile(t, filepath.Join(remote, "src", "main.go")); got != "package main\n" {
+		t.Errorf("pushed content = %q", got)
+	}
+	if got := readFile(t, filepath.Join(local, "notes.md")); got != "from agent\n" {
+		t.Errorf("pulled content = %q", got)
+	}
+
+	// Nothing changed: nothing to do
+	if result := runSync(t, s); len(result.Actions) != 0 {
+		t.Errorf("second pass actions = %+v, want none", result.Actions)
+	}
+
+	// Edit in the container, delete on the host
+	writeFile(t, filepath.Join(remote, "src", "main.go"), "package main // edited\n", t0.Add(time.Minute))
+	if err := os.Remove(filepath.Join(local, "notes.md")); err != nil {
+		t.Fatal(err)
+	}
+	runSync(t, s)
+
+	if got := readFile(t, filepath.Join(local, "src", "main.go")); got != "package main // edited\n" {
+		t.Errorf("pulled edit = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(remote, "notes.md")); !os.IsNotExist(err) {
+		t.Error("deletion on host was not synced to container")
+	}
+}
+
+func TestSyncerConflict(t *testing.T) {
+	s, local, remote := newTestSyncer(t)
+	t0 := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(local, "config.yaml"), "v1\n", t0)
+	runSync(t, s)
+
+	writeFile(t, filepath.Join(local, "config.yaml"), "host edit\n", t0.Add(time.Minute))
+	writeFile(t, filepath.Join(remote, "config.yaml"), "agent edit!\n", t0.Add(2*time.Minute))
+	result := runSync(t, s)
+
+	if len(result.Conflicts) != 1 {
+		t.Fatalf("Conflicts = %v, want 1", result.Conflicts)
+	}
+	kept := result.Conflicts[0]
+	if !strings.HasPrefix(kept, "config.sync-conflict-") || !strings.HasSuffix(kept, ".yaml") {
+		t.Errorf("conflict copy name = %q", kept)
+	}
+
+	if got := readFile(t, filepath.Join(local, "config.yaml")); got != "host edit\n" {
+		t.Errorf("host version = %q, want host edit kept", got)
+	}
+	if got := readFile(t, filepath.Join(remote, "config.yaml")); got != "host edit\n" {
+		t.Errorf("container version = %q, want host edit pushed", got)
+	}
+	if got := readFile(t, filepath.Join(local, filepath.FromSlash(kept))); got != "agent edit!\n" {
+		t.Errorf("conflict copy = %q, want container edit", got)
+	}
+
+	// The conflict copy reaches the container on the next pass
+	runSync(t, s)
+	if got := readFile(t, filepath.Join(remote, filepath.FromSlash(kept))); got != "agent edit!\n" {
+		t.Errorf("conflict copy in container = %q", got)
+	}
+}
+
+func TestSyncerGitIgnore(t *testing.T) {
+	s, local, remote := newTestSyncer(t)
+	t0 := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(local, ".gitignore"), "node_modules/\n*.log\n", t0)
+	writeFile(t, filepath.Join(local, "node_modules", "dep", "index.js"), "x", t0)
+	writeFile(t, filepath.Join(local, "debug.log"), "x", t0)
+	writeFile(t, filepath.Join(local, "index.js"), "x", t0)
+
+	ignore, err := GitIgnore(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Ignore = ignore
+	runSync(t, s)
+
+	for _, p := range []string{"node_modules", "debug.log"} {
+		if _, err := os.Stat(filepath.Join(remote, p)); !os.IsNotExist(err) {
+			t.Errorf("%s should be ignored", p)
+		}
+	}
+	for _, p := range []string{".gitignore", "index.js"} {
+		if _, err := os.Stat(filepath.Join(remote, p)); err != nil {
+			t.Errorf("%s should be synced: %v", p, err)
+		}
+	}
+}
+
+func TestSyncerBasePersists(t *testing.T) {
+	s, local, remote := newTestSyncer(t)
+	t0 := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(local, "a.txt"), "a", t0)
+	runSync(t, s)
+
+	// A new syncer (next run) must see the deletion as a deletion, not a new file
+	if err := os.Remove(filepath.Join(remote, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	next := &Syncer{Local: s.Local, Remote: s.Remote, BaseFile: s.BaseFile}
+	runSync(t, next)
+
+	if _, err := os.Stat(filepath.Join(local, "a.txt")); !os.IsNotExist(err) {
+		t.Error("deletion in container was not synced to host after restart")
+	}
+}
+
+func TestConflictName(t *testing.T) {
+	ts := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	tests := map[string]string{
+		"main.go":    "main.sync-conflict-20260304-050607.go",
+		"dir/.env":   "dir/.env.sync-conflict-20260304-050607",
+		"Makefile":   "Makefile.sync-conflict-20260304-050607",
+		"a/b.tar.gz": "a/b.tar.sync-conflict-20260304-050607.gz",
+	}
+	for in, want := range tests {
+		if got := conflictName(in, ts); got != want {
+			t.Errorf("conflictName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -2,8 +2,8 @@
 package incus
 
 import (
-	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"runtime"
@@ -14,6 +14,7 @@ import (
 	"github.com/gorilla/websocket"
 	incus "github.com/lxc/incus/v6/client"
 	"github.com/lxc/incus/v6/shared/api"
+	"github.com/pkg/sftp"
 	"golang.org/x/sys/unix"
 	"golang.org/x/term"
 
@@ -387,62 +388,28 @@ func (c *Client) ListContainers(prefix string) ([]api.Instance, error) {
 	return filtered, nil
 }
 
-// ExecCommand executes a command inside the container.
+// ExecCommand executes a command inside the container as root with the
+// caller's stdio and returns its exit code.
 func (c *Client) ExecCommand(name string, command []string) (int, error) {
-	req := api.InstanceExecPost{
-		Command:     command,
-		WaitForWS:   true,
-		Interactive: false,
-	}
-
-	args := incus.InstanceExecArgs{
+	result, err := c.Exec(name, command, ExecOptions{
 		Stdin:  os.Stdin,
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
-	}
-
-	op, err := c.conn.ExecInstance(name, req, &args)
+	})
 	if err != nil {
 		return -1, err
 	}
-
-	if err := op.Wait(); err != nil {
-		return -1, err
-	}
-
-	opAPI := op.Get()
-	returnVal, ok := opAPI.Metadata["return"].(float64)
-	if !ok {
-		return -1, fmt.Errorf("unexpected return type in exec metadata")
-	}
-	return int(returnVal), nil
+	return result.ExitCode, nil
 }
 
-// ExecCommandWithOutput executes a command and returns stdout as a string.
+// ExecCommandWithOutput executes a command as root and returns stdout as a
+// string. Use Exec to also read stderr and the exit code.
 func (c *Client) ExecCommandWithOutput(name string, command []string) (string, error) {
-	req := api.InstanceExecPost{
-		Command:      command,
-		WaitForWS:    true,
-		Interactive:  false,
-		RecordOutput: false, // Use websocket streaming instead
-	}
-
-	var stdout, stderr bytes.Buffer
-	args := incus.InstanceExecArgs{
-		Stdout: &stdout,
-		Stderr: &stderr,
-	}
-
-	op, err := c.conn.ExecInstance(name, req, &args)
+	result, err := c.Exec(name, command, ExecOptions{})
 	if err != nil {
 		return "", err
 	}
-
-	if err := op.Wait(); err != nil {
-		return "", err
-	}
-
-	return stdout.String(), nil
+	return result.Stdout, nil
 }
 
 // ExecInteractive runs an interactive shell session inside the container using
@@ -450,6 +417,20 @@ func (c *Client) ExecCommandWithOutput(name string, command []string) (string, e
 // bladerunner backend where container IPs are not routable from the host).
 // If command is nil, defaults to ["bash"].
 func (c *Client) ExecInteractive(name string, command []string) (int, error) {
+	return c.ExecInteractiveWith(name, command, InteractiveOptions{})
+}
+
+// InteractiveOptions adds to an ExecInteractiveWith session.
+type InteractiveOptions struct {
+	// Env is added to the session's environment, overriding the defaults.
+	Env map[string]string
+	// Output, if non-nil, also receives everything written to the terminal.
+	Output io.Writer
+}
+
+// ExecInteractiveWith is ExecInteractive with extra environment and an
+// optional copy of the session's output.
+func (c *Client) ExecInteractiveWith(name string, command []string, opts InteractiveOptions) (int, error) {
 	if len(command) == 0 {
 		command = []string{"bash"}
 	}
@@ -469,6 +450,7 @@ func (c *Client) ExecInteractive(name string, command []string) (int, error) {
 		Width:       width,
 		Height:      height,
 		User:        1000, // agent user
+		Group:       1000,
 		Cwd:         "/home/agent",
 		Environment: map[string]string{
 			"TERM": os.Getenv("TERM"),
@@ -476,6 +458,9 @@ func (c *Client) ExecInteractive(name string, command []string) (int, error) {
 			"USER": "agent",
 		},
 	}
+	for k, v := range opts.Env {
+		req.Environment[k] = v
+	}
 
 	if req.Environment["TERM"] == "" {
 		req.Environment["TERM"] = "xterm-256color"
@@ -514,10 +499,15 @@ func (c *Client) ExecInteractive(name string, command []string) (int, error) {
 		}
 	}
 
+	var stdout io.Writer = os.Stdout
+	if opts.Output != nil {
+		stdout = io.MultiWriter(os.Stdout, opts.Output)
+	}
+
 	dataDone := make(chan bool)
 	args := incus.InstanceExecArgs{
 		Stdin:    os.Stdin,
-		Stdout:   os.Stdout,
+		Stdout:   stdout,
 		Stderr:   os.Stderr,
 		Control:  controlHandler,
 		DataDone: dataDone,
@@ -670,6 +660,15 @@ func (c *Client) GetStorageInfo() (*StorageInfo, error) {
 	}, nil
 }
 
+// StoragePoolDriver returns the storage driver (btrfs, zfs, dir, ...) of a pool.
+func (c *Client) StoragePoolDriver(pool string) (string, error) {
+	p, _, err := c.conn.GetStoragePool(pool)
+	if err != nil {
+		return "", fmt.Errorf("failed to get storage pool: %w", err)
+	}
+	return p.Driver, nil
+}
+
 // ImageExists checks if a local image alias exists.
 func (c *Client) ImageExists(alias string) bool {
 	_, _, err := c.conn.GetImageAlias(alias)
@@ -712,12 +711,7 @@ func (c *Client) Platform() Platform {
 
 // CreateSnapshot creates a snapshot of a container.
 func (c *Client) CreateSnapshot(containerName, snapshotName string, stateful bool) error {
-	req := api.InstanceSnapshotsPost{
-		Name:     snapshotName,
-		Stateful: stateful,
-	}
-
-	op, err := c.conn.CreateInstanceSnapshot(containerName, req)
+	op, err := c.conn.CreateInstanceSnapshot(containerName, snapshotRequest(snapshotName, stateful))
 	if err != nil {
 		return fmt.Errorf("failed to create snapshot: %w", err)
 	}
@@ -725,10 +719,23 @@ func (c *Client) CreateSnapshot(containerName, snapshotName string, stateful boo
 	return op.Wait()
 }
 
+// snapshotRequest builds the request for a manual snapshot. Without an
+// ExpiresAt, Incus applies the container's snapshots.expiry, which coop sets
+// for scheduled snapshots only; the zero time means never expire.
+func snapshotRequest(snapshotName string, stateful bool) api.InstanceSnapshotsPost {
+	return api.InstanceSnapshotsPost{
+		Name:      snapshotName,
+		Stateful:  stateful,
+		ExpiresAt: &time.Time{},
+	}
+}
+
 // RestoreSnapshot restores a container to a snapshot.
-func (c *Client) RestoreSnapshot(containerName, snapshotName string) error {
+// Set stateful=true to also restore the saved runtime state of a stateful snapshot.
+func (c *Client) RestoreSnapshot(containerName, snapshotName string, stateful bool) error {
 	req := api.InstancePut{
-		Restore: snapshotName,
+		Restore:  snapshotName,
+		Stateful: stateful,
 	}
 
 	op, err := c.conn.UpdateInstance(containerName, req, "")
@@ -748,6 +755,68 @@ func (c *Client) ListSnapshots(containerName string) ([]api.InstanceSnapshot, er
 	return snapshots, nil
 }
 
+// GetSnapshot returns a single snapshot of a container.
+func (c *Client) GetSnapshot(containerName, snapshotName string) (*api.InstanceSnapshot, error) {
+	snapshot, _, err := c.conn.GetInstanceSnapshot(containerName, snapshotName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// CopySnapshot copies a container snapshot to a new (stopped) container.
+// The copy is a scratch filesystem: it gets no snapshot schedule and no
+// devices beyond its root disk.
+func (c *Client) CopySnapshot(containerName, snapshotName, newName string) error {
+	snapshot, _, err := c.conn.GetInstanceSnapshot(containerName, snapshotName)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	snapshot.Config, snapshot.Devices = scratchConfig(snapshot.Config, snapshot.Devices)
+
+	op, err := c.conn.CopyInstanceSnapshot(c.conn, containerName, *snapshot, &incus.InstanceSnapshotCopyArgs{
+		Name: newName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy snapshot: %w", err)
+	}
+
+	if err := op.Wait(); err != nil {
+		return fmt.Errorf("snapshot copy failed: %w", err)
+	}
+	return nil
+}
+
+// scratchConfig drops the snapshot schedule, so the copy takes no snapshots
+// of its own, and every device but the root disk, so it holds no mounts,
+// proxies or passthrough devices.
+func scratchConfig(config map[string]string, devices map[string]map[string]string) (map[string]string, map[string]map[string]string) {
+	scratch := make(map[string]string, len(config))
+	for k, v := range config {
+		if !strings.HasPrefix(k, "snapshots.") {
+			scratch[k] = v
+		}
+	}
+	scratchDevices := make(map[string]map[string]string)
+	for name, dev := range devices {
+		if dev["type"] == "disk" && dev["path"] == "/" {
+			scratchDevices[name] = dev
+		}
+	}
+	return scratch, scratchDevices
+}
+
+// SFTP returns an SFTP client for a container's filesystem.
+// This works for stopped containers too; Incus mounts the storage as needed.
+// The caller must Close the client.
+func (c *Client) SFTP(containerName string) (*sftp.Client, error) {
+	client, err := c.conn.GetInstanceFileSFTP(containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file transfer session: %w", err)
+	}
+	return client, nil
+}
+
 // DeleteSnapshot deletes a snapshot.
 func (c *Client) DeleteSnapshot(containerName, snapshotName string) error {
 	op, err := c.conn.DeleteInstanceSnapshot(containerName, snapshotName)
@@ -757,6 +826,32 @@ func (c *Client) DeleteSnapshot(containerName, snapshotName string) error {
 	return op.Wait()
 }
 
+// UpdateConfig sets instance config keys on a container.
+// Keys with an empty value are removed from the config.
+func (c *Client) UpdateConfig(containerName string, config map[string]string) error {
+	instance, etag, err := c.conn.GetInstance(containerName)
+	if err != nil {
+		return fmt.Errorf("failed to get container: %w", err)
+	}
+
+	if instance.Config == nil {
+		instance.Config = make(map[string]string)
+	}
+	for k, v := range config {
+		if v == "" {
+			delete(instance.Config, k)
+		} else {
+			instance.Config[k] = v
+		}
+	}
+
+	op, err := c.conn.UpdateInstance(containerName, instance.Writable(), etag)
+	if err != nil {
+		return fmt.Errorf("failed to update config: %w", err)
+	}
+	return op.Wait()
+}
+
 // AddDevice adds a device to a container.
 func (c *Client) AddDevice(containerName, deviceName string, device map[string]string) error {
 	instance, etag, err := c.conn.GetInstance(containerName)
@@ -0,0 +1,92 @@
+package incus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRequestNeverExpires(t *testing.T) {
+	for _, stateful := range []bool{false, true} {
+		req := snapshotRequest("s1", stateful)
+		if req.Name != "s1" || req.Stateful != stateful {
+			t.Errorf("snapshotRequest() = %+v", req)
+		}
+		// A nil ExpiresAt would inherit the schedule's snapshots.expiry
+		if req.ExpiresAt == nil || !req.ExpiresAt.IsZero() {
+			t.Errorf("snapshotRequest(stateful=%v).ExpiresAt = %v, want zero time", stateful, req.ExpiresAt)
+		}
+	}
+}
+
+func TestScratchConfig(t *testing.T) {
+	config := map[string]string{
+		"snapshots.schedule":       "*/30 * * * *",
+		"snapshots.expiry":         "6H",
+		"snapshots.pattern":        "auto-{{ creation_date }}",
+		"limits.processes":         "500",
+		"user.coop.snapshot.every": "30m",
+	}
+	devices := map[string]map[string]string{
+		"root":      {"type": "disk", "path": "/", "pool": "default", "size": "20GiB"},
+		"workspace": {"type": "disk", "path": "/home/agent/workspace", "source": "/Users/me/src"},
+		"ssh":       {"type": "proxy", "listen": "tcp:127.0.0.1:2222", "connect": "tcp:127.0.0.1:22"},
+		"kvm":       {"type": "unix-char", "source": "/dev/kvm"},
+	}
+
+	gotConfig, gotDevices := scratchConfig(config, devices)
+	for k := range gotConfig {
+		if strings.HasPrefix(k, "snapshots.") {
+			t.Errorf("copy kept %s", k)
+		}
+	}
+	if gotConfig["limits.processes"] != "500" || gotConfig["user.coop.snapshot.every"] != "30m" {
+		t.Errorf("copy lost other config: %v", gotConfig)
+	}
+	if len(gotDevices) != 1 || gotDevices["root"]["size"] != "20GiB" {
+		t.Errorf("devices = %v, want only root", gotDevices)
+	}
+	if len(config) != 5 || len(devices) != 4 {
+		t.Error("scratchConfig modified its input")
+	}
+}
+
+func TestWaitExec(t *testing.T) {
+	defer func(d time.Duration) { execDrainTimeout = d }(execDrainTimeout)
+	execDrainTimeout = 10 * time.Millisecond
+	cancelled := errors.New("operation cancelled")
+
+	tests := []struct {
+		name        string
+		drain       bool // DataDone closes
+		waitErr     error
+		wantDrained bool
+	}{
+		{"completed", true, nil, true},
+		{"failed after connecting", true, cancelled, true},
+		{"cancelled before connecting", false, cancelled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDone := make(chan bool)
+			if tt.drain {
+				close(dataDone)
+			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				drained, err := waitExec(func() error { return tt.waitErr }, dataDone)
+				if drained != tt.wantDrained || !errors.Is(err, tt.waitErr) {
+					t.Errorf("waitExec() = %v, %v, want %v, %v", drained, err, tt.wantDrained, tt.waitErr)
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("waitExec() blocked")
+			}
+		})
+	}
+}
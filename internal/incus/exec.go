@@ -0,0 +1,160 @@
+package incus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	incus "github.com/lxc/incus/v6/client"
+	"github.com/lxc/incus/v6/shared/api"
+	"golang.org/x/sys/unix"
+)
+
+// ErrExecTimeout is returned when a command is killed for exceeding ExecOptions.Timeout.
+var ErrExecTimeout = errors.New("command timed out")
+
+// execDrainTimeout bounds the wait for output once the exec operation has
+// ended. An operation cancelled before its websockets connected never
+// signals DataDone.
+var execDrainTimeout = 5 * time.Second
+
+// ExecOptions configures a non-interactive command run with Exec.
+// The zero value runs the command as root in the image's default
+// directory with no input and captures both output streams.
+type ExecOptions struct {
+	// User and Group are the uid and gid to run as (0 is root).
+	User  uint32
+	Group uint32
+
+	// Cwd is the working directory inside the container.
+	Cwd string
+
+	// Env is added to the container's default environment.
+	Env map[string]string
+
+	// Stdin is the command's input. Nil means no input.
+	Stdin io.Reader
+
+	// Stdout and Stderr stream output as it arrives. A nil writer
+	// captures that stream into ExecResult instead.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Timeout kills the command after the given duration. Zero means no limit.
+	Timeout time.Duration
+}
+
+// ExecResult is the outcome of a command run with Exec.
+type ExecResult struct {
+	ExitCode int
+	Stdout   string // Only set when ExecOptions.Stdout is nil
+	Stderr   string // Only set when ExecOptions.Stderr is nil
+	Duration time.Duration
+}
+
+// Exec runs a command inside the container and waits for it to finish.
+// A non-zero exit code is reported in the result, not as an error. On
+// timeout the command is killed and the partial result is returned with
+// ErrExecTimeout.
+func (c *Client) Exec(name string, command []string, opts ExecOptions) (*ExecResult, error) {
+	req := api.InstanceExecPost{
+		Command:     command,
+		WaitForWS:   true,
+		Interactive: false,
+		Environment: opts.Env,
+		User:        opts.User,
+		Group:       opts.Group,
+		Cwd:         opts.Cwd,
+	}
+
+	var stdout, stderr bytes.Buffer
+	dataDone := make(chan bool)
+	controls := make(chan *websocket.Conn, 1)
+	args := incus.InstanceExecArgs{
+		Stdin:    opts.Stdin,
+		Stdout:   opts.Stdout,
+		Stderr:   opts.Stderr,
+		Control:  func(conn *websocket.Conn) { controls <- conn },
+		DataDone: dataDone,
+	}
+	if args.Stdout == nil {
+		args.Stdout = &stdout
+	}
+	if args.Stderr == nil {
+		args.Stderr = &stderr
+	}
+
+	started := time.Now()
+	op, err := c.conn.ExecInstance(name, req, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	var timedOut atomic.Bool
+	if opts.Timeout > 0 {
+		timer := time.AfterFunc(opts.Timeout, func() {
+			timedOut.Store(true)
+			select {
+			case control := <-controls:
+				_ = control.WriteJSON(api.InstanceExecControl{
+					Command: "signal",
+					Signal:  int(unix.SIGKILL),
+				})
+			default:
+				_ = op.Cancel()
+			}
+		})
+		defer timer.Stop()
+	}
+
+	drained, waitErr := waitExec(op.Wait, dataDone)
+
+	result := &ExecResult{
+		ExitCode: -1,
+		Duration: time.Since(started),
+	}
+	// Undrained buffers may still be written to
+	if drained {
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+	}
+	if returnVal, ok := op.Get().Metadata["return"].(float64); ok {
+		result.ExitCode = int(returnVal)
+	}
+
+	if timedOut.Load() {
+		return result, fmt.Errorf("%w after %s", ErrExecTimeout, opts.Timeout)
+	}
+	if waitErr != nil {
+		return result, waitErr
+	}
+	if result.ExitCode < 0 {
+		return result, fmt.Errorf("unexpected return type in exec metadata")
+	}
+	return result, nil
+}
+
+// waitExec waits for an exec operation and for its output to drain, and
+// reports whether it drained. Output usually drains before the operation
+// ends, but if the operation ends first (cancelled or failed) it waits at
+// most execDrainTimeout.
+func waitExec(wait func() error, dataDone <-chan bool) (bool, error) {
+	opDone := make(chan error, 1)
+	go func() { opDone <- wait() }()
+
+	select {
+	case <-dataDone:
+		return true, <-opDone
+	case err := <-opDone:
+		select {
+		case <-dataDone:
+			return true, err
+		case <-time.After(execDrainTimeout):
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package recording writes and replays terminal sessions as asciicast v2
+// files (https://docs.asciinema.org/manual/asciicast/v2/).
+//
+// A recording is a JSON header line followed by one JSON array per event:
+// [seconds, "o", data] for output and [seconds, "m", label] for markers.
+// Coop ends each recording with an "exit <code>" marker so listings can
+// show how the session ended; players that do not know markers skip them.
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Header is the first line of an asciicast v2 file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// exitMarkerPrefix labels the marker written by Recorder.Close.
+const exitMarkerPrefix = "exit "
+
+// Recorder appends terminal output to an asciicast file. It is safe for
+// concurrent use, so stdout and stderr can share one recorder.
+type Recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	w       *bufio.Writer
+	started time.Time
+	pending []byte // Incomplete UTF-8 sequence held back from the last write
+}
+
+// Create starts a new recording at path.
+func Create(path string, header Header) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{file: f, w: bufio.NewWriter(f), started: time.Now()}
+	header.Version = 2
+	if header.Timestamp == 0 {
+		header.Timestamp = r.started.Unix()
+	}
+	if err := r.writeLine(header); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write records p as an output event. It never fails the caller's stream:
+// a broken recording must not break the session being recorded.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending, p...)
+	cut := completeUTF8(data)
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		_ = r.event("o", string(data[:cut]))
+	}
+	return len(p), nil
+}
+
+// Close records the exit code and closes the file.
+func (r *Recorder) Close(exitCode int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		_ = r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	if err := r.event("m", exitMarkerPrefix+strconv.Itoa(exitCode)); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	if err := r.w.Flush(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+func (r *Recorder) event(kind, data string) error {
+	elapsed := time.Since(r.started).Seconds()
+	return r.writeLine([]any{json.Number(strconv.FormatFloat(elapsed, 'f', 6, 64)), kind, data})
+}
+
+func (r *Recorder) writeLine(v any) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	// Flush each event so a crash or kill loses at most the current one.
+	return r.w.Flush()
+}
+
+// completeUTF8 returns the length of the longest prefix of b that does not
+// end in the middle of a UTF-8 sequence.
+func completeUTF8(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(b[i]) {
+			continue
+		}
+		if !utf8.FullRune(b[i:]) {
+			return i
+		}
+		break
+	}
+	return len(b)
+}
+
+// Event is one recorded event.
+type Event struct {
+	Time float64
+	Kind string
+	Data string
+}
+
+// Read parses an asciicast v2 file.
+func Read(path string) (*Header, []Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("%s: empty recording", path)
+	}
+	var header Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, fmt.Errorf("%s: invalid header: %w", path, err)
+	}
+	if header.Version != 2 {
+		return nil, nil, fmt.Errorf("%s: unsupported asciicast version %d", path, header.Version)
+	}
+
+	var events []Event
+	for line := 2; scanner.Scan(); line++ {
+		var raw []any
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil || len(raw) != 3 {
+			return nil, nil, fmt.Errorf("%s:%d: invalid event", path, line)
+		}
+		t, ok1 := raw[0].(float64)
+		kind, ok2 := raw[1].(string)
+		data, ok3 := raw[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, nil, fmt.Errorf("%s:%d: invalid event", path, line)
+		}
+		events = append(events, Event{Time: t, Kind: kind, Data: data})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return &header, events, nil
+}
+
+// Info summarizes a recording for listings.
+type Info struct {
+	Header   Header
+	Duration time.Duration
+	ExitCode *int // Nil if the session did not end cleanly
+}
+
+// Stat reads a recording's header, duration and exit code.
+func Stat(path string) (*Info, error) {
+	header, events, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{Header: *header}
+	if len(events) > 0 {
+		last := events[len(events)-1]
+		info.Duration = time.Duration(last.Time * float64(time.Second))
+		if last.Kind == "m" && strings.HasPrefix(last.Data, exitMarkerPrefix) {
+			if code, err := strconv.Atoi(strings.TrimPrefix(last.Data, exitMarkerPrefix)); err == nil {
+				info.ExitCode = &code
+			}
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,100 @@
+package recording
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.cast")
+
+	rec, err := Create(path, Header{Width: 80, Height: 24, Command: "bash"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	_, _ = rec.Write([]byte("hello "))
+	// Split a multi-byte rune across writes
+	snowman := []byte("☃\n")
+	_, _ = rec.Write(snowman[:1])
+	_, _ = rec.Write(snowman[1:])
+	if err := rec.Close(3); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	header, events, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Command != "bash" || header.Timestamp == 0 {
+		t.Errorf("header = %+v", header)
+	}
+
+	var output strings.Builder
+	for _, e := range events {
+		if e.Kind == "o" {
+			output.WriteString(e.Data)
+		}
+	}
+	if output.String() != "hello ☃\n" {
+		t.Errorf("output = %q", output.String())
+	}
+
+	info, err := Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.ExitCode == nil || *info.ExitCode != 3 {
+		t.Errorf("ExitCode = %v, want 3", info.ExitCode)
+	}
+}
+
+func TestCreateDoesNotOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.cast")
+	if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(path, Header{}); err == nil {
+		t.Error("Create should refuse to overwrite an existing recording")
+	}
+}
+
+func TestStatUnfinished(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.cast")
+	data := `{"version": 2, "width": 80, "height": 24}` + "\n" + `[0.5, "o", "hi"]` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.ExitCode != nil {
+		t.Errorf("ExitCode = %d, want nil", *info.ExitCode)
+	}
+	if info.Duration != 500*time.Millisecond {
+		t.Errorf("Duration = %v", info.Duration)
+	}
+}
+
+func TestCompleteUTF8(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"a☃", 4},
+		{"a\xe2\x98", 1},
+		{"a\xe2", 1},
+		{"\xff", 1}, // Invalid bytes are passed through
+	}
+	for _, tt := range tests {
+		if got := completeUTF8([]byte(tt.in)); got != tt.want {
+			t.Errorf("completeUTF8(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
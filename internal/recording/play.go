@@ -0,0 +1,67 @@
+package recording
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// PlayOptions controls replay timing.
+type PlayOptions struct {
+	Speed   float64       // Playback speed multiplier (default 1)
+	MaxIdle time.Duration // Cap pauses between events (0 for no cap)
+}
+
+// Play writes a recording's output events to w with their original timing.
+// It returns early without error when ctx is cancelled.
+func Play(ctx context.Context, path string, w io.Writer, opts PlayOptions) error {
+	_, events, err := Read(path)
+	if err != nil {
+		return err
+	}
+
+	for _, delay := range playDelays(events, opts) {
+		if delay.wait > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(delay.wait):
+			}
+		}
+		if _, err := io.WriteString(w, delay.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type playStep struct {
+	wait time.Duration
+	data string
+}
+
+// playDelays turns output events into writes preceded by how long to wait.
+func playDelays(events []Event, opts PlayOptions) []playStep {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+
+	var steps []playStep
+	var last float64
+	for _, e := range events {
+		if e.Kind != "o" {
+			continue
+		}
+		wait := time.Duration((e.Time - last) / speed * float64(time.Second))
+		last = e.Time
+		if wait < 0 {
+			wait = 0
+		}
+		if opts.MaxIdle > 0 && wait > opts.MaxIdle {
+			wait = opts.MaxIdle
+		}
+		steps = append(steps, playStep{wait: wait, data: e.Data})
+	}
+	return steps
+}
@@ -0,0 +1,25 @@
+package recording
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlayDelays(t *testing.T) {
+	events := []Event{
+		{Time: 1, Kind: "o", Data: "a"},
+		{Time: 1.5, Kind: "m", Data: "marker"},
+		{Time: 11, Kind: "o", Data: "b"},
+	}
+
+	steps := playDelays(events, PlayOptions{Speed: 2, MaxIdle: 2 * time.Second})
+	if len(steps) != 2 {
+		t.Fatalf("got %d steps, want 2", len(steps))
+	}
+	if steps[0].wait != 500*time.Millisecond || steps[0].data != "a" {
+		t.Errorf("steps[0] = %+v", steps[0])
+	}
+	if steps[1].wait != 2*time.Second || steps[1].data != "b" {
+		t.Errorf("steps[1] = %+v", steps[1])
+	}
+}
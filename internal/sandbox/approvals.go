@@ -0,0 +1,622 @@
+// Package sandbox provides the queue of privileged actions agents request from the host.
+package sandbox
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pkg/sftp"
+	"github.com/stuffbucket/coop/internal/audit"
+	"github.com/stuffbucket/coop/internal/config"
+)
+
+const (
+	// requestDevice is the proxy device relaying coop-request to the host.
+	requestDevice = "coop-request"
+	// RequestSocket is where coop-request reaches the host inside a
+	// container. It sits outside /run and /tmp, which are emptied at boot
+	// after Incus has created it.
+	RequestSocket = "/var/lib/coop-request.sock"
+	// requestTokenKey records the token identifying a container's requests.
+	requestTokenKey = "user.coop.request_token"
+	// SecretsDir holds secrets delivered to a container. It is on tmpfs,
+	// so they are gone when the container stops. It belongs to root with
+	// mode 0711, so the agent can read a secret it knows the name of but
+	// cannot plant anything for the host to write through.
+	SecretsDir = "/run/coop/secrets"
+	// DefaultApprovalsPort is the host port requests arrive on from a VM.
+	DefaultApprovalsPort = 7787
+)
+
+// ApprovalKind is what an agent asks for.
+type ApprovalKind string
+
+const (
+	ApprovalMount  ApprovalKind = "mount"  // A host directory mounted in the container
+	ApprovalExpose ApprovalKind = "expose" // A host port reachable from the container
+	ApprovalSecret ApprovalKind = "secret" // A value typed in by the user
+)
+
+// ApprovalStatus is where a request stands.
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalDenied   ApprovalStatus = "denied"
+	ApprovalFailed   ApprovalStatus = "failed" // Approved, but could not be applied
+)
+
+// Approval is a request from an agent for something only the host can grant.
+type Approval struct {
+	ID        string            `json:"id"`
+	Container string            `json:"container"`
+	Kind      ApprovalKind      `json:"kind"`
+	Args      map[string]string `json:"args,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Summary   string            `json:"summary"`
+	Status    ApprovalStatus    `json:"status"`
+	Requested time.Time         `json:"requested"`
+	Decided   time.Time         `json:"decided,omitzero"`
+	// Result tells the agent where to find what it was granted.
+	Result string `json:"result,omitempty"`
+	// Error is why a request was denied or failed.
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	validApprovalID = regexp.MustCompile(`^[a-f0-9]{6}$`)
+	validSecretName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+	validMountName  = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+)
+
+// maxReasonLen caps the reason an agent gives, which is shown to the user.
+const maxReasonLen = 500
+
+// maxPendingApprovals caps the undecided requests one container can queue.
+const maxPendingApprovals = 10
+
+// submitMu serializes submissions so the pending cap holds under
+// concurrent requests.
+var submitMu sync.Mutex
+
+// approvalsDir holds one JSON file per request and, for local Incus, the
+// socket requests arrive on. It is blocked by the seatbelt so no container
+// can approve its own requests.
+func approvalsDir() string {
+	return filepath.Join(config.GetDirectories().Data, "approvals")
+}
+
+func approvalPath(id string) string {
+	return filepath.Join(approvalsDir(), id+".json")
+}
+
+// stripControl removes control characters, which could move the cursor or
+// rewrite the terminal when a request is shown. Line breaks and tabs
+// become spaces.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// normalizeApproval validates a request's arguments and fills in defaults.
+func normalizeApproval(kind ApprovalKind, args map[string]string) (map[string]string, error) {
+	clean := make(map[string]string, len(args))
+	for k, v := range args {
+		clean[k] = stripControl(v)
+	}
+	args = clean
+
+	switch kind {
+	case ApprovalMount:
+		source := expandPath(args["source"])
+		if !filepath.IsAbs(source) {
+			return nil, fmt.Errorf("mount source must be an absolute host path, got %q", args["source"])
+		}
+		source = filepath.Clean(source)
+		name := args["name"]
+		if name == "" {
+			name = strings.ToLower(filepath.Base(source))
+		}
+		if !validMountName.MatchString(name) {
+			return nil, fmt.Errorf("invalid mount name %q", name)
+		}
+		target := args["path"]
+		if target == "" {
+			target = AgentHome + "/" + name
+		}
+		if !path.IsAbs(target) || path.Clean(target) == "/" {
+			return nil, fmt.Errorf("mount path must be an absolute container path below /, got %q", target)
+		}
+		readonly := args["readonly"] == "true"
+		return map[string]string{
+			"source":   source,
+			"name":     name,
+			"path":     path.Clean(target),
+			"readonly": strconv.FormatBool(readonly),
+		}, nil
+
+	case ApprovalExpose:
+		port, err := parsePort(args["port"])
+		if err != nil {
+			return nil, err
+		}
+		containerPort := port
+		if args["container_port"] != "" {
+			if containerPort, err = parsePort(args["container_port"]); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]string{"port": strconv.Itoa(port), "container_port": strconv.Itoa(containerPort)}, nil
+
+	case ApprovalSecret:
+		if !validSecretName.MatchString(args["name"]) {
+			return nil, fmt.Errorf("invalid secret name %q (use letters, digits and _)", args["name"])
+		}
+		return map[string]string{"name": args["name"]}, nil
+	}
+	return nil, fmt.Errorf("unknown request kind %q (use mount, expose or secret)", kind)
+}
+
+// approvalSummary describes a request in a line.
+func approvalSummary(kind ApprovalKind, args map[string]string) string {
+	switch kind {
+	case ApprovalMount:
+		s := fmt.Sprintf("mount %s at %s", args["source"], args["path"])
+		if args["readonly"] == "true" {
+			s += " (read-only)"
+		}
+		return s
+	case ApprovalExpose:
+		return fmt.Sprintf("expose host port %s on container port %s", args["port"], args["container_port"])
+	case ApprovalSecret:
+		return "secret " + args["name"]
+	}
+	return string(kind)
+}
+
+// SubmitApproval queues a request from a container and audits it. A
+// container can have at most maxPendingApprovals undecided requests.
+func SubmitApproval(container string, kind ApprovalKind, args map[string]string, reason string) (*Approval, error) {
+	args, err := normalizeApproval(kind, args)
+	if err != nil {
+		return nil, err
+	}
+	reason = strings.TrimSpace(stripControl(reason))
+	if len(reason) > maxReasonLen {
+		reason = strings.ToValidUTF8(reason[:maxReasonLen], "")
+	}
+
+	submitMu.Lock()
+	defer submitMu.Unlock()
+	existing, err := ListApprovals()
+	if err != nil {
+		return nil, err
+	}
+	pending := 0
+	for _, e := range existing {
+		if e.Container == container && e.Status == ApprovalPending {
+			pending++
+		}
+	}
+	if pending >= maxPendingApprovals {
+		return nil, fmt.Errorf("%s already has %d pending requests; wait for them to be decided", container, pending)
+	}
+
+	a := &Approval{
+		ID:        newJobID(),
+		Container: container,
+		Kind:      kind,
+		Args:      args,
+		Reason:    reason,
+		Summary:   approvalSummary(kind, args),
+		Status:    ApprovalPending,
+		Requested: time.Now().UTC(),
+	}
+	if err := saveApproval(a); err != nil {
+		return nil, err
+	}
+	auditOp(audit.Entry{Op: "approval.request", Actor: "agent@" + container, Container: container, Args: approvalAuditArgs(a)}, nil)
+	return a, nil
+}
+
+func approvalAuditArgs(a *Approval) map[string]string {
+	args := map[string]string{"id": a.ID, "kind": string(a.Kind)}
+	for k, v := range a.Args {
+		args[k] = v
+	}
+	if a.Reason != "" {
+		args["reason"] = a.Reason
+	}
+	return args
+}
+
+// LoadApproval reads a request by id.
+func LoadApproval(id string) (*Approval, error) {
+	if !validApprovalID.MatchString(id) {
+		return nil, fmt.Errorf("invalid request id %q", id)
+	}
+	data, err := os.ReadFile(approvalPath(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no request %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var a Approval
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("invalid request %s: %w", id, err)
+	}
+	return &a, nil
+}
+
+// ListApprovals returns every request, oldest first.
+func ListApprovals() ([]Approval, error) {
+	entries, err := os.ReadDir(approvalsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var approvals []Approval
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		a, err := LoadApproval(id)
+		if err != nil {
+			continue
+		}
+		approvals = append(approvals, *a)
+	}
+	sort.Slice(approvals, func(i, j int) bool { return approvals[i].Requested.Before(approvals[j].Requested) })
+	return approvals, nil
+}
+
+func saveApproval(a *Approval) error {
+	if err := os.MkdirAll(approvalsDir(), 0o700); err != nil {
+		return fmt.Errorf("create approvals dir: %w", err)
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := approvalPath(a.ID) + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, approvalPath(a.ID))
+}
+
+// pendingApproval loads a request that has not been decided yet.
+func pendingApproval(id string) (*Approval, error) {
+	a, err := LoadApproval(id)
+	if err != nil {
+		return nil, err
+	}
+	if a.Status != ApprovalPending {
+		return a, fmt.Errorf("request %s is already %s", id, a.Status)
+	}
+	return a, nil
+}
+
+// DenyApproval refuses a pending request, telling the agent why.
+func DenyApproval(id, why string) (a *Approval, err error) {
+	if a, err = pendingApproval(id); err != nil {
+		return a, err
+	}
+	a.Status = ApprovalDenied
+	a.Decided = time.Now().UTC()
+	a.Error = why
+	if err := saveApproval(a); err != nil {
+		return a, err
+	}
+	auditOp(audit.Entry{Op: "approval.deny", Container: a.Container, Args: approvalAuditArgs(a), Outcome: audit.OutcomeDenied}, nil)
+	return a, nil
+}
+
+// ApproveRequest applies a pending request through the manager. auth
+// records how the approval was authorized and secret is the value for a
+// secret request. force lets a mount or port past the seatbelt; protected
+// paths still go through the Authorizer.
+func (m *Manager) ApproveRequest(id, auth, secret string, force bool) (a *Approval, err error) {
+	if a, err = pendingApproval(id); err != nil {
+		return a, err
+	}
+	entry := audit.Entry{Op: "approval.approve", Container: a.Container, Args: approvalAuditArgs(a), Auth: auth}
+	defer func() { auditOp(entry, err) }()
+
+	result, err := m.applyApproval(a, secret, force)
+	a.Decided = time.Now().UTC()
+	if err != nil {
+		a.Status = ApprovalFailed
+		a.Error = err.Error()
+	} else {
+		a.Status = ApprovalApproved
+		a.Result = result
+	}
+	if saveErr := saveApproval(a); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return a, err
+}
+
+func (m *Manager) applyApproval(a *Approval, secret string, force bool) (string, error) {
+	switch a.Kind {
+	case ApprovalMount:
+		devices, err := m.client.ListDevices(a.Container)
+		if err != nil {
+			return "", containerNotFound(a.Container)
+		}
+		if _, exists := devices[a.Args["name"]]; exists {
+			return "", fmt.Errorf("%s already has a device named %s", a.Container, a.Args["name"])
+		}
+		err = m.Mount(a.Container, a.Args["name"], a.Args["source"], a.Args["path"], a.Args["readonly"] == "true", force)
+		return "mounted at " + a.Args["path"], err
+
+	case ApprovalExpose:
+		port, _ := strconv.Atoi(a.Args["port"])
+		containerPort, _ := strconv.Atoi(a.Args["container_port"])
+		err := m.Expose(a.Container, "host", port, containerPort, force)
+		return fmt.Sprintf("host port %d is at 127.0.0.1:%d", port, containerPort), err
+
+	case ApprovalSecret:
+		if secret == "" {
+			return "", errors.New("no secret value given")
+		}
+		target, err := m.writeSecret(a.Container, a.Args["name"], secret)
+		return "written to " + target, err
+	}
+	return "", fmt.Errorf("unknown request kind %q", a.Kind)
+}
+
+// writeSecret puts a secret in SecretsDir, readable only by the agent.
+func (m *Manager) writeSecret(name, secretName, value string) (string, error) {
+	if err := m.requireRunning(name); err != nil {
+		return "", err
+	}
+	client, err := m.client.SFTP(name)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = client.Close() }()
+	return writeSecretFile(client, secretName, value)
+}
+
+// writeSecretFile writes a secret as root over SFTP, which follows
+// symlinks. Nothing on the way may be the agent's: SecretsDir and its
+// parent are made root's real directories, and the secret is created
+// afresh with O_EXCL and handed to the agent through the open file.
+func writeSecretFile(client *sftp.Client, secretName, value string) (string, error) {
+	parent := path.Dir(SecretsDir)
+	if err := client.MkdirAll(parent); err != nil {
+		return "", fmt.Errorf("create %s: %w", parent, err)
+	}
+	if err := ownRootDir(client, parent, 0o755); err != nil {
+		return "", err
+	}
+	if _, err := client.Lstat(SecretsDir); errors.Is(err, os.ErrNotExist) {
+		if err := client.Mkdir(SecretsDir); err != nil {
+			return "", fmt.Errorf("create %s: %w", SecretsDir, err)
+		}
+	}
+	// Earlier versions gave SecretsDir to the agent; this takes it back
+	if err := ownRootDir(client, SecretsDir, 0o711); err != nil {
+		return "", err
+	}
+
+	target := path.Join(SecretsDir, secretName)
+	if err := client.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("replace %s: %w", target, err)
+	}
+	f, err := client.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return "", fmt.Errorf("create %s: %w", target, err)
+	}
+	if err := f.Chmod(0o600); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if _, err := f.Write([]byte(value)); err != nil {
+		_ = f.Close()
+		return "", fmt.Errorf("write %s: %w", target, err)
+	}
+	if err := f.Chown(AgentUID, AgentUID); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return target, f.Close()
+}
+
+// ownRootDir gives dir to root with mode, refusing anything but a real
+// directory.
+func ownRootDir(client *sftp.Client, dir string, mode os.FileMode) error {
+	info, err := client.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if err := client.Chown(dir, 0, 0); err != nil {
+		return err
+	}
+	return client.Chmod(dir, mode)
+}
+
+// newRequestToken returns a random token identifying a container's requests.
+func newRequestToken() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// requestSocketPath is the host socket requests arrive on with local Incus.
+func requestSocketPath() string {
+	return filepath.Join(approvalsDir(), "request.sock")
+}
+
+func (m *Manager) approvalsPort() int {
+	if port := m.config.Settings.Approvals.Port; port > 0 {
+		return port
+	}
+	return DefaultApprovalsPort
+}
+
+// requestConnect is where a container's request device connects from the
+// Incus host: the socket when Incus runs here, or the port from a VM.
+func (m *Manager) requestConnect() (string, error) {
+	switch backend := m.client.BackendName(); backend {
+	case "":
+		return "unix:" + requestSocketPath(), nil
+	case "colima", "lima":
+		return "tcp:" + net.JoinHostPort(limaHostIP, strconv.Itoa(m.approvalsPort())), nil
+	default:
+		return "", fmt.Errorf("the %s backend cannot reach this machine", backend)
+	}
+}
+
+// addRequestDevice relays RequestSocket in the container to the host.
+func (m *Manager) addRequestDevice(name string) error {
+	connect, err := m.requestConnect()
+	if err != nil {
+		return err
+	}
+	return m.client.AddDevice(name, requestDevice, map[string]string{
+		"type":    "proxy",
+		"bind":    "instance",
+		"listen":  "unix:" + RequestSocket,
+		"connect": connect,
+		"uid":     strconv.Itoa(AgentUID),
+		"gid":     strconv.Itoa(AgentUID),
+		"mode":    "0660",
+	})
+}
+
+// RequestListener listens where request devices connect to.
+func (m *Manager) RequestListener() (net.Listener, error) {
+	connect, err := m.requestConnect()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(connect, "tcp:") {
+		return net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(m.approvalsPort())))
+	}
+
+	if err := os.MkdirAll(approvalsDir(), 0o700); err != nil {
+		return nil, fmt.Errorf("create approvals dir: %w", err)
+	}
+	sock := requestSocketPath()
+	_ = os.Remove(sock) // Left behind by a server that did not exit cleanly
+	return net.Listen("unix", sock)
+}
+
+// requestContainer returns the container a request token belongs to.
+func (m *Manager) requestContainer(token string) (string, error) {
+	instances, err := m.client.ListContainers("")
+	if err != nil {
+		return "", err
+	}
+	for _, inst := range instances {
+		want := inst.Config[requestTokenKey]
+		if want != "" && subtle.ConstantTimeCompare([]byte(want), []byte(token)) == 1 {
+			return inst.Name, nil
+		}
+	}
+	return "", errors.New("unknown request token")
+}
+
+// RequestHandler serves coop-request. New requests are queued, audited
+// and passed to notify.
+func (m *Manager) RequestHandler(notify func(*Approval)) http.Handler {
+	return requestHandler(m.requestContainer, notify)
+}
+
+func requestHandler(lookup func(token string) (string, error), notify func(*Approval)) http.Handler {
+	authenticate := func(w http.ResponseWriter, r *http.Request) (string, bool) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeRequestJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing request token"})
+			return "", false
+		}
+		container, err := lookup(token)
+		if err != nil {
+			writeRequestJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return "", false
+		}
+		return container, true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/requests", func(w http.ResponseWriter, r *http.Request) {
+		container, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			Kind   ApprovalKind      `json:"kind"`
+			Args   map[string]string `json:"args"`
+			Reason string            `json:"reason"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body); err != nil {
+			writeRequestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+		a, err := SubmitApproval(container, body.Kind, body.Args, body.Reason)
+		if err != nil {
+			writeRequestJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if notify != nil {
+			notify(a)
+		}
+		writeRequestJSON(w, http.StatusCreated, a)
+	})
+	mux.HandleFunc("GET /v1/requests/{id}", func(w http.ResponseWriter, r *http.Request) {
+		container, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		// Another container's requests are as good as missing
+		a, err := LoadApproval(r.PathValue("id"))
+		if err != nil || a.Container != container {
+			writeRequestJSON(w, http.StatusNotFound, map[string]string{"error": "no request " + r.PathValue("id")})
+			return
+		}
+		writeRequestJSON(w, http.StatusOK, a)
+	})
+	return mux
+}
+
+func writeRequestJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
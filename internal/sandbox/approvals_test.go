@@ -0,0 +1,316 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stuffbucket/coop/internal/audit"
+)
+
+func TestNormalizeApproval(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    ApprovalKind
+		args    map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name: "mount defaults",
+			kind: ApprovalMount,
+			args: map[string]string{"source": "/srv/Data/"},
+			want: map[string]string{"source": "/srv/Data", "name": "data", "path": AgentHome + "/data", "readonly": "false"},
+		},
+		{
+			name: "mount read-only at a path",
+			kind: ApprovalMount,
+			args: map[string]string{"source": "/srv/data", "path": "/mnt/data/", "readonly": "true", "extra": "x"},
+			want: map[string]string{"source": "/srv/data", "name": "data", "path": "/mnt/data", "readonly": "true"},
+		},
+		{
+			name:    "mount relative source",
+			kind:    ApprovalMount,
+			args:    map[string]string{"source": "data"},
+			wantErr: "absolute host path",
+		},
+		{
+			name:    "mount over the root",
+			kind:    ApprovalMount,
+			args:    map[string]string{"source": "/srv/data", "path": "/"},
+			wantErr: "mount path",
+		},
+		{
+			name:    "mount name with a path",
+			kind:    ApprovalMount,
+			args:    map[string]string{"source": "/srv/data", "name": "../root"},
+			wantErr: "invalid mount name",
+		},
+		{
+			name: "expose same port",
+			kind: ApprovalExpose,
+			args: map[string]string{"port": "5432"},
+			want: map[string]string{"port": "5432", "container_port": "5432"},
+		},
+		{
+			name:    "expose bad port",
+			kind:    ApprovalExpose,
+			args:    map[string]string{"port": "70000"},
+			wantErr: "invalid port",
+		},
+		{
+			name: "secret",
+			kind: ApprovalSecret,
+			args: map[string]string{"name": "GITHUB_TOKEN"},
+			want: map[string]string{"name": "GITHUB_TOKEN"},
+		},
+		{
+			name:    "secret path traversal",
+			kind:    ApprovalSecret,
+			args:    map[string]string{"name": "../../etc/passwd"},
+			wantErr: "invalid secret name",
+		},
+		{
+			name: "control characters",
+			kind: ApprovalMount,
+			args: map[string]string{"source": "/srv/data\x1b[2K", "name": "data", "path": "/mnt/data\u202e"},
+			want: map[string]string{"source": "/srv/data[2K", "name": "data", "path": "/mnt/data", "readonly": "false"},
+		},
+		{
+			name:    "unknown kind",
+			kind:    "sudo",
+			wantErr: "unknown request kind",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeApproval(tt.kind, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("normalizeApproval() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeApproval() error: %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("normalizeApproval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApprovalQueue(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+	t.Setenv("COOP_DATA_DIR", t.TempDir())
+
+	first, err := SubmitApproval("web", ApprovalExpose, map[string]string{"port": "5432"}, "  run the tests  ")
+	if err != nil {
+		t.Fatalf("SubmitApproval() error: %v", err)
+	}
+	if first.Status != ApprovalPending || first.Reason != "run the tests" || first.Summary != "expose host port 5432 on container port 5432" {
+		t.Errorf("SubmitApproval() = %+v", first)
+	}
+	second, err := SubmitApproval("api", ApprovalSecret, map[string]string{"name": "TOKEN"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	denied, err := DenyApproval(second.ID, "not today")
+	if err != nil {
+		t.Fatalf("DenyApproval() error: %v", err)
+	}
+	if denied.Status != ApprovalDenied || denied.Error != "not today" || denied.Decided.IsZero() {
+		t.Errorf("DenyApproval() = %+v", denied)
+	}
+	if _, err := DenyApproval(second.ID, ""); err == nil || !strings.Contains(err.Error(), "already denied") {
+		t.Errorf("second DenyApproval() error = %v", err)
+	}
+
+	list, err := ListApprovals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != first.ID || list[1].Status != ApprovalDenied {
+		t.Errorf("ListApprovals() = %+v", list)
+	}
+
+	if _, err := LoadApproval("../audit"); err == nil {
+		t.Error("LoadApproval() accepted a path")
+	}
+
+	entries, err := AuditLog().Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, e := range entries {
+		ops = append(ops, e.Op)
+	}
+	if strings.Join(ops, ",") != "approval.request,approval.request,approval.deny" {
+		t.Errorf("audited %v", ops)
+	}
+	if entries[0].Actor != "agent@web" || entries[2].Outcome != audit.OutcomeDenied {
+		t.Errorf("audit entries = %+v", entries)
+	}
+}
+
+func TestRequestHandler(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+	t.Setenv("COOP_DATA_DIR", t.TempDir())
+
+	tokens := map[string]string{"web-token": "web", "api-token": "api"}
+	var notified []*Approval
+	srv := httptest.NewServer(requestHandler(func(token string) (string, error) {
+		if name, ok := tokens[token]; ok {
+			return name, nil
+		}
+		return "", errors.New("unknown request token")
+	}, func(a *Approval) { notified = append(notified, a) }))
+	defer srv.Close()
+
+	do := func(method, path, token, body string) (*http.Response, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp, out
+	}
+
+	if resp, _ := do("POST", "/v1/requests", "", `{}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token: status %d", resp.StatusCode)
+	}
+	if resp, _ := do("POST", "/v1/requests", "guess", `{}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("bad token: status %d", resp.StatusCode)
+	}
+	if resp, out := do("POST", "/v1/requests", "web-token", `{"kind":"secret","args":{"name":"a/b"}}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid request: status %d, %v", resp.StatusCode, out)
+	}
+
+	resp, out := do("POST", "/v1/requests", "web-token", `{"kind":"secret","args":{"name":"TOKEN"},"reason":"deploy"}`)
+	if resp.StatusCode != http.StatusCreated || out["container"] != "web" || out["status"] != "pending" {
+		t.Fatalf("submit: status %d, %v", resp.StatusCode, out)
+	}
+	id := out["id"].(string)
+	if len(notified) != 1 || notified[0].ID != id {
+		t.Errorf("notified %v", notified)
+	}
+
+	if resp, out := do("GET", "/v1/requests/"+id, "web-token", ""); resp.StatusCode != http.StatusOK || out["id"] != id {
+		t.Errorf("own request: status %d, %v", resp.StatusCode, out)
+	}
+	// The container is taken from the token, never from the request
+	if resp, _ := do("GET", "/v1/requests/"+id, "api-token", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other container's request: status %d", resp.StatusCode)
+	}
+}
+
+func TestSubmitApprovalLimits(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+	t.Setenv("COOP_DATA_DIR", t.TempDir())
+
+	a, err := SubmitApproval("web", ApprovalSecret, map[string]string{"name": "TOKEN"}, "need\x1b]0;pwned\x07 it\nnow‮")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Reason != "need]0;pwned it now" {
+		t.Errorf("Reason = %q", a.Reason)
+	}
+
+	for range maxPendingApprovals - 1 {
+		if _, err := SubmitApproval("web", ApprovalSecret, map[string]string{"name": "TOKEN"}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := SubmitApproval("web", ApprovalSecret, map[string]string{"name": "TOKEN"}, ""); err == nil || !strings.Contains(err.Error(), "pending requests") {
+		t.Errorf("SubmitApproval() over the cap error = %v", err)
+	}
+	if _, err := SubmitApproval("api", ApprovalSecret, map[string]string{"name": "TOKEN"}, ""); err != nil {
+		t.Errorf("another container's request was refused: %v", err)
+	}
+
+	// Deciding a request frees a slot
+	if _, err := DenyApproval(a.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SubmitApproval("web", ApprovalSecret, map[string]string{"name": "TOKEN"}, ""); err != nil {
+		t.Errorf("SubmitApproval() after a decision: %v", err)
+	}
+}
+
+func TestWriteSecretFile(t *testing.T) {
+	client := memSFTP(t)
+	if err := client.MkdirAll(SecretsDir); err != nil {
+		t.Fatal(err)
+	}
+	// The agent points a secret at a file only root may write
+	if err := client.MkdirAll("/etc"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := client.Create("/etc/shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte("root:x:"))
+	_ = f.Close()
+	if err := client.Symlink("/etc/shadow", SecretsDir+"/TOKEN"); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := writeSecretFile(client, "TOKEN", "s3cret")
+	if err != nil {
+		t.Fatalf("writeSecretFile() error: %v", err)
+	}
+
+	read := func(p string) string {
+		f, err := client.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := read("/etc/shadow"); got != "root:x:" {
+		t.Errorf("wrote through the symlink: /etc/shadow = %q", got)
+	}
+	info, err := client.Lstat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Mode().IsRegular() || read(target) != "s3cret" {
+		t.Errorf("%s = %v %q, want a regular file with the secret", target, info.Mode(), read(target))
+	}
+
+	// A symlink in place of the directory is refused
+	if err := client.RemoveAll(SecretsDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Symlink("/etc", SecretsDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeSecretFile(client, "shadow", "x"); err == nil {
+		t.Error("writeSecretFile() followed a symlinked secrets dir")
+	}
+	if got := read("/etc/shadow"); got != "root:x:" {
+		t.Errorf("/etc/shadow = %q", got)
+	}
+}
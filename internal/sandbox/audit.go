@@ -0,0 +1,64 @@
+// Package sandbox provides the audit trail of security-sensitive operations.
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stuffbucket/coop/internal/audit"
+	"github.com/stuffbucket/coop/internal/config"
+)
+
+// auditDir holds the audit log and its head file. It is blocked by the
+// seatbelt so no container can rewrite its own history.
+func auditDir() string {
+	return filepath.Join(config.GetDirectories().Data, "audit")
+}
+
+// AuditLog returns coop's audit log. Its key lives in the config directory.
+func AuditLog() *audit.Log {
+	return audit.Open(
+		filepath.Join(auditDir(), "audit.jsonl"),
+		filepath.Join(config.GetDirectories().Config, "audit.key"),
+	)
+}
+
+// RecordAudit appends an entry for an operation that ended with opErr.
+// An entry whose Outcome is already set keeps it.
+func RecordAudit(e audit.Entry, opErr error) error {
+	if opErr != nil {
+		if e.Outcome == "" {
+			e.Outcome = audit.OutcomeFailed
+		}
+		e.Error = opErr.Error()
+	}
+	_, err := AuditLog().Append(e)
+	return err
+}
+
+// auditOp records an operation, warning rather than failing it when the
+// log cannot be written.
+func auditOp(e audit.Entry, opErr error) {
+	if err := RecordAudit(e, opErr); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write audit log: %v\n", err)
+	}
+}
+
+// AuditShell records a shell session started outside the manager, such as
+// ssh replacing the coop process.
+func AuditShell(name string, remoteCmd []string, transport ShellTransport, forwardAgent bool) {
+	auditOp(audit.Entry{Op: "shell", Container: name, Args: shellAuditArgs(remoteCmd, transport, forwardAgent)}, nil)
+}
+
+func shellAuditArgs(remoteCmd []string, transport ShellTransport, forwardAgent bool) map[string]string {
+	args := map[string]string{"transport": string(transport)}
+	if len(remoteCmd) > 0 {
+		args["command"] = strings.Join(remoteCmd, " ")
+	}
+	if forwardAgent {
+		args["forward_agent"] = "true"
+	}
+	return args
+}
@@ -0,0 +1,181 @@
+// Package sandbox provides the channels that deliver authorization codes.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stuffbucket/coop/internal/config"
+	"github.com/stuffbucket/coop/internal/ui"
+)
+
+// Authorization code channels. Codes travel out of band so that a process
+// driving the terminal, such as an agent, cannot read them.
+const (
+	AuthChannelNotify        = "notify"        // Desktop notification (macOS, Windows, notify-send)
+	AuthChannelDBus          = "dbus"          // freedesktop notification over the session bus
+	AuthChannelAuthenticator = "authenticator" // Authenticator app enrolled with 'coop seatbelt enroll'
+	AuthChannelFile          = "file"          // File or FIFO, for tests and scripts
+)
+
+// ErrAuthCodeUndelivered is returned when no channel could deliver an
+// authorization code, such as on a headless host without a notification
+// daemon or an enrolled authenticator app.
+var ErrAuthCodeUndelivered = errors.New("no channel could deliver the authorization code")
+
+// AuthChannel delivers an authorization code to the user.
+type AuthChannel interface {
+	Name() string
+	// Deliver makes code visible to the user, who types it at the prompt.
+	Deliver(code, reason string) error
+	// Hint tells the user where to find the code.
+	Hint() string
+}
+
+// DefaultAuthChannels are used when settings name none: the platform's
+// notifications, plus an enrolled authenticator app.
+func DefaultAuthChannels() []string {
+	channels := []string{AuthChannelNotify}
+	if runtime.GOOS == "linux" {
+		channels = []string{AuthChannelDBus}
+	}
+	if AuthenticatorEnrolled() {
+		channels = append(channels, AuthChannelAuthenticator)
+	}
+	return channels
+}
+
+// AuthChannels builds the channels named in settings, or the defaults.
+func AuthChannels(settings config.SeatbeltSettings) ([]AuthChannel, error) {
+	names := settings.AuthChannels
+	if len(names) == 0 {
+		names = DefaultAuthChannels()
+	}
+
+	var channels []AuthChannel
+	for _, name := range names {
+		switch name {
+		case AuthChannelNotify:
+			channels = append(channels, notifyChannel{})
+		case AuthChannelDBus:
+			channels = append(channels, dbusChannel{})
+		case AuthChannelAuthenticator:
+			channels = append(channels, authenticatorChannel{})
+		case AuthChannelFile:
+			path := settings.AuthFile
+			if path == "" {
+				return nil, fmt.Errorf("the file auth channel needs seatbelt.auth_file")
+			}
+			channels = append(channels, fileChannel{path: expandPath(path)})
+		default:
+			return nil, fmt.Errorf("unknown auth channel %q (use notify, dbus, authenticator or file)", name)
+		}
+	}
+	return channels, nil
+}
+
+// DeliverAuthCode sends code through every channel and returns those that
+// delivered it. The error lists the failures when none did.
+func DeliverAuthCode(channels []AuthChannel, code, reason string) ([]AuthChannel, error) {
+	var delivered []AuthChannel
+	var failures []string
+	for _, c := range channels {
+		if err := c.Deliver(code, reason); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.Name(), err))
+			continue
+		}
+		delivered = append(delivered, c)
+	}
+	if len(delivered) == 0 {
+		if len(failures) == 0 {
+			return nil, fmt.Errorf("%w: no auth channels configured", ErrAuthCodeUndelivered)
+		}
+		return nil, fmt.Errorf("%w (%s)", ErrAuthCodeUndelivered, strings.Join(failures, "; "))
+	}
+	return delivered, nil
+}
+
+type notifyChannel struct{}
+
+func (notifyChannel) Name() string { return AuthChannelNotify }
+func (notifyChannel) Hint() string { return "Code sent as a desktop notification" }
+
+func (notifyChannel) Deliver(code, reason string) error {
+	return ui.NotifyWithSound("coop", "Authorization code "+code, reason, "Purr")
+}
+
+// dbusChannel talks to org.freedesktop.Notifications directly, so a
+// missing notification daemon is reported instead of silently ignored.
+type dbusChannel struct{}
+
+func (dbusChannel) Name() string { return AuthChannelDBus }
+func (dbusChannel) Hint() string { return "Code sent as a desktop notification" }
+
+func (dbusChannel) Deliver(code, reason string) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return fmt.Errorf("no D-Bus session bus: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	const urgencyCritical = byte(2)
+	obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+	call := obj.Call("org.freedesktop.Notifications.Notify", 0,
+		"coop",                          // app_name
+		uint32(0),                       // replaces_id
+		"dialog-password",               // app_icon
+		"coop authorization code "+code, // summary
+		reason,                          // body
+		[]string{},                      // actions
+		map[string]dbus.Variant{"urgency": dbus.MakeVariant(urgencyCritical)},
+		int32(CodeValidity.Milliseconds()), // expire_timeout
+	)
+	if call.Err != nil {
+		return fmt.Errorf("no notification daemon: %w", call.Err)
+	}
+	return nil
+}
+
+// authenticatorChannel sends nothing: the enrolled app shows the code.
+type authenticatorChannel struct{}
+
+func (authenticatorChannel) Name() string { return AuthChannelAuthenticator }
+func (authenticatorChannel) Hint() string { return "Read the code from your authenticator app" }
+
+func (authenticatorChannel) Deliver(string, string) error {
+	if !AuthenticatorEnrolled() {
+		return errors.New("not enrolled; run 'coop seatbelt enroll'")
+	}
+	return nil
+}
+
+// fileChannel writes the code to a regular file, or to a FIFO once a
+// reader opens it.
+type fileChannel struct {
+	path string
+}
+
+func (fileChannel) Name() string   { return AuthChannelFile }
+func (c fileChannel) Hint() string { return "Code written to " + c.path }
+
+func (c fileChannel) Deliver(code, _ string) error {
+	line := []byte(code + "\n")
+	info, err := os.Stat(c.path)
+	if err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		// Opening a FIFO blocks until a reader arrives; don't hold up the prompt.
+		go func() {
+			f, err := os.OpenFile(c.path, os.O_WRONLY, 0)
+			if err != nil {
+				return
+			}
+			_, _ = f.Write(line)
+			_ = f.Close()
+		}()
+		return nil
+	}
+	return os.WriteFile(c.path, line, 0o600)
+}
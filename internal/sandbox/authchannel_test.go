@@ -0,0 +1,138 @@
+package sandbox
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stuffbucket/coop/internal/config"
+)
+
+func TestAuthChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings config.SeatbeltSettings
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "explicit list",
+			settings: config.SeatbeltSettings{AuthChannels: []string{"dbus", "authenticator"}},
+			want:     []string{"dbus", "authenticator"},
+		},
+		{
+			name:     "file channel",
+			settings: config.SeatbeltSettings{AuthChannels: []string{"file"}, AuthFile: "/tmp/code"},
+			want:     []string{"file"},
+		},
+		{
+			name:     "file channel without a path",
+			settings: config.SeatbeltSettings{AuthChannels: []string{"file"}},
+			wantErr:  "auth_file",
+		},
+		{
+			name:     "unknown channel",
+			settings: config.SeatbeltSettings{AuthChannels: []string{"sms"}},
+			wantErr:  `unknown auth channel "sms"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channels, err := AuthChannels(tt.settings)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("AuthChannels() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthChannels() error: %v", err)
+			}
+			var names []string
+			for _, c := range channels {
+				names = append(names, c.Name())
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("AuthChannels() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeliverAuthCodeFile(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+	path := filepath.Join(t.TempDir(), "code")
+
+	channels, err := AuthChannels(config.SeatbeltSettings{
+		AuthChannels: []string{"authenticator", "file"},
+		AuthFile:     path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The authenticator is not enrolled, so only the file delivers
+	delivered, err := DeliverAuthCode(channels, "123456", "test")
+	if err != nil {
+		t.Fatalf("DeliverAuthCode() error: %v", err)
+	}
+	if len(delivered) != 1 || delivered[0].Name() != AuthChannelFile {
+		t.Errorf("delivered through %v, want file only", delivered)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "123456\n" {
+		t.Errorf("file contains %q", data)
+	}
+
+	_, err = DeliverAuthCode(channels[:1], "123456", "test")
+	if !errors.Is(err, ErrAuthCodeUndelivered) || !strings.Contains(err.Error(), "authenticator: not enrolled") {
+		t.Errorf("DeliverAuthCode(authenticator) error = %v", err)
+	}
+}
+
+func TestAuthenticatorEnrollment(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+	t.Setenv("COOP_DATA_DIR", t.TempDir())
+	if _, err := RotateSeatbeltSecret(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := AuthenticatorURL("me@host")
+	if err != nil {
+		t.Fatalf("AuthenticatorURL() error: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || q.Get("secret") == "" || q.Get("algorithm") != "SHA1" || q.Get("issuer") != "coop" {
+		t.Errorf("AuthenticatorURL() = %s", raw)
+	}
+
+	if AuthenticatorEnrolled() || slices.Contains(DefaultAuthChannels(), AuthChannelAuthenticator) {
+		t.Fatal("enrolled before MarkAuthenticatorEnrolled")
+	}
+	if err := MarkAuthenticatorEnrolled(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(DefaultAuthChannels(), AuthChannelAuthenticator) {
+		t.Errorf("DefaultAuthChannels() = %v, want authenticator once enrolled", DefaultAuthChannels())
+	}
+
+	// A new secret leaves the app with the old one
+	if _, err := RotateSeatbeltSecret(); err != nil {
+		t.Fatal(err)
+	}
+	if AuthenticatorEnrolled() {
+		t.Error("still enrolled after RotateSeatbeltSecret")
+	}
+	raw2, _ := AuthenticatorURL("me@host")
+	if raw2 == raw {
+		t.Error("AuthenticatorURL() unchanged after rotation")
+	}
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/config"
+)
+
+func TestDeliverAuthCodeFIFO(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "code")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+
+	channels, err := AuthChannels(config.SeatbeltSettings{AuthChannels: []string{"file"}, AuthFile: fifo})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delivery must not wait for the reader
+	done := make(chan error, 1)
+	go func() {
+		_, err := DeliverAuthCode(channels, "654321", "test")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("DeliverAuthCode() error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("DeliverAuthCode() blocked on the FIFO")
+	}
+
+	data, err := os.ReadFile(fifo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "654321\n" {
+		t.Errorf("FIFO delivered %q", data)
+	}
+}
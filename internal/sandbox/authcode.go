@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/base32"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
+	"github.com/stuffbucket/coop/internal/audit"
 	"github.com/stuffbucket/coop/internal/config"
 )
 
@@ -27,6 +29,8 @@ const (
 	CodeValidity = 90 * time.Second
 	// seatbeltKeyFile is where we persist the secret used for host-only TOTP.
 	seatbeltKeyFile = "seatbelt.key"
+	// enrolledFile marks that an authenticator app holds the current secret.
+	enrolledFile = "seatbelt.enrolled"
 )
 
 var (
@@ -75,11 +79,12 @@ func seatbeltSecret() (string, error) {
 	return secretVal, secretErr
 }
 
+// totpOpts uses SHA-1, the only algorithm every authenticator app honors.
 var totpOpts = totp.ValidateOpts{
 	Period:    uint(CodeWindow.Seconds()),
 	Skew:      1,
 	Digits:    otp.DigitsSix,
-	Algorithm: otp.AlgorithmSHA256,
+	Algorithm: otp.AlgorithmSHA1,
 }
 
 // CurrentAuthCode returns the current authorization code.
@@ -106,15 +111,59 @@ func ValidateAuthCode(code string) (bool, error) {
 }
 
 // RotateSeatbeltSecret deletes the persisted secret and generates a new one.
-func RotateSeatbeltSecret() (string, error) {
+// An enrolled authenticator app no longer matches and must be enrolled again.
+func RotateSeatbeltSecret() (secret string, err error) {
+	defer func() { auditOp(audit.Entry{Op: "seatbelt.rotate"}, err) }()
+
 	secretOnce = sync.Once{} // reset cache
 	path := secretPath()
 	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 		return "", fmt.Errorf("remove seatbelt secret: %w", err)
 	}
+	if err := os.Remove(enrolledPath()); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("remove authenticator enrollment: %w", err)
+	}
 	return seatbeltSecret()
 }
 
+func enrolledPath() string {
+	return filepath.Join(config.GetDirectories().Config, enrolledFile)
+}
+
+// AuthenticatorURL returns the otpauth:// URL that enrolls an authenticator
+// app with the current secret, as encoded in the enrollment QR code.
+func AuthenticatorURL(account string) (string, error) {
+	secret, err := seatbeltSecret()
+	if err != nil {
+		return "", err
+	}
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", "coop")
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", strconv.Itoa(CodeDigits))
+	v.Set("period", strconv.Itoa(int(CodeWindow.Seconds())))
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/coop:" + account, RawQuery: v.Encode()}
+	return u.String(), nil
+}
+
+// MarkAuthenticatorEnrolled records that an authenticator app produced a
+// valid code for the current secret.
+func MarkAuthenticatorEnrolled() error {
+	if err := os.WriteFile(enrolledPath(), []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0o600); err != nil {
+		return err
+	}
+	auditOp(audit.Entry{Op: "seatbelt.enroll", Auth: "totp:authenticator"}, nil)
+	return nil
+}
+
+// AuthenticatorEnrolled reports whether an authenticator app holds the
+// current secret.
+func AuthenticatorEnrolled() bool {
+	_, err := os.Stat(enrolledPath())
+	return err == nil
+}
+
 // ParseForceFlag parses a --force flag value.
 // Returns (forceRequested, codeProvided, codeValue)
 func ParseForceFlag(value string) (bool, bool, string) {
@@ -0,0 +1,369 @@
+// Package sandbox provides file copies between the host and containers.
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"github.com/stuffbucket/coop/internal/audit"
+)
+
+// AgentHome is the agent user's home directory; relative container paths
+// are resolved against it.
+const AgentHome = "/home/agent"
+
+// CopyPath is one side of a copy: a host path, or a path inside a container.
+type CopyPath struct {
+	Container string // Empty for host paths
+	Path      string
+}
+
+// IsContainer returns true if the path is inside a container.
+func (p CopyPath) IsContainer() bool {
+	return p.Container != ""
+}
+
+// String formats the path the way it is written on the command line.
+func (p CopyPath) String() string {
+	if p.IsContainer() {
+		return p.Container + ":" + p.Path
+	}
+	return p.Path
+}
+
+// ParseCopyPath parses a copy argument. "container:path" refers to a
+// container (relative paths are under /home/agent); anything else, including
+// paths containing a "/" before the first ":", is a host path.
+func ParseCopyPath(arg string) CopyPath {
+	before, after, found := strings.Cut(arg, ":")
+	if !found || before == "" || strings.Contains(before, "/") {
+		return CopyPath{Path: arg}
+	}
+
+	p := after
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(AgentHome, p)
+	}
+	return CopyPath{Container: before, Path: path.Clean(p)}
+}
+
+// CopyProgress reports bytes copied so far.
+type CopyProgress struct {
+	File  string // File currently being copied
+	Done  int64  // Bytes copied so far
+	Total int64  // Total bytes to copy
+}
+
+// CopyOptions controls CopyToContainer and CopyFromContainer.
+type CopyOptions struct {
+	// Force allows copying seatbelted host paths (confirmed by the Authorizer).
+	Force bool
+	// Progress, if set, is called as data is copied.
+	Progress func(CopyProgress)
+}
+
+// resolveCopyHostPath makes a host path absolute and authorizes it,
+// returning the authorization method of an override.
+func (m *Manager) resolveCopyHostPath(hostPath, container string, force bool) (string, string, error) {
+	hostPath, err := filepath.Abs(expandPath(hostPath))
+	if err != nil {
+		return "", "", err
+	}
+	auth, err := m.AuthorizeHostPath(HostAccess{
+		Op:        HostOpCopy,
+		Path:      hostPath,
+		Container: container,
+		Force:     force,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return hostPath, auth, nil
+}
+
+// CopyToContainer copies a host file or directory (recursively) into a
+// container. Modes are preserved and everything is owned by the agent user.
+// If dst is an existing directory, src is copied into it.
+func (m *Manager) CopyToContainer(name, src, dst string, opts CopyOptions) (err error) {
+	entry := audit.Entry{Op: "cp", Container: name, Args: map[string]string{"from": src, "to": name + ":" + dst}}
+	defer func() { auditOp(entry, err) }()
+
+	if _, err := m.client.GetContainer(name); err != nil {
+		return containerNotFound(name)
+	}
+
+	src, entry.Auth, err = m.resolveCopyHostPath(src, name, opts.Force)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.client.SFTP(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	if st, err := client.Stat(dst); err == nil && st.IsDir() {
+		dst = path.Join(dst, filepath.Base(src))
+	}
+
+	c := &copier{progress: opts.Progress}
+	if info.IsDir() {
+		c.total, err = hostTreeSize(src)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.total = info.Size()
+	}
+
+	return filepath.WalkDir(src, func(hostPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, hostPath)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, filepath.ToSlash(rel))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			if err := client.MkdirAll(target); err != nil {
+				return fmt.Errorf("create %s: %w", target, err)
+			}
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(hostPath)
+			if err != nil {
+				return err
+			}
+			_ = client.Remove(target)
+			if err := client.Symlink(link, target); err != nil {
+				return fmt.Errorf("create %s: %w", target, err)
+			}
+			return nil // Ownership of the link itself is not settable over SFTP
+		case info.Mode().IsRegular():
+			if err := c.uploadFile(client, hostPath, target); err != nil {
+				return err
+			}
+		default:
+			return nil // Skip devices, sockets and pipes
+		}
+
+		if err := client.Chmod(target, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("chmod %s: %w", target, err)
+		}
+		if err := client.Chown(target, AgentUID, AgentUID); err != nil {
+			return fmt.Errorf("chown %s: %w", target, err)
+		}
+		return nil
+	})
+}
+
+// CopyFromContainer copies a container file or directory (recursively) to the
+// host. Modes are preserved; files are owned by the current user.
+// If dst is an existing directory, src is copied into it.
+func (m *Manager) CopyFromContainer(name, src, dst string, opts CopyOptions) (err error) {
+	entry := audit.Entry{Op: "cp", Container: name, Args: map[string]string{"from": name + ":" + src, "to": dst}}
+	defer func() { auditOp(entry, err) }()
+
+	if _, err := m.client.GetContainer(name); err != nil {
+		return containerNotFound(name)
+	}
+
+	dst, entry.Auth, err = m.resolveCopyHostPath(dst, name, opts.Force)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.client.SFTP(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	info, err := client.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+
+	if st, err := os.Stat(dst); err == nil && st.IsDir() {
+		dst = filepath.Join(dst, path.Base(src))
+	}
+
+	c := &copier{progress: opts.Progress}
+	if info.IsDir() {
+		c.total, err = containerTreeSize(client, src)
+		if err != nil {
+			return err
+		}
+	} else {
+		c.total = info.Size()
+	}
+
+	// Directory modes are applied last so read-only directories can be filled
+	dirModes := make(map[string]os.FileMode)
+
+	walker := client.Walk(src)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+
+		remotePath := walker.Path()
+		rel := strings.TrimPrefix(strings.TrimPrefix(remotePath, src), "/")
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		info := walker.Stat()
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			dirModes[target] = info.Mode().Perm()
+			continue
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := client.ReadLink(remotePath)
+			if err != nil {
+				return err
+			}
+			_ = os.Remove(target)
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+			continue
+		case info.Mode().IsRegular():
+			if err := c.downloadFile(client, remotePath, target); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+
+		if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	for dir, mode := range dirModes {
+		if err := os.Chmod(dir, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copier tracks progress across the files of one copy.
+type copier struct {
+	done, total int64
+	progress    func(CopyProgress)
+}
+
+func (c *copier) uploadFile(client *sftp.Client, hostPath, target string) error {
+	in, err := os.Open(hostPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := client.Create(target)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", target, err)
+	}
+	if err := c.copy(out, in, target); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (c *copier) downloadFile(client *sftp.Client, remotePath, target string) error {
+	in, err := client.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if err := c.copy(out, in, target); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copy copies one file, reporting progress after each chunk.
+func (c *copier) copy(dst io.Writer, src io.Reader, name string) error {
+	buf := make([]byte, 256*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			c.done += int64(n)
+			if c.progress != nil {
+				c.progress(CopyProgress{File: name, Done: c.done, Total: c.total})
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// hostTreeSize returns the total size of regular files under root.
+func hostTreeSize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// containerTreeSize returns the total size of regular files under root.
+func containerTreeSize(client *sftp.Client, root string) (int64, error) {
+	var total int64
+	walker := client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return 0, err
+		}
+		if walker.Stat().Mode().IsRegular() {
+			total += walker.Stat().Size()
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,67 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCopyPath(t *testing.T) {
+	tests := []struct {
+		arg       string
+		container string
+		path      string
+	}{
+		{"myagent:/etc/hosts", "myagent", "/etc/hosts"},
+		{"myagent:work/", "myagent", "/home/agent/work"},
+		{"myagent:", "myagent", "/home/agent"},
+		{"myagent:../other", "myagent", "/home/other"},
+		{"./file.txt", "", "./file.txt"},
+		{"/tmp/a:b", "", "/tmp/a:b"},
+		{"dir/name:with-colon", "", "dir/name:with-colon"},
+		{":nothing", "", ":nothing"},
+		{"plain", "", "plain"},
+	}
+
+	for _, tt := range tests {
+		got := ParseCopyPath(tt.arg)
+		if got.Container != tt.container || got.Path != tt.path {
+			t.Errorf("ParseCopyPath(%q) = {%q, %q}, want {%q, %q}",
+				tt.arg, got.Container, got.Path, tt.container, tt.path)
+		}
+		if got.IsContainer() != (tt.container != "") {
+			t.Errorf("ParseCopyPath(%q).IsContainer() = %v", tt.arg, got.IsContainer())
+		}
+	}
+}
+
+func TestResolveCopyHostPathSeatbelt(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+	t.Setenv("COOP_DATA_DIR", t.TempDir())
+
+	m := &Manager{}
+	m.SetAuthorizer(func(HostAccess, SeatbeltDecision) (string, error) { return "test", nil })
+
+	protected := filepath.Join(home, ".ssh", "id_ed25519")
+	if _, _, err := m.resolveCopyHostPath(protected, "web", false); err == nil || !strings.Contains(err.Error(), "protected") {
+		t.Errorf("resolveCopyHostPath(%q) should refuse, got %v", protected, err)
+	}
+	if got, auth, err := m.resolveCopyHostPath(protected, "web", true); err != nil || got != protected || auth != "test" {
+		t.Errorf("resolveCopyHostPath(%q, force) = %q, %q, %v", protected, got, auth, err)
+	}
+
+	dir := t.TempDir()
+	t.Chdir(dir)
+	got, _, err := m.resolveCopyHostPath("out.txt", "web", false)
+	if err != nil {
+		t.Fatalf("resolveCopyHostPath(relative) error: %v", err)
+	}
+	if !filepath.IsAbs(got) || filepath.Base(got) != "out.txt" {
+		t.Errorf("resolveCopyHostPath(relative) = %q, want absolute path", got)
+	}
+}
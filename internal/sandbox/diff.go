@@ -0,0 +1,382 @@
+// Package sandbox provides filesystem diffs between snapshots and live containers.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/pkg/sftp"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	// LiveSnapshot refers to the container's current filesystem in a diff.
+	LiveSnapshot = "live"
+
+	// maxDiffContentSize limits which files get content diffs.
+	maxDiffContentSize = 1 << 20
+	// diffContextLines is the number of unchanged lines around each hunk.
+	diffContextLines = 3
+)
+
+// diffSkipDirs are virtual filesystems that only exist in a running container.
+var diffSkipDirs = []string{"/proc", "/sys", "/dev", "/run"}
+
+// ChangeKind describes how a path differs between two filesystem states.
+type ChangeKind string
+
+const (
+	// ChangeAdded means the path only exists in the newer state.
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved means the path only exists in the older state.
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeModified means the path exists in both with different metadata.
+	ChangeModified ChangeKind = "modified"
+)
+
+// FileEntry is the metadata of one path in a filesystem manifest.
+type FileEntry struct {
+	Mode    os.FileMode
+	Size    int64
+	ModTime time.Time
+	Link    string // Symlink target
+}
+
+// FileChange is a single difference between two filesystem states.
+type FileChange struct {
+	Path     string
+	Kind     ChangeKind
+	Old, New *FileEntry
+	// Diff is a unified diff of the contents (text files, DiffOptions.Content only).
+	Diff string
+}
+
+// DiffOptions controls DiffSnapshots.
+type DiffOptions struct {
+	Prefix  string // Only compare paths under this directory (default: /)
+	Content bool   // Include unified diffs for changed text files
+}
+
+// DiffSnapshots compares two filesystem states of a container.
+// from and to are snapshot names, or LiveSnapshot for the current filesystem.
+// Snapshots are copied to temporary stopped containers and read over the
+// Incus SFTP API; the copies are deleted afterwards, also when ctx is
+// cancelled.
+func (m *Manager) DiffSnapshots(ctx context.Context, name, from, to string, opts DiffOptions) ([]FileChange, error) {
+	if _, err := m.client.GetContainer(name); err != nil {
+		return nil, containerNotFound(name)
+	}
+
+	prefix := path.Clean("/" + opts.Prefix)
+
+	oldFS, closeOld, err := m.openSnapshotFS(ctx, name, from)
+	if err != nil {
+		return nil, err
+	}
+	defer closeOld()
+
+	newFS, closeNew, err := m.openSnapshotFS(ctx, name, to)
+	if err != nil {
+		return nil, err
+	}
+	defer closeNew()
+
+	// Closing the sessions ends a walk in progress, so the deferred
+	// cleanups run promptly when ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() {
+		_ = oldFS.Close()
+		_ = newFS.Close()
+	})
+	defer stop()
+
+	oldManifest, err := walkManifest(oldFS, prefix)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", from, err)
+	}
+	newManifest, err := walkManifest(newFS, prefix)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", to, err)
+	}
+	// The root of a walk is always listed, so empty means it does not exist
+	if len(oldManifest) == 0 && len(newManifest) == 0 {
+		return nil, fmt.Errorf("%s does not exist in %s or %s", prefix, from, to)
+	}
+
+	changes := diffManifests(oldManifest, newManifest)
+
+	if opts.Content {
+		for i := range changes {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			c := &changes[i]
+			oldData := readTextFile(oldFS, c.Path, c.Old)
+			newData := readTextFile(newFS, c.Path, c.New)
+			if oldData == nil && newData == nil {
+				continue
+			}
+			c.Diff = UnifiedDiff(c.Path, oldData, newData)
+		}
+	}
+
+	return changes, nil
+}
+
+// openSnapshotFS returns an SFTP client for a snapshot or the live container,
+// and a cleanup function that must be called when done. A copy cannot be
+// interrupted, so a cancelled ctx is honoured once it has finished.
+func (m *Manager) openSnapshotFS(ctx context.Context, name, snapshot string) (*sftp.Client, func(), error) {
+	if snapshot == LiveSnapshot {
+		client, err := m.client.SFTP(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, func() { _ = client.Close() }, nil
+	}
+
+	if _, err := m.client.GetSnapshot(name, snapshot); err != nil {
+		return nil, nil, err
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	tmpName := "coop-diff-" + hex.EncodeToString(suffix)
+
+	// A failed copy can leave a partial container behind
+	cleanup := func() { _ = m.client.DeleteContainer(tmpName) }
+	if err := m.client.CopySnapshot(name, snapshot, tmpName); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	if ctx.Err() != nil {
+		cleanup()
+		return nil, nil, ctx.Err()
+	}
+
+	client, err := m.client.SFTP(tmpName)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return client, func() {
+		_ = client.Close()
+		cleanup()
+	}, nil
+}
+
+// walkManifest lists every path under root with its metadata. The manifest
+// is empty if root does not exist, so its contents diff as added or removed.
+func walkManifest(client *sftp.Client, root string) (map[string]FileEntry, error) {
+	manifest := make(map[string]FileEntry)
+
+	walker := client.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == root {
+				if errors.Is(err, os.ErrNotExist) {
+					return manifest, nil
+				}
+				return nil, err
+			}
+			continue // unreadable entry, keep going
+		}
+
+		p := walker.Path()
+		if root == "/" && isDiffSkipDir(p) {
+			walker.SkipDir()
+			continue
+		}
+
+		info := walker.Stat()
+		entry := FileEntry{
+			Mode:    info.Mode(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			entry.Link, _ = client.ReadLink(p)
+		}
+		manifest[p] = entry
+	}
+
+	return manifest, nil
+}
+
+func isDiffSkipDir(p string) bool {
+	for _, dir := range diffSkipDirs {
+		if p == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// diffManifests compares two manifests and returns changes sorted by path.
+// Directory size and mtime are ignored since they change whenever entries do.
+func diffManifests(oldManifest, newManifest map[string]FileEntry) []FileChange {
+	var changes []FileChange
+
+	for p, oldEntry := range oldManifest {
+		oldEntry := oldEntry
+		newEntry, ok := newManifest[p]
+		if !ok {
+			changes = append(changes, FileChange{Path: p, Kind: ChangeRemoved, Old: &oldEntry})
+			continue
+		}
+		if entryChanged(oldEntry, newEntry) {
+			newEntry := newEntry
+			changes = append(changes, FileChange{Path: p, Kind: ChangeModified, Old: &oldEntry, New: &newEntry})
+		}
+	}
+
+	for p, newEntry := range newManifest {
+		if _, ok := oldManifest[p]; !ok {
+			newEntry := newEntry
+			changes = append(changes, FileChange{Path: p, Kind: ChangeAdded, New: &newEntry})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func entryChanged(a, b FileEntry) bool {
+	if a.Mode != b.Mode || a.Link != b.Link {
+		return true
+	}
+	if a.Mode.IsDir() {
+		return false
+	}
+	return a.Size != b.Size || !a.ModTime.Equal(b.ModTime)
+}
+
+// readTextFile returns the contents of a regular text file, or nil if the
+// entry is missing, not a regular file, too large or binary.
+func readTextFile(client *sftp.Client, p string, entry *FileEntry) []byte {
+	if entry == nil || !entry.Mode.IsRegular() || entry.Size > maxDiffContentSize {
+		return nil
+	}
+
+	f, err := client.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxDiffContentSize))
+	if err != nil || !isText(data) {
+		return nil
+	}
+	return data
+}
+
+// isText returns true if data looks like text (valid UTF-8, no NUL bytes).
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// diffLine is one line of a line-oriented diff.
+type diffLine struct {
+	op      byte // ' ', '-' or '+'
+	text    string
+	oldLine int
+	newLine int
+}
+
+// UnifiedDiff renders a unified diff between two versions of a file.
+// Returns an empty string if the contents are identical.
+func UnifiedDiff(name string, oldData, newData []byte) string {
+	var lines []diffLine
+	oldLine, newLine := 1, 1
+	for _, d := range diff.Do(string(oldData), string(newData)) {
+		for _, text := range splitDiffText(d.Text) {
+			switch d.Type {
+			case diffmatchpatch.DiffEqual:
+				lines = append(lines, diffLine{' ', text, oldLine, newLine})
+				oldLine++
+				newLine++
+			case diffmatchpatch.DiffDelete:
+				lines = append(lines, diffLine{'-', text, oldLine, newLine})
+				oldLine++
+			case diffmatchpatch.DiffInsert:
+				lines = append(lines, diffLine{'+', text, oldLine, newLine})
+				newLine++
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are within 2*context lines of each other
+		start := max(i-diffContextLines, 0)
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].op != ' ' {
+				end = j
+			} else if j-end > 2*diffContextLines {
+				break
+			}
+		}
+		end = min(end+diffContextLines, len(lines)-1)
+
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- a%s\n+++ b%s\n", name, name)
+		}
+		writeHunk(&b, lines[start:end+1])
+		i = end + 1
+	}
+	return b.String()
+}
+
+func writeHunk(b *strings.Builder, hunk []diffLine) {
+	oldCount, newCount := 0, 0
+	for _, l := range hunk {
+		if l.op != '+' {
+			oldCount++
+		}
+		if l.op != '-' {
+			newCount++
+		}
+	}
+	oldStart, newStart := hunk[0].oldLine, hunk[0].newLine
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+
+	fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, l := range hunk {
+		fmt.Fprintf(b, "%c%s\n", l.op, l.text)
+	}
+}
+
+// splitDiffText splits a diff chunk into lines without trailing newlines.
+func splitDiffText(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,187 @@
+package sandbox
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+func TestDiffManifests(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+
+	oldManifest := map[string]FileEntry{
+		"/home":           {Mode: os.ModeDir | 0755, Size: 4096, ModTime: t0},
+		"/home/a.txt":     {Mode: 0644, Size: 10, ModTime: t0},
+		"/home/b.txt":     {Mode: 0644, Size: 10, ModTime: t0},
+		"/home/gone.txt":  {Mode: 0644, Size: 5, ModTime: t0},
+		"/home/link":      {Mode: os.ModeSymlink | 0777, Link: "a.txt", ModTime: t0},
+		"/home/same.txt":  {Mode: 0644, Size: 3, ModTime: t0},
+		"/home/chmod.txt": {Mode: 0644, Size: 3, ModTime: t0},
+	}
+	newManifest := map[string]FileEntry{
+		"/home":           {Mode: os.ModeDir | 0755, Size: 8192, ModTime: t1}, // dir metadata churn ignored
+		"/home/a.txt":     {Mode: 0644, Size: 12, ModTime: t1},
+		"/home/b.txt":     {Mode: 0644, Size: 10, ModTime: t1},
+		"/home/link":      {Mode: os.ModeSymlink | 0777, Link: "b.txt", ModTime: t0},
+		"/home/new.txt":   {Mode: 0644, Size: 1, ModTime: t1},
+		"/home/same.txt":  {Mode: 0644, Size: 3, ModTime: t0},
+		"/home/chmod.txt": {Mode: 0755, Size: 3, ModTime: t0},
+	}
+
+	changes := diffManifests(oldManifest, newManifest)
+
+	want := []struct {
+		path string
+		kind ChangeKind
+	}{
+		{"/home/a.txt", ChangeModified},
+		{"/home/b.txt", ChangeModified},
+		{"/home/chmod.txt", ChangeModified},
+		{"/home/gone.txt", ChangeRemoved},
+		{"/home/link", ChangeModified},
+		{"/home/new.txt", ChangeAdded},
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		if changes[i].Path != w.path || changes[i].Kind != w.kind {
+			t.Errorf("change %d = %s %s, want %s %s", i, changes[i].Kind, changes[i].Path, w.kind, w.path)
+		}
+	}
+
+	if changes[3].Old == nil || changes[3].New != nil {
+		t.Error("removed change should only have Old")
+	}
+	if changes[5].Old != nil || changes[5].New == nil {
+		t.Error("added change should only have New")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldData := []byte("one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n")
+	newData := []byte("one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n")
+
+	got := UnifiedDiff("/etc/numbers", oldData, newData)
+
+	want := strings.Join([]string{
+		"--- a/etc/numbers",
+		"+++ b/etc/numbers",
+		"@@ -1,6 +1,6 @@",
+		" one",
+		" two",
+		"-three",
+		"+THREE",
+		" four",
+		" five",
+		" six",
+		"@@ -8,3 +8,4 @@",
+		" eight",
+		" nine",
+		" ten",
+		"+eleven",
+		"",
+	}, "\n")
+
+	if got != want {
+		t.Errorf("UnifiedDiff() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedDiffAddedFile(t *testing.T) {
+	got := UnifiedDiff("/new", nil, []byte("hello\n"))
+	want := "--- a/new\n+++ b/new\n@@ -0,0 +1,1 @@\n+hello\n"
+	if got != want {
+		t.Errorf("UnifiedDiff() = %q, want %q", got, want)
+	}
+}
+
+func TestUnifiedDiffIdentical(t *testing.T) {
+	if got := UnifiedDiff("/same", []byte("a\nb\n"), []byte("a\nb\n")); got != "" {
+		t.Errorf("UnifiedDiff() = %q, want empty", got)
+	}
+}
+
+func TestIsText(t *testing.T) {
+	if !isText([]byte("plain text\n")) {
+		t.Error("plain text should be text")
+	}
+	if isText([]byte{'a', 0, 'b'}) {
+		t.Error("NUL byte should be binary")
+	}
+	if isText([]byte{0xff, 0xfe}) {
+		t.Error("invalid UTF-8 should be binary")
+	}
+}
+
+// memSFTP returns an SFTP client backed by an in-memory filesystem.
+func memSFTP(t *testing.T) *sftp.Client {
+	t.Helper()
+	handlers := sftp.InMemHandler()
+	handlers.FileCmd = ignoreSetstat{handlers.FileCmd}
+	serverConn, clientConn := net.Pipe()
+	server := sftp.NewRequestServer(serverConn, handlers)
+	go func() { _ = server.Serve() }()
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client
+}
+
+// ignoreSetstat accepts chmod and chown by path, which the in-memory
+// filesystem has no notion of.
+type ignoreSetstat struct{ sftp.FileCmder }
+
+func (c ignoreSetstat) Filecmd(r *sftp.Request) error {
+	if r.Method == "Setstat" {
+		return nil
+	}
+	return c.FileCmder.Filecmd(r)
+}
+
+func TestWalkManifestOneSided(t *testing.T) {
+	oldFS, newFS := memSFTP(t), memSFTP(t)
+	if err := newFS.MkdirAll("/work/src"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFS.Create("/work/src/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	oldManifest, err := walkManifest(oldFS, "/work")
+	if err != nil {
+		t.Fatalf("walkManifest() on a missing prefix: %v", err)
+	}
+	if len(oldManifest) != 0 {
+		t.Errorf("walkManifest() on a missing prefix = %v, want empty", oldManifest)
+	}
+	newManifest, err := walkManifest(newFS, "/work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var added []string
+	for _, c := range diffManifests(oldManifest, newManifest) {
+		if c.Kind != ChangeAdded {
+			t.Errorf("%s is %s, want added", c.Path, c.Kind)
+		}
+		added = append(added, c.Path)
+	}
+	if got := strings.Join(added, " "); got != "/work /work/src /work/src/main.go" {
+		t.Errorf("added = %s", got)
+	}
+}
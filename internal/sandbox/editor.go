@@ -0,0 +1,108 @@
+// Package sandbox provides remote editor integration over SSH.
+package sandbox
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path"
+	"runtime"
+)
+
+// Editor is a desktop editor that can open a folder in a container over SSH.
+type Editor string
+
+const (
+	EditorVSCode    Editor = "vscode"
+	EditorCursor    Editor = "cursor"
+	EditorJetBrains Editor = "jetbrains" // JetBrains Gateway
+)
+
+// DefaultEditorPath is the folder opened when none is given.
+const DefaultEditorPath = AgentHome + "/workspace"
+
+// ParseEditor resolves an editor name, accepting common aliases.
+func ParseEditor(name string) (Editor, error) {
+	switch name {
+	case "", "vscode", "code":
+		return EditorVSCode, nil
+	case "cursor":
+		return EditorCursor, nil
+	case "jetbrains", "gateway":
+		return EditorJetBrains, nil
+	}
+	return "", fmt.Errorf("unknown editor %q (use vscode, cursor or jetbrains)", name)
+}
+
+// PrepareRemoteEditor makes a container reachable by name from editors
+// that read ~/.ssh/config by writing its Host entry (with the backend's
+// jump host, if any). Editors only see the entry when ~/.ssh/config
+// includes coop's SSH config; see sshkeys.EnsureInclude.
+func (m *Manager) PrepareRemoteEditor(name string) error {
+	if err := m.requireRunning(name); err != nil {
+		return err
+	}
+	ip, err := m.client.GetContainerIP(name)
+	if err != nil {
+		return fmt.Errorf("could not get container IP: %w", err)
+	}
+	if err := m.UpdateSSHConfig(name, ip); err != nil {
+		return fmt.Errorf("failed to update SSH config: %w", err)
+	}
+	return nil
+}
+
+// EditorCommand returns the command that opens dir in a container with
+// editor, where host is the container's SSH host name. It prefers the
+// editor's own CLI and falls back to opening its URL handler.
+func EditorCommand(editor Editor, host, dir string) ([]string, error) {
+	dir = path.Clean(dir)
+	if !path.IsAbs(dir) {
+		dir = path.Join(AgentHome, dir)
+	}
+
+	if cli := editorCLI(editor); cli != "" {
+		if p, err := exec.LookPath(cli); err == nil {
+			return []string{p, "--remote", "ssh-remote+" + host, dir}, nil
+		}
+	}
+
+	opener := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		opener = "open"
+	}
+	if _, err := exec.LookPath(opener); err != nil {
+		return nil, fmt.Errorf("cannot launch %s: neither its command-line tool nor %s is available", editor, opener)
+	}
+	return []string{opener, editorURI(editor, host, dir)}, nil
+}
+
+// editorCLI is the editor's command-line launcher, if it has one.
+func editorCLI(editor Editor) string {
+	switch editor {
+	case EditorVSCode:
+		return "code"
+	case EditorCursor:
+		return "cursor"
+	}
+	return ""
+}
+
+// editorURI builds the URL that makes an editor open dir on host over SSH.
+func editorURI(editor Editor, host, dir string) string {
+	switch editor {
+	case EditorJetBrains:
+		params := url.Values{}
+		params.Set("type", "ssh")
+		params.Set("deploy", "false")
+		params.Set("host", host)
+		params.Set("port", "22")
+		params.Set("user", "agent")
+		params.Set("projectPath", dir)
+		return "jetbrains-gateway://connect#" + params.Encode()
+	case EditorCursor:
+		return "cursor://vscode-remote/ssh-remote+" + host + dir
+	default:
+		return "vscode://vscode-remote/ssh-remote+" + host + dir
+	}
+}
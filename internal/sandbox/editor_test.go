@@ -0,0 +1,46 @@
+package sandbox
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseEditor(t *testing.T) {
+	tests := map[string]Editor{
+		"":        EditorVSCode,
+		"code":    EditorVSCode,
+		"cursor":  EditorCursor,
+		"gateway": EditorJetBrains,
+	}
+	for name, want := range tests {
+		if got, err := ParseEditor(name); err != nil || got != want {
+			t.Errorf("ParseEditor(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseEditor("emacs"); err == nil {
+		t.Error("ParseEditor(emacs) should fail")
+	}
+}
+
+func TestEditorURI(t *testing.T) {
+	if got := editorURI(EditorVSCode, "dev", "/home/agent/workspace"); got != "vscode://vscode-remote/ssh-remote+dev/home/agent/workspace" {
+		t.Errorf("vscode URI = %q", got)
+	}
+	if got := editorURI(EditorCursor, "dev", "/srv"); got != "cursor://vscode-remote/ssh-remote+dev/srv" {
+		t.Errorf("cursor URI = %q", got)
+	}
+
+	got := editorURI(EditorJetBrains, "dev", "/home/agent/my project")
+	prefix := "jetbrains-gateway://connect#"
+	if !strings.HasPrefix(got, prefix) {
+		t.Fatalf("gateway URI = %q", got)
+	}
+	params, err := url.ParseQuery(strings.TrimPrefix(got, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Get("host") != "dev" || params.Get("user") != "agent" || params.Get("projectPath") != "/home/agent/my project" {
+		t.Errorf("gateway params = %v", params)
+	}
+}
@@ -0,0 +1,88 @@
+// Package sandbox provides nested Docker and Podman support for agent containers.
+package sandbox
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ContainerEngine is a container runtime installed inside an agent container.
+type ContainerEngine string
+
+const (
+	EngineDocker ContainerEngine = "docker"
+	EnginePodman ContainerEngine = "podman"
+)
+
+// engineKey records a container's engine in its Incus config.
+const engineKey = "user.coop.engine"
+
+// ContainerEngines lists the engines 'coop create --with' accepts.
+var ContainerEngines = []ContainerEngine{EngineDocker, EnginePodman}
+
+// ParseContainerEngine validates an engine name. An empty name means none.
+func ParseContainerEngine(s string) (ContainerEngine, error) {
+	if s == "" || slices.Contains(ContainerEngines, ContainerEngine(s)) {
+		return ContainerEngine(s), nil
+	}
+	return "", fmt.Errorf("unknown container engine %q (use docker or podman)", s)
+}
+
+// engineKernelModules are loaded on the host before the container starts.
+// A container cannot load modules itself, and without these the engine's
+// overlay storage and bridge networking fail at runtime.
+var engineKernelModules = "overlay,br_netfilter,ip_tables,iptable_filter,iptable_nat,nf_nat,xt_conntrack,veth"
+
+// instanceConfig returns the Incus config keys an engine needs on top of
+// the security tier's. Intercepting mknod and setxattr lets image layers
+// create device nodes and overlay whiteouts in an unprivileged container.
+func (e ContainerEngine) instanceConfig() map[string]string {
+	return map[string]string{
+		engineKey:                              string(e),
+		"security.nesting":                     "true",
+		"security.syscalls.intercept.mknod":    "true",
+		"security.syscalls.intercept.setxattr": "true",
+		"linux.kernel_modules":                 engineKernelModules,
+	}
+}
+
+// isolationConfig merges an engine's keys over the security tier's. Both
+// restrict syscalls through security.syscalls.* keys, so the tier's deny
+// list and the engine's interception apply together.
+func isolationConfig(security SecurityProfile, engine ContainerEngine) map[string]string {
+	config := security.instanceConfig()
+	if engine != "" {
+		maps.Copy(config, engine.instanceConfig())
+	}
+	return config
+}
+
+// storageDriver picks the engine's storage driver for a storage pool
+// driver. Overlay does not stack on ZFS datasets, so those use vfs.
+func (e ContainerEngine) storageDriver(poolDriver string) string {
+	switch {
+	case poolDriver == "zfs":
+		return "vfs"
+	case e == EnginePodman:
+		return "overlay"
+	default:
+		return "overlay2"
+	}
+}
+
+// allowEngine lifts the tier restrictions an engine cannot run under.
+// Docker and Podman attach cgroup device filters with bpf.
+func (p SecurityProfile) allowEngine() (SecurityProfile, error) {
+	if !p.Nesting {
+		return p, fmt.Errorf("the %s security tier does not allow nested containers", p.Tier)
+	}
+	p.DeniedSyscalls = slices.DeleteFunc(slices.Clone(p.DeniedSyscalls), func(s string) bool { return s == "bpf" })
+	return p, nil
+}
+
+// ContainerEngineOf returns the engine recorded in a container's config,
+// or "" when it was created without one.
+func ContainerEngineOf(config map[string]string) ContainerEngine {
+	return ContainerEngine(config[engineKey])
+}
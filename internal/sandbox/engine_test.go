@@ -0,0 +1,134 @@
+package sandbox
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseContainerEngine(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ContainerEngine
+		wantErr bool
+	}{
+		{"", "", false},
+		{"docker", EngineDocker, false},
+		{"podman", EnginePodman, false},
+		{"Docker", "", true},
+		{"containerd", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseContainerEngine(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContainerEngine(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseContainerEngine(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngineConfig(t *testing.T) {
+	config := EngineDocker.instanceConfig()
+	for _, key := range []string{"security.nesting", "security.syscalls.intercept.mknod", "security.syscalls.intercept.setxattr"} {
+		if config[key] != "true" {
+			t.Errorf("%s = %q, want true", key, config[key])
+		}
+	}
+	if config["linux.kernel_modules"] == "" {
+		t.Error("linux.kernel_modules not set")
+	}
+	if got := ContainerEngineOf(config); got != EngineDocker {
+		t.Errorf("ContainerEngineOf() = %q, want docker", got)
+	}
+	if got := ContainerEngineOf(map[string]string{}); got != "" {
+		t.Errorf("ContainerEngineOf() = %q for a container without one", got)
+	}
+}
+
+func TestIsolationConfig(t *testing.T) {
+	for _, tier := range []SecurityTier{SecurityStandard, SecurityDev} {
+		t.Run(string(tier), func(t *testing.T) {
+			security, err := tier.Profile().allowEngine()
+			if err != nil {
+				t.Fatalf("allowEngine() failed: %v", err)
+			}
+			config := isolationConfig(security, EngineDocker)
+			// raw.seccomp replaces Incus' policy and with it the interception
+			if _, ok := config["raw.seccomp"]; ok {
+				t.Error("raw.seccomp should not be set with an engine")
+			}
+			for _, key := range []string{"security.nesting", "security.syscalls.intercept.mknod", "security.syscalls.intercept.setxattr"} {
+				if config[key] != "true" {
+					t.Errorf("%s = %q, want true", key, config[key])
+				}
+			}
+			deny := config["security.syscalls.deny"]
+			if strings.Contains(deny, "bpf") {
+				t.Errorf("security.syscalls.deny = %q, want bpf allowed", deny)
+			}
+			for _, syscall := range security.DeniedSyscalls {
+				if !strings.Contains(deny, syscall+" errno 38") {
+					t.Errorf("security.syscalls.deny lacks %s", syscall)
+				}
+			}
+			if config[securityTierKey] != string(tier) || ContainerEngineOf(config) != EngineDocker {
+				t.Error("tier and engine should both be recorded")
+			}
+		})
+	}
+
+	if _, ok := isolationConfig(SecurityStrict.Profile(), "")[engineKey]; ok {
+		t.Error("no engine should be recorded without one")
+	}
+}
+
+func TestEngineStorageDriver(t *testing.T) {
+	tests := []struct {
+		engine ContainerEngine
+		pool   string
+		want   string
+	}{
+		{EngineDocker, "btrfs", "overlay2"},
+		{EngineDocker, "dir", "overlay2"},
+		{EngineDocker, "zfs", "vfs"},
+		{EnginePodman, "btrfs", "overlay"},
+		{EnginePodman, "zfs", "vfs"},
+		{EngineDocker, "", "overlay2"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.engine.storageDriver(tt.pool); got != tt.want {
+			t.Errorf("%s on %q: storageDriver() = %q, want %q", tt.engine, tt.pool, got, tt.want)
+		}
+	}
+}
+
+func TestAllowEngine(t *testing.T) {
+	if _, err := SecurityStrict.Profile().allowEngine(); err == nil {
+		t.Error("strict tier should refuse a container engine")
+	}
+
+	standard := SecurityStandard.Profile()
+	profile, err := standard.allowEngine()
+	if err != nil {
+		t.Fatalf("allowEngine() failed: %v", err)
+	}
+	if slices.Contains(profile.DeniedSyscalls, "bpf") {
+		t.Error("bpf should be allowed with an engine")
+	}
+	if !slices.Contains(profile.DeniedSyscalls, "userfaultfd") {
+		t.Error("other syscalls should stay denied")
+	}
+	if !slices.Contains(standard.DeniedSyscalls, "bpf") {
+		t.Error("allowEngine() modified the tier's shared deny list")
+	}
+
+	if _, err := SecurityDev.Profile().allowEngine(); err != nil {
+		t.Errorf("dev tier should allow an engine: %v", err)
+	}
+}
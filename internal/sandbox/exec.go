@@ -0,0 +1,84 @@
+// Package sandbox provides structured command execution in containers.
+package sandbox
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/stuffbucket/coop/internal/incus"
+)
+
+// ExecOptions configures a command run with Manager.Exec.
+type ExecOptions = incus.ExecOptions
+
+// ExecResult is the outcome of a command run with Manager.Exec.
+type ExecResult = incus.ExecResult
+
+// ErrExecTimeout is returned when a command is killed for exceeding its timeout.
+var ErrExecTimeout = incus.ErrExecTimeout
+
+// ParseExecUser resolves "root", "agent" or a numeric uid.
+func ParseExecUser(user string) (uint32, error) {
+	switch user {
+	case "", "root":
+		return 0, nil
+	case "agent":
+		return AgentUID, nil
+	}
+	uid, err := strconv.ParseUint(user, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user %q (use root, agent or a numeric uid)", user)
+	}
+	return uint32(uid), nil
+}
+
+// ParseExecEnv parses KEY=VALUE pairs into an environment map.
+func ParseExecEnv(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	env := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid environment variable %q (use KEY=VALUE)", pair)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+// withExecDefaults fills in the agent user's home directory and login
+// environment when running as the agent, unless the caller set them.
+// A relative Cwd is resolved against the user's home directory.
+func withExecDefaults(opts ExecOptions) ExecOptions {
+	home := "/root"
+	if opts.User == AgentUID {
+		home = AgentHome
+	}
+	if opts.Cwd != "" && !path.IsAbs(opts.Cwd) {
+		opts.Cwd = path.Join(home, opts.Cwd)
+	}
+	if opts.User != AgentUID {
+		return opts
+	}
+	if opts.Group == 0 {
+		opts.Group = AgentUID
+	}
+	if opts.Cwd == "" {
+		opts.Cwd = AgentHome
+	}
+
+	env := map[string]string{
+		"HOME":    AgentHome,
+		"USER":    "agent",
+		"LOGNAME": "agent",
+	}
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+	opts.Env = env
+	return opts
+}
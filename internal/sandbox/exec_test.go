@@ -0,0 +1,76 @@
+package sandbox
+
+import (
+	"testing"
+)
+
+func TestParseExecUser(t *testing.T) {
+	tests := []struct {
+		user    string
+		want    uint32
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"root", 0, false},
+		{"agent", AgentUID, false},
+		{"1001", 1001, false},
+		{"nobody", 0, true},
+		{"-1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			got, err := ParseExecUser(tt.user)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExecUser(%q) error = %v, wantErr %v", tt.user, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseExecUser(%q) = %d, want %d", tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExecEnv(t *testing.T) {
+	env, err := ParseExecEnv([]string{"A=1", "B=", "C=x=y"})
+	if err != nil {
+		t.Fatalf("ParseExecEnv: %v", err)
+	}
+	want := map[string]string{"A": "1", "B": "", "C": "x=y"}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("env[%q] = %q, want %q", k, env[k], v)
+		}
+	}
+
+	for _, bad := range []string{"NOVALUE", "=x"} {
+		if _, err := ParseExecEnv([]string{bad}); err == nil {
+			t.Errorf("ParseExecEnv(%q) should fail", bad)
+		}
+	}
+}
+
+func TestWithExecDefaults(t *testing.T) {
+	root := withExecDefaults(ExecOptions{Cwd: "/tmp"})
+	if root.Cwd != "/tmp" || root.Env != nil {
+		t.Errorf("root options changed: %+v", root)
+	}
+
+	if got := withExecDefaults(ExecOptions{Cwd: "src"}).Cwd; got != "/root/src" {
+		t.Errorf("root relative Cwd = %q, want /root/src", got)
+	}
+	if got := withExecDefaults(ExecOptions{User: AgentUID, Cwd: "workspace"}).Cwd; got != "/home/agent/workspace" {
+		t.Errorf("agent relative Cwd = %q, want /home/agent/workspace", got)
+	}
+
+	agent := withExecDefaults(ExecOptions{User: AgentUID, Env: map[string]string{"HOME": "/work", "X": "1"}})
+	if agent.Group != AgentUID {
+		t.Errorf("Group = %d, want %d", agent.Group, AgentUID)
+	}
+	if agent.Cwd != AgentHome {
+		t.Errorf("Cwd = %q, want %q", agent.Cwd, AgentHome)
+	}
+	if agent.Env["HOME"] != "/work" || agent.Env["USER"] != "agent" || agent.Env["X"] != "1" {
+		t.Errorf("Env = %v", agent.Env)
+	}
+}
@@ -0,0 +1,203 @@
+// Package sandbox provides reverse tunnels exposing host services to containers.
+package sandbox
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stuffbucket/coop/internal/audit"
+	"github.com/stuffbucket/coop/internal/state"
+)
+
+// exposeDevicePrefix names the Incus proxy devices: expose-<container port>.
+const exposeDevicePrefix = "expose-"
+
+// limaHostIP is the address of the macOS host as seen from a Lima VM
+// (host.lima.internal with the default user-mode network).
+const limaHostIP = "192.168.5.2"
+
+// protectedPorts are host services an agent should not reach without
+// explicit authorization: remote access, container/VM control planes and
+// file sharing. Exposing them is policed like mounting seatbelted paths.
+var protectedPorts = map[int]string{
+	22:    "SSH",
+	88:    "Kerberos",
+	111:   "RPC portmapper",
+	139:   "SMB",
+	445:   "SMB",
+	548:   "AFP file sharing",
+	631:   "CUPS printing",
+	2049:  "NFS",
+	2375:  "Docker API",
+	2376:  "Docker API (TLS)",
+	2379:  "etcd",
+	3389:  "Remote Desktop",
+	5900:  "VNC / Screen Sharing",
+	6443:  "Kubernetes API",
+	8443:  "Incus API",
+	10250: "Kubelet API",
+}
+
+// Exposed is a host service reachable inside a container.
+type Exposed struct {
+	HostAddr      string
+	HostPort      int
+	ContainerPort int
+}
+
+// ParseHostAddr parses [host:]PORT or ADDR:PORT. "host" (or no address)
+// means the machine running coop.
+func ParseHostAddr(spec string) (addr string, port int, err error) {
+	addr = "host"
+	portStr := spec
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		addr, portStr = spec[:i], spec[i+1:]
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if addr != "host" && net.ParseIP(addr) == nil {
+			return "", 0, fmt.Errorf("invalid host address %q (use host or an IP address)", addr)
+		}
+	}
+	if port, err = parsePort(portStr); err != nil {
+		return "", 0, err
+	}
+	return addr, port, nil
+}
+
+// IsPortProtected returns true if exposing a host address and port needs
+// authorization: a protected service, or an address beyond this machine.
+func IsPortProtected(addr string, port int) (bool, string) {
+	if service, ok := protectedPorts[port]; ok {
+		return true, fmt.Sprintf("port %d is %s", port, service)
+	}
+	if addr != "host" {
+		if ip := net.ParseIP(addr); ip == nil || !ip.IsLoopback() {
+			return true, fmt.Sprintf("%s is not this machine; the container would reach your network", addr)
+		}
+	}
+	return false, ""
+}
+
+// hostAddrFromIncus resolves "host" to the address that reaches this
+// machine from the Incus host, where proxy devices connect from.
+func (m *Manager) hostAddrFromIncus(addr string) (string, error) {
+	if addr != "host" {
+		return addr, nil
+	}
+	switch m.client.BackendName() {
+	case "colima", "lima":
+		return limaHostIP, nil
+	case "bladerunner", "remote":
+		return "", fmt.Errorf("the %s backend cannot reach services on this machine; give the address explicitly", m.client.BackendName())
+	}
+	return "127.0.0.1", nil
+}
+
+// Expose makes host addr:hostPort reachable inside the container at
+// 127.0.0.1:containerPort, using an Incus proxy device that listens in the
+// container and connects from the host.
+// Set force=true to expose protected ports (confirmed by the Authorizer).
+func (m *Manager) Expose(name, addr string, hostPort, containerPort int, force bool) (err error) {
+	entry := audit.Entry{Op: "expose", Container: name, Args: map[string]string{
+		"addr": addr, "port": strconv.Itoa(hostPort), "container_port": strconv.Itoa(containerPort),
+	}}
+	defer func() { auditOp(entry, err) }()
+
+	if _, err := m.client.GetContainer(name); err != nil {
+		return containerNotFound(name)
+	}
+
+	auth, err := m.AuthorizeHostPort(name, addr, hostPort, force)
+	entry.Auth = auth
+	if err != nil {
+		entry.Outcome = audit.OutcomeDenied
+		return err
+	}
+
+	connectAddr, err := m.hostAddrFromIncus(addr)
+	if err != nil {
+		return err
+	}
+
+	device := map[string]string{
+		"type":    "proxy",
+		"bind":    "instance",
+		"listen":  fmt.Sprintf("tcp:127.0.0.1:%d", containerPort),
+		"connect": "tcp:" + net.JoinHostPort(connectAddr, strconv.Itoa(hostPort)),
+	}
+	if err := m.client.AddDevice(name, exposeDeviceName(containerPort), device); err != nil {
+		return err
+	}
+
+	m.trackState(name, func(t *state.Tracker) (string, error) {
+		return t.RecordExpose(state.Expose{HostAddr: addr, HostPort: hostPort, ContainerPort: containerPort, Forced: auth != ""})
+	})
+	return nil
+}
+
+// Unexpose removes an exposed host service by container port.
+func (m *Manager) Unexpose(name string, containerPort int) (err error) {
+	defer func() {
+		auditOp(audit.Entry{Op: "unexpose", Container: name, Args: map[string]string{"container_port": strconv.Itoa(containerPort)}}, err)
+	}()
+
+	devices, err := m.client.ListDevices(name)
+	if err != nil {
+		return containerNotFound(name)
+	}
+	if _, ok := devices[exposeDeviceName(containerPort)]; !ok {
+		return fmt.Errorf("nothing is exposed on port %d in %s", containerPort, name)
+	}
+	if err := m.client.RemoveDevice(name, exposeDeviceName(containerPort)); err != nil {
+		return err
+	}
+
+	m.trackState(name, func(t *state.Tracker) (string, error) {
+		return t.RecordUnexpose(containerPort)
+	})
+	return nil
+}
+
+// trackState records a change in the instance's state history. The
+// change has already been made, so a failure only warns.
+func (m *Manager) trackState(name string, record func(*state.Tracker) (string, error)) {
+	tracker, err := state.NewTracker(filepath.Join(m.config.Dirs.Data, "instances"), name, "")
+	if err == nil {
+		_, err = record(tracker)
+	}
+	if err != nil {
+		fmt.Printf("Warning: %s changed but state tracking failed: %v\n", name, err)
+	}
+}
+
+// ListExposed returns the host services exposed to a container, sorted by container port.
+func (m *Manager) ListExposed(name string) ([]Exposed, error) {
+	devices, err := m.client.ListDevices(name)
+	if err != nil {
+		return nil, containerNotFound(name)
+	}
+
+	var exposed []Exposed
+	for devName, dev := range devices {
+		if !strings.HasPrefix(devName, exposeDevicePrefix) || dev["type"] != "proxy" {
+			continue
+		}
+		e := Exposed{}
+		e.ContainerPort, _ = strconv.Atoi(dev["listen"][strings.LastIndex(dev["listen"], ":")+1:])
+		if host, port, err := net.SplitHostPort(strings.TrimPrefix(dev["connect"], "tcp:")); err == nil {
+			e.HostAddr = host
+			e.HostPort, _ = strconv.Atoi(port)
+		}
+		exposed = append(exposed, e)
+	}
+
+	sort.Slice(exposed, func(i, j int) bool { return exposed[i].ContainerPort < exposed[j].ContainerPort })
+	return exposed, nil
+}
+
+func exposeDeviceName(containerPort int) string {
+	return exposeDevicePrefix + strconv.Itoa(containerPort)
+}
@@ -0,0 +1,83 @@
+package sandbox
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stuffbucket/coop/internal/config"
+	"github.com/stuffbucket/coop/internal/state"
+)
+
+func TestParseHostAddr(t *testing.T) {
+	tests := []struct {
+		spec    string
+		addr    string
+		port    int
+		wantErr bool
+	}{
+		{"5432", "host", 5432, false},
+		{"host:5432", "host", 5432, false},
+		{"127.0.0.1:11434", "127.0.0.1", 11434, false},
+		{"[::1]:8080", "::1", 8080, false},
+		{"10.0.0.5:6379", "10.0.0.5", 6379, false},
+		{"db.local:5432", "", 0, true},
+		{"host:0", "", 0, true},
+		{"host:", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		addr, port, err := ParseHostAddr(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHostAddr(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if addr != tt.addr || port != tt.port {
+			t.Errorf("ParseHostAddr(%q) = %q, %d, want %q, %d", tt.spec, addr, port, tt.addr, tt.port)
+		}
+	}
+}
+
+func TestIsPortProtected(t *testing.T) {
+	tests := []struct {
+		addr      string
+		port      int
+		protected bool
+	}{
+		{"host", 5432, false},
+		{"127.0.0.1", 11434, false},
+		{"::1", 8080, false},
+		{"host", 22, true},
+		{"host", 2375, true},
+		{"127.0.0.1", 5900, true},
+		{"10.0.0.5", 6379, true},
+		{"0.0.0.0", 8080, true},
+	}
+
+	for _, tt := range tests {
+		protected, reason := IsPortProtected(tt.addr, tt.port)
+		if protected != tt.protected {
+			t.Errorf("IsPortProtected(%q, %d) = %v, want %v", tt.addr, tt.port, protected, tt.protected)
+		}
+		if protected && reason == "" {
+			t.Errorf("IsPortProtected(%q, %d) returned no reason", tt.addr, tt.port)
+		}
+	}
+}
+
+func TestTrackState(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Dirs.Data = t.TempDir()
+	m := &Manager{config: cfg}
+
+	m.trackState("web", func(t *state.Tracker) (string, error) {
+		return t.RecordExpose(state.Expose{HostAddr: "host", HostPort: 22, ContainerPort: 2222, Forced: true})
+	})
+
+	tracker, err := state.NewTracker(filepath.Join(cfg.Dirs.Data, "instances"), "web", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exposes := tracker.Instance().Exposes; len(exposes) != 1 || !exposes[0].Forced || exposes[0].ContainerPort != 2222 {
+		t.Errorf("Exposes = %+v, want the forced expose", exposes)
+	}
+}
@@ -0,0 +1,273 @@
+// Package sandbox provides host-to-container port forwarding.
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stuffbucket/coop/internal/audit"
+)
+
+const (
+	// forwardKeyPrefix prefixes the instance config keys recording forwards:
+	// user.coop.forward.<host port> = <container port>.
+	forwardKeyPrefix = "user.coop.forward."
+	// forwardDevicePrefix names the Incus proxy devices: fwd-<host port>.
+	forwardDevicePrefix = "fwd-"
+)
+
+// ForwardMode is how a forward is implemented.
+type ForwardMode string
+
+const (
+	// ForwardProxy uses an Incus proxy device, which Incus keeps across restarts.
+	ForwardProxy ForwardMode = "proxy"
+	// ForwardSSH uses an SSH -L tunnel, for backends whose Incus host is not
+	// this machine. Tunnels are re-opened by RestoreForwards.
+	ForwardSSH ForwardMode = "ssh"
+)
+
+// Forward is a host port forwarded to a container port.
+type Forward struct {
+	HostPort      int
+	ContainerPort int
+	Mode          ForwardMode
+	Active        bool
+}
+
+// ParsePortSpec parses HOST[:CONTAINER]; the container port defaults to the host port.
+func ParsePortSpec(spec string) (hostPort, containerPort int, err error) {
+	hostStr, containerStr, found := strings.Cut(spec, ":")
+	if hostPort, err = parsePort(hostStr); err != nil {
+		return 0, 0, err
+	}
+	containerPort = hostPort
+	if found {
+		if containerPort, err = parsePort(containerStr); err != nil {
+			return 0, 0, err
+		}
+	}
+	return hostPort, containerPort, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q (must be 1-65535)", s)
+	}
+	return port, nil
+}
+
+// forwardMode picks the forwarding mechanism for the backend. Proxy devices
+// listen on the Incus host, which is only reachable as localhost when it is
+// this machine or a VM that forwards its ports here (Colima, Lima).
+func (m *Manager) forwardMode() ForwardMode {
+	if m.SharesHostFilesystem() {
+		return ForwardProxy
+	}
+	return ForwardSSH
+}
+
+// AddForward forwards 127.0.0.1:hostPort on the host to containerPort in the
+// container. The forward is recorded so it comes back when the container starts.
+func (m *Manager) AddForward(name string, hostPort, containerPort int) (err error) {
+	defer func() {
+		auditOp(audit.Entry{Op: "forward.add", Container: name, Args: forwardAuditArgs(hostPort, containerPort)}, err)
+	}()
+
+	if _, err := m.client.GetContainer(name); err != nil {
+		return containerNotFound(name)
+	}
+
+	forwards, err := m.ListForwards(name)
+	if err != nil {
+		return err
+	}
+	for _, f := range forwards {
+		if f.HostPort == hostPort {
+			return fmt.Errorf("port %d is already forwarded to %s:%d", hostPort, name, f.ContainerPort)
+		}
+	}
+
+	if m.forwardMode() == ForwardProxy {
+		device := map[string]string{
+			"type":    "proxy",
+			"listen":  fmt.Sprintf("tcp:127.0.0.1:%d", hostPort),
+			"connect": fmt.Sprintf("tcp:127.0.0.1:%d", containerPort),
+			"bind":    "host",
+		}
+		if err := m.client.AddDevice(name, forwardDeviceName(hostPort), device); err != nil {
+			return err
+		}
+	} else if err := m.startTunnel(name, hostPort, containerPort); err != nil {
+		return err
+	}
+
+	return m.client.UpdateConfig(name, map[string]string{
+		forwardKey(hostPort): strconv.Itoa(containerPort),
+	})
+}
+
+// RemoveForward stops forwarding a host port and forgets it.
+func (m *Manager) RemoveForward(name string, hostPort int) (err error) {
+	defer func() {
+		auditOp(audit.Entry{Op: "forward.remove", Container: name, Args: forwardAuditArgs(hostPort, 0)}, err)
+	}()
+
+	container, err := m.client.GetContainer(name)
+	if err != nil {
+		return containerNotFound(name)
+	}
+	if _, ok := container.Config[forwardKey(hostPort)]; !ok {
+		return fmt.Errorf("port %d is not forwarded to %s", hostPort, name)
+	}
+
+	if _, ok := container.Devices[forwardDeviceName(hostPort)]; ok {
+		if err := m.client.RemoveDevice(name, forwardDeviceName(hostPort)); err != nil {
+			return err
+		}
+	}
+	m.stopTunnel(name, hostPort)
+
+	return m.client.UpdateConfig(name, map[string]string{forwardKey(hostPort): ""})
+}
+
+// forwardAuditArgs describes a forward in the audit log; containerPort is
+// 0 when only the host port is known.
+func forwardAuditArgs(hostPort, containerPort int) map[string]string {
+	args := map[string]string{"port": strconv.Itoa(hostPort)}
+	if containerPort > 0 {
+		args["container_port"] = strconv.Itoa(containerPort)
+	}
+	return args
+}
+
+// ListForwards returns a container's forwards sorted by host port.
+func (m *Manager) ListForwards(name string) ([]Forward, error) {
+	container, err := m.client.GetContainer(name)
+	if err != nil {
+		return nil, containerNotFound(name)
+	}
+	running := ContainerState(container.Status).IsRunning()
+
+	var forwards []Forward
+	for key, value := range container.Config {
+		hostStr, ok := strings.CutPrefix(key, forwardKeyPrefix)
+		if !ok {
+			continue
+		}
+		hostPort, err1 := strconv.Atoi(hostStr)
+		containerPort, err2 := strconv.Atoi(value)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		f := Forward{HostPort: hostPort, ContainerPort: containerPort, Mode: ForwardSSH}
+		if _, ok := container.Devices[forwardDeviceName(hostPort)]; ok {
+			f.Mode = ForwardProxy
+			f.Active = running
+		} else {
+			f.Active = running && m.tunnelActive(name, hostPort)
+		}
+		forwards = append(forwards, f)
+	}
+
+	sort.Slice(forwards, func(i, j int) bool { return forwards[i].HostPort < forwards[j].HostPort })
+	return forwards, nil
+}
+
+// RestoreForwards re-opens SSH tunnels after the container starts.
+// Proxy device forwards are restored by Incus itself.
+func (m *Manager) RestoreForwards(name string) error {
+	forwards, err := m.ListForwards(name)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, f := range forwards {
+		if f.Mode != ForwardSSH || f.Active {
+			continue
+		}
+		if err := m.startTunnel(name, f.HostPort, f.ContainerPort); err != nil {
+			failed = append(failed, fmt.Sprintf("%d: %v", f.HostPort, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not restore forwards: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// startTunnel opens a background SSH tunnel. It runs as an SSH control
+// master so it can be checked and stopped through its socket.
+func (m *Manager) startTunnel(name string, hostPort, containerPort int) error {
+	sshArgs, err := m.SSHArgs(name)
+	if err != nil {
+		return err
+	}
+
+	sock := m.tunnelSocket(name, hostPort)
+	if err := os.MkdirAll(filepath.Dir(sock), 0700); err != nil {
+		return err
+	}
+
+	args := []string{
+		"-f", "-N", "-M", "-S", sock,
+		"-o", "ExitOnForwardFailure=yes",
+		"-L", fmt.Sprintf("127.0.0.1:%d:127.0.0.1:%d", hostPort, containerPort),
+	}
+	cmd := exec.Command("ssh", append(args, sshArgs...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ssh tunnel failed: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (m *Manager) stopTunnel(name string, hostPort int) {
+	sock := m.tunnelSocket(name, hostPort)
+	if _, err := os.Stat(sock); err != nil {
+		return
+	}
+	_ = exec.Command("ssh", "-S", sock, "-O", "exit", "coop-"+name).Run()
+	_ = os.Remove(sock)
+}
+
+// stopTunnels closes all SSH tunnels to a container. The forwards stay
+// recorded and are re-opened by RestoreForwards.
+func (m *Manager) stopTunnels(name string) {
+	socks, _ := filepath.Glob(filepath.Join(m.config.Dirs.Cache, "fwd", name+"-*.sock"))
+	for _, sock := range socks {
+		port, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(sock), name+"-"), ".sock"))
+		if err == nil {
+			m.stopTunnel(name, port)
+		}
+	}
+}
+
+func (m *Manager) tunnelActive(name string, hostPort int) bool {
+	sock := m.tunnelSocket(name, hostPort)
+	if _, err := os.Stat(sock); err != nil {
+		return false
+	}
+	return exec.Command("ssh", "-S", sock, "-O", "check", "coop-"+name).Run() == nil
+}
+
+// tunnelSocket is the control socket of a tunnel. Kept short: Unix socket
+// paths are limited to about 100 bytes.
+func (m *Manager) tunnelSocket(name string, hostPort int) string {
+	return filepath.Join(m.config.Dirs.Cache, "fwd", fmt.Sprintf("%s-%d.sock", name, hostPort))
+}
+
+func forwardKey(hostPort int) string {
+	return forwardKeyPrefix + strconv.Itoa(hostPort)
+}
+
+func forwardDeviceName(hostPort int) string {
+	return forwardDevicePrefix + strconv.Itoa(hostPort)
+}
@@ -0,0 +1,31 @@
+package sandbox
+
+import "testing"
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec        string
+		host, guest int
+		wantErr     bool
+	}{
+		{"3000", 3000, 3000, false},
+		{"8080:8888", 8080, 8888, false},
+		{"1:65535", 1, 65535, false},
+		{"0", 0, 0, true},
+		{"70000", 0, 0, true},
+		{"abc", 0, 0, true},
+		{"3000:", 0, 0, true},
+		{":3000", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		host, guest, err := ParsePortSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePortSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if host != tt.host || guest != tt.guest {
+			t.Errorf("ParsePortSpec(%q) = %d, %d, want %d, %d", tt.spec, host, guest, tt.host, tt.guest)
+		}
+	}
+}
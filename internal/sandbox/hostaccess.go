@@ -0,0 +1,154 @@
+// Package sandbox provides the authorization layer for host paths and ports reaching containers.
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/stuffbucket/coop/internal/audit"
+)
+
+// HostOp names how a container gets to a host path.
+type HostOp string
+
+const (
+	HostOpWorkdir HostOp = "workdir" // workspace disk device set at create
+	HostOpMount   HostOp = "mount"   // disk device added with 'coop mount'
+	HostOpCopy    HostOp = "copy"    // file transfer with 'coop cp'
+	HostOpSync    HostOp = "sync"    // file transfer with 'coop sync'
+	HostOpProxy   HostOp = "proxy"   // proxy device connecting to a host socket
+	HostOpExpose  HostOp = "expose"  // proxy device reaching a host port with 'coop expose'
+)
+
+// verb describes the operation in refusals: "refusing to <verb> ...".
+func (op HostOp) verb() string {
+	switch op {
+	case HostOpWorkdir:
+		return "use as workdir"
+	case HostOpProxy:
+		return "proxy to"
+	}
+	return string(op)
+}
+
+// overrideHint tells how to get past a deny rule for the operation.
+func (op HostOp) overrideHint() string {
+	if op == HostOpProxy {
+		return "Add an allow rule to " + SeatbeltPolicyPath()
+	}
+	return "Use --force to override"
+}
+
+// HostAccess is a request to let a container use a host path, or for
+// HostOpExpose a host address and port.
+type HostAccess struct {
+	Op        HostOp
+	Path      string // ADDR:PORT for HostOpExpose
+	Container string
+	// Force asks to override a deny rule. The Manager's Authorizer must
+	// confirm it before the access goes ahead.
+	Force bool
+	// Authorized marks an override confirmed and audited earlier, such as
+	// a sync pair that is run again. Block rules still apply.
+	Authorized bool
+}
+
+// Authorizer confirms a forced override of a denied host path, for example
+// by asking for a one-time code. It returns how the override was
+// authorized, such as "totp", or an error to refuse it.
+type Authorizer func(access HostAccess, d SeatbeltDecision) (string, error)
+
+// ErrNoAuthorizer is returned when an override is requested but nothing
+// can confirm it.
+var ErrNoAuthorizer = errors.New("no way to confirm the override in this context")
+
+// SetAuthorizer sets how forced overrides of denied host paths are confirmed.
+// Without one, every override is refused.
+func (m *Manager) SetAuthorizer(fn Authorizer) {
+	m.authorizer = fn
+}
+
+// AuthorizeHostPath is the single gate for host paths reaching a container,
+// whether as a device, a file transfer or a proxy. Allowed paths pass.
+// Blocked paths are always refused. Denied paths need Force and the
+// Authorizer's confirmation; every attempted override is audited, and one
+// that cannot be recorded is refused. Returns the authorization method for
+// a new override, or "" when none was needed.
+func (m *Manager) AuthorizeHostPath(access HostAccess) (string, error) {
+	d := CheckSeatbelt(access.Path, access.Container)
+	switch {
+	case d.Verdict == SeatbeltAllowed:
+		return "", nil
+	case d.Verdict == SeatbeltBlocked:
+		return "", fmt.Errorf("refusing to %s blocked path: %s", access.Op.verb(), d.Reason)
+	case access.Authorized:
+		return "", nil
+	case !access.Force:
+		return "", fmt.Errorf("refusing to %s protected path: %s. %s", access.Op.verb(), d.Reason, access.Op.overrideHint())
+	case m.authorizer == nil:
+		return "", fmt.Errorf("refusing to %s protected path: %w", access.Op.verb(), ErrNoAuthorizer)
+	}
+
+	entry := audit.Entry{
+		Op:        "seatbelt.override",
+		Container: access.Container,
+		Args: map[string]string{
+			"op":     string(access.Op),
+			"path":   d.Path,
+			"reason": d.Reason,
+		},
+	}
+	if d.Rule != nil {
+		entry.Args["rule"] = fmt.Sprintf("%s %s", d.Rule.Action, d.Rule.Path)
+	}
+	return m.confirmOverride(access, d, entry, "protected path")
+}
+
+// AuthorizeHostPort is the gate for host ports reaching a container.
+// Ports that are not protected pass; protected ones and addresses beyond
+// this machine need force and the Authorizer's confirmation, audited like
+// a path override. Returns the authorization method for an override, or
+// "" when none was needed.
+func (m *Manager) AuthorizeHostPort(container, addr string, port int, force bool) (string, error) {
+	protected, reason := IsPortProtected(addr, port)
+	switch {
+	case !protected:
+		return "", nil
+	case !force:
+		return "", fmt.Errorf("refusing to expose protected port: %s. %s", reason, HostOpExpose.overrideHint())
+	case m.authorizer == nil:
+		return "", fmt.Errorf("refusing to expose protected port: %w", ErrNoAuthorizer)
+	}
+
+	access := HostAccess{Op: HostOpExpose, Path: net.JoinHostPort(addr, strconv.Itoa(port)), Container: container, Force: true}
+	d := SeatbeltDecision{Path: access.Path, Verdict: SeatbeltDenied, Reason: reason}
+	entry := audit.Entry{
+		Op:        "port.override",
+		Container: container,
+		Args: map[string]string{
+			"op":     string(HostOpExpose),
+			"addr":   addr,
+			"port":   strconv.Itoa(port),
+			"reason": reason,
+		},
+	}
+	return m.confirmOverride(access, d, entry, "protected port")
+}
+
+// confirmOverride asks the Authorizer to confirm an override and audits
+// the attempt in entry. An override that cannot be recorded is refused.
+func (m *Manager) confirmOverride(access HostAccess, d SeatbeltDecision, entry audit.Entry, what string) (string, error) {
+	auth, err := m.authorizer(access, d)
+	entry.Auth = auth
+	if err != nil {
+		entry.Outcome = audit.OutcomeDenied
+		auditOp(entry, err)
+		return "", fmt.Errorf("refusing to %s %s: %w", access.Op.verb(), what, err)
+	}
+	if err := RecordAudit(entry, nil); err != nil {
+		return "", fmt.Errorf("refusing to %s %s: could not record the override: %w", access.Op.verb(), what, err)
+	}
+	return auth, nil
+}
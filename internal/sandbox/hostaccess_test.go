@@ -0,0 +1,188 @@
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stuffbucket/coop/internal/audit"
+)
+
+func TestAuthorizeHostPath(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+
+	root := t.TempDir()
+	secrets := filepath.Join(root, "secrets")
+	vault := filepath.Join(root, "vault")
+	policy := `{"rules": [
+		{"path": "` + secrets + `", "action": "deny", "reason": "test secrets"},
+		{"path": "` + vault + `", "action": "block", "reason": "test vault"}
+	]}`
+	if err := os.WriteFile(SeatbeltPolicyPath(), []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	approve := func(HostAccess, SeatbeltDecision) (string, error) { return "totp", nil }
+	reject := func(HostAccess, SeatbeltDecision) (string, error) { return "totp", errors.New("wrong code") }
+
+	tests := []struct {
+		name       string
+		authorizer Authorizer
+		access     HostAccess
+		wantErr    string        // empty when the access should be allowed
+		wantAudit  audit.Outcome // empty when nothing should be audited
+	}{
+		{
+			name:   "allowed path",
+			access: HostAccess{Op: HostOpMount, Path: filepath.Join(root, "src"), Container: "web"},
+		},
+		{
+			name:       "blocked even with force",
+			authorizer: approve,
+			access:     HostAccess{Op: HostOpMount, Path: vault, Container: "web", Force: true},
+			wantErr:    "refusing to mount blocked path",
+		},
+		{
+			name:    "denied without force",
+			access:  HostAccess{Op: HostOpCopy, Path: filepath.Join(secrets, "key"), Container: "web"},
+			wantErr: "Use --force",
+		},
+		{
+			name:    "proxy points at the policy",
+			access:  HostAccess{Op: HostOpProxy, Path: filepath.Join(secrets, "agent.sock"), Container: "web"},
+			wantErr: "Add an allow rule",
+		},
+		{
+			name:    "force without authorizer",
+			access:  HostAccess{Op: HostOpWorkdir, Path: secrets, Container: "web", Force: true},
+			wantErr: ErrNoAuthorizer.Error(),
+		},
+		{
+			name:       "force rejected",
+			authorizer: reject,
+			access:     HostAccess{Op: HostOpSync, Path: secrets, Container: "web", Force: true},
+			wantErr:    "wrong code",
+			wantAudit:  audit.OutcomeDenied,
+		},
+		{
+			name:       "force approved",
+			authorizer: approve,
+			access:     HostAccess{Op: HostOpWorkdir, Path: secrets, Container: "web", Force: true},
+			wantAudit:  audit.OutcomeOK,
+		},
+		{
+			name:   "authorized earlier",
+			access: HostAccess{Op: HostOpSync, Path: secrets, Container: "web", Authorized: true},
+		},
+		{
+			name:    "authorized earlier but now blocked",
+			access:  HostAccess{Op: HostOpSync, Path: vault, Container: "web", Authorized: true},
+			wantErr: "blocked path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COOP_DATA_DIR", t.TempDir())
+			m := &Manager{}
+			m.SetAuthorizer(tt.authorizer)
+
+			auth, err := m.AuthorizeHostPath(tt.access)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("AuthorizeHostPath() error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("AuthorizeHostPath() error = %v, want %q", err, tt.wantErr)
+			}
+			if wantAuth := tt.wantAudit == audit.OutcomeOK; (auth == "totp") != wantAuth {
+				t.Errorf("AuthorizeHostPath() auth = %q", auth)
+			}
+
+			entries, err := AuditLog().Entries()
+			if err != nil {
+				t.Fatalf("Entries() error: %v", err)
+			}
+			if tt.wantAudit == "" {
+				if len(entries) != 0 {
+					t.Errorf("audited %+v, want nothing", entries)
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %d audit entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if e.Op != "seatbelt.override" || e.Outcome != tt.wantAudit || e.Auth != "totp" || e.Container != "web" {
+				t.Errorf("audit entry = %+v", e)
+			}
+			if e.Args["op"] != string(tt.access.Op) || e.Args["rule"] != "deny "+secrets {
+				t.Errorf("audit args = %v", e.Args)
+			}
+		})
+	}
+}
+
+func TestAuthorizeHostPort(t *testing.T) {
+	approve := func(HostAccess, SeatbeltDecision) (string, error) { return "totp", nil }
+	reject := func(HostAccess, SeatbeltDecision) (string, error) { return "totp", errors.New("wrong code") }
+
+	tests := []struct {
+		name       string
+		authorizer Authorizer
+		addr       string
+		port       int
+		force      bool
+		wantErr    string        // empty when the port should be exposed
+		wantAudit  audit.Outcome // empty when nothing should be audited
+	}{
+		{name: "ordinary port", addr: "host", port: 5432},
+		{name: "protected without force", authorizer: approve, addr: "host", port: 22, wantErr: "Use --force"},
+		{name: "force without authorizer", addr: "host", port: 22, force: true, wantErr: ErrNoAuthorizer.Error()},
+		{name: "force rejected", authorizer: reject, addr: "host", port: 2375, force: true, wantErr: "wrong code", wantAudit: audit.OutcomeDenied},
+		{name: "force approved", authorizer: approve, addr: "10.0.0.8", port: 8080, force: true, wantAudit: audit.OutcomeOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+			t.Setenv("COOP_DATA_DIR", t.TempDir())
+			m := &Manager{}
+			m.SetAuthorizer(tt.authorizer)
+
+			auth, err := m.AuthorizeHostPort("web", tt.addr, tt.port, tt.force)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("AuthorizeHostPort() error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("AuthorizeHostPort() error = %v, want %q", err, tt.wantErr)
+			}
+			if wantAuth := tt.wantAudit == audit.OutcomeOK; (auth == "totp") != wantAuth {
+				t.Errorf("AuthorizeHostPort() auth = %q", auth)
+			}
+
+			entries, err := AuditLog().Entries()
+			if err != nil {
+				t.Fatalf("Entries() error: %v", err)
+			}
+			if tt.wantAudit == "" {
+				if len(entries) != 0 {
+					t.Errorf("audited %+v, want nothing", entries)
+				}
+				return
+			}
+			if len(entries) != 1 {
+				t.Fatalf("got %d audit entries, want 1", len(entries))
+			}
+			e := entries[0]
+			if e.Op != "port.override" || e.Outcome != tt.wantAudit || e.Auth != "totp" || e.Container != "web" {
+				t.Errorf("audit entry = %+v", e)
+			}
+			if e.Args["addr"] != tt.addr || e.Args["port"] != strconv.Itoa(tt.port) || e.Args["reason"] == "" {
+				t.Errorf("audit args = %v", e.Args)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Package sandbox provides SSH host key pinning for containers.
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/stuffbucket/coop/internal/sshkeys"
+)
+
+// hostKeyPattern matches the public host keys sshd generates on first boot.
+const hostKeyPattern = "/etc/ssh/ssh_host_*_key.pub"
+
+// PinHostKeys reads a container's SSH host public keys through the Incus
+// file API and pins them in known_hosts under the container's name. The
+// Incus API is already authenticated, so ssh never has to trust a key on
+// first use. It is called after cloud-init and whenever the keys may have
+// changed (restore); run it again after regenerating keys in a container.
+func (m *Manager) PinHostKeys(name string) error {
+	keys, err := m.readHostKeys(name)
+	if err != nil {
+		return err
+	}
+	return sshkeys.PinHostKeys(name, keys)
+}
+
+// ensureHostKeys pins a container's host keys unless some are pinned
+// already, so containers created before pinning keep working.
+func (m *Manager) ensureHostKeys(name string) error {
+	if sshkeys.HasPinnedHostKeys(name) {
+		return nil
+	}
+	return m.PinHostKeys(name)
+}
+
+// readHostKeys returns a container's public host keys in authorized_keys
+// format, sorted by file name.
+func (m *Manager) readHostKeys(name string) ([]string, error) {
+	client, err := m.client.SFTP(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = client.Close() }()
+
+	paths, err := client.Glob(hostKeyPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list host keys: %w", err)
+	}
+	sort.Strings(paths)
+
+	var keys []string
+	for _, p := range paths {
+		f, err := client.Open(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(f, 16<<10))
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		keys = append(keys, string(data))
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("container %s has no SSH host keys yet", name)
+	}
+	return keys, nil
+}
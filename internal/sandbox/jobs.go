@@ -0,0 +1,268 @@
+// Package sandbox provides detached jobs supervised by tmux inside containers.
+package sandbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/audit"
+)
+
+// jobsDir holds one directory per job with its command, start time, log
+// and, once it finishes, its exit code.
+const jobsDir = AgentHome + "/.coop/jobs"
+
+// jobSessionPrefix names the tmux session of each job: coop-job-<id>.
+const jobSessionPrefix = "coop-job-"
+
+// JobStatus describes whether a job is still running.
+type JobStatus string
+
+const (
+	JobRunning JobStatus = "running"
+	JobExited  JobStatus = "exited"
+	JobKilled  JobStatus = "killed" // Session gone without an exit code
+)
+
+// Job is a command running detached inside a container.
+type Job struct {
+	ID       string
+	Command  string
+	Started  time.Time
+	Status   JobStatus
+	ExitCode int // Only meaningful when Status is JobExited
+}
+
+var validJobID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ValidateJobID reports whether id can name a job.
+func ValidateJobID(id string) error {
+	if !validJobID.MatchString(id) {
+		return fmt.Errorf("invalid job id %q", id)
+	}
+	return nil
+}
+
+// newJobID returns a short random job id.
+func newJobID() string {
+	buf := make([]byte, 3)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// jobScript runs inside the tmux session: it waits until the session's
+// output is being logged, runs the command in its working directory and
+// records its exit code.
+const jobScript = `tmux wait-for "$0"; dir=$1; cd "$2" && shift 2 && "$@"; echo $? > "$dir/exit"`
+
+// StartJob runs a command as the agent user in a new tmux session that
+// outlives the caller's terminal. Output is appended to the job's log.
+// opts.User, Stdin, Stdout, Stderr and Timeout are ignored.
+func (m *Manager) StartJob(name string, command []string, opts ExecOptions) (job *Job, err error) {
+	defer func() {
+		args := map[string]string{"command": strings.Join(command, " ")}
+		if job != nil {
+			args["job"] = job.ID
+		}
+		auditOp(audit.Entry{Op: "job.start", Container: name, Args: args}, err)
+	}()
+
+	if len(command) == 0 {
+		return nil, fmt.Errorf("command required")
+	}
+
+	id := newJobID()
+	dir := jobsDir + "/" + id
+	session := jobSessionPrefix + id
+	cmdLine := strings.Join(command, " ")
+
+	setup := []string{"sh", "-c", `mkdir -p "$1" && printf '%s\n' "$2" > "$1/command" && date +%s > "$1/started"`, "sh", dir, cmdLine}
+	if err := m.execAgent(name, setup, ExecOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to prepare job: %w", err)
+	}
+
+	opts = withExecDefaults(ExecOptions{User: AgentUID, Cwd: opts.Cwd, Env: opts.Env})
+	if err := m.execAgent(name, jobCommand(session, dir, opts.Cwd, opts.Env, command), opts); err != nil {
+		return nil, fmt.Errorf("failed to start job: %w", err)
+	}
+
+	return &Job{ID: id, Command: cmdLine, Started: time.Now(), Status: JobRunning}, nil
+}
+
+// jobCommand returns the tmux invocation starting a job. tmux splits its
+// arguments on any that is or ends with ";", so the command, environment
+// and directory reach jobScript quoted inside one shell command instead.
+func jobCommand(session, dir, cwd string, env map[string]string, command []string) []string {
+	words := []string{"exec", "env"}
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		words = append(words, shellQuote(k+"="+env[k]))
+	}
+	words = append(words, "sh", "-c", shellQuote(jobScript), session, dir, shellQuote(cwd))
+	for _, arg := range command {
+		words = append(words, shellQuote(arg))
+	}
+	return []string{
+		"tmux", "new-session", "-d", "-s", session, strings.Join(words, " "),
+		";", "pipe-pane", "-t", session, "-o", "cat >> " + dir + "/log",
+		";", "wait-for", "-S", session,
+	}
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// listJobsScript prints one tab-separated line per job:
+// id, start time, running (1/0), exit code (may be empty), command.
+const listJobsScript = `cd "$0" 2>/dev/null || exit 0
+for d in */; do
+	id=${d%/}
+	run=0
+	tmux has-session -t "=coop-job-$id" 2>/dev/null && run=1
+	printf '%s\t%s\t%s\t%s\t%s\n' "$id" "$(cat "$id/started" 2>/dev/null)" "$run" "$(cat "$id/exit" 2>/dev/null)" "$(cat "$id/command" 2>/dev/null)"
+done`
+
+// ListJobs returns the container's detached jobs, most recent first.
+func (m *Manager) ListJobs(name string) ([]Job, error) {
+	if err := m.requireRunning(name); err != nil {
+		return nil, err
+	}
+	result, err := m.client.Exec(name, []string{"sh", "-c", listJobsScript, jobsDir}, withExecDefaults(ExecOptions{User: AgentUID}))
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to list jobs: %s", strings.TrimSpace(result.Stderr))
+	}
+	return parseJobList(result.Stdout), nil
+}
+
+// parseJobList parses the output of listJobsScript.
+func parseJobList(out string) []Job {
+	var jobs []Job
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) != 5 || ValidateJobID(fields[0]) != nil {
+			continue
+		}
+
+		job := Job{ID: fields[0], Command: fields[4], Status: JobKilled}
+		if secs, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			job.Started = time.Unix(secs, 0)
+		}
+		switch {
+		case fields[2] == "1":
+			job.Status = JobRunning
+		case fields[3] != "":
+			if code, err := strconv.Atoi(fields[3]); err == nil {
+				job.Status = JobExited
+				job.ExitCode = code
+			}
+		}
+		jobs = append(jobs, job)
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Started.After(jobs[j].Started) })
+	return jobs
+}
+
+// AttachJob connects the terminal to a running job's tmux session.
+// Detaching (Ctrl-b d) leaves the job running.
+func (m *Manager) AttachJob(name, id string) (int, error) {
+	job, err := m.findJob(name, id)
+	if err != nil {
+		return -1, err
+	}
+	if job.Status != JobRunning {
+		return -1, fmt.Errorf("job %s is not running (use 'coop job logs' to see its output)", id)
+	}
+	return m.client.ExecInteractive(name, []string{"tmux", "attach-session", "-t", "=" + jobSessionPrefix + id})
+}
+
+// JobLogs writes a job's output to w. With follow, it keeps streaming
+// until the caller exits.
+func (m *Manager) JobLogs(name, id string, follow bool, w io.Writer) error {
+	if _, err := m.findJob(name, id); err != nil {
+		return err
+	}
+	cmd := []string{"tail", "-n", "+1"}
+	if follow {
+		cmd = append(cmd, "-F")
+	}
+	cmd = append(cmd, jobsDir+"/"+id+"/log")
+
+	opts := withExecDefaults(ExecOptions{User: AgentUID, Stdout: w})
+	result, err := m.client.Exec(name, cmd, opts)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to read job log: %s", strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// KillJob stops a running job. Its log is kept.
+func (m *Manager) KillJob(name, id string) error {
+	job, err := m.findJob(name, id)
+	if err != nil {
+		return err
+	}
+	if job.Status != JobRunning {
+		return fmt.Errorf("job %s is not running", id)
+	}
+	return m.execAgent(name, []string{"tmux", "kill-session", "-t", "=" + jobSessionPrefix + id}, ExecOptions{})
+}
+
+func (m *Manager) findJob(name, id string) (*Job, error) {
+	if err := ValidateJobID(id); err != nil {
+		return nil, err
+	}
+	jobs, err := m.ListJobs(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.ID == id {
+			return &job, nil
+		}
+	}
+	return nil, fmt.Errorf("job %s not found in %s", id, name)
+}
+
+// execAgent runs a command as the agent user and fails on a non-zero exit.
+func (m *Manager) execAgent(name string, command []string, opts ExecOptions) error {
+	if err := m.requireRunning(name); err != nil {
+		return err
+	}
+	opts.User = AgentUID
+	result, err := m.client.Exec(name, command, withExecDefaults(opts))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s exited with %d: %s", command[0], result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+func (m *Manager) requireRunning(name string) error {
+	container, err := m.client.GetContainer(name)
+	if err != nil {
+		return containerNotFound(name)
+	}
+	if ContainerState(container.Status) != StateRunning {
+		return fmt.Errorf("container %s is not running", name)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package sandbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseJobList(t *testing.T) {
+	out := "a1b2c3\t1700000000\t1\t\tclaude --resume\n" +
+		"d4e5f6\t1700000100\t0\t2\tnpm test\n" +
+		"0a0b0c\t1699999000\t0\t\tsleep 1000\n" +
+		"bad id\t1\t0\t0\tignored\n" +
+		"\n"
+
+	jobs := parseJobList(out)
+	if len(jobs) != 3 {
+		t.Fatalf("got %d jobs, want 3: %+v", len(jobs), jobs)
+	}
+
+	// Most recent first
+	want := []struct {
+		id       string
+		status   JobStatus
+		exitCode int
+		command  string
+	}{
+		{"d4e5f6", JobExited, 2, "npm test"},
+		{"a1b2c3", JobRunning, 0, "claude --resume"},
+		{"0a0b0c", JobKilled, 0, "sleep 1000"},
+	}
+	for i, w := range want {
+		got := jobs[i]
+		if got.ID != w.id || got.Status != w.status || got.ExitCode != w.exitCode || got.Command != w.command {
+			t.Errorf("jobs[%d] = %+v, want %+v", i, got, w)
+		}
+	}
+	if !jobs[1].Started.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Started = %v", jobs[1].Started)
+	}
+}
+
+func TestValidateJobID(t *testing.T) {
+	for _, id := range []string{"3f9a2c", "build-1"} {
+		if err := ValidateJobID(id); err != nil {
+			t.Errorf("ValidateJobID(%q) = %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "-x", "a/b", "A1", "a b", "x;rm"} {
+		if err := ValidateJobID(id); err == nil {
+			t.Errorf("ValidateJobID(%q) should fail", id)
+		}
+	}
+}
+
+func TestNewJobID(t *testing.T) {
+	id := newJobID()
+	if err := ValidateJobID(id); err != nil {
+		t.Errorf("newJobID() = %q: %v", id, err)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build unix
+
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobCommand(t *testing.T) {
+	dir := t.TempDir()
+	command := []string{"sh", "-c", `printf '%s\n' "$GREETING" "$@" > out`, "sh", ";", "make;", "it's", "{}"}
+	run := jobCommand("coop-job-abc123", dir, dir, map[string]string{"GREETING": "hi;"}, command)
+
+	// Only coop's own separators may reach tmux as commands
+	var separators int
+	for _, arg := range run {
+		if strings.HasSuffix(arg, ";") {
+			if arg != ";" {
+				t.Errorf("tmux would split %q", arg)
+			}
+			separators++
+		}
+	}
+	if separators != 2 {
+		t.Errorf("got %d separators in %q, want 2", separators, run)
+	}
+
+	// Run the session's shell command, with a tmux that returns at once
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "tmux"), []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("sh", "-c", run[5])
+	cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("job failed: %v: %s", err, output)
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(out), "hi;\n;\nmake;\nit's\n{}\n"; got != want {
+		t.Errorf("job saw %q, want %q", got, want)
+	}
+	if code, _ := os.ReadFile(filepath.Join(dir, "exit")); strings.TrimSpace(string(code)) != "0" {
+		t.Errorf("exit = %q, want 0", code)
+	}
+}
@@ -4,18 +4,21 @@ package sandbox
 import (
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	securejoin "github.com/cyphar/filepath-securejoin"
+	"github.com/lxc/incus/v6/shared/units"
+	"github.com/stuffbucket/coop/internal/audit"
 	"github.com/stuffbucket/coop/internal/cloudinit"
 	"github.com/stuffbucket/coop/internal/config"
 	"github.com/stuffbucket/coop/internal/incus"
 	"github.com/stuffbucket/coop/internal/names"
-	"github.com/stuffbucket/coop/internal/platform"
 	"github.com/stuffbucket/coop/internal/sshkeys"
 	"github.com/stuffbucket/coop/internal/state"
 	"github.com/stuffbucket/coop/internal/ui"
@@ -61,8 +64,9 @@ func containerNotFound(name string) error {
 
 // Manager handles container lifecycle operations.
 type Manager struct {
-	client *incus.Client
-	config *config.Config
+	client     *incus.Client
+	config     *config.Config
+	authorizer Authorizer
 }
 
 // NewManager creates a new sandbox manager.
@@ -105,7 +109,10 @@ type ContainerConfig struct {
 	DiskGB     int
 	Profiles   []string
 	WorkingDir string
-	Verbose    bool // Stream cloud-init logs during setup
+	Force      bool // Authorize a seatbelted WorkingDir (confirmed by the Authorizer)
+	Security   SecurityTier
+	Engine     ContainerEngine // Docker or Podman to install inside, if any
+	Verbose    bool            // Stream cloud-init logs during setup
 }
 
 // DefaultContainerConfig returns sensible defaults from config.
@@ -117,12 +124,33 @@ func DefaultContainerConfig(name string) ContainerConfig {
 		MemoryMB: cfg.Settings.DefaultMemoryMB,
 		DiskGB:   cfg.Settings.DefaultDiskGB,
 		Profiles: []string{"default", AgentProfile},
+		Security: SecurityTier(cfg.Settings.DefaultSecurity),
 	}
 }
 
 // Create creates a new agent container.
-func (m *Manager) Create(cfg ContainerConfig) error {
+func (m *Manager) Create(cfg ContainerConfig) (err error) {
 	containerName := cfg.Name
+	entry := audit.Entry{Op: "create", Container: containerName}
+	defer func() { auditOp(entry, err) }()
+
+	tier, err := ParseSecurityTier(string(cfg.Security))
+	if err != nil {
+		return err
+	}
+	security := tier.Profile()
+	entry.Args = map[string]string{"security": string(tier)}
+
+	engine, err := ParseContainerEngine(string(cfg.Engine))
+	if err != nil {
+		return err
+	}
+	if engine != "" {
+		if security, err = security.allowEngine(); err != nil {
+			return err
+		}
+		entry.Args["engine"] = string(engine)
+	}
 
 	// Check if container already exists
 	existing, err := m.client.GetContainer(containerName)
@@ -130,10 +158,44 @@ func (m *Manager) Create(cfg ContainerConfig) error {
 		return fmt.Errorf("container %s already exists", containerName)
 	}
 
+	if cfg.WorkingDir != "" {
+		workDir, err := filepath.Abs(expandPath(cfg.WorkingDir))
+		if err != nil {
+			return err
+		}
+		auth, err := m.AuthorizeHostPath(HostAccess{
+			Op:        HostOpWorkdir,
+			Path:      workDir,
+			Container: containerName,
+			Force:     cfg.Force,
+		})
+		if err != nil {
+			return err
+		}
+		cfg.WorkingDir = workDir
+		entry.Args["workdir"] = workDir
+		entry.Auth = auth
+	}
+
 	// Generate cloud-init user-data
 	cloudCfg := cloudinit.DefaultConfig()
 	cloudCfg.Hostname = containerName
 	cloudCfg.SSHPubKey = cfg.SSHPubKey
+	cloudCfg.NoSudo = !security.Sudo
+	if engine != "" {
+		// Agent containers use the profile's root disk on the default pool
+		poolDriver, _ := m.client.StoragePoolDriver("default")
+		cloudCfg.Engine = string(engine)
+		cloudCfg.EngineStorageDriver = engine.storageDriver(poolDriver)
+	}
+	if err := configureSSHCA(&cloudCfg, containerName); err != nil {
+		return fmt.Errorf("failed to set up SSH CA: %w", err)
+	}
+	// Agents ask for mounts, ports and secrets with coop-request, where
+	// the backend lets a proxy device reach this machine
+	if _, connErr := m.requestConnect(); connErr == nil {
+		cloudCfg.RequestToken = newRequestToken()
+	}
 
 	userData, err := cloudinit.Generate(cloudCfg)
 	if err != nil {
@@ -155,6 +217,10 @@ func (m *Manager) Create(cfg ContainerConfig) error {
 		"limits.memory":    fmt.Sprintf("%dMiB", cfg.MemoryMB),
 		"limits.processes": DefaultProcessLimit,
 	}
+	if cloudCfg.RequestToken != "" {
+		containerConfig[requestTokenKey] = cloudCfg.RequestToken
+	}
+	maps.Copy(containerConfig, isolationConfig(security, engine))
 
 	// UID mapping: map host UID to agent UID inside the container.
 	// This only works when Incus runs on the same host (colima/lima with shared
@@ -172,11 +238,33 @@ func (m *Manager) Create(cfg ContainerConfig) error {
 	if !strings.Contains(image, "/") && !m.client.ImageExists(image) {
 		image = m.handleMissingImage(image)
 	}
-	fmt.Printf("Creating container %s from %s...\n", containerName, image)
+	fmt.Printf("Creating container %s from %s (%s security)...\n", containerName, image, tier)
 	if err := m.client.CreateContainer(containerName, image, containerConfig, cfg.Profiles); err != nil {
 		return fmt.Errorf("failed to create container: %w", err)
 	}
 
+	// The workspace belongs to this container alone: it was authorized for
+	// it, and a profile device would reach every agent container.
+	if cfg.WorkingDir != "" {
+		if err := m.client.AddDevice(containerName, "workspace", map[string]string{
+			"type":   "disk",
+			"source": cfg.WorkingDir,
+			"path":   "/home/agent/workspace",
+		}); err != nil {
+			return fmt.Errorf("failed to add workspace: %w", err)
+		}
+	}
+	if security.KVM {
+		if err := m.client.AddDevice(containerName, "kvm", kvmDevice()); err != nil {
+			return fmt.Errorf("failed to add /dev/kvm: %w", err)
+		}
+	}
+	if cloudCfg.RequestToken != "" {
+		if err := m.addRequestDevice(containerName); err != nil {
+			fmt.Printf("Warning: coop-request will not reach the host: %v\n", err)
+		}
+	}
+
 	// Start the container
 	fmt.Printf("Starting container %s...\n", containerName)
 	if err := m.client.StartContainer(containerName); err != nil {
@@ -197,6 +285,10 @@ func (m *Manager) Create(cfg ContainerConfig) error {
 		return fmt.Errorf("cloud-init failed: %w", err)
 	}
 
+	if err := m.PinHostKeys(containerName); err != nil {
+		fmt.Printf("Warning: could not pin SSH host keys: %v\n", err)
+	}
+
 	// Get container IP
 	ip, err := m.client.GetContainerIP(containerName)
 	if err != nil {
@@ -309,15 +401,6 @@ func (m *Manager) ensureAgentProfile(cfg ContainerConfig) error {
 		},
 	}
 
-	// Add workspace mount if specified
-	if cfg.WorkingDir != "" {
-		devices["workspace"] = map[string]string{
-			"type":   "disk",
-			"source": cfg.WorkingDir,
-			"path":   "/home/agent/workspace",
-		}
-	}
-
 	return m.client.EnsureProfile(AgentProfile, profileConfig, devices)
 }
 
@@ -475,12 +558,15 @@ func (m *Manager) Stop(name string, force bool) error {
 	if err := m.client.StopContainer(name, force); err != nil {
 		return fmt.Errorf("failed to stop container: %w", err)
 	}
+	m.stopTunnels(name)
 
 	return nil
 }
 
 // Lock freezes a running container, pausing all processes.
-func (m *Manager) Lock(name string) error {
+func (m *Manager) Lock(name string) (err error) {
+	defer func() { auditOp(audit.Entry{Op: "lock", Container: name}, err) }()
+
 	container, err := m.client.GetContainer(name)
 	if err != nil {
 		return containerNotFound(name)
@@ -498,7 +584,9 @@ func (m *Manager) Lock(name string) error {
 }
 
 // Unlock unfreezes a frozen container, resuming all processes.
-func (m *Manager) Unlock(name string) error {
+func (m *Manager) Unlock(name string) (err error) {
+	defer func() { auditOp(audit.Entry{Op: "unlock", Container: name}, err) }()
+
 	container, err := m.client.GetContainer(name)
 	if err != nil {
 		return containerNotFound(name)
@@ -540,7 +628,11 @@ func (m *Manager) Logs(name string, follow bool, lines int) error {
 }
 
 // Delete removes an agent container.
-func (m *Manager) Delete(name string, force bool) error {
+func (m *Manager) Delete(name string, force bool) (err error) {
+	defer func() {
+		auditOp(audit.Entry{Op: "delete", Container: name, Args: map[string]string{"force": strconv.FormatBool(force)}}, err)
+	}()
+
 	containerName := name
 
 	// Check if container exists
@@ -557,6 +649,18 @@ func (m *Manager) Delete(name string, force bool) error {
 		}
 	}
 
+	m.stopTunnels(containerName)
+
+	if err := sshkeys.RemoveSSHConfig(containerName); err != nil {
+		fmt.Printf("Warning: failed to remove SSH config entry: %v\n", err)
+	}
+	if err := sshkeys.UnpinHostKeys(containerName); err != nil {
+		fmt.Printf("Warning: failed to remove pinned host keys: %v\n", err)
+	}
+	if err := sshkeys.RevokeContainerKey(containerName); err != nil {
+		fmt.Printf("Warning: failed to revoke SSH key: %v\n", err)
+	}
+
 	// Delete the container
 	fmt.Printf("Deleting container %s...\n", containerName)
 	if err := m.client.DeleteContainer(containerName); err != nil {
@@ -624,8 +728,14 @@ func (m *Manager) Status(name string) (*ContainerStatus, error) {
 		Name:      name,
 		Status:    container.Status,
 		CreatedAt: container.CreatedAt,
+		Security:  ContainerSecurityTier(container.Config),
+		Engine:    ContainerEngineOf(container.Config),
+		Backend:   m.client.BackendName(),
 		Config:    container.Config,
 	}
+	if size, err := units.ParseByteSizeString(container.ExpandedDevices["root"]["size"]); err == nil {
+		status.RootSize = size
+	}
 
 	if ContainerState(container.Status) == StateRunning {
 		if ip, err := m.client.GetContainerIP(name); err == nil {
@@ -642,6 +752,10 @@ type ContainerStatus struct {
 	Status    string
 	IP        string
 	CreatedAt time.Time
+	Security  SecurityTier    // Empty for containers created before tiers
+	Engine    ContainerEngine // Empty without --with
+	Backend   string          // VM backend, or "" for local Incus
+	RootSize  int64           // Root disk quota in bytes, 0 if none
 	Config    map[string]string
 }
 
@@ -661,7 +775,14 @@ func (m *Manager) SSH(name string) (string, error) {
 		return "", fmt.Errorf("could not get container IP: %w", err)
 	}
 
-	return sshkeys.SSHCommand("agent", ip), nil
+	if err := m.ensureHostKeys(name); err != nil {
+		return "", fmt.Errorf("could not pin host keys: %w", err)
+	}
+	if _, err := sshkeys.IssueCert(name, m.CertTTL(), false); err != nil {
+		return "", fmt.Errorf("could not issue SSH certificate: %w", err)
+	}
+
+	return sshkeys.SSHCommand(name, "agent", ip), nil
 }
 
 // SSHArgs returns the SSH arguments as a slice for exec.
@@ -680,7 +801,14 @@ func (m *Manager) SSHArgs(name string) ([]string, error) {
 		return nil, fmt.Errorf("could not get container IP: %w", err)
 	}
 
-	args := sshkeys.SSHArgs("agent", ip)
+	if err := m.ensureHostKeys(name); err != nil {
+		return nil, fmt.Errorf("could not pin host keys: %w", err)
+	}
+	if _, err := sshkeys.IssueCert(name, SessionCertTTL, true); err != nil {
+		return nil, fmt.Errorf("could not issue SSH certificate: %w", err)
+	}
+
+	args := sshkeys.SSHArgs(name, "agent", ip)
 
 	// Prepend proxy args if the backend requires tunneling to reach container IPs
 	if proxyArgs := m.client.SSHProxyArgs(); len(proxyArgs) > 0 {
@@ -690,58 +818,115 @@ func (m *Manager) SSHArgs(name string) ([]string, error) {
 	return args, nil
 }
 
-// Exec runs a command in the container.
-func (m *Manager) Exec(name string, command []string) (int, error) {
+// Exec runs a command in the container. Running as AgentUID defaults the
+// working directory and HOME/USER to the agent's.
+func (m *Manager) Exec(name string, command []string, opts ExecOptions) (result *ExecResult, err error) {
+	defer func() {
+		args := map[string]string{"command": strings.Join(command, " "), "user": strconv.FormatUint(uint64(opts.User), 10)}
+		if result != nil {
+			args["exit_code"] = strconv.Itoa(result.ExitCode)
+		}
+		auditOp(audit.Entry{Op: "exec", Container: name, Args: args}, err)
+	}()
+
 	container, err := m.client.GetContainer(name)
 	if err != nil {
-		return -1, fmt.Errorf("container %s not found", name)
+		return nil, fmt.Errorf("container %s not found", name)
 	}
 
 	if ContainerState(container.Status) != StateRunning {
-		return -1, fmt.Errorf("container %s is not running", name)
+		return nil, fmt.Errorf("container %s is not running", name)
 	}
 
-	return m.client.ExecCommand(name, command)
+	return m.client.Exec(name, command, withExecDefaults(opts))
 }
 
-// Shell opens an interactive shell in the container.
-// For backends without routable container IPs (e.g. bladerunner), this uses
-// the Incus exec API with a PTY. Returns the exit code.
-// If remoteCmd is non-empty, it is executed instead of an interactive shell.
-func (m *Manager) Shell(name string, remoteCmd []string) (int, error) {
-	container, err := m.client.GetContainer(name)
-	if err != nil {
-		return -1, fmt.Errorf("container %s not found", name)
-	}
+// ShellOptions configures an exec shell.
+type ShellOptions struct {
+	// ForwardAgent relays the host's SSH agent into the session.
+	ForwardAgent bool
+	// Recorder, if non-nil, receives a copy of the session's output.
+	Recorder io.Writer
+}
 
-	if ContainerState(container.Status) != StateRunning {
-		return -1, fmt.Errorf("container %s is not running", name)
+// Shell opens an interactive shell in the container through the Incus exec
+// API with a PTY, for when SSH cannot reach the container. The host's
+// locale and terminal settings are passed through as ssh would.
+// Returns the exit code. If remoteCmd is non-empty, it is executed instead
+// of an interactive login shell.
+func (m *Manager) Shell(name string, remoteCmd []string, opts ShellOptions) (code int, err error) {
+	defer func() {
+		auditOp(audit.Entry{Op: "shell", Container: name, Args: shellAuditArgs(remoteCmd, TransportExec, opts.ForwardAgent)}, err)
+	}()
+
+	if err := m.requireRunning(name); err != nil {
+		return -1, err
 	}
 
 	command := remoteCmd
 	if len(command) == 0 {
-		command = []string{"sudo", "-iu", "agent"}
+		command = []string{"bash", "--login"}
 	}
 
-	return m.client.ExecInteractive(name, command)
-}
+	env := forwardedEnv(os.Environ())
+	env["SHELL"] = "/bin/bash"
+	env["LOGNAME"] = "agent"
+	if opts.ForwardAgent {
+		sock, stop, err := m.forwardAgent(name)
+		if err != nil {
+			return -1, err
+		}
+		defer stop()
+		env["SSH_AUTH_SOCK"] = sock
+	}
 
-// UseIncusExec returns true if the backend requires using Incus exec
-// instead of SSH for shell access (e.g. because container IPs are not
-// routable from the host).
-func (m *Manager) UseIncusExec() bool {
-	return m.client.BackendName() == "bladerunner"
+	return m.client.ExecInteractiveWith(name, command, incus.InteractiveOptions{Env: env, Output: opts.Recorder})
 }
 
-// EnsureSSHKeys ensures coop SSH keys exist and returns the public key.
+// EnsureSSHCA ensures coop's SSH user CA exists and returns its public key.
 // Keys are stored in ~/.config/coop/ssh/, isolated from ~/.ssh/
-func EnsureSSHKeys() (string, error) {
-	return sshkeys.EnsureKeys()
+func EnsureSSHCA() (string, error) {
+	return sshkeys.EnsureCA()
+}
+
+// UpdateSSHConfig adds/updates the SSH config entry for a container,
+// including the backend's jump host when container IPs are not routable.
+func (m *Manager) UpdateSSHConfig(name, ip string) error {
+	if err := m.ensureHostKeys(name); err != nil {
+		return fmt.Errorf("could not pin host keys: %w", err)
+	}
+	if _, err := sshkeys.IssueCert(name, m.CertTTL(), false); err != nil {
+		return fmt.Errorf("could not issue SSH certificate: %w", err)
+	}
+	return sshkeys.WriteSSHConfig(name, ip, m.client.SSHProxyArgs())
 }
 
-// UpdateSSHConfig adds/updates the SSH config entry for a container.
-func UpdateSSHConfig(name, ip string) error {
-	return sshkeys.WriteSSHConfig(name, ip)
+// SyncSSHConfig rebuilds the SSH config from the containers Incus reports,
+// with one entry per running container that has an IP. Entries for deleted
+// containers are dropped and proxy lines follow the current backend.
+// Returns the hosts written.
+func (m *Manager) SyncSSHConfig() ([]sshkeys.Host, error) {
+	containers, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	var hosts []sshkeys.Host
+	for _, c := range containers {
+		if c.IP == "" {
+			continue
+		}
+		if err := m.ensureHostKeys(c.Name); err != nil {
+			fmt.Printf("Warning: could not pin host keys for %s: %v\n", c.Name, err)
+		}
+		if _, err := sshkeys.IssueCert(c.Name, m.CertTTL(), false); err != nil {
+			fmt.Printf("Warning: could not issue SSH certificate for %s: %v\n", c.Name, err)
+		}
+		hosts = append(hosts, sshkeys.Host{Name: c.Name, IP: c.IP})
+	}
+	if err := sshkeys.RewriteSSHConfig(hosts, m.client.SSHProxyArgs()); err != nil {
+		return nil, err
+	}
+	return hosts, nil
 }
 
 // GetContainerIP returns the IP address of a running container.
@@ -763,58 +948,159 @@ func (m *Manager) GetStorageInfo() (avail, total uint64, err error) {
 	return info.Available, info.Total, nil
 }
 
+// SnapshotMode selects how a running container is captured by a snapshot.
+type SnapshotMode string
+
+const (
+	// SnapshotStopped stops the container, snapshots its filesystem and restarts it.
+	// This is the most consistent mode but kills in-flight processes.
+	SnapshotStopped SnapshotMode = "stopped"
+	// SnapshotStateful checkpoints memory and processes (CRIU) without stopping,
+	// so the container can later be resumed exactly where it was.
+	SnapshotStateful SnapshotMode = "stateful"
+	// SnapshotLive takes a crash-consistent filesystem snapshot without stopping.
+	SnapshotLive SnapshotMode = "live"
+)
+
+// ErrStatefulUnsupported is returned when the server cannot checkpoint a
+// running container (e.g. CRIU is not installed in the Incus host).
+var ErrStatefulUnsupported = errors.New("stateful snapshots not supported")
+
+// statefulUnsupportedHints appear in Incus errors when the host cannot
+// checkpoint: CRIU is missing or migration.stateful is off.
+var statefulUnsupportedHints = []string{"criu", "migration.stateful", "not supported", "unsupported"}
+
+// statefulUnsupported reports whether a stateful snapshot failed because
+// the host cannot checkpoint, rather than for a reason a live snapshot
+// would hit too.
+func statefulUnsupported(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, hint := range statefulUnsupportedHints {
+		if strings.Contains(msg, hint) {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateSnapshot creates a snapshot of a container.
+// A running container is stopped for a consistent snapshot and restarted.
 func (m *Manager) CreateSnapshot(name, snapshotName string) error {
+	return m.CreateSnapshotWithMode(name, snapshotName, SnapshotStopped)
+}
+
+// CreateSnapshotWithMode creates a snapshot using the given capture mode.
+// Stopped containers always get a plain filesystem snapshot.
+// Returns an error wrapping ErrStatefulUnsupported if a stateful snapshot
+// cannot be taken; callers may retry with SnapshotLive.
+func (m *Manager) CreateSnapshotWithMode(name, snapshotName string, mode SnapshotMode) error {
 	container, err := m.client.GetContainer(name)
 	if err != nil {
 		return containerNotFound(name)
 	}
 
+	if _, err := m.client.GetSnapshot(name, snapshotName); err == nil {
+		return fmt.Errorf("snapshot %s already exists", snapshotName)
+	}
+
 	wasRunning := ContainerState(container.Status) == StateRunning
-	if wasRunning {
-		// Stop for consistent snapshot
-		if err := m.client.StopContainer(name, false); err != nil {
-			return fmt.Errorf("failed to stop container for snapshot: %w", err)
+	if !wasRunning {
+		return m.client.CreateSnapshot(name, snapshotName, false)
+	}
+
+	switch mode {
+	case SnapshotStateful:
+		err := m.client.CreateSnapshot(name, snapshotName, true)
+		if err != nil && statefulUnsupported(err) {
+			return fmt.Errorf("%w: %v", ErrStatefulUnsupported, err)
 		}
+		return err
+	case SnapshotLive:
+		return m.createLiveSnapshot(name, snapshotName, container.ExpandedDevices["root"]["pool"])
+	case SnapshotStopped, "":
+		// handled below
+	default:
+		return fmt.Errorf("unknown snapshot mode: %s", mode)
+	}
+
+	// Stop for consistent snapshot
+	if err := m.client.StopContainer(name, false); err != nil {
+		return fmt.Errorf("failed to stop container for snapshot: %w", err)
 	}
 
 	if err := m.client.CreateSnapshot(name, snapshotName, false); err != nil {
-		// Try to restart if we stopped it
-		if wasRunning {
-			_ = m.client.StartContainer(name)
-		}
+		// Try to restart since we stopped it
+		_ = m.client.StartContainer(name)
 		return err
 	}
 
-	if wasRunning {
-		if err := m.client.StartContainer(name); err != nil {
-			return fmt.Errorf("snapshot created but failed to restart container: %w", err)
-		}
-		// Best effort wait for container to be fully running again
-		_ = m.client.WaitForCondition(name, incus.WaitStatusRunning, WaitRunningTimeout, time.Second)
+	if err := m.client.StartContainer(name); err != nil {
+		return fmt.Errorf("snapshot created but failed to restart container: %w", err)
 	}
+	// Best effort wait for container to be fully running again
+	_ = m.client.WaitForCondition(name, incus.WaitStatusRunning, WaitRunningTimeout, time.Second)
 
 	return nil
 }
 
+// createLiveSnapshot snapshots a running container's filesystem without stopping it.
+// Copy-on-write pools (btrfs, zfs, lvm) snapshot atomically. The dir driver copies
+// files one by one, so the container is frozen for the duration of the copy.
+func (m *Manager) createLiveSnapshot(name, snapshotName, pool string) error {
+	if pool == "" {
+		pool = "default"
+	}
+	driver, err := m.client.StoragePoolDriver(pool)
+	if err != nil || driver != "dir" {
+		return m.client.CreateSnapshot(name, snapshotName, false)
+	}
+
+	if err := m.client.FreezeContainer(name); err != nil {
+		return fmt.Errorf("failed to freeze container for snapshot: %w", err)
+	}
+	snapErr := m.client.CreateSnapshot(name, snapshotName, false)
+	if err := m.client.UnfreezeContainer(name); err != nil {
+		return fmt.Errorf("snapshot taken but failed to unfreeze container: %w", err)
+	}
+	return snapErr
+}
+
 // RestoreSnapshot restores a container to a snapshot.
+// Stateful snapshots resume the container with its saved processes and memory.
 func (m *Manager) RestoreSnapshot(name, snapshotName string) error {
 	container, err := m.client.GetContainer(name)
 	if err != nil {
 		return containerNotFound(name)
 	}
 
+	snapshot, err := m.client.GetSnapshot(name, snapshotName)
+	if err != nil {
+		return err
+	}
+
 	wasRunning := ContainerState(container.Status) == StateRunning
 	if wasRunning {
-		if err := m.client.StopContainer(name, false); err != nil {
+		// Runtime state is replaced by the checkpoint, so no need for a clean shutdown
+		if err := m.client.StopContainer(name, snapshot.Stateful); err != nil {
 			return fmt.Errorf("failed to stop container for restore: %w", err)
 		}
 	}
 
-	if err := m.client.RestoreSnapshot(name, snapshotName); err != nil {
+	if err := m.client.RestoreSnapshot(name, snapshotName, snapshot.Stateful); err != nil {
 		return err
 	}
 
+	// The snapshot may predate a host key change; pin the keys it has
+	if err := m.PinHostKeys(name); err != nil {
+		fmt.Printf("Warning: could not pin SSH host keys: %v\n", err)
+	}
+
+	if snapshot.Stateful {
+		// Incus resumes the checkpointed processes as part of the restore
+		_ = m.client.WaitForCondition(name, incus.WaitStatusRunning, WaitRunningTimeout, time.Second)
+		return nil
+	}
+
 	if wasRunning {
 		if err := m.client.StartContainer(name); err != nil {
 			return fmt.Errorf("restored but failed to restart container: %w", err)
@@ -830,6 +1116,7 @@ func (m *Manager) RestoreSnapshot(name, snapshotName string) error {
 type SnapshotInfo struct {
 	Name      string
 	CreatedAt time.Time
+	Stateful  bool // Includes a runtime checkpoint (memory and processes)
 }
 
 // ListSnapshots returns all snapshots for a container.
@@ -848,6 +1135,7 @@ func (m *Manager) ListSnapshots(name string) ([]SnapshotInfo, error) {
 		infos = append(infos, SnapshotInfo{
 			Name:      s.Name,
 			CreatedAt: s.CreatedAt,
+			Stateful:  s.Stateful,
 		})
 	}
 	return infos, nil
@@ -897,226 +1185,28 @@ type MountInfo struct {
 	Readonly bool
 }
 
-// sipProtectedPaths are macOS directories protected by System Integrity Protection.
-// From Apple: https://support.apple.com/en-us/102149
-var sipProtectedPaths = []string{
-	"/System",
-	"/usr",
-	"/bin",
-	"/sbin",
-	"/var",
-	"/private/var",
-}
-
-// commonSensitiveDirs are credential directories shared across all platforms.
-var commonSensitiveDirs = []string{
-	".ssh",             // SSH keys
-	".gnupg",           // GPG keys
-	".aws",             // AWS credentials
-	".azure",           // Azure credentials
-	".config/gcloud",   // GCP credentials
-	".kube",            // Kubernetes config
-	".docker",          // Docker config and creds
-	".npmrc",           // npm tokens (file)
-	".netrc",           // Generic credential file
-	".gitconfig",       // May contain credentials
-	".git-credentials", // Git credential storage
-	".config/gh",       // GitHub CLI tokens
-	".anthropic",       // Anthropic API keys
-	".openai",          // OpenAI API keys
-	".config",          // Parent of coop config
-	".config/coop",     // Coop trust root (hard block)
-	"Desktop",          // Personal files
-	"Documents",        // Personal documents
-	"Downloads",        // Downloaded files, potential malware vector
-}
-
-// macOSSensitiveDirs are macOS-specific credential directories.
-var macOSSensitiveDirs = []string{
-	"Library",                                // Keychains, app data, cookies
-	"Library/Keychains",                      // macOS keychain files
-	"Library/Cookies",                        // Browser cookies
-	"Library/Application Support/MobileSync", // iOS backups
-}
-
-// linuxSensitiveDirs are Linux-specific credential directories.
-var linuxSensitiveDirs = []string{
-	".local/share/keyrings", // GNOME Keyring storage
-	".pki",                  // NSS certificate database
-	".password-store",       // pass password manager
-	".local/share/kwalletd", // KDE Wallet
-}
-
-// getSensitiveHomeDirs returns the sensitive directories for the current platform.
-func getSensitiveHomeDirs() []string {
-	dirs := make([]string, 0, len(commonSensitiveDirs)+10)
-	dirs = append(dirs, commonSensitiveDirs...)
-
-	switch platform.Detect() {
-	case platform.MacOS:
-		dirs = append(dirs, macOSSensitiveDirs...)
-	case platform.Linux:
-		dirs = append(dirs, linuxSensitiveDirs...)
-	case platform.WSL2:
-		dirs = append(dirs, linuxSensitiveDirs...)
-		// WSL2 absolute paths are handled separately in IsSeatbelted
-	}
-	return dirs
-}
-
-// getWSL2SensitivePaths returns Windows-side sensitive paths accessible from WSL2.
-func getWSL2SensitivePaths() []string {
-	winUser := detectWindowsUsername()
-	if winUser == "" {
-		return nil
-	}
-
-	winHome := "/mnt/c/Users/" + winUser
-	return []string{
-		winHome + "/.ssh",
-		winHome + "/.aws",
-		winHome + "/.azure",
-		winHome + "/.kube",
-		winHome + "/.docker",
-		winHome + "/AppData/Roaming",         // Windows credential managers
-		winHome + "/AppData/Local/Microsoft", // Windows auth data
-	}
-}
-
-// detectWindowsUsername attempts to find the Windows username from WSL2.
-func detectWindowsUsername() string {
-	// Try WSLENV-provided path
-	if userprofile := os.Getenv("USERPROFILE"); userprofile != "" {
-		// USERPROFILE might be like C:\Users\brian
-		parts := strings.Split(userprofile, "\\")
-		if len(parts) >= 3 {
-			return parts[len(parts)-1]
-		}
-	}
-
-	// Try wslpath if available
-	if output, err := exec.Command("wslvar", "USERNAME").Output(); err == nil {
-		return strings.TrimSpace(string(output))
-	}
-
-	// Fallback: check /mnt/c/Users for non-system directories
-	entries, err := os.ReadDir("/mnt/c/Users")
-	if err != nil {
-		return ""
-	}
-	for _, e := range entries {
-		name := e.Name()
-		// Skip system accounts
-		if name == "Public" || name == "Default" || name == "Default User" || name == "All Users" {
-			continue
-		}
-		if e.IsDir() {
-			return name
-		}
-	}
-	return ""
-}
-
-// expandPath expands ~ to the current user's home directory.
-// Note: ~user paths (other than ~/) are NOT expanded for security reasons.
-func expandPath(path string) string {
-	if path == "" {
-		return path
-	}
-
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return path
-	}
-
-	if path == "~" {
-		return home
-	}
-
-	if strings.HasPrefix(path, "~/") {
-		return filepath.Join(home, path[2:])
-	}
-
-	// Do NOT expand ~user paths - this could bypass seatbelt protection
-	// by expanding ~root/.ssh to something other than $HOME/.ssh
-	return path
-}
-
-// IsSeatbelted returns true if a path is in a protected directory.
-func IsSeatbelted(path string) (bool, string) {
-	// Expand ~ and resolve to absolute path
-	expanded := expandPath(path)
-
-	// Resolve any symlinks and clean the path
-	if resolved, err := filepath.EvalSymlinks(expanded); err == nil {
-		expanded = resolved
-	}
-	expanded = filepath.Clean(expanded)
-
-	// Check SIP-protected system directories (macOS only)
-	if platform.Detect() == platform.MacOS {
-		for _, prefix := range sipProtectedPaths {
-			if expanded == prefix || strings.HasPrefix(expanded, prefix+"/") {
-				return true, fmt.Sprintf("%s is protected by System Integrity Protection", prefix)
-			}
-		}
-	}
-
-	// Check user home directory sensitive paths
-	home, _ := os.UserHomeDir()
-	if home != "" {
-		for _, dir := range getSensitiveHomeDirs() {
-			protected := filepath.Join(home, dir)
-			if pathContains(protected, expanded) || pathContains(expanded, protected) {
-				// Hard block for coop trust root
-				if strings.HasSuffix(protected, ".config/coop") {
-					return true, fmt.Sprintf("~/%s is a protected Coop path and cannot be mounted", dir)
-				}
-				return true, fmt.Sprintf("~/%s contains sensitive data (credentials, keys, tokens)", dir)
-			}
-		}
-	}
-
-	// Check WSL2-specific Windows paths
-	if platform.Detect() == platform.WSL2 {
-		for _, wslPath := range getWSL2SensitivePaths() {
-			if pathContains(wslPath, expanded) || pathContains(expanded, wslPath) {
-				return true, fmt.Sprintf("%s contains Windows credentials", wslPath)
-			}
-		}
-	}
-
-	return false, ""
-}
-
-// pathContains returns true if child is inside parent (after secure path resolution).
-func pathContains(parent, child string) bool {
-	parent = filepath.Clean(parent)
-	child = filepath.Clean(child)
-
-	rel, err := filepath.Rel(parent, child)
-	if err != nil {
-		return false
-	}
-	// SecureJoin prevents traversal via symlinks inside child
-	secured, err := securejoin.SecureJoin(parent, rel)
-	if err != nil {
-		return false
-	}
-	return secured == child
-}
-
 // Mount adds a host directory mount to a running container.
-// Set force=true to mount seatbelted directories (requires explicit acknowledgment).
-func (m *Manager) Mount(containerName, mountName, source, path string, readonly, force bool) error {
+// Set force=true to mount seatbelted directories (confirmed by the Authorizer).
+func (m *Manager) Mount(containerName, mountName, source, path string, readonly, force bool) (err error) {
+	entry := audit.Entry{Op: "mount", Container: containerName, Args: map[string]string{
+		"name": mountName, "source": source, "path": path, "readonly": strconv.FormatBool(readonly),
+	}}
+	defer func() { auditOp(entry, err) }()
+
 	if _, err := m.client.GetContainer(containerName); err != nil {
 		return containerNotFound(containerName)
 	}
 
-	// Check for seatbelted directories
-	if seatbelted, reason := IsSeatbelted(source); seatbelted && !force {
-		return fmt.Errorf("refusing to mount protected path: %s. Use --force to override", reason)
+	auth, err := m.AuthorizeHostPath(HostAccess{
+		Op:        HostOpMount,
+		Path:      source,
+		Container: containerName,
+		Force:     force,
+	})
+	if err != nil {
+		return err
 	}
+	entry.Auth = auth
 
 	device := map[string]string{
 		"type":   "disk",
@@ -1132,7 +1222,11 @@ func (m *Manager) Mount(containerName, mountName, source, path string, readonly,
 }
 
 // Unmount removes a mount from a container.
-func (m *Manager) Unmount(containerName, mountName string) error {
+func (m *Manager) Unmount(containerName, mountName string) (err error) {
+	defer func() {
+		auditOp(audit.Entry{Op: "unmount", Container: containerName, Args: map[string]string{"name": mountName}}, err)
+	}()
+
 	if _, err := m.client.GetContainer(containerName); err != nil {
 		return containerNotFound(containerName)
 	}
@@ -1,6 +1,7 @@
 package sandbox
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stuffbucket/coop/internal/config"
@@ -131,3 +132,23 @@ func TestGenerateName(t *testing.T) {
 		t.Errorf("GenerateName returned duplicate names: %q", name1)
 	}
 }
+
+func TestStatefulUnsupported(t *testing.T) {
+	tests := []struct {
+		err  string
+		want bool
+	}{
+		{"Unable to create stateful snapshot: CRIU isn't installed", true},
+		{"Stateful snapshot requires migration.stateful to be set to true", true},
+		{"Checkpointing is not supported on this host", true},
+		{"Snapshot \"s1\" already exists", false},
+		{"write /var/lib/incus/storage-pools/default: no space left on device", false},
+		{"Get \"http://unix.socket/1.0\": dial unix: connection refused", false},
+	}
+
+	for _, tt := range tests {
+		if got := statefulUnsupported(errors.New(tt.err)); got != tt.want {
+			t.Errorf("statefulUnsupported(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
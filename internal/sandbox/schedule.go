@@ -0,0 +1,151 @@
+// Package sandbox provides automatic snapshot scheduling backed by Incus.
+package sandbox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AutoSnapshotPrefix is the name prefix of scheduled snapshots.
+	AutoSnapshotPrefix = "auto-"
+	// AutoSnapshotNote is the state-tracking note recorded for scheduled snapshots.
+	AutoSnapshotNote = "auto"
+
+	// autoSnapshotPattern names scheduled snapshots auto-YYYYMMDD-HHMM.
+	// Incus renders it with pongo2, whose date filter takes a Go layout.
+	autoSnapshotPattern = "auto-{{ creation_date|date:'20060102-1504' }}"
+
+	// Instance config keys remembering what the user asked for, so the
+	// schedule can be shown in the same terms it was set.
+	scheduleEveryKey = "user.coop.snapshot.every"
+	scheduleKeepKey  = "user.coop.snapshot.keep"
+)
+
+// SnapshotSchedule describes automatic snapshots for a container.
+type SnapshotSchedule struct {
+	Every  time.Duration // Interval between snapshots
+	Keep   int           // Number of snapshots retained
+	Cron   string        // Incus snapshots.schedule expression
+	Expiry string        // Incus snapshots.expiry expression
+}
+
+// NewSnapshotSchedule builds a schedule taking a snapshot every interval and
+// keeping the most recent keep snapshots. Incus schedules are cron-based, so
+// the interval must evenly divide an hour or a day.
+//
+// Retention is by age, not count: Incus expires each snapshot every x keep
+// after it was taken. While the container is stopped no new snapshots are
+// taken but old ones still expire, so fewer than keep may remain.
+func NewSnapshotSchedule(every time.Duration, keep int) (*SnapshotSchedule, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("keep must be at least 1")
+	}
+	cron, err := cronForInterval(every)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotSchedule{
+		Every:  every,
+		Keep:   keep,
+		Cron:   cron,
+		Expiry: expiryFor(every * time.Duration(keep)),
+	}, nil
+}
+
+// cronForInterval converts a fixed interval into a cron expression.
+func cronForInterval(every time.Duration) (string, error) {
+	if every < time.Minute || every%time.Minute != 0 {
+		return "", fmt.Errorf("interval must be a whole number of minutes (got %s)", every)
+	}
+
+	minutes := int(every / time.Minute)
+	switch {
+	case minutes < 60 && 60%minutes == 0:
+		return fmt.Sprintf("*/%d * * * *", minutes), nil
+	case minutes == 60:
+		return "0 * * * *", nil
+	case minutes%60 == 0 && minutes < 24*60 && (24*60)%minutes == 0:
+		return fmt.Sprintf("0 */%d * * *", minutes/60), nil
+	case minutes == 24*60:
+		return "0 0 * * *", nil
+	}
+	return "", fmt.Errorf("interval %s must evenly divide an hour or a day", every)
+}
+
+// expiryFor formats a retention period as an Incus expiry expression.
+func expiryFor(d time.Duration) string {
+	minutes := int(d / time.Minute)
+	if minutes%60 == 0 {
+		return fmt.Sprintf("%dH", minutes/60)
+	}
+	return fmt.Sprintf("%dM", minutes)
+}
+
+// SetSnapshotSchedule enables automatic snapshots on a container.
+// Incus takes the snapshots (without stopping the container) and expires
+// them, so the schedule keeps running when coop is not. Manual snapshots are
+// created with an explicit expiry, so snapshots.expiry only applies to these.
+func (m *Manager) SetSnapshotSchedule(name string, schedule *SnapshotSchedule) error {
+	if _, err := m.client.GetContainer(name); err != nil {
+		return containerNotFound(name)
+	}
+
+	return m.client.UpdateConfig(name, map[string]string{
+		"snapshots.schedule": schedule.Cron,
+		"snapshots.expiry":   schedule.Expiry,
+		"snapshots.pattern":  autoSnapshotPattern,
+		scheduleEveryKey:     schedule.Every.String(),
+		scheduleKeepKey:      strconv.Itoa(schedule.Keep),
+	})
+}
+
+// ClearSnapshotSchedule disables automatic snapshots on a container.
+// Existing automatic snapshots are kept.
+func (m *Manager) ClearSnapshotSchedule(name string) error {
+	if _, err := m.client.GetContainer(name); err != nil {
+		return containerNotFound(name)
+	}
+
+	return m.client.UpdateConfig(name, map[string]string{
+		"snapshots.schedule": "",
+		"snapshots.expiry":   "",
+		"snapshots.pattern":  "",
+		scheduleEveryKey:     "",
+		scheduleKeepKey:      "",
+	})
+}
+
+// GetSnapshotSchedule returns the automatic snapshot schedule for a container,
+// or nil if none is configured.
+func (m *Manager) GetSnapshotSchedule(name string) (*SnapshotSchedule, error) {
+	container, err := m.client.GetContainer(name)
+	if err != nil {
+		return nil, containerNotFound(name)
+	}
+
+	cron := container.Config["snapshots.schedule"]
+	if cron == "" {
+		return nil, nil
+	}
+
+	schedule := &SnapshotSchedule{
+		Cron:   cron,
+		Expiry: container.Config["snapshots.expiry"],
+	}
+	// Schedules set outside coop have no interval/keep; show the raw values.
+	if every, err := time.ParseDuration(container.Config[scheduleEveryKey]); err == nil {
+		schedule.Every = every
+	}
+	if keep, err := strconv.Atoi(container.Config[scheduleKeepKey]); err == nil {
+		schedule.Keep = keep
+	}
+	return schedule, nil
+}
+
+// IsAutoSnapshot reports whether a snapshot was taken by a schedule.
+func IsAutoSnapshot(snapshotName string) bool {
+	return strings.HasPrefix(snapshotName, AutoSnapshotPrefix)
+}
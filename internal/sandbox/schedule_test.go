@@ -0,0 +1,65 @@
+package sandbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewSnapshotSchedule(t *testing.T) {
+	tests := []struct {
+		every      time.Duration
+		keep       int
+		wantCron   string
+		wantExpiry string
+	}{
+		{30 * time.Minute, 12, "*/30 * * * *", "6H"},
+		{5 * time.Minute, 3, "*/5 * * * *", "15M"},
+		{time.Hour, 24, "0 * * * *", "24H"},
+		{6 * time.Hour, 4, "0 */6 * * *", "24H"},
+		{24 * time.Hour, 7, "0 0 * * *", "168H"},
+	}
+
+	for _, tt := range tests {
+		s, err := NewSnapshotSchedule(tt.every, tt.keep)
+		if err != nil {
+			t.Errorf("NewSnapshotSchedule(%s, %d) error: %v", tt.every, tt.keep, err)
+			continue
+		}
+		if s.Cron != tt.wantCron {
+			t.Errorf("NewSnapshotSchedule(%s, %d).Cron = %q, want %q", tt.every, tt.keep, s.Cron, tt.wantCron)
+		}
+		if s.Expiry != tt.wantExpiry {
+			t.Errorf("NewSnapshotSchedule(%s, %d).Expiry = %q, want %q", tt.every, tt.keep, s.Expiry, tt.wantExpiry)
+		}
+	}
+}
+
+func TestNewSnapshotScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		every time.Duration
+		keep  int
+	}{
+		{30 * time.Minute, 0}, // nothing kept
+		{30 * time.Second, 5}, // below cron granularity
+		{90 * time.Second, 5}, // not whole minutes
+		{7 * time.Minute, 5},  // does not divide an hour
+		{5 * time.Hour, 5},    // does not divide a day
+		{48 * time.Hour, 5},   // longer than a day
+		{90 * time.Minute, 5}, // neither
+	}
+
+	for _, tt := range tests {
+		if _, err := NewSnapshotSchedule(tt.every, tt.keep); err == nil {
+			t.Errorf("NewSnapshotSchedule(%s, %d) should fail", tt.every, tt.keep)
+		}
+	}
+}
+
+func TestIsAutoSnapshot(t *testing.T) {
+	if !IsAutoSnapshot("auto-20260101-1230") {
+		t.Error("IsAutoSnapshot(auto-20260101-1230) = false, want true")
+	}
+	if IsAutoSnapshot("before-upgrade") {
+		t.Error("IsAutoSnapshot(before-upgrade) = true, want false")
+	}
+}
@@ -0,0 +1,481 @@
+// Package sandbox provides the seatbelt policy guarding host paths.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/stuffbucket/coop/internal/config"
+	"github.com/stuffbucket/coop/internal/platform"
+)
+
+// SeatbeltAction is what a seatbelt rule does to the paths it matches.
+type SeatbeltAction string
+
+const (
+	// SeatbeltDeny refuses a path unless authorized with --force.
+	SeatbeltDeny SeatbeltAction = "deny"
+	// SeatbeltAllow makes an exception to deny rules that are no more specific.
+	SeatbeltAllow SeatbeltAction = "allow"
+	// SeatbeltBlock refuses a path even with --force; allow rules cannot override it.
+	SeatbeltBlock SeatbeltAction = "block"
+)
+
+// SeatbeltRule matches a host path glob. Patterns are absolute or start
+// with ~/ or **/; * and ? match within one path element and ** matches any
+// number of elements. A rule matches the paths its pattern names, everything
+// below them, and (for deny and block) the directories above them up to the
+// first **, since sharing a parent exposes them too.
+type SeatbeltRule struct {
+	Path   string         `json:"path"`
+	Action SeatbeltAction `json:"action"`
+	Reason string         `json:"reason,omitempty"`
+	// Containers limits an allow rule to these containers.
+	Containers []string `json:"containers,omitempty"`
+
+	// Source is "default" for built-in rules or the policy file path.
+	Source string `json:"-"`
+}
+
+// SeatbeltPolicy is the user's seatbelt policy file. Its rules are
+// evaluated together with the built-in ones.
+type SeatbeltPolicy struct {
+	Rules []SeatbeltRule `json:"rules"`
+}
+
+// SeatbeltVerdict is the outcome of a seatbelt check.
+type SeatbeltVerdict string
+
+const (
+	SeatbeltAllowed SeatbeltVerdict = "allowed"
+	SeatbeltDenied  SeatbeltVerdict = "denied"
+	SeatbeltBlocked SeatbeltVerdict = "blocked"
+)
+
+// SeatbeltDecision explains a seatbelt check.
+type SeatbeltDecision struct {
+	Path    string // Resolved path that was checked
+	Verdict SeatbeltVerdict
+	Reason  string
+	// Rule decided the verdict; nil when no rule matched.
+	Rule *SeatbeltRule
+	// Overridden is the deny rule an allow Rule made an exception to.
+	Overridden *SeatbeltRule
+	// PolicyError is set when the policy file could not be used; only
+	// built-in rules were applied and the path is denied at least.
+	PolicyError error
+}
+
+// Protected reports whether the path needs authorization or is blocked.
+func (d SeatbeltDecision) Protected() bool {
+	return d.Verdict != SeatbeltAllowed
+}
+
+// SeatbeltPolicyPath is the user's seatbelt policy file. It lives in the
+// config directory, which is itself blocked, so agents cannot change it.
+func SeatbeltPolicyPath() string {
+	return filepath.Join(config.GetDirectories().Config, "seatbelt.json")
+}
+
+// LoadSeatbeltPolicy reads a policy file. A missing file is an empty policy.
+func LoadSeatbeltPolicy(path string) (*SeatbeltPolicy, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &SeatbeltPolicy{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var policy SeatbeltPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid seatbelt policy %s: %w", path, err)
+	}
+	for i := range policy.Rules {
+		r := &policy.Rules[i]
+		r.Source = path
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("invalid seatbelt policy %s: rule %d: %w", path, i+1, err)
+		}
+	}
+	return &policy, nil
+}
+
+func (r *SeatbeltRule) validate() error {
+	switch r.Action {
+	case SeatbeltDeny, SeatbeltAllow, SeatbeltBlock:
+	default:
+		return fmt.Errorf("unknown action %q (use deny, allow or block)", r.Action)
+	}
+	if !strings.HasPrefix(r.Path, "/") && !strings.HasPrefix(r.Path, "~/") && !strings.HasPrefix(r.Path, "**/") {
+		return fmt.Errorf("path %q must be absolute or start with ~/", r.Path)
+	}
+	for _, elem := range strings.Split(r.Path, "/") {
+		if _, err := filepath.Match(elem, ""); err != nil {
+			return fmt.Errorf("path %q: %w", r.Path, err)
+		}
+	}
+	if len(r.Containers) > 0 && r.Action != SeatbeltAllow {
+		return fmt.Errorf("containers can only limit allow rules")
+	}
+	return nil
+}
+
+// SeatbeltRules returns the rules in effect: the built-in rules followed
+// by the policy file's. The error reports a policy file that could not be
+// used; the built-in rules are still returned.
+func SeatbeltRules() ([]SeatbeltRule, error) {
+	rules := defaultSeatbeltRules()
+	policy, err := LoadSeatbeltPolicy(SeatbeltPolicyPath())
+	if err != nil {
+		return rules, err
+	}
+	return append(rules, policy.Rules...), nil
+}
+
+// CheckSeatbelt decides whether a host path may be shared with a
+// container. container may be empty when none is involved, in which case
+// only allow rules without a container list apply.
+func CheckSeatbelt(path, container string) SeatbeltDecision {
+	rules, policyErr := SeatbeltRules()
+	d := evaluateSeatbelt(rules, resolveSeatbeltPath(path), container, seatbeltHome())
+	if policyErr != nil {
+		d.PolicyError = policyErr
+		if d.Verdict == SeatbeltAllowed {
+			d.Verdict = SeatbeltDenied
+			d.Reason = fmt.Sprintf("seatbelt policy could not be loaded (%v)", policyErr)
+			d.Rule = nil
+		}
+	}
+	return d
+}
+
+// IsSeatbelted returns true if a path is in a protected directory.
+func IsSeatbelted(path string) (bool, string) {
+	d := CheckSeatbelt(path, "")
+	return d.Protected(), d.Reason
+}
+
+// evaluateSeatbelt applies rules to a resolved path. Block rules win;
+// otherwise a deny rule applies unless an allow rule matching the path
+// itself is at least as specific.
+func evaluateSeatbelt(rules []SeatbeltRule, path, container, home string) SeatbeltDecision {
+	d := SeatbeltDecision{Path: path, Verdict: SeatbeltAllowed}
+	target := splitSeatbeltPath(path)
+
+	var deny, allow *SeatbeltRule
+	var denySpec, allowSpec int
+	for i := range rules {
+		r := &rules[i]
+		pattern := splitSeatbeltPath(expandSeatbeltPattern(r.Path, home))
+		within, parent := matchSeatbelt(pattern, target)
+		spec := specificity(pattern)
+
+		switch r.Action {
+		case SeatbeltBlock:
+			if within || parent {
+				d.Verdict, d.Rule, d.Reason = SeatbeltBlocked, r, r.reason()
+				return d
+			}
+		case SeatbeltDeny:
+			if (within || parent) && (deny == nil || spec > denySpec) {
+				deny, denySpec = r, spec
+			}
+		case SeatbeltAllow:
+			if within && r.appliesTo(container) && (allow == nil || spec > allowSpec) {
+				allow, allowSpec = r, spec
+			}
+		}
+	}
+
+	switch {
+	case deny == nil:
+		if allow != nil {
+			d.Rule = allow
+		}
+	case allow != nil && allowSpec >= denySpec:
+		d.Rule, d.Overridden = allow, deny
+		d.Reason = fmt.Sprintf("allowed by %s despite %s", allow.Path, deny.Path)
+	default:
+		d.Verdict, d.Rule, d.Reason = SeatbeltDenied, deny, deny.reason()
+	}
+	return d
+}
+
+func (r *SeatbeltRule) reason() string {
+	if r.Reason != "" {
+		return r.Reason
+	}
+	return fmt.Sprintf("%s is protected by seatbelt policy", r.Path)
+}
+
+func (r *SeatbeltRule) appliesTo(container string) bool {
+	return len(r.Containers) == 0 || (container != "" && slices.Contains(r.Containers, container))
+}
+
+// matchSeatbelt matches pattern elements against path elements. within
+// reports that the path is something the pattern names or below it;
+// parent that the path is a directory above something it could name.
+func matchSeatbelt(pattern, path []string) (within, parent bool) {
+	if len(pattern) == 0 {
+		return true, false
+	}
+	if pattern[0] == "**" {
+		// Any directory could hold a match below **, so parents are
+		// only recognized up to the first **
+		for i := 0; i <= len(path); i++ {
+			if w, _ := matchSeatbelt(pattern[1:], path[i:]); w {
+				return true, false
+			}
+		}
+		return false, false
+	}
+	if len(path) == 0 {
+		return false, true
+	}
+	if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+		return false, false
+	}
+	return matchSeatbelt(pattern[1:], path[1:])
+}
+
+// specificity ranks patterns by their fixed elements.
+func specificity(pattern []string) int {
+	n := 0
+	for _, elem := range pattern {
+		if elem != "**" {
+			n++
+		}
+	}
+	return n
+}
+
+func splitSeatbeltPath(path string) []string {
+	var elems []string
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// expandSeatbeltPattern expands ~/ in a pattern to home.
+func expandSeatbeltPattern(pattern, home string) string {
+	if strings.HasPrefix(pattern, "~/") {
+		if home == "" {
+			// Unmatchable rather than relative to /
+			return "/\x00" + pattern
+		}
+		return home + pattern[1:]
+	}
+	return pattern
+}
+
+// seatbeltHome is the home directory rules are relative to, with symlinks
+// resolved like the paths being checked.
+func seatbeltHome() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(home); err == nil {
+		home = resolved
+	}
+	return home
+}
+
+// resolveSeatbeltPath expands ~ and resolves symlinks, so a link cannot
+// smuggle a protected path past the rules.
+func resolveSeatbeltPath(path string) string {
+	expanded := expandPath(path)
+	if abs, err := filepath.Abs(expanded); err == nil {
+		expanded = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(expanded); err == nil {
+		expanded = resolved
+	}
+	return filepath.Clean(expanded)
+}
+
+// defaultSeatbeltRules are the built-in rules for the current platform.
+func defaultSeatbeltRules() []SeatbeltRule {
+	var rules []SeatbeltRule
+	add := func(path string, action SeatbeltAction, reason string) {
+		rules = append(rules, SeatbeltRule{Path: path, Action: action, Reason: reason, Source: "default"})
+	}
+
+	// Coop's own config is its trust root: keys, CA and this policy
+	add(config.GetDirectories().Config, SeatbeltBlock, "the coop config directory is a protected Coop path and cannot be shared")
+	add(auditDir(), SeatbeltBlock, "the coop audit log is a protected Coop path and cannot be shared")
+	add(approvalsDir(), SeatbeltBlock, "the coop approval queue is a protected Coop path and cannot be shared")
+	for _, dir := range getSensitiveHomeDirs() {
+		if dir == ".config/coop" {
+			add("~/"+dir, SeatbeltBlock, fmt.Sprintf("~/%s is a protected Coop path and cannot be shared", dir))
+			continue
+		}
+		add("~/"+dir, SeatbeltDeny, fmt.Sprintf("~/%s contains sensitive data (credentials, keys, tokens)", dir))
+	}
+
+	switch platform.Detect() {
+	case platform.MacOS:
+		for _, prefix := range sipProtectedPaths {
+			add(prefix, SeatbeltDeny, fmt.Sprintf("%s is protected by System Integrity Protection", prefix))
+		}
+	case platform.WSL2:
+		for _, wslPath := range getWSL2SensitivePaths() {
+			add(wslPath, SeatbeltDeny, fmt.Sprintf("%s contains Windows credentials", wslPath))
+		}
+	}
+	return rules
+}
+
+// sipProtectedPaths are macOS directories protected by System Integrity Protection.
+// From Apple: https://support.apple.com/en-us/102149
+var sipProtectedPaths = []string{
+	"/System",
+	"/usr",
+	"/bin",
+	"/sbin",
+	"/var",
+	"/private/var",
+}
+
+// commonSensitiveDirs are credential directories shared across all platforms.
+var commonSensitiveDirs = []string{
+	".ssh",             // SSH keys
+	".gnupg",           // GPG keys
+	".aws",             // AWS credentials
+	".azure",           // Azure credentials
+	".config/gcloud",   // GCP credentials
+	".kube",            // Kubernetes config
+	".docker",          // Docker config and creds
+	".npmrc",           // npm tokens (file)
+	".netrc",           // Generic credential file
+	".gitconfig",       // May contain credentials
+	".git-credentials", // Git credential storage
+	".config/gh",       // GitHub CLI tokens
+	".anthropic",       // Anthropic API keys
+	".openai",          // OpenAI API keys
+	".config",          // Parent of coop config
+	".config/coop",     // Coop trust root (hard block)
+	"Desktop",          // Personal files
+	"Documents",        // Personal documents
+	"Downloads",        // Downloaded files, potential malware vector
+}
+
+// macOSSensitiveDirs are macOS-specific credential directories.
+var macOSSensitiveDirs = []string{
+	"Library",                                // Keychains, app data, cookies
+	"Library/Keychains",                      // macOS keychain files
+	"Library/Cookies",                        // Browser cookies
+	"Library/Application Support/MobileSync", // iOS backups
+}
+
+// linuxSensitiveDirs are Linux-specific credential directories.
+var linuxSensitiveDirs = []string{
+	".local/share/keyrings", // GNOME Keyring storage
+	".pki",                  // NSS certificate database
+	".password-store",       // pass password manager
+	".local/share/kwalletd", // KDE Wallet
+}
+
+// getSensitiveHomeDirs returns the sensitive directories for the current platform.
+func getSensitiveHomeDirs() []string {
+	dirs := make([]string, 0, len(commonSensitiveDirs)+10)
+	dirs = append(dirs, commonSensitiveDirs...)
+
+	switch platform.Detect() {
+	case platform.MacOS:
+		dirs = append(dirs, macOSSensitiveDirs...)
+	case platform.Linux:
+		dirs = append(dirs, linuxSensitiveDirs...)
+	case platform.WSL2:
+		dirs = append(dirs, linuxSensitiveDirs...)
+		// WSL2 absolute paths come from getWSL2SensitivePaths
+	}
+	return dirs
+}
+
+// getWSL2SensitivePaths returns Windows-side sensitive paths accessible from WSL2.
+func getWSL2SensitivePaths() []string {
+	winUser := detectWindowsUsername()
+	if winUser == "" {
+		return nil
+	}
+
+	winHome := "/mnt/c/Users/" + winUser
+	return []string{
+		winHome + "/.ssh",
+		winHome + "/.aws",
+		winHome + "/.azure",
+		winHome + "/.kube",
+		winHome + "/.docker",
+		winHome + "/AppData/Roaming",         // Windows credential managers
+		winHome + "/AppData/Local/Microsoft", // Windows auth data
+	}
+}
+
+// detectWindowsUsername attempts to find the Windows username from WSL2.
+func detectWindowsUsername() string {
+	// Try WSLENV-provided path
+	if userprofile := os.Getenv("USERPROFILE"); userprofile != "" {
+		// USERPROFILE might be like C:\Users\brian
+		parts := strings.Split(userprofile, "\\")
+		if len(parts) >= 3 {
+			return parts[len(parts)-1]
+		}
+	}
+
+	// Try wslpath if available
+	if output, err := exec.Command("wslvar", "USERNAME").Output(); err == nil {
+		return strings.TrimSpace(string(output))
+	}
+
+	// Fallback: check /mnt/c/Users for non-system directories
+	entries, err := os.ReadDir("/mnt/c/Users")
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		name := e.Name()
+		// Skip system accounts
+		if name == "Public" || name == "Default" || name == "Default User" || name == "All Users" {
+			continue
+		}
+		if e.IsDir() {
+			return name
+		}
+	}
+	return ""
+}
+
+// expandPath expands ~ to the current user's home directory.
+// Note: ~user paths (other than ~/) are NOT expanded for security reasons.
+func expandPath(path string) string {
+	if path == "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	if path == "~" {
+		return home
+	}
+
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(home, path[2:])
+	}
+
+	// Do NOT expand ~user paths - this could bypass seatbelt protection
+	// by expanding ~root/.ssh to something other than $HOME/.ssh
+	return path
+}
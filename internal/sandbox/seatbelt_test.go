@@ -228,3 +228,135 @@ func TestExpandPath(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluateSeatbelt(t *testing.T) {
+	const home = "/home/u"
+	rules := []SeatbeltRule{
+		{Path: "~/.config", Action: SeatbeltDeny},
+		{Path: "~/.config/coop", Action: SeatbeltBlock},
+		{Path: "~/.config/gh", Action: SeatbeltDeny},
+		{Path: "~/Documents", Action: SeatbeltDeny},
+		{Path: "~/Documents/code", Action: SeatbeltAllow},
+		{Path: "~/.config/myapp", Action: SeatbeltAllow, Containers: []string{"web"}},
+		{Path: "~/clients/*/keys", Action: SeatbeltDeny},
+		{Path: "**/.env", Action: SeatbeltDeny},
+		{Path: "~/Documents/code/vault", Action: SeatbeltBlock},
+	}
+
+	tests := []struct {
+		path      string
+		container string
+		want      SeatbeltVerdict
+		rule      string
+	}{
+		{"/home/u/projects/app", "", SeatbeltAllowed, ""},
+		{"/home/u/.config/nvim", "", SeatbeltDenied, "~/.config"},
+		{"/home/u/.config/gh/hosts.yml", "", SeatbeltDenied, "~/.config/gh"},
+		{"/home/u/.config/coop", "", SeatbeltBlocked, "~/.config/coop"},
+		// Sharing a parent exposes what is below it
+		{"/home/u/.config", "", SeatbeltBlocked, "~/.config/coop"},
+		{"/home/u", "", SeatbeltBlocked, "~/.config/coop"},
+		{"/home/u/Documents/code/app", "", SeatbeltAllowed, "~/Documents/code"},
+		{"/home/u/Documents/code/vault/x", "", SeatbeltBlocked, "~/Documents/code/vault"},
+		{"/home/u/Documents/taxes", "", SeatbeltDenied, "~/Documents"},
+		// Per-container allow
+		{"/home/u/.config/myapp", "web", SeatbeltAllowed, "~/.config/myapp"},
+		{"/home/u/.config/myapp", "other", SeatbeltDenied, "~/.config"},
+		{"/home/u/.config/myapp", "", SeatbeltDenied, "~/.config"},
+		// Globs
+		{"/home/u/clients/acme/keys/id", "", SeatbeltDenied, "~/clients/*/keys"},
+		{"/home/u/clients/acme", "", SeatbeltDenied, "~/clients/*/keys"},
+		{"/home/u/clients/acme/src", "", SeatbeltAllowed, ""},
+		{"/home/u/projects/app/.env", "", SeatbeltDenied, "**/.env"},
+		{"/home/u/projects/app/.envrc", "", SeatbeltAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path+"@"+tt.container, func(t *testing.T) {
+			d := evaluateSeatbelt(rules, tt.path, tt.container, home)
+			if d.Verdict != tt.want {
+				t.Errorf("verdict = %s, want %s (reason: %s)", d.Verdict, tt.want, d.Reason)
+			}
+			rule := ""
+			if d.Rule != nil {
+				rule = d.Rule.Path
+			}
+			if rule != tt.rule {
+				t.Errorf("rule = %q, want %q", rule, tt.rule)
+			}
+		})
+	}
+}
+
+func TestLoadSeatbeltPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	policy, err := LoadSeatbeltPolicy(filepath.Join(dir, "missing.json"))
+	if err != nil || len(policy.Rules) != 0 {
+		t.Fatalf("missing policy = %+v, %v", policy, err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `{"rules": [{"path": "~/Documents/code", "action": "allow", "containers": ["web"]}]}`, false},
+		{"unknown action", `{"rules": [{"path": "~/x", "action": "permit"}]}`, true},
+		{"relative path", `{"rules": [{"path": "x/y", "action": "deny"}]}`, true},
+		{"bad glob", `{"rules": [{"path": "~/[x", "action": "deny"}]}`, true},
+		{"containers on deny", `{"rules": [{"path": "~/x", "action": "deny", "containers": ["web"]}]}`, true},
+		{"malformed", `{"rules": [`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			policy, err := LoadSeatbeltPolicy(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && policy.Rules[0].Source != path {
+				t.Errorf("Source = %q, want %q", policy.Rules[0].Source, path)
+			}
+		})
+	}
+}
+
+func TestCheckSeatbeltPolicyFile(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("UserHomeDir not available")
+	}
+	configDir := t.TempDir()
+	t.Setenv("COOP_CONFIG_DIR", configDir)
+
+	target := filepath.Join(home, "Documents", "code")
+	if d := CheckSeatbelt(target, ""); d.Verdict != SeatbeltDenied {
+		t.Fatalf("without policy: %s (%s)", d.Verdict, d.Reason)
+	}
+
+	policy := `{"rules": [{"path": "~/Documents/code", "action": "allow"}]}`
+	if err := os.WriteFile(SeatbeltPolicyPath(), []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if d := CheckSeatbelt(target, ""); d.Verdict != SeatbeltAllowed || d.Overridden == nil {
+		t.Errorf("with allow rule: %s (%s)", d.Verdict, d.Reason)
+	}
+
+	// A broken policy must not open anything up
+	if err := os.WriteFile(SeatbeltPolicyPath(), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d := CheckSeatbelt(filepath.Join(home, "projects"), "")
+	if d.Verdict != SeatbeltDenied || d.PolicyError == nil {
+		t.Errorf("with broken policy: %s (%s)", d.Verdict, d.Reason)
+	}
+
+	// The config directory is blocked wherever it is
+	if d := CheckSeatbelt(configDir, ""); d.Verdict != SeatbeltBlocked {
+		t.Errorf("config dir: %s (%s)", d.Verdict, d.Reason)
+	}
+}
@@ -0,0 +1,183 @@
+// Package sandbox provides the security tiers agent containers are created with.
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SecurityTier selects how far a container is locked down.
+type SecurityTier string
+
+const (
+	// SecurityStrict is for untrusted agents: no sudo, no nested
+	// containers, and a narrower syscall, AppArmor and capability set.
+	SecurityStrict SecurityTier = "strict"
+	// SecurityStandard keeps sudo and nesting, which most agents need, but
+	// blocks syscalls and capabilities they do not.
+	SecurityStandard SecurityTier = "standard"
+	// SecurityDev is for trusted work that needs the host's hardware,
+	// such as VMs or emulators through /dev/kvm.
+	SecurityDev SecurityTier = "dev"
+)
+
+// DefaultSecurityTier is used when neither --security nor settings pick one.
+const DefaultSecurityTier = SecurityStandard
+
+// securityTierKey records a container's tier in its Incus config.
+const securityTierKey = "user.coop.security"
+
+// SecurityTiers lists the tiers from most to least restrictive.
+var SecurityTiers = []SecurityTier{SecurityStrict, SecurityStandard, SecurityDev}
+
+// ParseSecurityTier validates a tier name. An empty name is the default tier.
+func ParseSecurityTier(s string) (SecurityTier, error) {
+	if s == "" {
+		return DefaultSecurityTier, nil
+	}
+	for _, tier := range SecurityTiers {
+		if SecurityTier(s) == tier {
+			return tier, nil
+		}
+	}
+	return "", fmt.Errorf("unknown security tier %q (use strict, standard or dev)", s)
+}
+
+// SecurityProfile is what a tier turns on and off.
+type SecurityProfile struct {
+	Tier           SecurityTier
+	Nesting        bool     // Nested containers (Docker, Podman, Incus)
+	Sudo           bool     // Passwordless sudo for the agent user
+	IsolatedIDMap  bool     // A UID/GID range no other container shares
+	KVM            bool     // /dev/kvm passed through when the host has it
+	DeniedSyscalls []string // Failed with ENOSYS on top of Incus' default list
+	AppArmor       []string // Rules added to the Incus AppArmor profile
+	DroppedCaps    []string // Capabilities removed from the container
+}
+
+// standardDeniedSyscalls reach kernel surfaces agents have no use for and
+// which are common container escape and exploit vectors.
+var standardDeniedSyscalls = []string{
+	"bpf", "userfaultfd", "perf_event_open", "kexec_file_load",
+	"add_key", "request_key", "keyctl", "io_uring_setup",
+}
+
+// standardDroppedCaps control the host rather than the container.
+var standardDroppedCaps = []string{
+	"sys_module", "sys_rawio", "sys_time", "sys_boot",
+	"mac_admin", "mac_override", "syslog", "wake_alarm",
+}
+
+// Profile returns what the tier sets.
+func (t SecurityTier) Profile() SecurityProfile {
+	switch t {
+	case SecurityStrict:
+		return SecurityProfile{
+			Tier:           t,
+			IsolatedIDMap:  true,
+			DeniedSyscalls: append(append([]string{}, standardDeniedSyscalls...), "ptrace", "process_vm_readv", "process_vm_writev"),
+			// systemd still mounts /run and friends at boot, so mount stays
+			AppArmor: []string{
+				"deny pivot_root,",
+				"deny /sys/kernel/security/** rwklx,",
+				"deny /proc/sys/kernel/** wklx,",
+			},
+			DroppedCaps: append(append([]string{}, standardDroppedCaps...), "sys_ptrace", "net_raw", "sys_pacct"),
+		}
+	case SecurityDev:
+		return SecurityProfile{
+			Tier:    t,
+			Nesting: true,
+			Sudo:    true,
+			KVM:     true,
+		}
+	default:
+		return SecurityProfile{
+			Tier:           SecurityStandard,
+			Nesting:        true,
+			Sudo:           true,
+			IsolatedIDMap:  true,
+			DeniedSyscalls: standardDeniedSyscalls,
+			AppArmor:       []string{"deny /sys/kernel/security/** rwklx,"},
+			DroppedCaps:    standardDroppedCaps,
+		}
+	}
+}
+
+// Summary lists the profile's notable choices, e.g. "no sudo, no nesting".
+func (p SecurityProfile) Summary() string {
+	var parts []string
+	if !p.Sudo {
+		parts = append(parts, "no sudo")
+	}
+	if !p.Nesting {
+		parts = append(parts, "no nesting")
+	}
+	if p.KVM {
+		parts = append(parts, "/dev/kvm")
+	}
+	if !p.IsolatedIDMap {
+		parts = append(parts, "shared idmap")
+	}
+	if len(p.DeniedSyscalls) > 0 {
+		parts = append(parts, fmt.Sprintf("%d extra syscalls denied", len(p.DeniedSyscalls)))
+	}
+	if len(p.DroppedCaps) > 0 {
+		parts = append(parts, fmt.Sprintf("%d capabilities dropped", len(p.DroppedCaps)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// instanceConfig returns the Incus config keys applying the profile. Every
+// key is set explicitly, overriding the shared agent profile.
+func (p SecurityProfile) instanceConfig() map[string]string {
+	config := map[string]string{
+		securityTierKey:                  string(p.Tier),
+		"security.privileged":            "false",
+		"security.nesting":               fmt.Sprint(p.Nesting),
+		"security.idmap.isolated":        fmt.Sprint(p.IsolatedIDMap),
+		"security.syscalls.deny_default": "true",
+	}
+	if deny := p.syscallDenyList(); deny != "" {
+		config["security.syscalls.deny"] = deny
+	}
+	if len(p.AppArmor) > 0 {
+		config["raw.apparmor"] = strings.Join(p.AppArmor, "\n")
+	}
+	if len(p.DroppedCaps) > 0 {
+		config["raw.lxc"] = "lxc.cap.drop = " + strings.Join(p.DroppedCaps, " ")
+	}
+	return config
+}
+
+// syscallDenyList renders DeniedSyscalls as security.syscalls.deny lines.
+// Incus adds them to its generated policy, after its default list and
+// alongside the syscall interception a container engine needs; raw.seccomp
+// would replace that policy instead.
+func (p SecurityProfile) syscallDenyList() string {
+	var lines []string
+	for _, syscall := range p.DeniedSyscalls {
+		lines = append(lines, syscall+" errno 38")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// kvmDevice passes /dev/kvm through; it is skipped where the host has none.
+// Incus creates the node as root:root 0660 by default, which the agent
+// cannot open, and the host's kvm group has no counterpart in the
+// container, so the dev tier opens it to everyone.
+func kvmDevice() map[string]string {
+	return map[string]string{
+		"type":     "unix-char",
+		"source":   "/dev/kvm",
+		"path":     "/dev/kvm",
+		"mode":     "0666",
+		"required": "false",
+	}
+}
+
+// ContainerSecurityTier returns the tier recorded in a container's config,
+// or "" for containers created before tiers.
+func ContainerSecurityTier(config map[string]string) SecurityTier {
+	return SecurityTier(config[securityTierKey])
+}
@@ -0,0 +1,115 @@
+package sandbox
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSecurityTier(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    SecurityTier
+		wantErr bool
+	}{
+		{"", SecurityStandard, false},
+		{"strict", SecurityStrict, false},
+		{"standard", SecurityStandard, false},
+		{"dev", SecurityDev, false},
+		{"Strict", "", true},
+		{"paranoid", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSecurityTier(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSecurityTier(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSecurityTier(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecurityProfileConfig(t *testing.T) {
+	tests := []struct {
+		tier    SecurityTier
+		want    map[string]string
+		absent  []string
+		seccomp []string
+	}{
+		{
+			tier: SecurityStrict,
+			want: map[string]string{
+				"user.coop.security":      "strict",
+				"security.privileged":     "false",
+				"security.nesting":        "false",
+				"security.idmap.isolated": "true",
+			},
+			seccomp: []string{"bpf errno 38", "ptrace errno 38"},
+		},
+		{
+			tier: SecurityStandard,
+			want: map[string]string{
+				"user.coop.security":      "standard",
+				"security.nesting":        "true",
+				"security.idmap.isolated": "true",
+			},
+			seccomp: []string{"bpf errno 38", "io_uring_setup errno 38"},
+		},
+		{
+			tier: SecurityDev,
+			want: map[string]string{
+				"user.coop.security":      "dev",
+				"security.nesting":        "true",
+				"security.idmap.isolated": "false",
+			},
+			absent: []string{"security.syscalls.deny", "raw.apparmor", "raw.lxc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.tier), func(t *testing.T) {
+			config := tt.tier.Profile().instanceConfig()
+			for k, v := range tt.want {
+				if config[k] != v {
+					t.Errorf("%s = %q, want %q", k, config[k], v)
+				}
+			}
+			for _, k := range tt.absent {
+				if _, ok := config[k]; ok {
+					t.Errorf("%s should not be set", k)
+				}
+			}
+			// raw.seccomp would replace Incus' policy, defaults and all
+			if _, ok := config["raw.seccomp"]; ok {
+				t.Error("raw.seccomp should not be set")
+			}
+			if config["security.syscalls.deny_default"] != "true" {
+				t.Error("Incus' default deny list should stay on")
+			}
+			deny := strings.Split(config["security.syscalls.deny"], "\n")
+			for _, line := range tt.seccomp {
+				if !slices.Contains(deny, line) {
+					t.Errorf("security.syscalls.deny lacks %q", line)
+				}
+			}
+		})
+	}
+
+	if strings.Contains(SecurityStandard.Profile().instanceConfig()["security.syscalls.deny"], "ptrace") {
+		t.Error("standard tier should leave ptrace to debuggers")
+	}
+	if !strings.HasPrefix(SecurityStrict.Profile().instanceConfig()["raw.lxc"], "lxc.cap.drop = sys_module ") {
+		t.Error("strict tier should drop capabilities")
+	}
+	if SecurityStrict.Profile().Sudo || !SecurityStandard.Profile().Sudo || !SecurityDev.Profile().KVM {
+		t.Error("tiers should toggle sudo and /dev/kvm")
+	}
+	// The agent opens /dev/kvm without root or a host group
+	if kvm := kvmDevice(); kvm["mode"] != "0666" || kvm["required"] != "false" {
+		t.Errorf("kvmDevice() = %v, want mode 0666 and optional", kvm)
+	}
+}
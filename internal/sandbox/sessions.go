@@ -0,0 +1,139 @@
+// Package sandbox provides shell and exec session recording.
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/recording"
+)
+
+// recordSessionsKey overrides the record_sessions setting for one container.
+const recordSessionsKey = "user.coop.record_sessions"
+
+// sessionExt is the file extension of asciicast recordings.
+const sessionExt = ".cast"
+
+// Session is a recorded shell or exec session.
+type Session struct {
+	Container string
+	ID        string // File name without extension: <time>-<kind>
+	Path      string
+	Info      *recording.Info // Nil if the file could not be read
+}
+
+// RecordsSessions reports whether sessions in a container are recorded:
+// the container's own setting if it has one, else the record_sessions setting.
+func (m *Manager) RecordsSessions(name string) bool {
+	if container, err := m.client.GetContainer(name); err == nil {
+		if v, err := strconv.ParseBool(container.Config[recordSessionsKey]); err == nil {
+			return v
+		}
+	}
+	return m.config.Settings.RecordSessions
+}
+
+// SetSessionRecording sets a container's recording override: "on", "off",
+// or "default" to follow the record_sessions setting.
+func (m *Manager) SetSessionRecording(name, mode string) error {
+	if _, err := m.client.GetContainer(name); err != nil {
+		return containerNotFound(name)
+	}
+
+	var value string
+	switch mode {
+	case "on":
+		value = "true"
+	case "off":
+		value = "false"
+	case "default":
+		value = ""
+	default:
+		return fmt.Errorf("invalid recording mode %q (use on, off or default)", mode)
+	}
+	return m.client.UpdateConfig(name, map[string]string{recordSessionsKey: value})
+}
+
+// SessionDir is where a container's recordings are stored.
+func (m *Manager) SessionDir(name string) string {
+	return filepath.Join(m.config.Dirs.Logs, "sessions", name)
+}
+
+// StartRecording creates a recording for a shell or exec session. kind
+// ("shell" or "exec") becomes part of the session ID.
+func (m *Manager) StartRecording(name, kind string, command []string, width, height int) (*recording.Recorder, *Session, error) {
+	dir := m.SessionDir(name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+
+	header := recording.Header{
+		Width:   width,
+		Height:  height,
+		Command: strings.Join(command, " "),
+		Title:   name,
+		Env:     map[string]string{"TERM": os.Getenv("TERM"), "SHELL": "/bin/bash"},
+	}
+
+	base := time.Now().Format("20060102-150405") + "-" + kind
+	id := base
+	for n := 2; ; n++ {
+		path := filepath.Join(dir, id+sessionExt)
+		rec, err := recording.Create(path, header)
+		if err == nil {
+			return rec, &Session{Container: name, ID: id, Path: path}, nil
+		}
+		if !os.IsExist(err) || n > 100 {
+			return nil, nil, fmt.Errorf("failed to start recording: %w", err)
+		}
+		// Another session started in the same second
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// ListSessions returns recorded sessions, newest first. With an empty
+// name it lists every container's sessions, including deleted containers.
+func (m *Manager) ListSessions(name string) ([]Session, error) {
+	pattern := filepath.Join(m.config.Dirs.Logs, "sessions", "*", "*"+sessionExt)
+	if name != "" {
+		pattern = filepath.Join(m.SessionDir(name), "*"+sessionExt)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(paths))
+	for _, path := range paths {
+		s := Session{
+			Container: filepath.Base(filepath.Dir(path)),
+			ID:        strings.TrimSuffix(filepath.Base(path), sessionExt),
+			Path:      path,
+		}
+		if info, err := recording.Stat(path); err == nil {
+			s.Info = info
+		}
+		sessions = append(sessions, s)
+	}
+
+	// IDs start with a timestamp, so they sort chronologically
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].ID > sessions[j].ID })
+	return sessions, nil
+}
+
+// FindSession returns a container's recording by ID.
+func (m *Manager) FindSession(name, id string) (*Session, error) {
+	if strings.ContainsAny(id, `/\`) || id == "" {
+		return nil, fmt.Errorf("invalid session id %q", id)
+	}
+	path := filepath.Join(m.SessionDir(name), strings.TrimSuffix(id, sessionExt)+sessionExt)
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("session %s not found for %s", id, name)
+	}
+	return &Session{Container: name, ID: strings.TrimSuffix(id, sessionExt), Path: path}, nil
+}
@@ -0,0 +1,69 @@
+package sandbox
+
+import (
+	"testing"
+
+	"github.com/stuffbucket/coop/internal/config"
+)
+
+func TestSessionRecordings(t *testing.T) {
+	m := &Manager{config: &config.Config{Dirs: config.Directories{Logs: t.TempDir()}}}
+
+	rec, first, err := m.StartRecording("alpha", "shell", []string{"bash"}, 80, 24)
+	if err != nil {
+		t.Fatalf("StartRecording: %v", err)
+	}
+	_, _ = rec.Write([]byte("hi\n"))
+	if err := rec.Close(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second session in the same second gets its own file
+	rec, second, err := m.StartRecording("alpha", "shell", []string{"make"}, 80, 24)
+	if err != nil {
+		t.Fatalf("StartRecording: %v", err)
+	}
+	if err := rec.Close(2); err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("sessions share ID %s", first.ID)
+	}
+
+	rec, _, err = m.StartRecording("beta", "exec", []string{"ls"}, 80, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rec.Close(0)
+
+	all, err := m.ListSessions("")
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("ListSessions(\"\") = %d sessions, want 3", len(all))
+	}
+
+	alpha, err := m.ListSessions("alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alpha) != 2 {
+		t.Fatalf("ListSessions(alpha) = %d sessions, want 2", len(alpha))
+	}
+	for _, s := range alpha {
+		if s.Info == nil || s.Info.ExitCode == nil {
+			t.Errorf("session %s has no exit code", s.ID)
+		}
+	}
+
+	found, err := m.FindSession("alpha", second.ID+".cast")
+	if err != nil || found.Path != second.Path {
+		t.Errorf("FindSession = %+v, %v", found, err)
+	}
+	for _, bad := range []string{"", "../beta/x", "missing"} {
+		if _, err := m.FindSession("alpha", bad); err == nil {
+			t.Errorf("FindSession(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package sandbox provides SSH certificates for container logins.
+package sandbox
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/cloudinit"
+	"github.com/stuffbucket/coop/internal/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultCertTTL is the lifetime of certificates used through
+	// ~/.ssh/config, unless ssh.cert_ttl is set.
+	DefaultCertTTL = 8 * time.Hour
+	// SessionCertTTL is the lifetime of the certificate issued for each
+	// ssh session coop starts; it only has to outlive authentication.
+	SessionCertTTL = 5 * time.Minute
+)
+
+// CertTTL returns the configured lifetime of ~/.ssh/config certificates.
+func (m *Manager) CertTTL() time.Duration {
+	if ttl, err := time.ParseDuration(m.config.Settings.SSH.CertTTL); err == nil && ttl > 0 {
+		return ttl
+	}
+	return DefaultCertTTL
+}
+
+// IssueSSHCert signs a new certificate for a container's key. Session
+// certificates are for a single ssh invocation; the others back the
+// container's ~/.ssh/config entry.
+func (m *Manager) IssueSSHCert(name string, ttl time.Duration, session bool) (*ssh.Certificate, error) {
+	if _, err := m.client.GetContainer(name); err != nil {
+		return nil, containerNotFound(name)
+	}
+	cert, err := sshkeys.IssueCert(name, ttl, session)
+	if err != nil {
+		return nil, fmt.Errorf("could not issue SSH certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// configureSSHCA makes a new container trust coop's CA for certificates
+// naming it. A key left over from an earlier container with the same name
+// is revoked first, so its certificates are rejected.
+func configureSSHCA(cfg *cloudinit.Config, name string) error {
+	if err := sshkeys.RevokeContainerKey(name); err != nil {
+		return err
+	}
+	ca, err := sshkeys.EnsureCA()
+	if err != nil {
+		return err
+	}
+	revoked, err := sshkeys.RevokedKeys()
+	if err != nil {
+		return err
+	}
+	cfg.SSHUserCA = ca
+	cfg.SSHPrincipal = sshkeys.Principal(name)
+	cfg.SSHRevokedKeys = revoked
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package sandbox provides host folder sync for backends without shared mounts.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/stuffbucket/coop/internal/audit"
+	"github.com/stuffbucket/coop/internal/filesync"
+)
+
+// syncKeyPrefix prefixes the instance config keys holding sync pairs,
+// one key per pair: user.coop.sync.<name>.
+const syncKeyPrefix = "user.coop.sync."
+
+// SyncPair is a host directory kept in sync with a container directory.
+type SyncPair struct {
+	Name   string `json:"-"`
+	Source string `json:"source"` // Host directory
+	Path   string `json:"path"`   // Container directory
+	// Authorized records that a protected source was approved with --force.
+	Authorized bool `json:"authorized,omitempty"`
+}
+
+// SharesHostFilesystem reports whether disk mounts can see host paths.
+// Bladerunner and remote Incus servers run containers on another machine,
+// so host folders must be synced instead of mounted.
+func (m *Manager) SharesHostFilesystem() bool {
+	switch m.client.BackendName() {
+	case "bladerunner", "remote":
+		return false
+	}
+	return true
+}
+
+// AddSync registers a sync pair on a container.
+// Set force=true to sync seatbelted directories (confirmed by the Authorizer).
+func (m *Manager) AddSync(containerName string, pair SyncPair, force bool) (err error) {
+	entry := audit.Entry{Op: "sync.add", Container: containerName, Args: map[string]string{"name": pair.Name, "source": pair.Source, "path": pair.Path}}
+	defer func() { auditOp(entry, err) }()
+
+	if _, err := m.client.GetContainer(containerName); err != nil {
+		return containerNotFound(containerName)
+	}
+
+	source, err := filepath.Abs(expandPath(pair.Source))
+	if err != nil {
+		return err
+	}
+	entry.Auth, err = m.AuthorizeHostPath(HostAccess{
+		Op:        HostOpSync,
+		Path:      source,
+		Container: containerName,
+		Force:     force,
+	})
+	if err != nil {
+		return err
+	}
+	pair.Authorized = entry.Auth != ""
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", source)
+	}
+	if !path.IsAbs(pair.Path) {
+		return fmt.Errorf("container path must be absolute: %s", pair.Path)
+	}
+
+	pair.Source = source
+	pair.Path = path.Clean(pair.Path)
+
+	value, err := json.Marshal(pair)
+	if err != nil {
+		return err
+	}
+	return m.client.UpdateConfig(containerName, map[string]string{
+		syncKeyPrefix + pair.Name: string(value),
+	})
+}
+
+// RemoveSync unregisters a sync pair. Files on both sides are kept.
+func (m *Manager) RemoveSync(containerName, name string) error {
+	pairs, err := m.ListSyncs(containerName)
+	if err != nil {
+		return err
+	}
+	for _, p := range pairs {
+		if p.Name == name {
+			_ = os.Remove(m.syncBaseFile(containerName, name))
+			return m.client.UpdateConfig(containerName, map[string]string{syncKeyPrefix + name: ""})
+		}
+	}
+	return fmt.Errorf("sync %s not found on %s", name, containerName)
+}
+
+// ListSyncs returns the sync pairs registered on a container, sorted by name.
+func (m *Manager) ListSyncs(containerName string) ([]SyncPair, error) {
+	container, err := m.client.GetContainer(containerName)
+	if err != nil {
+		return nil, containerNotFound(containerName)
+	}
+
+	var pairs []SyncPair
+	for key, value := range container.Config {
+		name, ok := strings.CutPrefix(key, syncKeyPrefix)
+		if !ok {
+			continue
+		}
+		var pair SyncPair
+		if err := json.Unmarshal([]byte(value), &pair); err != nil {
+			return nil, fmt.Errorf("invalid sync config %s: %w", key, err)
+		}
+		pair.Name = name
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs, nil
+}
+
+// NewSyncer prepares a sync engine for a pair over the Incus file API.
+// The container directory is created if needed. Call the returned function
+// to close the connection when done.
+func (m *Manager) NewSyncer(containerName string, pair SyncPair) (*filesync.Syncer, func(), error) {
+	if _, err := m.AuthorizeHostPath(HostAccess{
+		Op:         HostOpSync,
+		Path:       pair.Source,
+		Container:  containerName,
+		Authorized: pair.Authorized,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	ignore, err := filesync.GitIgnore(pair.Source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read .gitignore: %w", err)
+	}
+
+	client, err := m.client.SFTP(containerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	remote := &filesync.SFTPFS{Client: client, Root: pair.Path, UID: AgentUID, GID: AgentUID}
+	if err := remote.EnsureRoot(); err != nil {
+		_ = client.Close()
+		return nil, nil, fmt.Errorf("create %s: %w", pair.Path, err)
+	}
+
+	syncer := &filesync.Syncer{
+		Local:    &filesync.LocalFS{Root: pair.Source},
+		Remote:   remote,
+		BaseFile: m.syncBaseFile(containerName, pair.Name),
+		Ignore:   ignore,
+	}
+	return syncer, func() { _ = client.Close() }, nil
+}
+
+// syncBaseFile is where the sync engine remembers the last synced state.
+func (m *Manager) syncBaseFile(containerName, name string) string {
+	return filepath.Join(m.config.Dirs.Data, "sync", containerName, name+".json")
+}
@@ -0,0 +1,256 @@
+// Package sandbox provides shell transport selection between SSH and Incus exec.
+package sandbox
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/sshkeys"
+)
+
+// ShellTransport is how coop shell reaches a container.
+type ShellTransport string
+
+const (
+	// TransportSSH connects directly to the container IP.
+	TransportSSH ShellTransport = "ssh"
+	// TransportSSHProxy connects through the backend's SSH jump host.
+	TransportSSHProxy ShellTransport = "ssh-proxy"
+	// TransportExec uses the Incus exec API with a PTY; it needs no network path.
+	TransportExec ShellTransport = "exec"
+)
+
+// transportCacheTTL is how long a probe result is trusted.
+const transportCacheTTL = 10 * time.Minute
+
+// sshProbeTimeout bounds each connectivity check.
+const sshProbeTimeout = 3 * time.Second
+
+// transportCache records the last probe result for a container.
+type transportCache struct {
+	Transport ShellTransport `json:"transport"`
+	Backend   string         `json:"backend"`
+	IP        string         `json:"ip"`
+	CheckedAt time.Time      `json:"checked_at"`
+}
+
+// valid reports whether a cached result applies to the container now.
+func (c *transportCache) valid(backend, ip string, now time.Time) bool {
+	return c.Backend == backend && c.IP == ip && now.Sub(c.CheckedAt) < transportCacheTTL
+}
+
+// ShellTransport decides how to open a shell in a container. via may be
+// "ssh" or "exec" to skip probing; empty or "auto" probes connectivity
+// (cached for a few minutes per container IP).
+func (m *Manager) ShellTransport(name, via string) (ShellTransport, error) {
+	if err := m.requireRunning(name); err != nil {
+		return "", err
+	}
+
+	switch via {
+	case "exec":
+		return TransportExec, nil
+	case "ssh":
+		if len(m.client.SSHProxyArgs()) > 0 {
+			return TransportSSHProxy, nil
+		}
+		return TransportSSH, nil
+	case "", "auto":
+	default:
+		return "", fmt.Errorf("invalid transport %q (use ssh or exec)", via)
+	}
+
+	// Bladerunner container IPs are never routable from the host
+	backend := m.client.BackendName()
+	if backend == "bladerunner" {
+		return TransportExec, nil
+	}
+
+	ip, err := m.client.GetContainerIP(name)
+	if err != nil {
+		return TransportExec, nil
+	}
+
+	cachePath := filepath.Join(m.config.Dirs.Cache, "shell", name+".json")
+	if cached, err := readTransportCache(cachePath); err == nil && cached.valid(backend, ip, time.Now()) {
+		return cached.Transport, nil
+	}
+	return m.probeTransport(name, backend, ip), nil
+}
+
+// ProbeShellTransport probes how coop shell would reach a running
+// container, ignoring and refreshing the cached result.
+func (m *Manager) ProbeShellTransport(name string) (ShellTransport, error) {
+	if err := m.requireRunning(name); err != nil {
+		return "", err
+	}
+	backend := m.client.BackendName()
+	if backend == "bladerunner" {
+		return TransportExec, nil
+	}
+	ip, err := m.client.GetContainerIP(name)
+	if err != nil {
+		return TransportExec, nil
+	}
+	return m.probeTransport(name, backend, ip), nil
+}
+
+// probeTransport checks SSH connectivity to ip and caches the result.
+func (m *Manager) probeTransport(name, backend, ip string) ShellTransport {
+	transport := TransportExec
+	if proxyArgs := m.client.SSHProxyArgs(); len(proxyArgs) > 0 {
+		if m.prepareSSHProbe(name) == nil && sshProxyReachable(proxyArgs, name, ip) {
+			transport = TransportSSHProxy
+		}
+	} else if sshReachable(net.JoinHostPort(ip, "22"), sshProbeTimeout) {
+		transport = TransportSSH
+	}
+
+	_ = writeTransportCache(filepath.Join(m.config.Dirs.Cache, "shell", name+".json"), transportCache{
+		Transport: transport,
+		Backend:   backend,
+		IP:        ip,
+		CheckedAt: time.Now(),
+	})
+	return transport
+}
+
+// sshReachable reports whether an SSH server answers at addr.
+func sshReachable(addr string, timeout time.Duration) bool {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	return err == nil && strings.HasPrefix(banner, "SSH-")
+}
+
+// prepareSSHProbe pins the container's host keys and issues a session
+// certificate so the probe can log in.
+func (m *Manager) prepareSSHProbe(name string) error {
+	if err := m.ensureHostKeys(name); err != nil {
+		return err
+	}
+	_, err := sshkeys.IssueCert(name, SessionCertTTL, true)
+	return err
+}
+
+// sshProxyReachable reports whether ssh through the backend's jump host
+// can log in to the container.
+func sshProxyReachable(proxyArgs []string, name, ip string) bool {
+	args := append([]string{}, proxyArgs...)
+	args = append(args,
+		"-o", "BatchMode=yes",
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(sshProbeTimeout.Seconds())),
+	)
+	args = append(args, sshkeys.SSHArgs(name, "agent", ip)...)
+	args = append(args, "true")
+	return exec.Command("ssh", args...).Run() == nil
+}
+
+func readTransportCache(path string) (*transportCache, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c transportCache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func writeTransportCache(path string, c transportCache) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// forwardedEnvVars are passed from the host to exec shells, as ssh does
+// with SendEnv.
+var forwardedEnvVars = []string{"TERM", "COLORTERM", "LANG", "LANGUAGE", "TZ"}
+
+// forwardedEnv picks the variables from environ that exec shells inherit:
+// forwardedEnvVars and any LC_* locale settings.
+func forwardedEnv(environ []string) map[string]string {
+	env := map[string]string{}
+	for _, kv := range environ {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || value == "" {
+			continue
+		}
+		if strings.HasPrefix(key, "LC_") {
+			env[key] = value
+			continue
+		}
+		for _, name := range forwardedEnvVars {
+			if key == name {
+				env[key] = value
+			}
+		}
+	}
+	return env
+}
+
+// agentDevicePrefix names the proxy devices relaying the host SSH agent
+// into a container for one exec shell.
+const agentDevicePrefix = "ssh-agent-"
+
+// forwardAgent relays the host's SSH agent into the container for the
+// duration of a shell. It returns the socket path inside the container
+// and a function removing the relay.
+func (m *Manager) forwardAgent(name string) (string, func(), error) {
+	hostSock := os.Getenv("SSH_AUTH_SOCK")
+	if hostSock == "" {
+		return "", nil, fmt.Errorf("no SSH agent is running (SSH_AUTH_SOCK is not set)")
+	}
+	// The proxy device connects from the Incus host, which only sees this
+	// machine's sockets when Incus runs here.
+	if backend := m.client.BackendName(); backend != "" {
+		return "", nil, fmt.Errorf("agent forwarding over exec is not supported on the %s backend; use --via ssh", backend)
+	}
+	if _, err := m.AuthorizeHostPath(HostAccess{
+		Op:        HostOpProxy,
+		Path:      hostSock,
+		Container: name,
+	}); err != nil {
+		return "", nil, fmt.Errorf("cannot forward SSH agent: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	id := hex.EncodeToString(suffix)
+	device := agentDevicePrefix + id
+	sock := "/tmp/coop-ssh-agent-" + id + ".sock"
+
+	err := m.client.AddDevice(name, device, map[string]string{
+		"type":    "proxy",
+		"bind":    "instance",
+		"listen":  "unix:" + sock,
+		"connect": "unix:" + hostSock,
+		"uid":     fmt.Sprint(AgentUID),
+		"gid":     fmt.Sprint(AgentUID),
+		"mode":    "0600",
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to forward SSH agent: %w", err)
+	}
+	return sock, func() { _ = m.client.RemoveDevice(name, device) }, nil
+}
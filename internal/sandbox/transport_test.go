@@ -0,0 +1,113 @@
+package sandbox
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransportCacheValid(t *testing.T) {
+	now := time.Now()
+	c := transportCache{Transport: TransportSSH, Backend: "colima", IP: "10.0.0.5", CheckedAt: now.Add(-time.Minute)}
+
+	tests := []struct {
+		name    string
+		backend string
+		ip      string
+		now     time.Time
+		want    bool
+	}{
+		{"fresh", "colima", "10.0.0.5", now, true},
+		{"expired", "colima", "10.0.0.5", now.Add(transportCacheTTL), false},
+		{"new IP", "colima", "10.0.0.6", now, false},
+		{"other backend", "lima", "10.0.0.5", now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.valid(tt.backend, tt.ip, tt.now); got != tt.want {
+				t.Errorf("valid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransportCacheRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shell", "dev.json")
+	want := transportCache{Transport: TransportExec, Backend: "", IP: "10.0.0.5", CheckedAt: time.Now().Round(0)}
+	if err := writeTransportCache(path, want); err != nil {
+		t.Fatalf("writeTransportCache: %v", err)
+	}
+	got, err := readTransportCache(path)
+	if err != nil {
+		t.Fatalf("readTransportCache: %v", err)
+	}
+	if got.Transport != want.Transport || got.IP != want.IP || !got.CheckedAt.Equal(want.CheckedAt) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSSHReachable(t *testing.T) {
+	serve := func(banner string) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = ln.Close() })
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte(banner))
+				_ = conn.Close()
+			}
+		}()
+		return ln.Addr().String()
+	}
+
+	if !sshReachable(serve("SSH-2.0-OpenSSH_9.6\r\n"), time.Second) {
+		t.Error("SSH server not detected")
+	}
+	if sshReachable(serve("HTTP/1.1 400 Bad Request\r\n"), time.Second) {
+		t.Error("non-SSH server detected as SSH")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	_ = ln.Close()
+	if sshReachable(closed, time.Second) {
+		t.Error("closed port detected as SSH")
+	}
+}
+
+func TestForwardedEnv(t *testing.T) {
+	env := forwardedEnv([]string{
+		"TERM=xterm-kitty",
+		"LANG=en_US.UTF-8",
+		"LC_CTYPE=UTF-8",
+		"COLORTERM=truecolor",
+		"AWS_SECRET_ACCESS_KEY=nope",
+		"PATH=/usr/bin",
+		"TZ=",
+	})
+
+	want := map[string]string{
+		"TERM":      "xterm-kitty",
+		"LANG":      "en_US.UTF-8",
+		"LC_CTYPE":  "UTF-8",
+		"COLORTERM": "truecolor",
+	}
+	if len(env) != len(want) {
+		t.Errorf("forwardedEnv = %v, want %v", env, want)
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("env[%q] = %q, want %q", k, env[k], v)
+		}
+	}
+}
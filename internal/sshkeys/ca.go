@@ -0,0 +1,191 @@
+package sshkeys
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stuffbucket/coop/internal/filelock"
+	"golang.org/x/crypto/ssh"
+)
+
+// clockSkew backdates certificates so a container clock slightly behind
+// the host's still accepts them.
+const clockSkew = 5 * time.Minute
+
+// ContainerPaths are the per-container key and certificates.
+type ContainerPaths struct {
+	Dir                string // ~/.config/coop/ssh/containers/<name>
+	PrivateKey         string // id_ed25519
+	PublicKey          string // id_ed25519.pub
+	Certificate        string // id_ed25519-cert.pub, used by ~/.ssh/config and editors
+	SessionCertificate string // session-cert.pub, used by ssh sessions coop starts
+}
+
+// GetContainerPaths returns the key paths for a container.
+func GetContainerPaths(containerName string) ContainerPaths {
+	dir := filepath.Join(GetPaths().Containers, containerName)
+	return ContainerPaths{
+		Dir:                dir,
+		PrivateKey:         filepath.Join(dir, KeyName),
+		PublicKey:          filepath.Join(dir, KeyName+".pub"),
+		Certificate:        filepath.Join(dir, KeyName+"-cert.pub"),
+		SessionCertificate: filepath.Join(dir, "session-cert.pub"),
+	}
+}
+
+// Principal is the certificate principal a container accepts for the agent
+// user, so a certificate issued for one container is useless on another.
+func Principal(containerName string) string {
+	return "coop-" + containerName
+}
+
+// EnsureCA creates coop's SSH user CA if it doesn't exist and returns its
+// public key in authorized_keys format. Containers trust it through
+// sshd's TrustedUserCAKeys.
+func EnsureCA() (string, error) {
+	paths := GetPaths()
+	ca, err := loadOrCreateKey(paths.CAKey, paths.CAPublicKey, "coop user CA")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey()))), nil
+}
+
+// IssueCert signs a user certificate for a container's key, valid for ttl
+// and only for the container's principal. A session certificate is
+// written to SessionCertificate, otherwise to Certificate. The
+// container's key is generated on first use.
+func IssueCert(containerName string, ttl time.Duration, session bool) (*ssh.Certificate, error) {
+	paths := GetPaths()
+	ca, err := loadOrCreateKey(paths.CAKey, paths.CAPublicKey, "coop user CA")
+	if err != nil {
+		return nil, err
+	}
+	cp := GetContainerPaths(containerName)
+	key, err := loadOrCreateKey(cp.PrivateKey, cp.PublicKey, "coop "+containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             key.PublicKey(),
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{Principal(containerName)},
+		ValidAfter:      uint64(now.Add(-clockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(ttl).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-pty":              "",
+				"permit-port-forwarding":  "",
+				"permit-agent-forwarding": "",
+			},
+		},
+	}
+	kind := "config"
+	if session {
+		kind = "session"
+	}
+	cert.KeyId = fmt.Sprintf("coop:%s:%s:%d", containerName, kind, cert.Serial)
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+
+	path := cp.Certificate
+	if session {
+		path = cp.SessionCertificate
+	}
+	if err := writeFileAtomic(path, ssh.MarshalAuthorizedKey(cert), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// ReadCert reads a certificate written by IssueCert.
+func ReadCert(path string) (*ssh.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", path)
+	}
+	return cert, nil
+}
+
+// RevokeContainerKey adds a container's key to the revoked keys list and
+// deletes it with its certificates. Containers created afterwards reject
+// the key, so a recreated container with the same name does not accept
+// certificates issued to its predecessor. It is not an error if the
+// container has no key.
+func RevokeContainerKey(containerName string) error {
+	cp := GetContainerPaths(containerName)
+	data, err := os.ReadFile(cp.PublicKey)
+	if os.IsNotExist(err) {
+		return os.RemoveAll(cp.Dir)
+	}
+	if err != nil {
+		return err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", cp.PublicKey, err)
+	}
+
+	path := GetPaths().RevokedKeys
+	err = filelock.With(path, func() error {
+		revoked, err := readRevokedKeys(path)
+		if err != nil {
+			return err
+		}
+		line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+		for _, k := range revoked {
+			if k == line {
+				return nil
+			}
+		}
+		revoked = append(revoked, line)
+		return writeFileAtomic(path, []byte(strings.Join(revoked, "\n")+"\n"), 0o600)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke key: %w", err)
+	}
+	return os.RemoveAll(cp.Dir)
+}
+
+// RevokedKeys returns the revoked container keys in authorized_keys format.
+func RevokedKeys() ([]string, error) {
+	return readRevokedKeys(GetPaths().RevokedKeys)
+}
+
+func readRevokedKeys(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,135 @@
+package sshkeys
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestIssueCert(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+
+	caKey, err := EnsureCA()
+	if err != nil {
+		t.Fatalf("EnsureCA: %v", err)
+	}
+	ca, _, _, _, err := ssh.ParseAuthorizedKey([]byte(caKey))
+	if err != nil {
+		t.Fatalf("CA key: %v", err)
+	}
+
+	cert, err := IssueCert("web", time.Hour, true)
+	if err != nil {
+		t.Fatalf("IssueCert: %v", err)
+	}
+	read, err := ReadCert(GetContainerPaths("web").SessionCertificate)
+	if err != nil {
+		t.Fatalf("ReadCert: %v", err)
+	}
+	if read.Serial != cert.Serial || !strings.HasPrefix(read.KeyId, "coop:web:session:") {
+		t.Errorf("read back %q serial %d, want serial %d", read.KeyId, read.Serial, cert.Serial)
+	}
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(ca.Marshal())
+		},
+	}
+	if err := checker.CheckCert(Principal("web"), cert); err != nil {
+		t.Errorf("certificate rejected for its container: %v", err)
+	}
+	if err := checker.CheckCert(Principal("other"), cert); err == nil {
+		t.Error("certificate accepted for another container")
+	}
+
+	// The CA and container key are reused
+	again, err := IssueCert("web", time.Hour, false)
+	if err != nil {
+		t.Fatalf("IssueCert: %v", err)
+	}
+	if string(again.Key.Marshal()) != string(cert.Key.Marshal()) {
+		t.Error("container key changed between certificates")
+	}
+	if again.Serial == cert.Serial {
+		t.Error("certificates share a serial")
+	}
+	if caKey2, _ := EnsureCA(); caKey2 != caKey {
+		t.Error("CA key changed")
+	}
+}
+
+func TestRevokeContainerKey(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+
+	if err := RevokeContainerKey("web"); err != nil {
+		t.Fatalf("RevokeContainerKey without a key: %v", err)
+	}
+	cert, err := IssueCert("web", time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeContainerKey("web"); err != nil {
+		t.Fatalf("RevokeContainerKey: %v", err)
+	}
+
+	revoked, err := RevokedKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert.Key)))
+	if len(revoked) != 1 || revoked[0] != want {
+		t.Errorf("RevokedKeys = %v, want [%s]", revoked, want)
+	}
+	if _, err := os.Stat(GetContainerPaths("web").Dir); !os.IsNotExist(err) {
+		t.Error("container key directory not removed")
+	}
+
+	// A recreated container gets a new key
+	next, err := IssueCert("web", time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(next.Key.Marshal()) == string(cert.Key.Marshal()) {
+		t.Error("revoked key reused")
+	}
+}
+
+func TestEnsureCAConcurrent(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+
+	const n = 32
+	keys := make([]string, n)
+	errs := make([]error, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			keys[i], errs[i] = EnsureCA()
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	for i := range n {
+		if errs[i] != nil {
+			t.Fatalf("EnsureCA: %v", errs[i])
+		}
+		if keys[i] != keys[0] {
+			t.Fatalf("concurrent EnsureCA calls created different CAs:\n%s\n%s", keys[0], keys[i])
+		}
+	}
+	pub, err := os.ReadFile(GetPaths().CAPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(pub)) != keys[0] {
+		t.Errorf("CA public key file does not match the CA")
+	}
+}
@@ -0,0 +1,99 @@
+package sshkeys
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stuffbucket/coop/internal/filelock"
+	"golang.org/x/crypto/ssh"
+)
+
+// PinHostKeys replaces the known_hosts entries for a container with keys,
+// given in authorized_keys format ("ssh-ed25519 AAAA..."). Entries are
+// keyed by container name, which ssh looks up through HostKeyAlias, so a
+// new container reusing an IP never matches an old key.
+func PinHostKeys(containerName string, keys []string) error {
+	var entries []string
+	for _, key := range keys {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			return fmt.Errorf("invalid host key for %s: %w", containerName, err)
+		}
+		entries = append(entries, containerName+" "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))))
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no host keys to pin for %s", containerName)
+	}
+	return updateKnownHosts(containerName, entries)
+}
+
+// UnpinHostKeys removes a container's known_hosts entries.
+func UnpinHostKeys(containerName string) error {
+	if _, err := os.Stat(GetPaths().KnownHosts); os.IsNotExist(err) {
+		return nil
+	}
+	return updateKnownHosts(containerName, nil)
+}
+
+// HasPinnedHostKeys reports whether known_hosts has entries for a container.
+func HasPinnedHostKeys(containerName string) bool {
+	data, err := os.ReadFile(GetPaths().KnownHosts)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if knownHostsEntryFor(line, containerName) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateKnownHosts replaces a container's known_hosts entries with entries.
+func updateKnownHosts(containerName string, entries []string) error {
+	path := GetPaths().KnownHosts
+	return filelock.With(path, func() error {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read known_hosts: %w", err)
+		}
+		updated := replaceKnownHosts(string(data), containerName, entries)
+		if err := writeFileAtomic(path, []byte(updated), 0o600); err != nil {
+			return fmt.Errorf("failed to write known_hosts: %w", err)
+		}
+		return nil
+	})
+}
+
+// replaceKnownHosts drops the lines for host from known_hosts contents and
+// appends entries.
+func replaceKnownHosts(knownHosts, host string, entries []string) string {
+	var lines []string
+	for _, line := range strings.Split(knownHosts, "\n") {
+		if strings.TrimSpace(line) == "" || knownHostsEntryFor(line, host) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, entries...)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// knownHostsEntryFor reports whether a known_hosts line lists host among
+// its comma-separated host names.
+func knownHostsEntryFor(line, host string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+		return false
+	}
+	for _, name := range strings.Split(fields[0], ",") {
+		if name == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package sshkeys
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const testHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl root@old"
+
+func TestReplaceKnownHosts(t *testing.T) {
+	knownHosts := "10.0.0.2 ssh-ed25519 AAAA1\n" +
+		"web ssh-ed25519 AAAA2\n" +
+		"web,10.0.0.3 ssh-rsa AAAA3\n" +
+		"webserver ssh-ed25519 AAAA4\n"
+
+	got := replaceKnownHosts(knownHosts, "web", []string{"web ssh-ed25519 NEW"})
+	want := "10.0.0.2 ssh-ed25519 AAAA1\n" +
+		"webserver ssh-ed25519 AAAA4\n" +
+		"web ssh-ed25519 NEW\n"
+	if got != want {
+		t.Errorf("replaceKnownHosts:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := replaceKnownHosts("web ssh-ed25519 AAAA2\n", "web", nil); got != "" {
+		t.Errorf("removing the only entry left %q", got)
+	}
+}
+
+func TestPinHostKeys(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+
+	if HasPinnedHostKeys("web") {
+		t.Fatal("HasPinnedHostKeys before pinning")
+	}
+	if err := PinHostKeys("web", []string{testHostKey + "\n"}); err != nil {
+		t.Fatalf("PinHostKeys: %v", err)
+	}
+	// Pinning again replaces rather than appends
+	if err := PinHostKeys("web", []string{testHostKey}); err != nil {
+		t.Fatalf("PinHostKeys: %v", err)
+	}
+
+	data, err := os.ReadFile(GetPaths().KnownHosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(testHostKey)
+	if want := "web " + fields[0] + " " + fields[1] + "\n"; string(data) != want {
+		t.Errorf("known_hosts = %q, want %q", data, want)
+	}
+	if !HasPinnedHostKeys("web") {
+		t.Error("HasPinnedHostKeys after pinning")
+	}
+
+	if err := UnpinHostKeys("web"); err != nil {
+		t.Fatalf("UnpinHostKeys: %v", err)
+	}
+	if HasPinnedHostKeys("web") {
+		t.Error("entries left after UnpinHostKeys")
+	}
+
+	if err := PinHostKeys("web", []string{"not a key"}); err == nil {
+		t.Error("PinHostKeys accepted an invalid key")
+	}
+	if err := PinHostKeys("web", nil); err == nil {
+		t.Error("PinHostKeys accepted no keys")
+	}
+}
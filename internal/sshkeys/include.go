@@ -0,0 +1,194 @@
+package sshkeys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// includeComment marks the Include line coop adds to ~/.ssh/config.
+const includeComment = "# Added by coop: container host entries"
+
+// UserConfigFile returns the path of the user's OpenSSH config, ~/.ssh/config.
+func UserConfigFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "config"), nil
+}
+
+// EnsureInclude makes ~/.ssh/config include coop's SSH config so editors
+// and plain ssh can reach containers by name. Returns true if the file was
+// changed.
+func EnsureInclude() (bool, error) {
+	return editUserConfig(func(config, path string) string {
+		updated, _ := addInclude(config, path)
+		return updated
+	})
+}
+
+// RemoveInclude removes coop's Include line from ~/.ssh/config. Returns
+// true if the file was changed.
+func RemoveInclude() (bool, error) {
+	return editUserConfig(stripInclude)
+}
+
+// HasInclude reports whether ~/.ssh/config includes coop's SSH config.
+func HasInclude() bool {
+	userConfig, err := UserConfigFile()
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(userConfig)
+	return err == nil && hasInclude(string(data), GetPaths().ConfigFile)
+}
+
+// editUserConfig rewrites ~/.ssh/config through edit, which receives the
+// current contents and the path of coop's config.
+func editUserConfig(edit func(config, path string) string) (bool, error) {
+	userConfig, err := UserConfigFile()
+	if err != nil {
+		return false, err
+	}
+	coopConfig := GetPaths().ConfigFile
+	// Dotfile managers often symlink the config; update the target
+	if resolved, err := filepath.EvalSymlinks(userConfig); err == nil {
+		userConfig = resolved
+	}
+
+	data, err := os.ReadFile(userConfig)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %w", userConfig, err)
+	}
+
+	updated := edit(string(data), coopConfig)
+	if updated == string(data) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(userConfig), 0o700); err != nil {
+		return false, fmt.Errorf("failed to create ssh dir: %w", err)
+	}
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(userConfig); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := writeFileAtomic(userConfig, []byte(updated), mode); err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", userConfig, err)
+	}
+	return true, nil
+}
+
+// addInclude returns config with an Include of path added, unless it is
+// already included. The Include goes first: after a Host line it would
+// only apply to that host, so any such misplaced copy is removed.
+func addInclude(config, path string) (string, bool) {
+	if hasInclude(config, path) {
+		return config, false
+	}
+	config = stripInclude(config, path)
+	line := includeComment + "\nInclude " + path + "\n"
+	if strings.TrimSpace(config) == "" {
+		return line, true
+	}
+	return line + "\n" + config, true
+}
+
+// stripInclude removes path from every Include line in config, dropping
+// lines left with nothing to include along with coop's comment.
+func stripInclude(config, path string) string {
+	lines := strings.Split(config, "\n")
+	result := make([]string, 0, len(lines))
+	removed := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == includeComment {
+			removed = true
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.ToLower(fields[0]) != "include" {
+			result = append(result, line)
+			continue
+		}
+		kept := fields[:1]
+		for _, f := range fields[1:] {
+			if sameFile(f, path) {
+				removed = true
+				continue
+			}
+			kept = append(kept, f)
+		}
+		switch {
+		case len(kept) == len(fields):
+			result = append(result, line)
+		case len(kept) > 1:
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			result = append(result, indent+strings.Join(kept, " "))
+		}
+	}
+	if !removed {
+		return config
+	}
+	// Drop the blank line that separated coop's Include from the rest
+	for len(result) > 0 && strings.TrimSpace(result[0]) == "" {
+		result = result[1:]
+	}
+	return strings.Join(result, "\n")
+}
+
+// hasInclude reports whether config has a top-level Include of path.
+func hasInclude(config, path string) bool {
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		keyword := strings.ToLower(fields[0])
+		if keyword == "host" || keyword == "match" {
+			return false
+		}
+		if keyword != "include" {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if sameFile(f, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameFile reports whether an Include argument names path, expanding ~/.
+func sameFile(arg, path string) bool {
+	if strings.HasPrefix(arg, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			arg = filepath.Join(home, arg[2:])
+		}
+	}
+	return arg == path
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,101 @@
+package sshkeys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddInclude(t *testing.T) {
+	const path = "/home/user/.config/coop/ssh/config"
+
+	tests := []struct {
+		name    string
+		config  string
+		changed bool
+		rest    string // Expected config after coop's Include
+	}{
+		{"empty", "", true, ""},
+		{"existing hosts", "Host github.com\n    User git\n", true, "Host github.com\n    User git\n"},
+		{"already included", "Include " + path + "\n\nHost x\n", false, ""},
+		{"included among others", "Include ~/.orbstack/ssh/config " + path + "\n", false, ""},
+		{"only inside a host block", "Host x\n    Include " + path + "\n", true, "Host x\n"},
+		{"shared with another path", "Host x\n    Include a " + path + "\n", true, "Host x\n    Include a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := addInclude(tt.config, path)
+			if changed != tt.changed {
+				t.Fatalf("changed = %v, want %v", changed, tt.changed)
+			}
+			if !changed {
+				if got != tt.config {
+					t.Errorf("unchanged config was modified: %q", got)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, includeComment+"\nInclude "+path+"\n") {
+				t.Errorf("Include not at the top:\n%s", got)
+			}
+			if !strings.HasSuffix(got, tt.rest) {
+				t.Errorf("original config not preserved:\n%s", got)
+			}
+			if _, again := addInclude(got, path); again {
+				t.Error("addInclude is not idempotent")
+			}
+		})
+	}
+}
+
+func TestStripInclude(t *testing.T) {
+	const path = "/home/user/.config/coop/ssh/config"
+
+	added, _ := addInclude("Host github.com\n    User git\n", path)
+	if got := stripInclude(added, path); got != "Host github.com\n    User git\n" {
+		t.Errorf("stripInclude did not restore the original config:\n%q", got)
+	}
+
+	other := "Include ~/.orbstack/ssh/config\n"
+	if got := stripInclude(other, path); got != other {
+		t.Errorf("unrelated config was modified: %q", got)
+	}
+}
+
+func TestHasIncludeTilde(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	path := filepath.Join(home, ".config", "coop", "ssh", "config")
+	if !hasInclude("Include ~/.config/coop/ssh/config\n", path) {
+		t.Error("~/ form of the path not recognized")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte("new"), 0o600); err != nil {
+		t.Fatalf("writeFileAtomic: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new" {
+		t.Errorf("content = %q", data)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/stuffbucket/coop/internal/config"
+	"github.com/stuffbucket/coop/internal/filelock"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -22,11 +23,15 @@ const (
 
 // Paths returns the paths to the SSH key files.
 type Paths struct {
-	SSHDir     string // ~/.config/coop/ssh
-	PrivateKey string // ~/.config/coop/ssh/id_ed25519
-	PublicKey  string // ~/.config/coop/ssh/id_ed25519.pub
-	ConfigFile string // ~/.config/coop/ssh/config
-	KnownHosts string // ~/.config/coop/ssh/known_hosts
+	SSHDir      string // ~/.config/coop/ssh
+	PrivateKey  string // ~/.config/coop/ssh/id_ed25519 (shared key of containers created before the CA)
+	PublicKey   string // ~/.config/coop/ssh/id_ed25519.pub
+	ConfigFile  string // ~/.config/coop/ssh/config
+	KnownHosts  string // ~/.config/coop/ssh/known_hosts
+	CAKey       string // ~/.config/coop/ssh/ca
+	CAPublicKey string // ~/.config/coop/ssh/ca.pub
+	RevokedKeys string // ~/.config/coop/ssh/revoked_keys
+	Containers  string // ~/.config/coop/ssh/containers
 }
 
 // GetPaths returns the paths for coop SSH files.
@@ -39,62 +44,81 @@ func GetPaths() Paths {
 		PublicKey:  filepath.Join(dirs.SSH, KeyName+".pub"),
 		ConfigFile: filepath.Join(dirs.SSH, "config"),
 		KnownHosts: filepath.Join(dirs.SSH, "known_hosts"),
+
+		CAKey:       filepath.Join(dirs.SSH, "ca"),
+		CAPublicKey: filepath.Join(dirs.SSH, "ca.pub"),
+		RevokedKeys: filepath.Join(dirs.SSH, "revoked_keys"),
+		Containers:  filepath.Join(dirs.SSH, "containers"),
 	}
 }
 
-// EnsureKeys creates SSH keys if they don't exist, returns the public key.
-func EnsureKeys() (string, error) {
-	paths := GetPaths()
+// loadOrCreateKey reads an ed25519 private key, generating the keypair
+// if it does not exist yet. Generation holds a lock on the key, so
+// concurrent callers agree on one keypair, and the private key is written
+// last and atomically, so a reader never sees a partial one.
+func loadOrCreateKey(privPath, pubPath, comment string) (ssh.Signer, error) {
+	if signer, err := readKey(privPath); err == nil || !os.IsNotExist(err) {
+		return signer, err
+	}
 
 	// Create directory with restricted permissions
-	if err := os.MkdirAll(paths.SSHDir, 0700); err != nil {
-		return "", fmt.Errorf("failed to create ssh directory: %w", err)
+	if err := os.MkdirAll(filepath.Dir(privPath), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create ssh directory: %w", err)
 	}
 
-	// Check if keys already exist
-	if _, err := os.Stat(paths.PrivateKey); err == nil {
-		// Keys exist, read public key
-		pubKeyData, err := os.ReadFile(paths.PublicKey)
+	var signer ssh.Signer
+	err := filelock.With(privPath, func() error {
+		// Another process may have created it while we waited
+		var err error
+		if signer, err = readKey(privPath); err == nil || !os.IsNotExist(err) {
+			return err
+		}
+
+		// Generate new ed25519 keypair
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
 		if err != nil {
-			return "", fmt.Errorf("failed to read public key: %w", err)
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		signer, err = ssh.NewSignerFromKey(privKey)
+		if err != nil {
+			return fmt.Errorf("failed to create ssh signer: %w", err)
 		}
-		return string(pubKeyData), nil
-	}
 
-	// Generate new ed25519 keypair
-	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate key: %w", err)
-	}
+		// Marshal private key to PEM
+		privKeyPEM, err := ssh.MarshalPrivateKey(privKey, comment)
+		if err != nil {
+			return fmt.Errorf("failed to marshal private key: %w", err)
+		}
 
-	// Convert to SSH format
-	sshPubKey, err := ssh.NewPublicKey(pubKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to create ssh public key: %w", err)
-	}
+		// Write public key
+		if err := writeFileAtomic(pubPath, ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+			return fmt.Errorf("failed to write public key: %w", err)
+		}
 
-	// Marshal private key to PEM
-	privKeyPEM, err := ssh.MarshalPrivateKey(privKey, "coop agent sandbox key")
+		// Write private key with restricted permissions
+		if err := writeFileAtomic(privPath, pem.EncodeToMemory(privKeyPEM), 0600); err != nil {
+			return fmt.Errorf("failed to write private key: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal private key: %w", err)
+		return nil, err
 	}
+	return signer, nil
+}
 
-	privKeyBytes := pem.EncodeToMemory(privKeyPEM)
-
-	// Write private key with restricted permissions
-	if err := os.WriteFile(paths.PrivateKey, privKeyBytes, 0600); err != nil {
-		return "", fmt.Errorf("failed to write private key: %w", err)
+// readKey reads and parses a private key. The error satisfies
+// os.IsNotExist if the key does not exist.
+func readKey(privPath string) (ssh.Signer, error) {
+	data, err := os.ReadFile(privPath)
+	if err != nil {
+		return nil, err
 	}
-
-	// Write public key
-	pubKeyStr := string(ssh.MarshalAuthorizedKey(sshPubKey))
-	if err := os.WriteFile(paths.PublicKey, []byte(pubKeyStr), 0644); err != nil {
-		return "", fmt.Errorf("failed to write public key: %w", err)
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", privPath, err)
 	}
-
-	fmt.Printf("Generated new SSH keypair at %s\n", paths.SSHDir)
-
-	return pubKeyStr, nil
+	return signer, nil
 }
 
 // GetPublicKey returns the public key if it exists, empty string otherwise.
@@ -109,88 +133,177 @@ func GetPublicKey() string {
 	return string(data)
 }
 
-// SSHCommand returns the SSH command with the correct identity file.
-func SSHCommand(user, host string) string {
+// SSHCommand returns the SSH command with the container's key and
+// certificate. The host key is checked against the keys pinned for
+// containerName.
+func SSHCommand(containerName, user, host string) string {
 	paths := GetPaths()
+	cp := GetContainerPaths(containerName)
 
-	return fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=%s %s@%s",
-		paths.PrivateKey, paths.KnownHosts, user, host)
+	command := fmt.Sprintf("ssh -i %s -o CertificateFile=%s", cp.PrivateKey, cp.Certificate)
+	if legacyKeyExists() {
+		command += " -i " + paths.PrivateKey
+	}
+	return command + fmt.Sprintf(" -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=%s -o HostKeyAlias=%s %s@%s",
+		paths.KnownHosts, containerName, user, host)
 }
 
-// SSHArgs returns the SSH arguments as a slice for use with exec.
-func SSHArgs(user, host string) []string {
+// SSHArgs returns the SSH arguments as a slice for use with exec. They
+// authenticate with the container's session certificate (see IssueCert).
+// The host key is checked against the keys pinned for containerName.
+func SSHArgs(containerName, user, host string) []string {
 	paths := GetPaths()
+	cp := GetContainerPaths(containerName)
 
-	return []string{
-		"-i", paths.PrivateKey,
-		"-o", "StrictHostKeyChecking=accept-new",
-		"-o", "UserKnownHostsFile=" + paths.KnownHosts,
-		fmt.Sprintf("%s@%s", user, host),
+	args := []string{"-i", cp.PrivateKey, "-o", "CertificateFile=" + cp.SessionCertificate}
+	if legacyKeyExists() {
+		args = append(args, "-i", paths.PrivateKey)
 	}
+	return append(args,
+		"-o", "IdentitiesOnly=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "UserKnownHostsFile="+paths.KnownHosts,
+		"-o", "HostKeyAlias="+containerName,
+		fmt.Sprintf("%s@%s", user, host),
+	)
+}
+
+// legacyKeyExists reports whether the shared key from before the CA
+// exists. Containers created with it only authorize that key.
+func legacyKeyExists() bool {
+	_, err := os.Stat(GetPaths().PrivateKey)
+	return err == nil
 }
 
 // WriteSSHConfig writes/updates the SSH config for a container.
 // If an entry for the container already exists, it is replaced.
+// proxyArgs are the backend's ssh arguments for reaching container IPs
+// (see ProxyConfigLines); nil when IPs are directly routable.
 // Uses file locking to prevent race conditions with concurrent operations.
-func WriteSSHConfig(containerName, ip string) error {
-	paths := GetPaths()
-
-	// Ensure SSH dir exists
-	if err := os.MkdirAll(paths.SSHDir, 0o700); err != nil {
-		return fmt.Errorf("failed to create ssh dir: %w", err)
-	}
+func WriteSSHConfig(containerName, ip string, proxyArgs []string) error {
+	return updateSSHConfig(func(config string) string {
+		filteredLines := removeHostBlock(config, containerName)
+		hostEntry := hostBlock(Host{Name: containerName, IP: ip}, proxyArgs)
+		if len(filteredLines) > 0 {
+			return strings.Join(filteredLines, "\n") + "\n\n" + hostEntry
+		}
+		return hostEntry
+	})
+}
 
-	// Use file locking to prevent races
-	lockPath := paths.ConfigFile + ".lock"
-	lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to create lock file: %w", err)
+// RemoveSSHConfig removes a container's Host block from the SSH config.
+// It is not an error if the container has no entry.
+func RemoveSSHConfig(containerName string) error {
+	if _, err := os.Stat(GetPaths().ConfigFile); os.IsNotExist(err) {
+		return nil
 	}
-	defer func() { _ = lock.Close() }()
-	defer func() { _ = os.Remove(lockPath) }()
+	return updateSSHConfig(func(config string) string {
+		lines := removeHostBlock(config, containerName)
+		if len(lines) == 0 {
+			return ""
+		}
+		return strings.Join(lines, "\n") + "\n"
+	})
+}
 
-	// Acquire exclusive lock
-	if err := lockFile(lock); err != nil {
-		return fmt.Errorf("failed to acquire lock: %w", err)
-	}
-	defer func() { _ = unlockFile(lock) }()
+// Host is a container entry in coop's SSH config.
+type Host struct {
+	Name string
+	IP   string
+}
 
-	// Read existing config and filter out old entry for this container
-	var filteredLines []string
-	if data, err := os.ReadFile(paths.ConfigFile); err == nil {
-		filteredLines = removeHostBlock(string(data), containerName)
-	}
+// RewriteSSHConfig replaces the SSH config with entries for exactly hosts,
+// dropping blocks for containers that no longer exist and refreshing the
+// backend's proxy lines on the rest.
+func RewriteSSHConfig(hosts []Host, proxyArgs []string) error {
+	return updateSSHConfig(func(string) string {
+		blocks := make([]string, len(hosts))
+		for i, h := range hosts {
+			blocks[i] = hostBlock(h, proxyArgs)
+		}
+		return strings.Join(blocks, "\n")
+	})
+}
 
-	// Build new host entry
-	hostEntry := fmt.Sprintf(`# Coop agent container: %s
+// hostBlock renders the config entry for one container.
+func hostBlock(h Host, proxyArgs []string) string {
+	paths := GetPaths()
+	cp := GetContainerPaths(h.Name)
+	entry := fmt.Sprintf(`# Coop agent container: %s
 Host %s
     HostName %s
     User agent
     IdentityFile %s
-    StrictHostKeyChecking accept-new
+    CertificateFile %s
+`, h.Name, h.Name, h.IP, cp.PrivateKey, cp.Certificate)
+	if legacyKeyExists() {
+		entry += "    IdentityFile " + paths.PrivateKey + "\n"
+	}
+	entry += fmt.Sprintf(`    IdentitiesOnly yes
+    StrictHostKeyChecking yes
     UserKnownHostsFile %s
-`, containerName, containerName, ip, paths.PrivateKey, paths.KnownHosts)
-
-	// Combine filtered config with new entry
-	var newConfig string
-	if len(filteredLines) > 0 {
-		newConfig = strings.Join(filteredLines, "\n") + "\n\n" + hostEntry
-	} else {
-		newConfig = hostEntry
+    HostKeyAlias %s
+`, paths.KnownHosts, h.Name)
+	for _, line := range ProxyConfigLines(proxyArgs) {
+		entry += "    " + line + "\n"
 	}
+	return entry
+}
 
-	// Ensure known_hosts exists with safe perms
-	if _, err := os.Stat(paths.KnownHosts); os.IsNotExist(err) {
-		if err := os.WriteFile(paths.KnownHosts, []byte{}, 0o600); err != nil {
-			return fmt.Errorf("failed to init known_hosts: %w", err)
+// updateSSHConfig rewrites the SSH config through update while holding
+// the config lock.
+func updateSSHConfig(update func(config string) string) error {
+	paths := GetPaths()
+	return filelock.With(paths.ConfigFile, func() error {
+		var config string
+		if data, err := os.ReadFile(paths.ConfigFile); err == nil {
+			config = string(data)
 		}
-	}
 
-	if err := os.WriteFile(paths.ConfigFile, []byte(newConfig), 0600); err != nil {
-		return fmt.Errorf("failed to write ssh config: %w", err)
-	}
+		// Ensure known_hosts exists with safe perms
+		if _, err := os.Stat(paths.KnownHosts); os.IsNotExist(err) {
+			if err := os.WriteFile(paths.KnownHosts, []byte{}, 0o600); err != nil {
+				return fmt.Errorf("failed to init known_hosts: %w", err)
+			}
+		}
 
-	return nil
+		if err := os.WriteFile(paths.ConfigFile, []byte(update(config)), 0600); err != nil {
+			return fmt.Errorf("failed to write ssh config: %w", err)
+		}
+		return nil
+	})
+}
+
+// ProxyConfigLines converts ssh command-line proxy arguments, as returned
+// by a backend's SSHProxyArgs, into ssh_config lines. A jump host defined
+// in a separate config file (-F file -J host) becomes a ProxyCommand so
+// the entry works without that file being included.
+func ProxyConfigLines(args []string) []string {
+	var lines []string
+	var configFile string
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			break
+		}
+		switch args[i] {
+		case "-F":
+			configFile = args[i+1]
+		case "-J":
+			if configFile != "" {
+				lines = append(lines, fmt.Sprintf("ProxyCommand ssh -F %s -W %%h:%%p %s", configFile, args[i+1]))
+			} else {
+				lines = append(lines, "ProxyJump "+args[i+1])
+			}
+		case "-o":
+			if key, value, ok := strings.Cut(args[i+1], "="); ok {
+				lines = append(lines, key+" "+value)
+			}
+		default:
+			continue
+		}
+		i++
+	}
+	return lines
 }
 
 // removeHostBlock removes a Host block and its preceding comment from the config.
@@ -218,21 +331,21 @@ func removeHostBlock(config, hostName string) []string {
 			skipUntilNextHost = false
 		}
 
-		if skipUntilNextHost {
+		// Track comments that might belong to a host block; one also
+		// ends the block being skipped
+		if strings.HasPrefix(trimmed, "# Coop agent container:") {
+			skipUntilNextHost = false
+			pendingComment = line
 			continue
 		}
 
-		// Track comments that might belong to a host block
-		if strings.HasPrefix(trimmed, "# Coop agent container:") {
-			pendingComment = line
+		if skipUntilNextHost {
 			continue
 		}
 
-		// If we have a pending comment and this isn't a Host line, keep the comment
+		// The pending comment belongs to whatever follows; keep it
 		if pendingComment != "" {
-			if !strings.HasPrefix(trimmed, "Host ") {
-				result = append(result, pendingComment)
-			}
+			result = append(result, pendingComment)
 			pendingComment = ""
 		}
 
@@ -0,0 +1,98 @@
+package sshkeys
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProxyConfigLines(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"none", nil, nil},
+		{
+			"jump host from config file",
+			[]string{"-F", "/tmp/br/ssh_config", "-J", "bladerunner"},
+			[]string{"ProxyCommand ssh -F /tmp/br/ssh_config -W %h:%p bladerunner"},
+		},
+		{
+			"plain jump host",
+			[]string{"-J", "vm"},
+			[]string{"ProxyJump vm"},
+		},
+		{
+			"proxy command option",
+			[]string{"-o", "ProxyCommand=ssh -p 6022 incus@127.0.0.1 -W %h:%p"},
+			[]string{"ProxyCommand ssh -p 6022 incus@127.0.0.1 -W %h:%p"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProxyConfigLines(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProxyConfigLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveHostBlock(t *testing.T) {
+	config := `# Coop agent container: a
+Host a
+    HostName 10.0.0.2
+
+# Coop agent container: b
+Host b
+    HostName 10.0.0.3
+
+# Coop agent container: c
+Host c
+    HostName 10.0.0.4
+`
+	got := strings.Join(removeHostBlock(config, "b"), "\n")
+	want := `# Coop agent container: a
+Host a
+    HostName 10.0.0.2
+
+# Coop agent container: c
+Host c
+    HostName 10.0.0.4`
+	if got != want {
+		t.Errorf("removeHostBlock:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := removeHostBlock(config, "missing"); strings.Join(got, "\n") != strings.TrimRight(config, "\n") {
+		t.Errorf("config changed when removing a missing host:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestRewriteSSHConfig(t *testing.T) {
+	t.Setenv("COOP_CONFIG_DIR", t.TempDir())
+
+	if err := WriteSSHConfig("stale", "10.0.0.9", nil); err != nil {
+		t.Fatal(err)
+	}
+	hosts := []Host{{Name: "a", IP: "10.0.0.2"}, {Name: "b", IP: "10.0.0.3"}}
+	if err := RewriteSSHConfig(hosts, []string{"-J", "jump"}); err != nil {
+		t.Fatalf("RewriteSSHConfig: %v", err)
+	}
+	if err := RemoveSSHConfig("b"); err != nil {
+		t.Fatalf("RemoveSSHConfig: %v", err)
+	}
+
+	data, err := os.ReadFile(GetPaths().ConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := string(data)
+	if strings.Contains(config, "stale") || strings.Contains(config, "Host b") {
+		t.Errorf("removed hosts still present:\n%s", config)
+	}
+	if !strings.Contains(config, "Host a\n    HostName 10.0.0.2") || !strings.Contains(config, "ProxyJump jump") {
+		t.Errorf("expected host entry missing:\n%s", config)
+	}
+}
@@ -33,18 +33,27 @@ type Instance struct {
 	// CreatedAt is when the instance was created
 	CreatedAt time.Time `json:"created_at"`
 
+	// Security is the security tier the instance was created with
+	Security string `json:"security,omitempty"`
+
 	// Packages installed via package managers
 	Packages Packages `json:"packages,omitempty"`
 
 	// Mounts attached to the instance
 	Mounts []Mount `json:"mounts,omitempty"`
 
+	// Exposes are host services reachable from inside the instance
+	Exposes []Expose `json:"exposes,omitempty"`
+
 	// Env variables set on the instance
 	Env map[string]string `json:"env,omitempty"`
 
 	// CurrentSnapshot is the Incus snapshot name for current state (if any)
 	CurrentSnapshot string `json:"current_snapshot,omitempty"`
 
+	// LastExec is the most recent tracked command (full history is in git)
+	LastExec *ExecRecord `json:"last_exec,omitempty"`
+
 	// UpdatedAt is when state.json was last modified
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -140,6 +149,28 @@ type Mount struct {
 	Readonly bool   `json:"readonly"`
 }
 
+// Expose tracks a host service made reachable inside the instance.
+type Expose struct {
+	HostAddr      string `json:"host_addr"`
+	HostPort      int    `json:"host_port"`
+	ContainerPort int    `json:"container_port"`
+	Forced        bool   `json:"forced,omitempty"` // Protected port authorized with --force
+}
+
+// ExecRecord tracks a command run inside the instance.
+type ExecRecord struct {
+	Command    []string  `json:"command"`
+	ExitCode   int       `json:"exit_code"`
+	DurationMS int64     `json:"duration_ms"`
+	Checkpoint string    `json:"checkpoint,omitempty"` // Snapshot taken before running
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// Duration returns how long the command ran.
+func (r ExecRecord) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
 // NewInstance creates state for a new Incus instance.
 func NewInstance(name, baseImage string) *Instance {
 	now := time.Now()
@@ -257,6 +288,24 @@ func (inst *Instance) RemoveMount(name string) {
 	inst.Mounts = kept
 }
 
+// AddExpose records an exposed host service.
+func (inst *Instance) AddExpose(e Expose) {
+	// Replace existing expose on the same container port
+	inst.RemoveExpose(e.ContainerPort)
+	inst.Exposes = append(inst.Exposes, e)
+}
+
+// RemoveExpose removes an exposed host service by container port.
+func (inst *Instance) RemoveExpose(containerPort int) {
+	var kept []Expose
+	for _, e := range inst.Exposes {
+		if e.ContainerPort != containerPort {
+			kept = append(kept, e)
+		}
+	}
+	inst.Exposes = kept
+}
+
 // SetCurrentSnapshot updates the current snapshot name.
 func (inst *Instance) SetCurrentSnapshot(snapshotName string) {
 	inst.CurrentSnapshot = snapshotName
@@ -3,6 +3,7 @@ package state
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 )
 
@@ -69,6 +70,18 @@ func (t *Tracker) RecordPackageInstall(manager string, packages []string) (strin
 	return t.repo.Commit(fmt.Sprintf("install %s: %v", manager, packages))
 }
 
+// RecordSecurity records the instance's security tier.
+func (t *Tracker) RecordSecurity(tier string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.instance.Security = tier
+	if err := t.instance.Save(t.stateDir); err != nil {
+		return "", err
+	}
+	return t.repo.Commit(fmt.Sprintf("security: %s", tier))
+}
+
 // RecordMount records a mount being added.
 func (t *Tracker) RecordMount(name, source, path string, readonly bool) (string, error) {
 	t.mu.Lock()
@@ -97,6 +110,34 @@ func (t *Tracker) RecordUnmount(name string) (string, error) {
 	return t.repo.Commit(fmt.Sprintf("unmount %s", name))
 }
 
+// RecordExpose records a host service being exposed to the instance.
+func (t *Tracker) RecordExpose(e Expose) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.instance.AddExpose(e)
+	if err := t.instance.Save(t.stateDir); err != nil {
+		return "", err
+	}
+	msg := fmt.Sprintf("expose %s:%d -> %d", e.HostAddr, e.HostPort, e.ContainerPort)
+	if e.Forced {
+		msg += " (forced)"
+	}
+	return t.repo.Commit(msg)
+}
+
+// RecordUnexpose records an exposed host service being removed.
+func (t *Tracker) RecordUnexpose(containerPort int) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.instance.RemoveExpose(containerPort)
+	if err := t.instance.Save(t.stateDir); err != nil {
+		return "", err
+	}
+	return t.repo.Commit(fmt.Sprintf("unexpose %d", containerPort))
+}
+
 // RecordSnapshot records that an Incus snapshot was created.
 // Links the snapshot name to the current git commit.
 // Returns the commit hash.
@@ -128,6 +169,50 @@ func (t *Tracker) RecordSnapshot(snapshotName, note string) (string, error) {
 	return hash, nil
 }
 
+// RecordExec records a command run inside the instance.
+// The commit message carries the command line, exit code and duration.
+func (t *Tracker) RecordExec(rec ExecRecord) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.instance.LastExec = &rec
+	if err := t.instance.Save(t.stateDir); err != nil {
+		return "", err
+	}
+
+	msg := fmt.Sprintf("exec: %s (exit %d, %s)", strings.Join(rec.Command, " "), rec.ExitCode, rec.Duration())
+	if rec.Checkpoint != "" {
+		msg += fmt.Sprintf(" [checkpoint: %s]", rec.Checkpoint)
+	}
+	return t.repo.Commit(msg)
+}
+
+// RecordRestore records that the instance was restored to a snapshot.
+// Unlike UndoToSnapshot, history after the snapshot is kept so the
+// reason for rolling back stays visible.
+func (t *Tracker) RecordRestore(snapshotName, note string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	msg := fmt.Sprintf("restore: %s", snapshotName)
+	if note != "" {
+		msg += " - " + note
+	}
+
+	t.instance.SetCurrentSnapshot(snapshotName)
+	if err := t.instance.Save(t.stateDir); err != nil {
+		return "", err
+	}
+	return t.repo.Commit(msg)
+}
+
+// HasSnapshot returns true if a snapshot has been recorded by this tracker.
+func (t *Tracker) HasSnapshot(snapshotName string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.links.CommitFor(snapshotName) != ""
+}
+
 // RecordEnv records environment variable changes.
 func (t *Tracker) RecordEnv(key, value string) (string, error) {
 	t.mu.Lock()
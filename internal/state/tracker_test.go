@@ -3,6 +3,7 @@ package state
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -71,6 +72,34 @@ func TestTrackerPackages(t *testing.T) {
 	}
 }
 
+func TestTrackerSecurity(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tracker, err := NewTracker(tmpDir, "sec-test", "ubuntu:24.04")
+	if err != nil {
+		t.Fatalf("NewTracker failed: %v", err)
+	}
+	if _, err := tracker.RecordSecurity("strict"); err != nil {
+		t.Fatalf("RecordSecurity failed: %v", err)
+	}
+
+	loaded, err := Load(tmpDir, "sec-test")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Security != "strict" {
+		t.Errorf("Security = %q, want %q", loaded.Security, "strict")
+	}
+
+	history, err := tracker.History(1)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(history) != 1 || history[0].Message != "security: strict" {
+		t.Errorf("History = %+v, want the security commit", history)
+	}
+}
+
 func TestTrackerMounts(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -103,6 +132,40 @@ func TestTrackerMounts(t *testing.T) {
 	}
 }
 
+func TestTrackerExposes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tracker, err := NewTracker(tmpDir, "expose-test", "ubuntu:24.04")
+	if err != nil {
+		t.Fatalf("NewTracker failed: %v", err)
+	}
+
+	e := Expose{HostAddr: "127.0.0.1", HostPort: 5432, ContainerPort: 5432}
+	if _, err := tracker.RecordExpose(e); err != nil {
+		t.Fatalf("RecordExpose failed: %v", err)
+	}
+
+	// Re-exposing the same container port replaces the entry
+	e.HostPort = 15432
+	if _, err := tracker.RecordExpose(e); err != nil {
+		t.Fatalf("RecordExpose failed: %v", err)
+	}
+
+	inst := tracker.Instance()
+	if len(inst.Exposes) != 1 || inst.Exposes[0].HostPort != 15432 {
+		t.Fatalf("Exposes = %+v, want one entry for host port 15432", inst.Exposes)
+	}
+
+	if _, err := tracker.RecordUnexpose(5432); err != nil {
+		t.Fatalf("RecordUnexpose failed: %v", err)
+	}
+
+	inst = tracker.Instance()
+	if len(inst.Exposes) != 0 {
+		t.Errorf("Exposes after unexpose = %d, want 0", len(inst.Exposes))
+	}
+}
+
 func TestTrackerSnapshots(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -126,6 +189,13 @@ func TestTrackerSnapshots(t *testing.T) {
 	if inst.CurrentSnapshot != "checkpoint1" {
 		t.Errorf("CurrentSnapshot = %q, want %q", inst.CurrentSnapshot, "checkpoint1")
 	}
+
+	if !tracker.HasSnapshot("checkpoint1") {
+		t.Error("HasSnapshot(checkpoint1) = false, want true")
+	}
+	if tracker.HasSnapshot("checkpoint2") {
+		t.Error("HasSnapshot(checkpoint2) = true, want false")
+	}
 }
 
 func TestTrackerSnapshotLinkSurvivesReload(t *testing.T) {
@@ -237,6 +307,55 @@ func TestTrackerUndo(t *testing.T) {
 	// The caller would now run: incus restore undo-test good-state
 }
 
+func TestTrackerExecAndRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tracker, err := NewTracker(tmpDir, "exec-test", "ubuntu:24.04")
+	if err != nil {
+		t.Fatalf("NewTracker failed: %v", err)
+	}
+
+	if _, err := tracker.RecordSnapshot("pre-exec", "checkpoint"); err != nil {
+		t.Fatalf("RecordSnapshot failed: %v", err)
+	}
+
+	rec := ExecRecord{
+		Command:    []string{"apt-get", "install", "-y", "foo"},
+		ExitCode:   100,
+		DurationMS: 1500,
+		Checkpoint: "pre-exec",
+	}
+	if _, err := tracker.RecordExec(rec); err != nil {
+		t.Fatalf("RecordExec failed: %v", err)
+	}
+
+	inst := tracker.Instance()
+	if inst.LastExec == nil || inst.LastExec.ExitCode != 100 {
+		t.Fatalf("LastExec = %+v, want exit code 100", inst.LastExec)
+	}
+
+	if _, err := tracker.RecordRestore("pre-exec", "exec failed"); err != nil {
+		t.Fatalf("RecordRestore failed: %v", err)
+	}
+
+	history, err := tracker.History(3)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("History has %d commits, want 3", len(history))
+	}
+
+	// Newest first: restore, exec, snapshot - the failed exec stays visible
+	if !strings.HasPrefix(history[0].Message, "restore: pre-exec") {
+		t.Errorf("history[0] = %q, want restore commit", history[0].Message)
+	}
+	want := "exec: apt-get install -y foo (exit 100, 1.5s) [checkpoint: pre-exec]"
+	if history[1].Message != want {
+		t.Errorf("history[1] = %q, want %q", history[1].Message, want)
+	}
+}
+
 func TestTrackerUndoRemovesLaterCommits(t *testing.T) {
 	tmpDir := t.TempDir()
 
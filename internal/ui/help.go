@@ -254,8 +254,18 @@ func NewCommandColumnsProvider() *CommandColumnsProvider {
 			{Title: "Access", Entries: []HelpEntry{
 				{"shell", "Interactive shell"},
 				{"ssh", "Print SSH command"},
+				{"code", "Open in editor"},
+				{"ssh-config", "Sync SSH config"},
+				{"ssh-cert", "Show SSH certificates"},
 				{"exec", "Run command"},
+				{"jobs", "Background jobs"},
+				{"attach", "Attach to job"},
+				{"sessions", "Recorded sessions"},
 				{"mount", "Manage mounts"},
+				{"cp", "Copy files"},
+				{"sync", "Sync folders"},
+				{"forward", "Forward ports"},
+				{"expose", "Expose host service"},
 			}},
 			{Title: "State & Images", Entries: []HelpEntry{
 				{"snapshot", "Manage snapshots"},
@@ -263,6 +273,9 @@ func NewCommandColumnsProvider() *CommandColumnsProvider {
 				{"image", "Manage images"},
 			}},
 			{Title: "Infrastructure", Entries: []HelpEntry{
+				{"seatbelt", "Protected path policy"},
+				{"audit", "Audit log"},
+				{"approvals", "Agent requests"},
 				{"doctor", "Check setup health"},
 				{"vm", "VM backend (macOS)"},
 				{"config", "Show config"},
@@ -0,0 +1,50 @@
+package ui
+
+import (
+	"image/color"
+	"strings"
+
+	"github.com/boombuler/barcode/qr"
+)
+
+// qrQuietZone is the blank border, in modules, scanners need around a code.
+const qrQuietZone = 2
+
+// QRCode renders content as a QR code for the terminal, two modules per
+// line using half blocks. Light modules are drawn in the foreground color
+// so the code scans on the usual light-on-dark terminal.
+func QRCode(content string) (string, error) {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return "", err
+	}
+
+	size := code.Bounds().Dx()
+	light := func(x, y int) bool {
+		x, y = x-qrQuietZone, y-qrQuietZone
+		if x < 0 || y < 0 || x >= size || y >= size {
+			return true
+		}
+		return code.At(x, y) == color.White
+	}
+
+	var sb strings.Builder
+	total := size + 2*qrQuietZone
+	for y := 0; y < total; y += 2 {
+		for x := 0; x < total; x++ {
+			top, bottom := light(x, y), y+1 < total && light(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
@@ -903,33 +903,34 @@ func Notify(title, subtitle, message string) {
 	}
 }
 
-// NotifyWithSound sends a notification with optional sound.
-func NotifyWithSound(title, subtitle, message, sound string) {
+// NotifyWithSound sends a notification with optional sound. It returns an
+// error when no notification could be shown.
+func NotifyWithSound(title, subtitle, message, sound string) error {
 	body := message
 	if subtitle != "" {
 		body = fmt.Sprintf("%s — %s", subtitle, message)
 	}
 
 	// Primary: cross-platform popup
-	if err := beeep.Notify(title, body, ""); err == nil {
+	err := beeep.Notify(title, body, "")
+	if err == nil {
 		// Optionally add sound on macOS
 		if runtime.GOOS == "darwin" && sound != "" {
 			script := fmt.Sprintf(`display notification %q with title %q subtitle %q sound name %q`, message, title, subtitle, sound)
 			_ = exec.Command("osascript", "-e", script).Start()
 		}
-		return
+		return nil
 	}
 
 	// Fallback macOS
 	if runtime.GOOS == "darwin" {
+		script := fmt.Sprintf(`display notification %q with title %q subtitle %q`, message, title, subtitle)
 		if sound != "" {
-			script := fmt.Sprintf(`display notification %q with title %q subtitle %q sound name %q`, message, title, subtitle, sound)
-			_ = exec.Command("osascript", "-e", script).Start()
-		} else {
-			script := fmt.Sprintf(`display notification %q with title %q subtitle %q`, message, title, subtitle)
-			_ = exec.Command("osascript", "-e", script).Start()
+			script = fmt.Sprintf(`display notification %q with title %q subtitle %q sound name %q`, message, title, subtitle, sound)
 		}
+		return exec.Command("osascript", "-e", script).Start()
 	}
+	return err
 }
 
 // TTYPrint writes directly to /dev/tty, bypassing stdout/stderr redirection.
@@ -960,7 +961,9 @@ const (
 
 // AuthCodePromptConfig configures the auth code prompt.
 type AuthCodePromptConfig struct {
+	Title     string                          // Heading (default: "Protected path")
 	Reason    string                          // Why authorization is needed
+	Hint      string                          // Where to find the code (optional)
 	Timeout   time.Duration                   // Total time allowed
 	Attempts  int                             // Max attempts
 	Validator func(code string) (bool, error) // Code validation function
@@ -979,8 +982,16 @@ func PromptAuthCode(cfg AuthCodePromptConfig) AuthCodeResult {
 	deadline := startTime.Add(cfg.Timeout)
 
 	// Initial display
-	_, _ = fmt.Fprintf(tty, "\n⚠️  Protected path: %s\n", cfg.Reason)
-	_, _ = fmt.Fprintf(tty, "A 6-digit authorization code is required.\n\n")
+	title := cfg.Title
+	if title == "" {
+		title = "Protected path"
+	}
+	_, _ = fmt.Fprintf(tty, "\n⚠️  %s: %s\n", title, cfg.Reason)
+	_, _ = fmt.Fprintf(tty, "A 6-digit authorization code is required.\n")
+	if cfg.Hint != "" {
+		_, _ = fmt.Fprintf(tty, "%s\n", cfg.Hint)
+	}
+	_, _ = fmt.Fprintf(tty, "\n")
 
 	// Style definitions
 	barWidth := 20
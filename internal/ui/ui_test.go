@@ -3,6 +3,7 @@ package ui
 import (
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestVisibleWidth(t *testing.T) {
@@ -281,3 +282,24 @@ func BenchmarkTableRender(b *testing.B) {
 		tbl.Render()
 	}
 }
+
+func TestQRCode(t *testing.T) {
+	code, err := QRCode("otpauth://totp/coop:me?secret=JBSWY3DPEHPK3PXP&issuer=coop")
+	if err != nil {
+		t.Fatalf("QRCode() error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(code, "\n"), "\n")
+	width := utf8.RuneCountInString(lines[0])
+	// Two modules per line, plus the quiet zone on each side
+	if want := (width + 1) / 2; len(lines) != want {
+		t.Errorf("QRCode() has %d lines for width %d, want %d", len(lines), width, want)
+	}
+	for i, line := range lines {
+		if n := utf8.RuneCountInString(line); n != width {
+			t.Fatalf("line %d has width %d, want %d", i, n, width)
+		}
+	}
+	if strings.Trim(lines[0], "▀█") != "" {
+		t.Errorf("first line %q should be quiet zone", lines[0])
+	}
+}